@@ -0,0 +1,290 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultAccountKeyName is the same cache key autocert uses, so an
+	// account created by autocert can be managed with roman and vice versa.
+	defaultAccountKeyName = "acme_account+key"
+)
+
+// ErrNoKey is returned by a KeyStore that doesn't have an account key yet.
+var ErrNoKey = errors.New("no account key")
+
+type KeyStore interface {
+	// GetKey returns the account key, or ErrNoKey if none has been stored.
+	GetKey(ctx context.Context) (crypto.Signer, error)
+
+	// PutKey stores the account key.
+	PutKey(ctx context.Context, key crypto.Signer) error
+}
+
+// CacheKeyStore stores the account key PEM encoded in an autocert.Cache.
+type CacheKeyStore struct {
+	Cache autocert.Cache
+
+	// Name is the cache key the account key is stored under, defaults to
+	// acme_account+key.
+	Name string
+}
+
+// GetKey returns the account key from the cache.
+func (c CacheKeyStore) GetKey(ctx context.Context) (crypto.Signer, error) {
+	keyBytes, err := c.Cache.Get(ctx, c.name())
+	if err == autocert.ErrCacheMiss {
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode account key")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported account key type: %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported account key type: %v", block.Type)
+	}
+}
+
+// PutKey stores the account key in the cache.
+func (c CacheKeyStore) PutKey(ctx context.Context, key crypto.Signer) error {
+	var block *pem.Block
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	default:
+		return fmt.Errorf("unsupported account key type: %T", key)
+	}
+
+	return c.Cache.Put(ctx, c.name(), pem.EncodeToMemory(block))
+}
+
+func (c CacheKeyStore) name() string {
+	if c.Name == "" {
+		return defaultAccountKeyName
+	}
+	return c.Name
+}
+
+// AccountManager manages the lifecycle of an ACME account whose key is kept in
+// KeyStore. A new key is generated the first time an account is registered.
+type AccountManager struct {
+	Directory string
+	AgreeTOS  func(tosURL string) bool
+	KeyStore  KeyStore
+
+	// EABKeyID and EABHMACKey are the external account binding credentials
+	// used when registering with CAs that require them.
+	EABKeyID   string
+	EABHMACKey string
+
+	// MaxRetries is how often requests that failed with a transient error are
+	// retried, see Client.MaxRetries.
+	MaxRetries int
+
+	// KeyType is the type of the account key generated on registration,
+	// defaults to KeyTypeP256.
+	KeyType KeyType
+
+	// HTTPClient and UserAgent are used for requests to the ACME server, see
+	// Client.HTTPClient.
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+// Register registers an account with contacts (for example
+// mailto:foo@example.com). If the account already exists, it's returned as is.
+func (a AccountManager) Register(contacts []string) (*acme.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	acmeClient, err := a.client(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	eab, err := externalAccountBinding(a.Directory, a.EABKeyID, a.EABHMACKey)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := acmeClient.Register(ctx, &acme.Account{Contact: contacts, ExternalAccountBinding: eab}, a.AgreeTOS)
+	if err == acme.ErrAccountAlreadyExists {
+		return acmeClient.GetReg(ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// Fetch returns the account.
+func (a AccountManager) Fetch() (*acme.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	acmeClient, err := a.client(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return acmeClient.GetReg(ctx, "")
+}
+
+// UpdateContacts replaces the contacts of the account.
+func (a AccountManager) UpdateContacts(contacts []string) (*acme.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	acmeClient, err := a.client(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return acmeClient.UpdateReg(ctx, &acme.Account{Contact: contacts})
+}
+
+// Deactivate permanently deactivates the account. The key stays in KeyStore
+// but can no longer be used.
+func (a AccountManager) Deactivate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	acmeClient, err := a.client(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	return acmeClient.DeactivateReg(ctx)
+}
+
+// RolloverKey replaces the account key with newKey, the account and its
+// authorizations are kept. If newKey is nil, a new key of KeyType is
+// generated. The
+// new key is put in KeyStore once the CA accepted it, if that fails the
+// account is rolled back to the old key.
+func (a AccountManager) RolloverKey(newKey crypto.Signer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	acmeClient, err := a.client(ctx, false)
+	if err != nil {
+		return err
+	}
+	oldKey := acmeClient.Key
+
+	if newKey == nil {
+		newKey, err = generateKey(a.KeyType, KeyTypeP256)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = acmeClient.AccountKeyRollover(ctx, newKey)
+	if err != nil {
+		return err
+	}
+
+	err = a.KeyStore.PutKey(ctx, newKey)
+	if err != nil {
+		// the ca only knows the new key now, go back to the one we have
+		rollbackErr := acmeClient.AccountKeyRollover(ctx, oldKey)
+		if rollbackErr != nil {
+			return fmt.Errorf("unable to store new account key (%v) and unable to roll back to the old key: %v", err, rollbackErr)
+		}
+		return fmt.Errorf("unable to store new account key: %v", err)
+	}
+
+	return nil
+}
+
+// registeredClient returns a client for the account, registering it with
+// email as contact if it doesn't exist yet. The timeout is up to the caller.
+func (a AccountManager) registeredClient(ctx context.Context, email string) (*acme.Client, error) {
+	acmeClient, err := a.client(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	eab, err := externalAccountBinding(a.Directory, a.EABKeyID, a.EABHMACKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// register sets the account url on the client even if the account
+	// already exists
+	account := &acme.Account{Contact: []string{"mailto:" + email}, ExternalAccountBinding: eab}
+	_, err = acmeClient.Register(ctx, account, a.AgreeTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, err
+	}
+
+	return acmeClient, nil
+}
+
+// client returns an acme.Client using the account key from KeyStore. If
+// create is set and there is no key yet, one is generated and stored.
+func (a AccountManager) client(ctx context.Context, create bool) (*acme.Client, error) {
+	if a.KeyStore == nil {
+		return nil, fmt.Errorf("no key store")
+	}
+
+	key, err := a.KeyStore.GetKey(ctx)
+	if err == ErrNoKey && create {
+		key, err = generateKey(a.KeyType, KeyTypeP256)
+		if err != nil {
+			return nil, err
+		}
+		err = a.KeyStore.PutKey(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &acme.Client{
+		Key:          key,
+		DirectoryURL: a.Directory,
+		RetryBackoff: retryBackoff(maxRetries(a.MaxRetries)),
+		HTTPClient:   a.HTTPClient,
+		UserAgent:    a.UserAgent,
+	}, nil
+}
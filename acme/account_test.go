@@ -0,0 +1,369 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestAccountManager(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	a := AccountManager{
+		Directory: server.URL + "/directory",
+		AgreeTOS:  acme.AcceptTOS,
+		KeyStore:  CacheKeyStore{Cache: &memoryCache{m: make(map[string][]byte)}},
+	}
+
+	// nothing to fetch before registering
+	_, err = a.Fetch()
+	if err != ErrNoKey {
+		t.Errorf("Got error: %v, Want: %v", err, ErrNoKey)
+	}
+
+	account, err := a.Register([]string{"mailto:foo@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from Register: %v", err)
+	}
+
+	// registering again returns the same account
+	again, err := a.Register([]string{"mailto:foo@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from Register: %v", err)
+	}
+	if got, want := again.URI, account.URI; got != want {
+		t.Errorf("Got account: %v, Want: %v", got, want)
+	}
+
+	_, err = a.UpdateContacts([]string{"mailto:bar@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from UpdateContacts: %v", err)
+	}
+	account, err = a.Fetch()
+	if err != nil {
+		t.Fatalf("Unexpected response from Fetch: %v", err)
+	}
+	if got, want := account.Contact[0], "mailto:bar@example.com"; got != want {
+		t.Errorf("Got contact: %v, Want: %v", got, want)
+	}
+
+	err = a.Deactivate()
+	if err != nil {
+		t.Fatalf("Unexpected response from Deactivate: %v", err)
+	}
+	account, err = a.Fetch()
+	if err != nil {
+		t.Fatalf("Unexpected response from Fetch: %v", err)
+	}
+	if got, want := account.Status, acme.StatusDeactivated; got != want {
+		t.Errorf("Got status: %v, Want: %v", got, want)
+	}
+}
+
+func TestAccountManagerRolloverKey(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	keyStore := CacheKeyStore{Cache: &memoryCache{m: make(map[string][]byte)}}
+	a := AccountManager{
+		Directory: server.URL + "/directory",
+		AgreeTOS:  acme.AcceptTOS,
+		KeyStore:  keyStore,
+	}
+
+	account, err := a.Register([]string{"mailto:foo@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from Register: %v", err)
+	}
+	oldKey, err := keyStore.GetKey(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from GetKey: %v", err)
+	}
+
+	err = a.RolloverKey(nil)
+	if err != nil {
+		t.Fatalf("Unexpected response from RolloverKey: %v", err)
+	}
+
+	// the new key is stored and still belongs to the same account
+	newKey, err := keyStore.GetKey(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from GetKey: %v", err)
+	}
+	if oldKey.(*ecdsa.PrivateKey).Equal(newKey) {
+		t.Errorf("Account key was not replaced")
+	}
+	rolled, err := a.Fetch()
+	if err != nil {
+		t.Fatalf("Unexpected response from Fetch: %v", err)
+	}
+	if got, want := rolled.URI, account.URI; got != want {
+		t.Errorf("Got account: %v, Want: %v", got, want)
+	}
+
+	// the old key no longer belongs to the account
+	old := AccountManager{
+		Directory: server.URL + "/directory",
+		AgreeTOS:  acme.AcceptTOS,
+		KeyStore:  &staticKeyStore{key: oldKey},
+	}
+	_, err = old.Fetch()
+	if err == nil {
+		t.Errorf("Expected an error fetching the account with the old key")
+	}
+}
+
+func TestAccountManagerRolloverKeyRollback(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	keyStore := &staticKeyStore{}
+	a := AccountManager{
+		Directory: server.URL + "/directory",
+		AgreeTOS:  acme.AcceptTOS,
+		KeyStore:  keyStore,
+	}
+
+	account, err := a.Register([]string{"mailto:foo@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from Register: %v", err)
+	}
+
+	// the new key can't be stored, the account goes back to the old key
+	keyStore.failPut = true
+	err = a.RolloverKey(nil)
+	if err == nil {
+		t.Fatalf("Expected an error when the new key can't be stored")
+	}
+
+	rolled, err := a.Fetch()
+	if err != nil {
+		t.Fatalf("Unexpected response from Fetch: %v", err)
+	}
+	if got, want := rolled.URI, account.URI; got != want {
+		t.Errorf("Got account: %v, Want: %v", got, want)
+	}
+}
+
+// staticKeyStore is used in tests to hold a key in memory.
+type staticKeyStore struct {
+	key     crypto.Signer
+	failPut bool
+}
+
+func (s *staticKeyStore) GetKey(ctx context.Context) (crypto.Signer, error) {
+	if s.key == nil {
+		return nil, ErrNoKey
+	}
+	return s.key, nil
+}
+
+func (s *staticKeyStore) PutKey(ctx context.Context, key crypto.Signer) error {
+	if s.failPut {
+		return fmt.Errorf("unable to put key")
+	}
+	s.key = key
+	return nil
+}
+
+func TestClientKeyStore(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+		KeyStore:           CacheKeyStore{Cache: &memoryCache{m: make(map[string][]byte)}},
+	}
+
+	// both certificates are requested with the same account
+	for _, hostname := range []string{"foo.example.com", "bar.example.com"} {
+		_, err = acmeClient.CertificateForDomain(hostname)
+		if err != nil {
+			t.Fatalf("Unexpected response from CertificateForDomain: %v", err)
+		}
+	}
+	if got, want := len(server.accounts), 1; got != want {
+		t.Errorf("Got %v accounts, Want: %v", got, want)
+	}
+}
+
+func TestClientReuseAuthorizations(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inKeyStore     KeyStore
+		outPerformedOn string
+	}{
+		// 0 - disposable accounts have to prove control every time
+		{nil, "foo.example.com,foo.example.com,foo.example.com,bar.example.com"},
+		// 1 - the account reuses its valid authorizations
+		{CacheKeyStore{Cache: &memoryCache{m: make(map[string][]byte)}}, "foo.example.com,bar.example.com"},
+	}
+
+	for i, tt := range tests {
+		performer := &acceptingPerformer{}
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: performer,
+			KeyStore:           tt.inKeyStore,
+		}
+
+		for _, hostnames := range [][]string{{"foo.example.com"}, {"foo.example.com"}, {"foo.example.com", "bar.example.com"}} {
+			_, err = acmeClient.CertificateForDomains(hostnames)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from CertificateForDomains: %v", i, err)
+			}
+		}
+
+		if got, want := strings.Join(performer.hostnames, ","), tt.outPerformedOn; got != want {
+			t.Errorf("Test(%v) Got performed on: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestClientAccountKeyType(t *testing.T) {
+	tests := []struct {
+		inKeyType  KeyType
+		inKeyStore bool
+		outKey     string
+		outErr     bool
+	}{
+		// 0 - disposable accounts default to rsa
+		{"", false, "RSA", false},
+		// 1 - accounts in a key store default to p-256
+		{"", true, "EC P-256", false},
+		// 2 - p-256 disposable account
+		{KeyTypeP256, false, "EC P-256", false},
+		// 3 - p-384 account in a key store
+		{KeyTypeP384, true, "EC P-384", false},
+		// 4 - unsupported key type
+		{KeyType("ed25519"), false, "", true},
+	}
+
+	for i, tt := range tests {
+		server, err := newFakeACME()
+		if err != nil {
+			t.Fatalf("Unexpected response from newFakeACME: %v", err)
+		}
+
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			AccountKeyType:     tt.inKeyType,
+		}
+		if tt.inKeyStore {
+			acmeClient.KeyStore = &staticKeyStore{}
+		}
+
+		_, err = acmeClient.CertificateForDomain("foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+
+		// the server knows the account by its public key
+		var keys []string
+		server.mu.Lock()
+		for v := range server.accountKeys {
+			var jwk struct {
+				Kty string `json:"kty"`
+				Crv string `json:"crv"`
+			}
+			json.Unmarshal([]byte(v), &jwk)
+			keys = append(keys, strings.TrimSpace(jwk.Kty+" "+jwk.Crv))
+		}
+		server.mu.Unlock()
+		server.Close()
+
+		if got, want := strings.Join(keys, ","), tt.outKey; got != want {
+			t.Errorf("Test(%v) Got account key: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestCacheKeyStore(t *testing.T) {
+	k := CacheKeyStore{Cache: &memoryCache{m: make(map[string][]byte)}}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+
+	err = k.PutKey(context.Background(), rsaKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from PutKey: %v", err)
+	}
+	key, err := k.GetKey(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from GetKey: %v", err)
+	}
+	if !rsaKey.Equal(key) {
+		t.Errorf("Key from store does not match")
+	}
+}
+
+// memoryCache is used in tests as an in-memory autocert.Cache.
+type memoryCache struct {
+	sync.Mutex
+	m map[string][]byte
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	v, ok := c.m[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return v, nil
+}
+
+func (c *memoryCache) Put(ctx context.Context, key string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.m[key] = data
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.m, key)
+	return nil
+}
@@ -2,18 +2,25 @@ package acme
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"golang.org/x/crypto/acme"
 	"golang.org/x/net/context"
 
 	"github.com/mailgun/roman/challenge"
+	"github.com/mailgun/roman/internal/logging"
 )
 
 type Client struct {
@@ -21,41 +28,255 @@ type Client struct {
 	AgreeTOS           func(tosURL string) bool
 	Email              string
 	ChallengePerformer challenge.Performer
+
+	// KeyStore, if set, holds the key of the account used to request
+	// certificates. The account is registered on first use. If nil, a
+	// disposable account is created for every certificate.
+	KeyStore KeyStore
+
+	// HTTPClient, if set, is used for all requests to the ACME server, for
+	// example to go through an egress proxy or to trust a private CA root.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// UserAgent is prepended to the User-Agent header of requests to the
+	// ACME server.
+	UserAgent string
+
+	// AccountKeyType is the type of generated account keys, defaults to
+	// KeyTypeRSA2048 for disposable accounts and KeyTypeP256 for accounts in
+	// KeyStore.
+	AccountKeyType KeyType
+
+	// EABKeyID and EABHMACKey are the external account binding credentials
+	// required by some CAs (for example ZeroSSL and Google Trust Services).
+	// The HMAC key is base64url encoded, as handed out by the CA.
+	EABKeyID   string
+	EABHMACKey string
+
+	// KeyBits is the size of the RSA certificate keys, defaults to 2048.
+	// Use 3072 or 4096 for deployments with stricter compliance requirements.
+	KeyBits int
+
+	// MustStaple requests certificates with the OCSP Must-Staple (TLS
+	// Feature status_request) extension. Clients that honor it reject the
+	// certificate unless the handshake includes an OCSP staple.
+	MustStaple bool
+
+	// CSRTemplate, if set, is the certificate request certificates are
+	// requested with, for CAs that honor subject fields like Organization or
+	// Country. Its DNSNames are added to every certificate as extra subject
+	// alternative names. The common name is always the first hostname.
+	CSRTemplate *x509.CertificateRequest
+
+	// MaxRetries is how often a request that failed with a transient error
+	// (badNonce, rateLimited, or a 5xx response) is retried before giving up,
+	// defaults to 5. A negative value disables retries.
+	MaxRetries int
+
+	// Profile is the certificate profile requested from CAs that support
+	// them, for example ProfileShortLived for 6 day Let's Encrypt
+	// certificates. Empty uses the default profile of the CA.
+	Profile string
+
+	// Duration is the validity requested for certificates, for CAs that honor
+	// the notAfter field of orders (like internal CAs). Zero leaves it to the
+	// CA, Let's Encrypt rejects orders that set it.
+	Duration time.Duration
+
+	// TracerProvider, if set, is used to trace issuance with OpenTelemetry.
+	// Defaults to the provider of the span in the context of
+	// CertificateForDomainsContext, or the global provider.
+	TracerProvider trace.TracerProvider
+
+	// Timeouts are the timeouts of the phases of issuance, see Timeouts for
+	// the defaults.
+	Timeouts Timeouts
+
+	// Logger, if set, receives structured events for every step of issuance
+	// (account, order, authorization, challenge, finalize) with the host,
+	// step, duration and error. Defaults to the logger of the
+	// CertificateManager, or slog.Default().
+	Logger *slog.Logger
 }
 
 // CertificateForDomain returns a *tls.Certificate for a given hostname.
 func (c *Client) CertificateForDomain(hostname string) (*tls.Certificate, error) {
-	// create disposable account and client
-	acmeClient, err := createClient(c.Directory, c.Email, c.AgreeTOS)
+	return c.CertificateForDomains([]string{hostname})
+}
+
+// CertificateForDomains returns a single *tls.Certificate valid for all
+// hostnames, the first hostname is used as the common name.
+func (c *Client) CertificateForDomains(hostnames []string) (*tls.Certificate, error) {
+	return c.CertificateForDomainsContext(context.Background(), hostnames)
+}
+
+// CertificateForDomainsContext is like CertificateForDomains, ctx carries the
+// trace of the caller and cancels issuance.
+func (c *Client) CertificateForDomainsContext(ctx context.Context, hostnames []string) (*tls.Certificate, error) {
+	keyBits := c.KeyBits
+	if keyBits == 0 {
+		keyBits = defaultKeyBits
+	}
+	if keyBits < defaultKeyBits {
+		return nil, fmt.Errorf("rsa key size must be at least %v bits: %v", defaultKeyBits, keyBits)
+	}
+
+	// generate private key for certificate
+	certificatePrivateKey, err := rsa.GenerateKey(rand.Reader, keyBits)
 	if err != nil {
 		return nil, err
 	}
 
-	// request authorization for our public key to obtain certificates for hostname
-	authorization, err := getAuthorization(acmeClient, hostname)
+	return c.CertificateForKeyContext(ctx, hostnames, certificatePrivateKey)
+}
+
+// CertificateForKey returns a single *tls.Certificate valid for all hostnames
+// that uses privateKey instead of a newly generated key. Errors reported by
+// the ACME server are returned as a *Problem.
+func (c *Client) CertificateForKey(hostnames []string, privateKey crypto.Signer) (*tls.Certificate, error) {
+	return c.CertificateForKeyContext(context.Background(), hostnames, privateKey)
+}
+
+// CertificateForKeyContext is like CertificateForKey, ctx carries the trace of
+// the caller and cancels issuance.
+func (c *Client) CertificateForKeyContext(ctx context.Context, hostnames []string, privateKey crypto.Signer) (certificate *tls.Certificate, err error) {
+	ctx, span := c.tracer(ctx).Start(ctx, "acme.Certificate", trace.WithAttributes(attribute.StringSlice("roman.hostnames", hostnames)))
+	defer func() { endSpan(span, err) }()
+
+	if c.Logger != nil {
+		ctx = logging.NewContext(ctx, c.Logger)
+	}
+
+	certificate, err = c.certificateForKey(ctx, hostnames, privateKey)
+	if err != nil {
+		return nil, retryError(problemFromError(err), maxRetries(c.MaxRetries))
+	}
+
+	return certificate, nil
+}
+
+func (c *Client) certificateForKey(ctx context.Context, hostnames []string, privateKey crypto.Signer) (*tls.Certificate, error) {
+	if len(hostnames) == 0 {
+		return nil, fmt.Errorf("no hostnames to request a certificate for")
+	}
+
+	host := strings.Join(hostnames, ",")
+
+	// use our account if we have one, otherwise create a disposable one
+	start := time.Now()
+	accountCtx, span := startSpan(ctx, "acme.Account")
+	accountCtx, cancel := context.WithTimeout(accountCtx, c.Timeouts.account())
+	var acmeClient *acme.Client
+	var err error
+	if c.KeyStore != nil {
+		a := AccountManager{
+			Directory:  c.Directory,
+			AgreeTOS:   c.AgreeTOS,
+			KeyStore:   c.KeyStore,
+			EABKeyID:   c.EABKeyID,
+			EABHMACKey: c.EABHMACKey,
+			MaxRetries: c.MaxRetries,
+			KeyType:    c.AccountKeyType,
+			HTTPClient: c.HTTPClient,
+			UserAgent:  c.UserAgent,
+		}
+		acmeClient, err = a.registeredClient(accountCtx, c.Email)
+	} else {
+		acmeClient, err = c.createClient(accountCtx)
+	}
+	cancel()
+	endSpan(span, err)
+	logging.Step(ctx, "account", host, start, err)
 	if err != nil {
 		return nil, err
 	}
 
-	// perform the challenge requested in the authorization
-	err = c.ChallengePerformer.Perform(acmeClient, authorization, hostname)
+	// create an order for all hostnames (and the extra names of the csr
+	// template), the order contains the authorizations we need to satisfy
+	// before the certificate is issued
+	hostnames = c.certificateNames(hostnames)
+	start = time.Now()
+	order, err := createOrder(ctx, acmeClient, hostnames, c.Profile, c.Duration, c.Timeouts.order())
+	logging.Step(ctx, "order", host, start, err)
 	if err != nil {
 		return nil, err
 	}
 
+	// authorizations the account already holds are valid and need no
+	// challenge, if all of them are the order is ready right away
+	if order.Status != acme.StatusReady {
+		err = c.performAuthorizations(ctx, acmeClient, order)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// we've proven we own the domain, request the actual certificate
-	return requestCertificate(acmeClient, hostname)
+	start = time.Now()
+	certificate, err := requestCertificate(ctx, acmeClient, order, hostnames, privateKey, c.certificateRequest(hostnames), c.Timeouts.finalize())
+	logging.Step(ctx, "finalize", host, start, err)
+
+	return certificate, err
+}
+
+// performAuthorizations performs the challenges requested in each pending
+// authorization of order. If one fails, the authorizations that are left are
+// deactivated.
+func (c *Client) performAuthorizations(ctx context.Context, acmeClient *acme.Client, order *acme.Order) error {
+	for i, authorizationURL := range order.AuthzURLs {
+		err := c.performAuthorization(ctx, acmeClient, authorizationURL)
+		if err != nil {
+			deactivateAuthorizations(acmeClient, order.AuthzURLs[i:])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// performAuthorization performs the challenge of an authorization, unless
+// it's valid already.
+func (c *Client) performAuthorization(ctx context.Context, acmeClient *acme.Client, authorizationURL string) (err error) {
+	ctx, span := startSpan(ctx, "acme.Authorization")
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	authorization, err := getAuthorization(ctx, acmeClient, authorizationURL, c.Timeouts.authorization())
+	if err != nil {
+		logging.Step(ctx, "authorization", authorizationURL, start, err)
+		return err
+	}
+	hostname := authorization.Identifier.Value
+	span.SetAttributes(attribute.String("roman.hostname", hostname))
+	logging.Step(ctx, "authorization", hostname, start, nil)
+	if authorization.Status == acme.StatusValid {
+		return nil
+	}
+
+	// performers that take a context continue the trace and use the
+	// validation timeout
+	start = time.Now()
+	if p, ok := c.ChallengePerformer.(challenge.ContextPerformer); ok {
+		err = p.PerformContext(c.Timeouts.challengeContext(ctx), acmeClient, authorization, hostname)
+	} else {
+		err = c.ChallengePerformer.Perform(acmeClient, authorization, hostname)
+	}
+	logging.Step(ctx, "challenge", hostname, start, err)
+
+	return err
 }
 
 // createClient will create disposable account credentials and return
 // a acme.Client that will be used to get certificates.
-func createClient(directory string, email string, agreeTOS func(tosURL string) bool) (*acme.Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-	defer cancel()
+func (c *Client) createClient(ctx context.Context) (*acme.Client, error) {
+	eab, err := externalAccountBinding(c.Directory, c.EABKeyID, c.EABHMACKey)
+	if err != nil {
+		return nil, err
+	}
 
-	// create disposable key pair.
-	// TODO: consider not using disposable accounts
-	keypair, err := rsa.GenerateKey(rand.Reader, 2048)
+	// create disposable key pair, use KeyStore for a long lived account
+	keypair, err := generateKey(c.AccountKeyType, KeyTypeRSA2048)
 	if err != nil {
 		return nil, err
 	}
@@ -63,15 +284,19 @@ func createClient(directory string, email string, agreeTOS func(tosURL string) b
 	// create a client with a dummy account
 	client := &acme.Client{
 		Key:          keypair,
-		DirectoryURL: directory,
+		DirectoryURL: c.Directory,
+		RetryBackoff: retryBackoff(maxRetries(c.MaxRetries)),
+		HTTPClient:   c.HTTPClient,
+		UserAgent:    c.UserAgent,
 	}
 	contactAccount := acme.Account{
-		Contact: []string{"mailto:" + email},
+		Contact:                []string{"mailto:" + c.Email},
+		ExternalAccountBinding: eab,
 	}
 
 	// register returns a real account, but we throw it away because
 	// we use disposable accounts
-	_, err = client.Register(ctx, &contactAccount, agreeTOS)
+	_, err = client.Register(ctx, &contactAccount, c.AgreeTOS)
 	if err != nil {
 		return nil, err
 	}
@@ -79,56 +304,104 @@ func createClient(directory string, email string, agreeTOS func(tosURL string) b
 	return client, nil
 }
 
-// getAuthorization requests authorization to obtain certificates for a hostname.
-func getAuthorization(acmeClient *acme.Client, hostname string) (*acme.Authorization, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+// createOrder creates a new order for a certificate for hostnames, using
+// profile if it's not empty.
+func createOrder(ctx context.Context, acmeClient *acme.Client, hostnames []string, profile string, duration time.Duration, timeout time.Duration) (order *acme.Order, err error) {
+	ctx, span := startSpan(ctx, "acme.Order")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	authorization, err := acmeClient.Authorize(ctx, hostname)
+	// the ca starts the validity at issuance, which is close enough to now
+	var notAfter time.Time
+	if duration > 0 {
+		notAfter = time.Now().Add(duration)
+	}
+
+	switch {
+	case profile != "":
+		order, err = authorizeProfileOrder(ctx, acmeClient, hostnames, profile, notAfter)
+	case !notAfter.IsZero():
+		order, err = acmeClient.AuthorizeOrder(ctx, acme.DomainIDs(hostnames...), acme.WithOrderNotAfter(notAfter))
+	default:
+		order, err = acmeClient.AuthorizeOrder(ctx, acme.DomainIDs(hostnames...))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case acme.StatusPending, acme.StatusReady:
+		return order, nil
+	default:
+		return nil, fmt.Errorf("invalid order status: %v", order.Status)
+	}
+}
+
+// getAuthorization fetches an authorization of an order.
+func getAuthorization(ctx context.Context, acmeClient *acme.Client, authorizationURL string, timeout time.Duration) (*acme.Authorization, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	authorization, err := acmeClient.GetAuthorization(ctx, authorizationURL)
 	if err != nil {
 		return nil, err
 	}
 
 	switch authorization.Status {
-	case acme.StatusValid:
-	case acme.StatusPending:
+	case acme.StatusValid, acme.StatusPending:
 		return authorization, nil
 	case acme.StatusProcessing:
 		return nil, fmt.Errorf("certificate authorization already in progress")
-	case acme.StatusInvalid:
-	case acme.StatusRevoked:
-	case acme.StatusUnknown:
 	default:
 		return nil, fmt.Errorf("invalid certificate authorization status: %v", authorization.Status)
 	}
-
-	return authorization, nil
 }
 
-func requestCertificate(acmeClient *acme.Client, hostname string) (*tls.Certificate, error) {
+// deactivateAuthorizations deactivates the authorizations that are still
+// pending so abandoned orders don't count against the limits of the acme
+// server. This is best effort, errors are ignored. It doesn't take a context
+// so it also cleans up after issuance was cancelled.
+func deactivateAuthorizations(acmeClient *acme.Client, authorizationURLs []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
 
-	// generate private key for certificate
-	certificatePrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, err
+	for _, authorizationURL := range authorizationURLs {
+		authorization, err := acmeClient.GetAuthorization(ctx, authorizationURL)
+		if err != nil || authorization.Status != acme.StatusPending {
+			continue
+		}
+		acmeClient.RevokeAuthorization(ctx, authorizationURL)
 	}
+}
+
+// requestCertificate waits for order to become ready and finalizes it.
+func requestCertificate(ctx context.Context, acmeClient *acme.Client, order *acme.Order, hostnames []string, certificatePrivateKey crypto.Signer, cr *x509.CertificateRequest, timeout time.Duration) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// create certificate request
-	cr := &x509.CertificateRequest{
-		Subject: pkix.Name{
-			CommonName: hostname,
-		},
+	// wait for the acme server to process all authorizations
+	_, span := startSpan(ctx, "acme.WaitOrder")
+	order, err := acmeClient.WaitOrder(ctx, order.URI)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
 	}
 
+	// sign the certificate request, all hostnames are in the subject
+	// alternative names to match the order
+	_, span = startSpan(ctx, "acme.CSR")
 	csr, err := x509.CreateCertificateRequest(rand.Reader, cr, certificatePrivateKey)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	// ask the acme server for a certificates
-	certificateChain, _, err := acmeClient.CreateCert(ctx, csr, 90*24*time.Hour, true)
+	// finalize the order and download the certificate
+	_, span = startSpan(ctx, "acme.Finalize")
+	certificateChain, _, err := acmeClient.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -146,9 +419,12 @@ func requestCertificate(acmeClient *acme.Client, hostname string) (*tls.Certific
 	}
 
 	// validate the chain to make sure the certificate will actually work
-	err = validateCertificateChain(hostname, certificateChain)
-	if err != nil {
-		return nil, err
+	// for every hostname
+	for _, hostname := range hostnames {
+		err = validateCertificateChain(hostname, certificateChain)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &tls.Certificate{
@@ -183,13 +459,18 @@ func validateCertificateChain(domainName string, certificateChain [][]byte) erro
 
 	intermediates := x509.NewCertPool()
 	if len(certificateChain) > 2 {
-		for _, v := range x509Chain[1 : len(x509Chain)-2] {
+		for _, v := range x509Chain[1 : len(x509Chain)-1] {
 			intermediates.AddCert(v)
 		}
 	}
 
 	leaf := x509Chain[0]
 
+	// wildcard certificates are verified against a name they cover
+	if strings.HasPrefix(domainName, "*.") {
+		domainName = "wildcard" + strings.TrimPrefix(domainName, "*")
+	}
+
 	// verify the entire chain
 	opts := x509.VerifyOptions{
 		Roots:         roots,
@@ -3,11 +3,16 @@ package acme
 import (
 	"bufio"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"golang.org/x/crypto/acme"
@@ -51,6 +56,323 @@ func TestCertificateForDomain(t *testing.T) {
 	}
 }
 
+func TestClientOrder(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inHostname     string
+		inFail         bool
+		outPerformedOn string
+		outErr         bool
+	}{
+		// 0 - regular hostname
+		{"foo.example.com", false, "foo.example.com", false},
+		// 1 - wildcards are validated against the base domain
+		{"*.example.com", false, "example.com", false},
+		// 2 - failed challenge
+		{"bar.example.com", true, "bar.example.com", true},
+		// 3 - multiple hostnames in one order
+		{"foo.example.com,bar.example.com", false, "foo.example.com,bar.example.com", false},
+	}
+
+	for i, tt := range tests {
+		server.mu.Lock()
+		server.failChallenges = tt.inFail
+		server.mu.Unlock()
+
+		performer := &acceptingPerformer{}
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: performer,
+		}
+
+		certificate, err := acmeClient.CertificateForDomains(strings.Split(tt.inHostname, ","))
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := strings.Join(performer.hostnames, ","), tt.outPerformedOn; got != want {
+			t.Errorf("Test(%v) Got performed on: %v, Want: %v", i, got, want)
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := strings.Join(certificate.Leaf.DNSNames, ","), tt.inHostname; got != want {
+			t.Errorf("Test(%v) Got DNSName: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestClientKeyBits(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inKeyBits  int
+		outKeyBits int
+		outErr     bool
+	}{
+		// 0 - default
+		{0, 2048, false},
+		// 1 - larger key
+		{3072, 3072, false},
+		// 2 - too small
+		{1024, 0, true},
+	}
+
+	for i, tt := range tests {
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			KeyBits:            tt.inKeyBits,
+		}
+
+		certificate, err := acmeClient.CertificateForDomain("foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := certificate.PrivateKey.(*rsa.PrivateKey).N.BitLen(), tt.outKeyBits; got != want {
+			t.Errorf("Test(%v) Got key size: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestClientCertificateForKey(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+	}
+
+	for i := 0; i < 2; i++ {
+		certificate, err := acmeClient.CertificateForKey([]string{"foo.example.com"}, privateKey)
+		if err != nil {
+			t.Fatalf("Unexpected response from CertificateForKey: %v", err)
+		}
+		if !privateKey.PublicKey.Equal(certificate.Leaf.PublicKey) {
+			t.Errorf("Test(%v) Certificate was not issued for the private key", i)
+		}
+		if certificate.PrivateKey != privateKey {
+			t.Errorf("Test(%v) Got a different private key", i)
+		}
+	}
+}
+
+func TestClientMustStaple(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inMustStaple  bool
+		outMustStaple bool
+	}{
+		// 0 - no extension by default
+		{false, false},
+		// 1 - must staple
+		{true, true},
+	}
+
+	for i, tt := range tests {
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			MustStaple:         tt.inMustStaple,
+		}
+
+		certificate, err := acmeClient.CertificateForDomain("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CertificateForDomain: %v", i, err)
+		}
+		if got, want := HasMustStaple(certificate.Leaf), tt.outMustStaple; got != want {
+			t.Errorf("Test(%v) Got must staple: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestClientDeactivateAuthorizations(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: failingPerformer{},
+	}
+
+	_, err = acmeClient.CertificateForDomains([]string{"foo.example.com", "bar.example.com"})
+	if err == nil {
+		t.Fatalf("Expected an error when the challenge can't be performed")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if got, want := len(server.authorizations), 2; got != want {
+		t.Fatalf("Got %v authorizations, Want: %v", got, want)
+	}
+	for id, authorization := range server.authorizations {
+		if got, want := authorization.Status, acme.StatusDeactivated; got != want {
+			t.Errorf("Authorization(%v) Got status: %v, Want: %v", id, got, want)
+		}
+	}
+}
+
+// failingPerformer fails before a challenge is accepted, leaving the
+// authorization pending.
+type failingPerformer struct{}
+
+func (failingPerformer) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return fmt.Errorf("unable to update dns")
+}
+
+func TestClientCSRTemplate(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	performer := &acceptingPerformer{}
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: performer,
+		CSRTemplate: &x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName:         "ignored.example.com",
+				Organization:       []string{"Example Inc."},
+				OrganizationalUnit: []string{"Edge"},
+				Country:            []string{"US"},
+			},
+			DNSNames: []string{"www.example.com", "foo.example.com"},
+		},
+	}
+
+	certificate, err := acmeClient.CertificateForDomain("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from CertificateForDomain: %v", err)
+	}
+
+	subject := certificate.Leaf.Subject
+	if got, want := subject.CommonName, "foo.example.com"; got != want {
+		t.Errorf("Got CommonName: %v, Want: %v", got, want)
+	}
+	if got, want := fmt.Sprint(subject.Organization, subject.OrganizationalUnit, subject.Country), "[Example Inc.] [Edge] [US]"; got != want {
+		t.Errorf("Got subject: %v, Want: %v", got, want)
+	}
+
+	// extra names are part of the order and the certificate
+	if got, want := strings.Join(certificate.Leaf.DNSNames, ","), "foo.example.com,www.example.com"; got != want {
+		t.Errorf("Got DNSNames: %v, Want: %v", got, want)
+	}
+	if got, want := strings.Join(performer.hostnames, ","), "foo.example.com,www.example.com"; got != want {
+		t.Errorf("Got performed on: %v, Want: %v", got, want)
+	}
+
+	// the template is left alone
+	if got, want := len(acmeClient.CSRTemplate.DNSNames), 2; got != want {
+		t.Errorf("Got %v template DNSNames, Want: %v", got, want)
+	}
+}
+
+func TestClientHTTPClient(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inKeyStore KeyStore
+		inProfile  string
+	}{
+		// 0 - disposable account
+		{nil, ""},
+		// 1 - account in a key store
+		{&staticKeyStore{}, ""},
+		// 2 - orders with a profile
+		{nil, ProfileShortLived},
+	}
+
+	for i, tt := range tests {
+		transport := &recordingTransport{}
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			KeyStore:           tt.inKeyStore,
+			Profile:            tt.inProfile,
+			HTTPClient:         &http.Client{Transport: transport},
+			UserAgent:          "roman-test/1.0",
+		}
+
+		_, err := acmeClient.CertificateForDomain("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CertificateForDomain: %v", i, err)
+		}
+
+		// every request goes through the client
+		if len(transport.userAgents) == 0 {
+			t.Fatalf("Test(%v) No requests through the http client", i)
+		}
+		for _, v := range transport.userAgents {
+			if !strings.HasPrefix(v, "roman-test/1.0 ") {
+				t.Errorf("Test(%v) Got User-Agent: %v, Want prefix: roman-test/1.0", i, v)
+			}
+		}
+	}
+}
+
+// recordingTransport is used in tests to record the user agent of requests.
+type recordingTransport struct {
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.userAgents = append(r.userAgents, req.Header.Get("User-Agent"))
+	r.mu.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 func readConfiguration() (*challenge.Route53, error) {
 	file, err := os.Open("../.roman.configuration")
 	if err != nil {
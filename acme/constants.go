@@ -1,6 +1,25 @@
 package acme
 
 const (
-	LetsEncryptStaging    = "https://acme-staging.api.letsencrypt.org/directory"
-	LetsEncryptProduction = "https://acme-v01.api.letsencrypt.org/directory"
+	defaultKeyBits = 2048
+)
+
+const (
+	LetsEncryptStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	LetsEncryptProduction = "https://acme-v02.api.letsencrypt.org/directory"
+
+	// ZeroSSL requires external account binding (EAB) credentials from the
+	// ZeroSSL dashboard or API.
+	ZeroSSLProduction = "https://acme.zerossl.com/v2/DV90"
+
+	// BuyPass Go issues certificates valid for 180 days and requires an email
+	// contact, it does not use external account binding.
+	BuyPassStaging    = "https://api.test4.buypass.no/acme/directory"
+	BuyPassProduction = "https://api.buypass.com/acme/directory"
+
+	// Google Trust Services requires external account binding credentials
+	// from the Google Cloud public CA API. They can only be used to register
+	// a single account, so use them with a KeyStore.
+	GoogleTrustServicesStaging    = "https://dv.acme-v02.test-api.pki.goog/directory"
+	GoogleTrustServicesProduction = "https://dv.acme-v02.api.pki.goog/directory"
 )
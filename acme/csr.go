@@ -0,0 +1,45 @@
+package acme
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+)
+
+// certificateNames returns hostnames followed by the extra subject
+// alternative names of CSRTemplate that aren't in hostnames yet.
+func (c *Client) certificateNames(hostnames []string) []string {
+	if c.CSRTemplate == nil || len(c.CSRTemplate.DNSNames) == 0 {
+		return hostnames
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(hostnames)+len(c.CSRTemplate.DNSNames))
+	for _, v := range append(append([]string{}, hostnames...), c.CSRTemplate.DNSNames...) {
+		if !seen[v] {
+			seen[v] = true
+			names = append(names, v)
+		}
+	}
+
+	return names
+}
+
+// certificateRequest returns the certificate request for names, based on
+// CSRTemplate if set. The common name is always the first name and names are
+// the subject alternative names, so the request matches the order.
+func (c *Client) certificateRequest(names []string) *x509.CertificateRequest {
+	cr := &x509.CertificateRequest{}
+	if c.CSRTemplate != nil {
+		*cr = *c.CSRTemplate
+		cr.ExtraExtensions = append([]pkix.Extension(nil), c.CSRTemplate.ExtraExtensions...)
+	}
+
+	cr.Subject.CommonName = names[0]
+	cr.DNSNames = names
+
+	if c.MustStaple {
+		cr.ExtraExtensions = append(cr.ExtraExtensions, mustStapleExtension)
+	}
+
+	return cr
+}
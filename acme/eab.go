@@ -0,0 +1,40 @@
+package acme
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// externalAccountBindingRequired are the directories of CAs that refuse to
+// register accounts without external account binding.
+var externalAccountBindingRequired = map[string]bool{
+	ZeroSSLProduction:             true,
+	GoogleTrustServicesStaging:    true,
+	GoogleTrustServicesProduction: true,
+}
+
+// externalAccountBinding returns the external account binding for keyID and
+// hmacKey (base64url encoded, as handed out by CAs), or nil if keyID is empty.
+func externalAccountBinding(directory string, keyID string, hmacKey string) (*acme.ExternalAccountBinding, error) {
+	if keyID == "" {
+		// fail early with a useful error instead of the one from the CA
+		if externalAccountBindingRequired[directory] {
+			return nil, fmt.Errorf("%v requires external account binding, set EABKeyID and EABHMACKey", directory)
+		}
+		return nil, nil
+	}
+
+	// some CAs hand out keys with padding, others without
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(hmacKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode EAB HMAC key: %v", err)
+	}
+
+	return &acme.ExternalAccountBinding{
+		KID: keyID,
+		Key: key,
+	}, nil
+}
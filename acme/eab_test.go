@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestExternalAccountBinding(t *testing.T) {
+	tests := []struct {
+		inDirectory string
+		inKeyID     string
+		inHMACKey   string
+		outKey      string
+		outErr      bool
+	}{
+		// 0 - not needed
+		{LetsEncryptProduction, "", "", "", false},
+		// 1 - required but missing
+		{ZeroSSLProduction, "", "", "", true},
+		// 2 - without padding
+		{ZeroSSLProduction, "kid", "aG1hYy1rZXk", "hmac-key", false},
+		// 3 - with padding
+		{GoogleTrustServicesProduction, "kid", "aG1hYy1rZXk=", "hmac-key", false},
+		// 4 - not base64url
+		{GoogleTrustServicesProduction, "kid", "not base64!", "", true},
+	}
+
+	for i, tt := range tests {
+		eab, err := externalAccountBinding(tt.inDirectory, tt.inKeyID, tt.inHMACKey)
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if err != nil || tt.inKeyID == "" {
+			continue
+		}
+		if got, want := string(eab.Key), tt.outKey; got != want {
+			t.Errorf("Test(%v) Got key: %v, Want: %v", i, got, want)
+		}
+		if got, want := eab.KID, tt.inKeyID; got != want {
+			t.Errorf("Test(%v) Got kid: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestClientExternalAccountBinding(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+	server.requireEAB = true
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+	}
+
+	// 0 - rejected without credentials
+	_, err = acmeClient.CertificateForDomain("foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error without EAB credentials")
+	}
+
+	// 1 - accepted with credentials
+	acmeClient.EABKeyID = "kid"
+	acmeClient.EABHMACKey = "aG1hYy1rZXk"
+	_, err = acmeClient.CertificateForDomain("foo.example.com")
+	if err != nil {
+		t.Errorf("Unexpected response from CertificateForDomain: %v", err)
+	}
+}
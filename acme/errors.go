@@ -0,0 +1,157 @@
+package acme
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Problem types (RFC 8555 section 6.7) callers commonly branch on.
+const (
+	ProblemBadNonce                = "badNonce"
+	ProblemCAA                     = "caa"
+	ProblemConnection              = "connection"
+	ProblemDNS                     = "dns"
+	ProblemExternalAccountRequired = "externalAccountRequired"
+	ProblemIncorrectResponse       = "incorrectResponse"
+	ProblemMalformed               = "malformed"
+	ProblemRateLimited             = "rateLimited"
+	ProblemRejectedIdentifier      = "rejectedIdentifier"
+	ProblemServerInternal          = "serverInternal"
+	ProblemTLS                     = "tls"
+	ProblemUnauthorized            = "unauthorized"
+)
+
+const (
+	problemPrefix = "urn:ietf:params:acme:error:"
+)
+
+// Problem is an error reported by the ACME server, either in response to a
+// request or as the reason an authorization failed.
+type Problem struct {
+	// Type is the problem type without the urn:ietf:params:acme:error:
+	// prefix, for example ProblemRateLimited.
+	Type string
+
+	// Detail is the human readable explanation of the problem.
+	Detail string
+
+	// StatusCode is the HTTP status of the response, zero for problems of
+	// challenges and subproblems.
+	StatusCode int
+
+	// Identifier is the hostname the problem is about, if known.
+	Identifier string
+
+	// RetryAfter is how long the server asked us to wait before trying again.
+	RetryAfter time.Duration
+
+	// Subproblems are the problems of individual identifiers.
+	Subproblems []*Problem
+
+	// Err is the original error.
+	Err error
+}
+
+func (p *Problem) Error() string {
+	s := "acme: " + p.Type
+	if p.Identifier != "" {
+		s = s + " for " + p.Identifier
+	}
+	if p.Detail != "" {
+		s = s + ": " + p.Detail
+	}
+	for _, v := range p.Subproblems {
+		s = s + "; " + strings.TrimPrefix(v.Error(), "acme: ")
+	}
+	return s
+}
+
+func (p *Problem) Unwrap() error {
+	return p.Err
+}
+
+// IsProblem returns true if err is, or wraps, a Problem of problemType or one
+// with a subproblem of problemType.
+func IsProblem(err error, problemType string) bool {
+	var p *Problem
+	if !errors.As(err, &p) {
+		return false
+	}
+
+	if p.Type == problemType {
+		return true
+	}
+	for _, v := range p.Subproblems {
+		if v.Type == problemType {
+			return true
+		}
+	}
+	return false
+}
+
+// problemFromError turns errors of golang.org/x/crypto/acme anywhere in the
+// chain of err into a Problem, other errors are returned as is.
+func problemFromError(err error) error {
+	// failed authorizations carry the problems of their challenges
+	var authorizationErr *acme.AuthorizationError
+	if errors.As(err, &authorizationErr) {
+		p := &Problem{
+			Type:       ProblemUnauthorized,
+			Detail:     "authorization failed",
+			Identifier: authorizationErr.Identifier,
+			Err:        err,
+		}
+		for i, v := range authorizationErr.Errors {
+			challengeProblem := newProblem(v)
+			if challengeProblem == nil {
+				continue
+			}
+			if i == 0 {
+				p.Type, p.Detail, p.Subproblems = challengeProblem.Type, challengeProblem.Detail, challengeProblem.Subproblems
+				continue
+			}
+			p.Subproblems = append(p.Subproblems, challengeProblem)
+		}
+		return p
+	}
+
+	var acmeErr *acme.Error
+	if errors.As(err, &acmeErr) {
+		p := newProblem(acmeErr)
+		p.StatusCode = acmeErr.StatusCode
+		p.RetryAfter, _ = acme.RateLimit(acmeErr)
+		p.Err = err
+		return p
+	}
+
+	return err
+}
+
+// newProblem converts an *acme.Error, nil for any other error.
+func newProblem(err error) *Problem {
+	acmeErr, ok := err.(*acme.Error)
+	if !ok {
+		return nil
+	}
+
+	p := &Problem{
+		Type:   strings.TrimPrefix(acmeErr.ProblemType, problemPrefix),
+		Detail: acmeErr.Detail,
+		Err:    acmeErr,
+	}
+	for _, v := range acmeErr.Subproblems {
+		subproblem := &Problem{
+			Type:   strings.TrimPrefix(v.Type, problemPrefix),
+			Detail: v.Detail,
+		}
+		if v.Identifier != nil {
+			subproblem.Identifier = v.Identifier.Value
+		}
+		p.Subproblems = append(p.Subproblems, subproblem)
+	}
+
+	return p
+}
@@ -0,0 +1,117 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestProblemFromError(t *testing.T) {
+	rateLimited := &acme.Error{
+		StatusCode:  http.StatusTooManyRequests,
+		ProblemType: "urn:ietf:params:acme:error:rateLimited",
+		Detail:      "too many certificates already issued",
+		Header:      http.Header{"Retry-After": []string{"3600"}},
+	}
+	rejected := &acme.Error{
+		StatusCode:  http.StatusBadRequest,
+		ProblemType: "urn:ietf:params:acme:error:rejectedIdentifier",
+		Detail:      "some identifiers were rejected",
+		Subproblems: []acme.Subproblem{
+			{
+				Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+				Detail:     "forbidden domain",
+				Identifier: &acme.AuthzID{Type: "dns", Value: "foo.example.com"},
+			},
+		},
+	}
+	authorization := &acme.AuthorizationError{
+		Identifier: "foo.example.com",
+		Errors: []error{
+			&acme.Error{ProblemType: "urn:ietf:params:acme:error:connection", Detail: "connection refused"},
+		},
+	}
+
+	tests := []struct {
+		inErr         error
+		outType       string
+		outIdentifier string
+		outRetryAfter time.Duration
+		outError      string
+	}{
+		// 0 - rate limits come with retry after
+		{rateLimited, ProblemRateLimited, "", 1 * time.Hour, "acme: rateLimited: too many certificates already issued"},
+		// 1 - subproblems name the identifier
+		{rejected, ProblemRejectedIdentifier, "", 0, "acme: rejectedIdentifier: some identifiers were rejected; rejectedIdentifier for foo.example.com: forbidden domain"},
+		// 2 - failed authorizations use the problem of the challenge
+		{authorization, ProblemConnection, "foo.example.com", 0, "acme: connection for foo.example.com: connection refused"},
+		// 3 - wrapped errors
+		{fmt.Errorf("unexpected response from acmeClient.Accept: %w", rateLimited), ProblemRateLimited, "", 1 * time.Hour, "acme: rateLimited: too many certificates already issued"},
+	}
+
+	for i, tt := range tests {
+		err := problemFromError(tt.inErr)
+
+		var p *Problem
+		if !errors.As(err, &p) {
+			t.Fatalf("Test(%v) Got: %T, Want: *Problem", i, err)
+		}
+		if got, want := p.Type, tt.outType; got != want {
+			t.Errorf("Test(%v) Got type: %v, Want: %v", i, got, want)
+		}
+		if got, want := p.Identifier, tt.outIdentifier; got != want {
+			t.Errorf("Test(%v) Got identifier: %v, Want: %v", i, got, want)
+		}
+		if got, want := p.RetryAfter.Round(time.Minute), tt.outRetryAfter; got != want {
+			t.Errorf("Test(%v) Got retry after: %v, Want: %v", i, got, want)
+		}
+		if got, want := p.Error(), tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, got, want)
+		}
+		if !IsProblem(err, tt.outType) {
+			t.Errorf("Test(%v) IsProblem(%v) is false", i, tt.outType)
+		}
+
+		// the original error is still in the chain
+		if !errors.Is(err, tt.inErr) {
+			t.Errorf("Test(%v) Original error is not wrapped", i)
+		}
+	}
+
+	// other errors are left alone
+	err := fmt.Errorf("no hostnames to request a certificate for")
+	if got, want := problemFromError(err), err; got != want {
+		t.Errorf("Got: %v, Want: %v", got, want)
+	}
+}
+
+func TestClientProblem(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+	server.failChallenges = true
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+	}
+
+	_, err = acmeClient.CertificateForDomain("foo.example.com")
+	if !IsProblem(err, ProblemDNS) {
+		t.Fatalf("Got error: %v, Want: %v problem", err, ProblemDNS)
+	}
+
+	var p *Problem
+	errors.As(err, &p)
+	if got, want := p.Identifier, "foo.example.com"; got != want {
+		t.Errorf("Got identifier: %v, Want: %v", got, want)
+	}
+}
@@ -0,0 +1,557 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+// fakeACME is a minimal RFC 8555 server used in tests. It doesn't verify
+// signatures, every challenge that is accepted succeeds unless failChallenges
+// is set, and certificates are issued by a throwaway CA.
+type fakeACME struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	caKey          *ecdsa.PrivateKey
+	caCertificate  *x509.Certificate
+	nonce          int
+	accounts       map[string]*fakeAccount // account id to account
+	accountKeys    map[string]string       // jwk to account id
+	failChallenges bool
+	requireEAB     bool
+	orderErrors    []string // problem types returned by the next new-order requests
+	orderRequests  int
+	orders         map[string]*fakeOrder
+	authorizations map[string]*fakeAuthorization
+	certificates   map[string][]byte
+	revoked        map[string]int // base64url encoded certificate to revocation reason
+}
+
+type fakeAccount struct {
+	Status  string   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+}
+
+type fakeOrder struct {
+	Status         string         `json:"status"`
+	Identifiers    []acme.AuthzID `json:"identifiers"`
+	Authorizations []string       `json:"authorizations"`
+	Finalize       string         `json:"finalize"`
+	Certificate    string         `json:"certificate,omitempty"`
+	Profile        string         `json:"profile,omitempty"`
+	NotAfter       string         `json:"notAfter,omitempty"`
+}
+
+type fakeAuthorization struct {
+	Identifier acme.AuthzID     `json:"identifier"`
+	Status     string           `json:"status"`
+	Wildcard   bool             `json:"wildcard,omitempty"`
+	Challenges []*fakeChallenge `json:"challenges"`
+
+	account string // url of the account the authorization belongs to
+}
+
+type fakeChallenge struct {
+	Type   string            `json:"type"`
+	URL    string            `json:"url"`
+	Token  string            `json:"token"`
+	Status string            `json:"status"`
+	Error  map[string]string `json:"error,omitempty"`
+}
+
+func newFakeACME() (*fakeACME, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCertificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fakeACME{
+		caKey:          caKey,
+		caCertificate:  caCertificate,
+		accounts:       make(map[string]*fakeAccount),
+		accountKeys:    make(map[string]string),
+		orders:         make(map[string]*fakeOrder),
+		authorizations: make(map[string]*fakeAuthorization),
+		certificates:   make(map[string][]byte),
+		revoked:        make(map[string]int),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+
+	return f, nil
+}
+
+func (f *fakeACME) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nonce = f.nonce + 1
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%v", f.nonce))
+
+	if r.URL.Path == "/directory" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"newNonce":   f.URL + "/new-nonce",
+			"newAccount": f.URL + "/new-account",
+			"newOrder":   f.URL + "/new-order",
+			"revokeCert": f.URL + "/revoke-cert",
+			"keyChange":  f.URL + "/key-change",
+			"meta": map[string]interface{}{
+				"externalAccountRequired": f.requireEAB,
+			},
+		})
+		return
+	}
+	if r.URL.Path == "/new-nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// everything else is a jws, we only care about the payload and the key
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&jws)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	protectedBytes, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var protected struct {
+		JWK json.RawMessage `json:"jwk"`
+		KID string          `json:"kid"`
+	}
+	json.Unmarshal(protectedBytes, &protected)
+
+	path := r.URL.Path
+	if path == "/new-order" {
+		f.orderRequests = f.orderRequests + 1
+		if len(f.orderErrors) > 0 {
+			problemType := f.orderErrors[0]
+			f.orderErrors = f.orderErrors[1:]
+
+			status := http.StatusBadRequest
+			switch problemType {
+			case "serverInternal":
+				status = http.StatusInternalServerError
+			case "rateLimited":
+				status = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", "0")
+			}
+			writeJSON(w, status, map[string]string{"type": "urn:ietf:params:acme:error:" + problemType})
+			return
+		}
+	}
+
+	switch {
+	case path == "/new-account":
+		var req struct {
+			Contact                []string        `json:"contact"`
+			OnlyReturnExisting     bool            `json:"onlyReturnExisting"`
+			ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
+		}
+		json.Unmarshal(payload, &req)
+
+		// existing accounts are looked up by key
+		if id, ok := f.accountKeys[string(protected.JWK)]; ok {
+			w.Header().Set("Location", f.URL+"/account/"+id)
+			writeJSON(w, http.StatusOK, f.accounts[id])
+			return
+		}
+		if req.OnlyReturnExisting {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:accountDoesNotExist"})
+			return
+		}
+		if f.requireEAB && req.ExternalAccountBinding == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:externalAccountRequired"})
+			return
+		}
+
+		id := fmt.Sprint(len(f.accounts) + 1)
+		f.accounts[id] = &fakeAccount{Status: acme.StatusValid, Contact: req.Contact}
+		f.accountKeys[string(protected.JWK)] = id
+
+		w.Header().Set("Location", f.URL+"/account/"+id)
+		writeJSON(w, http.StatusCreated, f.accounts[id])
+	case path == "/key-change":
+		// the payload is a jws signed by the new key that names the old key
+		var inner struct {
+			Protected string `json:"protected"`
+			Payload   string `json:"payload"`
+		}
+		json.Unmarshal([]byte(payload), &inner)
+		innerProtectedBytes, _ := base64.RawURLEncoding.DecodeString(inner.Protected)
+		innerPayload, _ := base64.RawURLEncoding.DecodeString(inner.Payload)
+
+		var innerProtected struct {
+			JWK json.RawMessage `json:"jwk"`
+		}
+		json.Unmarshal(innerProtectedBytes, &innerProtected)
+		var req struct {
+			Account string          `json:"account"`
+			OldKey  json.RawMessage `json:"oldKey"`
+		}
+		json.Unmarshal(innerPayload, &req)
+
+		id, ok := f.accountKeys[string(req.OldKey)]
+		if !ok || req.Account != f.URL+"/account/"+id {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:malformed"})
+			return
+		}
+		if _, ok := f.accountKeys[string(innerProtected.JWK)]; ok {
+			writeJSON(w, http.StatusConflict, map[string]string{"type": "urn:ietf:params:acme:error:malformed"})
+			return
+		}
+
+		delete(f.accountKeys, string(req.OldKey))
+		f.accountKeys[string(innerProtected.JWK)] = id
+
+		writeJSON(w, http.StatusOK, f.accounts[id])
+	case strings.HasPrefix(path, "/account/"):
+		id := strings.TrimPrefix(path, "/account/")
+		account, ok := f.accounts[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		json.Unmarshal(payload, &req)
+		if req.Contact != nil {
+			account.Contact = req.Contact
+		}
+		if req.Status == acme.StatusDeactivated {
+			account.Status = acme.StatusDeactivated
+		}
+
+		w.Header().Set("Location", f.URL+"/account/"+id)
+		writeJSON(w, http.StatusOK, account)
+	case path == "/new-order":
+		var req struct {
+			Identifiers []acme.AuthzID `json:"identifiers"`
+			Profile     string         `json:"profile"`
+			NotAfter    string         `json:"notAfter"`
+		}
+		json.Unmarshal(payload, &req)
+
+		id := fmt.Sprint(len(f.orders) + 1)
+		order := &fakeOrder{
+			Status:      acme.StatusPending,
+			Identifiers: req.Identifiers,
+			Finalize:    f.URL + "/finalize/" + id,
+			Profile:     req.Profile,
+			NotAfter:    req.NotAfter,
+		}
+		for i, v := range req.Identifiers {
+			// like real CAs, reuse valid authorizations of the account
+			if reusedID, ok := f.validAuthorization(protected.KID, v.Value); ok {
+				order.Authorizations = append(order.Authorizations, f.URL+"/authorization/"+reusedID)
+				continue
+			}
+
+			authorizationID := fmt.Sprintf("%v-%v", id, i)
+			authorization := &fakeAuthorization{
+				Identifier: acme.AuthzID{Type: v.Type, Value: strings.TrimPrefix(v.Value, "*.")},
+				Status:     acme.StatusPending,
+				Wildcard:   strings.HasPrefix(v.Value, "*."),
+				account:    protected.KID,
+			}
+			for _, challengeType := range []string{"dns-01", "http-01"} {
+				authorization.Challenges = append(authorization.Challenges, &fakeChallenge{
+					Type:   challengeType,
+					URL:    f.URL + "/challenge/" + authorizationID + "/" + challengeType,
+					Token:  "token-" + authorizationID,
+					Status: acme.StatusPending,
+				})
+			}
+			f.authorizations[authorizationID] = authorization
+			order.Authorizations = append(order.Authorizations, f.URL+"/authorization/"+authorizationID)
+		}
+		f.orders[id] = order
+		f.updateOrder(order)
+
+		w.Header().Set("Location", f.URL+"/order/"+id)
+		writeJSON(w, http.StatusCreated, order)
+	case strings.HasPrefix(path, "/authorization/"):
+		authorization, ok := f.authorizations[strings.TrimPrefix(path, "/authorization/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// deactivation
+		var req struct {
+			Status string `json:"status"`
+		}
+		json.Unmarshal(payload, &req)
+		if req.Status == acme.StatusDeactivated {
+			authorization.Status = acme.StatusDeactivated
+		}
+
+		writeJSON(w, http.StatusOK, authorization)
+	case strings.HasPrefix(path, "/challenge/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/challenge/"), "/")
+		authorization, ok := f.authorizations[parts[0]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// accepting a challenge validates it right away
+		status := acme.StatusValid
+		if f.failChallenges {
+			status = acme.StatusInvalid
+		}
+		authorization.Status = status
+		for _, v := range authorization.Challenges {
+			if v.Type == parts[1] {
+				v.Status = status
+				if f.failChallenges {
+					v.Error = map[string]string{
+						"type":   "urn:ietf:params:acme:error:dns",
+						"detail": "DNS problem: NXDOMAIN looking up TXT for _acme-challenge." + authorization.Identifier.Value,
+					}
+				}
+				writeJSON(w, http.StatusOK, v)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case strings.HasPrefix(path, "/order/"):
+		id := strings.TrimPrefix(path, "/order/")
+		order, ok := f.orders[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.updateOrder(order)
+
+		w.Header().Set("Location", f.URL+"/order/"+id)
+		writeJSON(w, http.StatusOK, order)
+	case strings.HasPrefix(path, "/finalize/"):
+		id := strings.TrimPrefix(path, "/finalize/")
+		order, ok := f.orders[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.updateOrder(order)
+		if order.Status != acme.StatusReady {
+			writeJSON(w, http.StatusForbidden, map[string]string{"type": "urn:ietf:params:acme:error:orderNotReady"})
+			return
+		}
+
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &req)
+
+		certificate, err := f.issue(req.CSR, order)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badCSR", "detail": err.Error()})
+			return
+		}
+		f.certificates[id] = certificate
+		order.Status = acme.StatusValid
+		order.Certificate = f.URL + "/certificate/" + id
+
+		w.Header().Set("Location", f.URL+"/order/"+id)
+		writeJSON(w, http.StatusOK, order)
+	case strings.HasPrefix(path, "/certificate/"):
+		certificate, ok := f.certificates[strings.TrimPrefix(path, "/certificate/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.caCertificate.Raw})
+	case path == "/revoke-cert":
+		var req struct {
+			Certificate string `json:"certificate"`
+			Reason      int    `json:"reason"`
+		}
+		json.Unmarshal(payload, &req)
+
+		var issued bool
+		for _, v := range f.certificates {
+			if base64.RawURLEncoding.EncodeToString(v) == req.Certificate {
+				issued = true
+			}
+		}
+		if !issued {
+			writeJSON(w, http.StatusNotFound, map[string]string{"type": "urn:ietf:params:acme:error:malformed"})
+			return
+		}
+		if _, ok := f.revoked[req.Certificate]; ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:alreadyRevoked"})
+			return
+		}
+		f.revoked[req.Certificate] = req.Reason
+
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// validAuthorization returns the id of a valid authorization of account for
+// identifier.
+func (f *fakeACME) validAuthorization(account string, identifier string) (string, bool) {
+	if account == "" {
+		return "", false
+	}
+
+	for id, authorization := range f.authorizations {
+		value := authorization.Identifier.Value
+		if authorization.Wildcard {
+			value = "*." + value
+		}
+		if authorization.account == account && value == identifier && authorization.Status == acme.StatusValid {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// updateOrder moves a pending order to ready once all authorizations are valid.
+func (f *fakeACME) updateOrder(order *fakeOrder) {
+	if order.Status != acme.StatusPending {
+		return
+	}
+
+	for _, v := range order.Authorizations {
+		authorization := f.authorizations[v[strings.LastIndex(v, "/")+1:]]
+		if authorization.Status == acme.StatusInvalid {
+			order.Status = acme.StatusInvalid
+			return
+		}
+		if authorization.Status != acme.StatusValid {
+			return
+		}
+	}
+	order.Status = acme.StatusReady
+}
+
+// issue signs the base64url encoded csr of order with the fake CA. Certificates
+// are valid until the notAfter of the order if set, otherwise 6 days for the
+// shortlived profile and 90 for all others.
+func (f *fakeACME) issue(encodedCSR string, order *fakeOrder) ([]byte, error) {
+	der, err := base64.RawURLEncoding.DecodeString(encodedCSR)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	if order.Profile == ProfileShortLived {
+		notAfter = time.Now().Add(6 * 24 * time.Hour)
+	}
+	if order.NotAfter != "" {
+		notAfter, err = time.Parse(time.RFC3339, order.NotAfter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	// like real CAs, copy the requested tls feature extension
+	for _, e := range csr.Extensions {
+		if e.Id.Equal(OIDMustStaple) {
+			template.ExtraExtensions = append(template.ExtraExtensions, e)
+		}
+	}
+
+	return x509.CreateCertificate(rand.Reader, template, f.caCertificate, csr.PublicKey, f.caKey)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if status >= 400 {
+		w.Header().Set("Content-Type", "application/problem+json")
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// acceptingPerformer accepts the first challenge of each authorization and
+// records the hostnames it was asked to perform challenges for.
+type acceptingPerformer struct {
+	mu        sync.Mutex
+	hostnames []string
+}
+
+func (a *acceptingPerformer) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	a.mu.Lock()
+	a.hostnames = append(a.hostnames, hostname)
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	_, err := acmeClient.Accept(ctx, authorization.Challenges[0])
+	if err != nil {
+		return err
+	}
+	_, err = acmeClient.WaitAuthorization(ctx, authorization.URI)
+	return err
+}
@@ -1,10 +1,39 @@
 package acme
 
 import (
+	"crypto"
 	"crypto/tls"
+
+	"golang.org/x/net/context"
 )
 
 type CertificateForDomainer interface {
 	// CertificateForDomain obtains a certificate for a given hostname.
 	CertificateForDomain(hostname string) (*tls.Certificate, error)
 }
+
+type MultiCertificateForDomainer interface {
+	// CertificateForDomains obtains a single certificate valid for all hostnames.
+	CertificateForDomains(hostnames []string) (*tls.Certificate, error)
+}
+
+type CertificateForKeyer interface {
+	// CertificateForKey obtains a certificate for hostnames using an existing private key.
+	CertificateForKey(hostnames []string, privateKey crypto.Signer) (*tls.Certificate, error)
+}
+
+type ContextCertificateForDomainer interface {
+	// CertificateForDomainsContext is like CertificateForDomains, ctx carries the trace of the caller
+	// and cancels the request.
+	CertificateForDomainsContext(ctx context.Context, hostnames []string) (*tls.Certificate, error)
+}
+
+type ContextCertificateForKeyer interface {
+	// CertificateForKeyContext is like CertificateForKey, ctx carries the trace of the caller.
+	CertificateForKeyContext(ctx context.Context, hostnames []string, privateKey crypto.Signer) (*tls.Certificate, error)
+}
+
+type CertificateRevoker interface {
+	// RevokeCertificate revokes certificate, reason is a CRL reason code (RFC 5280).
+	RevokeCertificate(ctx context.Context, certificate *tls.Certificate, reason int) error
+}
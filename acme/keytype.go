@@ -0,0 +1,43 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+// KeyType is the type of a generated ACME account key. ECDSA keys are
+// smaller and faster to sign with than RSA keys. Ed25519 is not supported by
+// ACME CAs.
+type KeyType string
+
+const (
+	KeyTypeRSA2048 KeyType = "rsa2048"
+	KeyTypeRSA4096 KeyType = "rsa4096"
+	KeyTypeP256    KeyType = "p256"
+	KeyTypeP384    KeyType = "p384"
+)
+
+// generateKey generates an account key of keyType, or of defaultType if
+// keyType is empty.
+func generateKey(keyType KeyType, defaultType KeyType) (crypto.Signer, error) {
+	if keyType == "" {
+		keyType = defaultType
+	}
+
+	switch keyType {
+	case KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported account key type: %v", keyType)
+	}
+}
@@ -0,0 +1,30 @@
+package acme
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+var (
+	// OIDMustStaple is the TLS Feature extension (RFC 7633).
+	OIDMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+	// mustStapleExtension requests the status_request (5) TLS feature,
+	// SEQUENCE { INTEGER 5 }.
+	mustStapleExtension = pkix.Extension{
+		Id:    OIDMustStaple,
+		Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+	}
+)
+
+// HasMustStaple returns true if certificate carries the OCSP Must-Staple
+// extension and must be served with an OCSP staple.
+func HasMustStaple(certificate *x509.Certificate) bool {
+	for _, e := range certificate.Extensions {
+		if e.Id.Equal(OIDMustStaple) {
+			return true
+		}
+	}
+	return false
+}
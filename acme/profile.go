@@ -0,0 +1,220 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+const (
+	// ProfileClassic is the default Let's Encrypt profile, 90 day certificates.
+	ProfileClassic = "classic"
+
+	// ProfileShortLived is the Let's Encrypt profile for 6 day certificates.
+	ProfileShortLived = "shortlived"
+
+	// ProfileTLSServer is the Let's Encrypt profile for 90 day certificates
+	// with only the extensions needed by TLS servers.
+	ProfileTLSServer = "tlsserver"
+)
+
+// authorizeProfileOrder creates a new order for hostnames using a profile of
+// the CA. golang.org/x/crypto/acme doesn't support profiles, so the request
+// is signed and sent here and the order is then fetched with acmeClient.
+// acmeClient must have a registered account. notAfter is only sent if set.
+func authorizeProfileOrder(ctx context.Context, acmeClient *acme.Client, hostnames []string, profile string, notAfter time.Time) (*acme.Order, error) {
+	if acmeClient.KID == "" {
+		return nil, acme.ErrNoAccount
+	}
+
+	dir, err := acmeClient.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := acmeClient.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	payload := struct {
+		Identifiers []acme.AuthzID `json:"identifiers"`
+		Profile     string         `json:"profile"`
+		NotAfter    string         `json:"notAfter,omitempty"`
+	}{
+		Identifiers: acme.DomainIDs(hostnames...),
+		Profile:     profile,
+	}
+	if !notAfter.IsZero() {
+		payload.NotAfter = notAfter.UTC().Format(time.RFC3339)
+	}
+
+	nonce, err := fetchNonce(ctx, httpClient, acmeClient.UserAgent, dir.NonceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// retry a few times in case the nonce was rejected, the error response
+	// comes with a fresh one
+	var orderURL string
+	for i := 0; i < 3; i++ {
+		body, err := signRequest(acmeClient.Key, string(acmeClient.KID), nonce, dir.OrderURL, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest("POST", dir.OrderURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		setUserAgent(req, acmeClient.UserAgent)
+
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		nonce = resp.Header.Get("Replay-Nonce")
+
+		if resp.StatusCode == http.StatusCreated {
+			orderURL = resp.Header.Get("Location")
+			resp.Body.Close()
+			break
+		}
+
+		problem := &acme.Error{StatusCode: resp.StatusCode, Header: resp.Header}
+		json.NewDecoder(resp.Body).Decode(&struct {
+			Type   *string `json:"type"`
+			Detail *string `json:"detail"`
+		}{&problem.ProblemType, &problem.Detail})
+		resp.Body.Close()
+
+		if problem.ProblemType != "urn:ietf:params:acme:error:badNonce" || nonce == "" || i == 2 {
+			return nil, problem
+		}
+	}
+
+	return acmeClient.GetOrder(ctx, orderURL)
+}
+
+// fetchNonce gets a fresh anti-replay nonce from the CA.
+func fetchNonce(ctx context.Context, httpClient *http.Client, userAgent string, nonceURL string) (string, error) {
+	req, err := http.NewRequest("HEAD", nonceURL, nil)
+	if err != nil {
+		return "", err
+	}
+	setUserAgent(req, userAgent)
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("no nonce in response from %v", nonceURL)
+	}
+
+	return nonce, nil
+}
+
+// setUserAgent sets the User-Agent header the same way
+// golang.org/x/crypto/acme does.
+func setUserAgent(req *http.Request, userAgent string) {
+	ua := "roman"
+	if userAgent != "" {
+		ua = userAgent + " " + ua
+	}
+	req.Header.Set("User-Agent", ua)
+}
+
+// signRequest returns payload as a flattened JWS signed by the account key
+// in kid form.
+func signRequest(key crypto.Signer, kid string, nonce string, url string, payload interface{}) ([]byte, error) {
+	var alg string
+	var hash crypto.Hash
+	var size int
+
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg, hash = "RS256", crypto.SHA256
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().Name {
+		case "P-256":
+			alg, hash, size = "ES256", crypto.SHA256, 32
+		case "P-384":
+			alg, hash, size = "ES384", crypto.SHA384, 48
+		default:
+			return nil, fmt.Errorf("unsupported account key curve: %v", pub.Curve.Params().Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported account key type: %T", pub)
+	}
+
+	protectedBytes, err := json.Marshal(map[string]string{
+		"alg":   alg,
+		"kid":   kid,
+		"nonce": nonce,
+		"url":   url,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString(protectedBytes)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		d := sha256.Sum256([]byte(protected + "." + encodedPayload))
+		digest = d[:]
+	case crypto.SHA384:
+		d := sha512.Sum384([]byte(protected + "." + encodedPayload))
+		digest = d[:]
+	}
+
+	signature, err := key.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// jws uses the raw r || s form of ecdsa signatures, not asn.1
+	if size > 0 {
+		var sig struct {
+			R, S *big.Int
+		}
+		_, err = asn1.Unmarshal(signature, &sig)
+		if err != nil {
+			return nil, err
+		}
+		signature = make([]byte, 2*size)
+		sig.R.FillBytes(signature[:size])
+		sig.S.FillBytes(signature[size:])
+	}
+
+	return json.Marshal(map[string]string{
+		"protected": protected,
+		"payload":   encodedPayload,
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
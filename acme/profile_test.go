@@ -0,0 +1,143 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestClientProfile(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inProfile   string
+		inDuration  time.Duration
+		outLifetime time.Duration
+	}{
+		// 0 - default profile
+		{"", 0, 90 * 24 * time.Hour},
+		// 1 - classic profile
+		{ProfileClassic, 0, 90 * 24 * time.Hour},
+		// 2 - short lived certificates
+		{ProfileShortLived, 0, 6 * 24 * time.Hour},
+		// 3 - requested duration
+		{"", 30 * 24 * time.Hour, 30 * 24 * time.Hour},
+		// 4 - requested duration with a profile
+		{ProfileShortLived, 3 * 24 * time.Hour, 3 * 24 * time.Hour},
+	}
+
+	for i, tt := range tests {
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			Profile:            tt.inProfile,
+			Duration:           tt.inDuration,
+		}
+
+		certificate, err := acmeClient.CertificateForDomain("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CertificateForDomain: %v", i, err)
+		}
+
+		// the fake ca backdates certificates by an hour
+		lifetime := certificate.Leaf.NotAfter.Sub(certificate.Leaf.NotBefore) - 1*time.Hour
+		if got, want := lifetime.Round(time.Hour), tt.outLifetime; got != want {
+			t.Errorf("Test(%v) Got lifetime: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		inKey  crypto.Signer
+		outAlg string
+	}{
+		// 0 - p-256
+		{p256, "ES256"},
+		// 1 - p-384
+		{p384, "ES384"},
+		// 2 - rsa
+		{rsaKey, "RS256"},
+	}
+
+	for i, tt := range tests {
+		body, err := signRequest(tt.inKey, "https://acme.example.com/account/1", "nonce", "https://acme.example.com/new-order", map[string]string{"profile": "shortlived"})
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from signRequest: %v", i, err)
+		}
+
+		var jws struct {
+			Protected string `json:"protected"`
+			Payload   string `json:"payload"`
+			Signature string `json:"signature"`
+		}
+		err = json.Unmarshal(body, &jws)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Unmarshal: %v", i, err)
+		}
+
+		protectedBytes, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+		var protected map[string]string
+		json.Unmarshal(protectedBytes, &protected)
+		if got, want := protected["alg"], tt.outAlg; got != want {
+			t.Errorf("Test(%v) Got alg: %v, Want: %v", i, got, want)
+		}
+		if got, want := protected["kid"], "https://acme.example.com/account/1"; got != want {
+			t.Errorf("Test(%v) Got kid: %v, Want: %v", i, got, want)
+		}
+
+		signature, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+		signed := []byte(jws.Protected + "." + jws.Payload)
+
+		var valid bool
+		switch key := tt.inKey.(type) {
+		case *ecdsa.PrivateKey:
+			size := len(signature) / 2
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if size == 32 {
+				digest := sha256.Sum256(signed)
+				valid = ecdsa.Verify(&key.PublicKey, digest[:], r, s)
+			} else {
+				digest := sha512.Sum384(signed)
+				valid = ecdsa.Verify(&key.PublicKey, digest[:], r, s)
+			}
+		case *rsa.PrivateKey:
+			digest := sha256.Sum256(signed)
+			valid = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) == nil
+		}
+		if !valid {
+			t.Errorf("Test(%v) Invalid signature", i)
+		}
+	}
+}
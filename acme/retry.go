@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	defaultMaxRetries = 5
+
+	// maxRetryBackoff caps the exponential backoff between retries.
+	maxRetryBackoff = 10 * time.Second
+
+	// maxRetryAfter is the longest Retry-After we are willing to wait for,
+	// requests time out after a minute anyway. Longer rate limits are left
+	// to the next renewal attempt.
+	maxRetryAfter = 30 * time.Second
+)
+
+var (
+	retryBase = 1 * time.Second // used to speed up tests
+)
+
+// maxRetries returns how often transient errors are retried, MaxRetries
+// defaults to 5 and a negative value disables retries.
+func maxRetries(n int) int {
+	if n == 0 {
+		return defaultMaxRetries
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// retryBackoff returns an acme.Client RetryBackoff function that retries a
+// failed request at most maxRetries times. The acme client only retries
+// badNonce, rateLimited, and 5xx responses. Retry-After is honored if
+// present, otherwise the backoff doubles on every attempt.
+func retryBackoff(maxRetries int) func(n int, r *http.Request, resp *http.Response) time.Duration {
+	return func(n int, r *http.Request, resp *http.Response) time.Duration {
+		if n > maxRetries {
+			return 0
+		}
+
+		jitter := time.Duration(rand.Int63n(int64(retryBase)/10 + 1))
+
+		if resp != nil {
+			if v := resp.Header.Get("Retry-After"); v != "" {
+				d := retryAfter(v)
+				if d > maxRetryAfter {
+					return 0
+				}
+				if d > 0 {
+					return d + jitter
+				}
+			}
+		}
+
+		d := retryBase << uint(n-1)
+		if d > maxRetryBackoff || d <= 0 {
+			d = maxRetryBackoff
+		}
+		return d + jitter
+	}
+}
+
+// retryAfter parses a Retry-After header, either in seconds or as a date.
+func retryAfter(v string) time.Duration {
+	if i, err := strconv.Atoi(v); err == nil {
+		return time.Duration(i) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+	return t.Sub(time.Now())
+}
+
+// isTransient returns true if err is, or wraps, an acme error that is retried.
+func isTransient(err error) bool {
+	var e *acme.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.ProblemType == "urn:ietf:params:acme:error:badNonce" ||
+		e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// retryError makes errors that are still transient after all retries say so.
+func retryError(err error, maxRetries int) error {
+	if !isTransient(err) {
+		return err
+	}
+	return fmt.Errorf("giving up after %v retries: %w", maxRetries, err)
+}
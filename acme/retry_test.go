@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		inN          int
+		inRetryAfter string
+		outMin       time.Duration
+		outMax       time.Duration
+	}{
+		// 0 - first retry
+		{1, "", 1 * time.Second, 2 * time.Second},
+		// 1 - backoff doubles
+		{3, "", 4 * time.Second, 5 * time.Second},
+		// 2 - backoff is capped
+		{5, "", 10 * time.Second, 11 * time.Second},
+		// 3 - retry after is honored
+		{1, "20", 20 * time.Second, 21 * time.Second},
+		// 4 - retry after that's too long gives up
+		{1, "3600", 0, 0},
+		// 5 - out of retries
+		{6, "", 0, 0},
+	}
+
+	backoff := retryBackoff(5)
+
+	for i, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.inRetryAfter != "" {
+			resp.Header.Set("Retry-After", tt.inRetryAfter)
+		}
+
+		d := backoff(tt.inN, nil, resp)
+		if d < tt.outMin || d > tt.outMax {
+			t.Errorf("Test(%v) Got backoff: %v, Want between: %v and %v", i, d, tt.outMin, tt.outMax)
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	defer func(d time.Duration) { retryBase = d }(retryBase)
+	retryBase = 1 * time.Millisecond
+
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inErrors      []string
+		inMaxRetries  int
+		outRequests   int
+		outErr        bool
+		outErrMessage string
+	}{
+		// 0 - transient errors are retried
+		{[]string{"badNonce", "serverInternal", "rateLimited"}, 0, 4, false, ""},
+		// 1 - give up after the retry budget
+		{[]string{"serverInternal", "serverInternal", "serverInternal"}, 2, 3, true, "giving up after 2 retries"},
+		// 2 - retries disabled
+		{[]string{"serverInternal"}, -1, 1, true, "giving up after 0 retries"},
+		// 3 - other errors are not retried
+		{[]string{"rejectedIdentifier"}, 0, 1, true, "rejectedIdentifier"},
+	}
+
+	for i, tt := range tests {
+		server.mu.Lock()
+		server.orderErrors = tt.inErrors
+		server.orderRequests = 0
+		server.mu.Unlock()
+
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: &acceptingPerformer{},
+			MaxRetries:         tt.inMaxRetries,
+		}
+
+		_, err := acmeClient.CertificateForDomain("foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.outErrMessage) {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, err, tt.outErrMessage)
+		}
+
+		server.mu.Lock()
+		if got, want := server.orderRequests, tt.outRequests; got != want {
+			t.Errorf("Test(%v) Got %v order requests, Want: %v", i, got, want)
+		}
+		server.mu.Unlock()
+	}
+}
@@ -0,0 +1,40 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/tls"
+	"fmt"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+// RevokeCertificate revokes certificate with the CA, for example because its
+// private key was compromised. reason is a CRL reason code (RFC 5280), 0 if
+// unspecified. The request is signed with the private key of the certificate,
+// so it doesn't need the account that requested it. Revoking a certificate
+// that is already revoked succeeds, so revocations can be retried. Errors
+// reported by the ACME server are returned as a *Problem.
+func (c *Client) RevokeCertificate(ctx context.Context, certificate *tls.Certificate, reason int) error {
+	if len(certificate.Certificate) == 0 {
+		return fmt.Errorf("no certificate to revoke")
+	}
+	privateKey, ok := certificate.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type: %T", certificate.PrivateKey)
+	}
+
+	acmeClient := &acme.Client{
+		DirectoryURL: c.Directory,
+		RetryBackoff: retryBackoff(maxRetries(c.MaxRetries)),
+		HTTPClient:   c.HTTPClient,
+		UserAgent:    c.UserAgent,
+	}
+
+	err := acmeClient.RevokeCert(ctx, privateKey, certificate.Certificate[0], acme.CRLReasonCode(reason))
+	if err != nil {
+		return problemFromError(err)
+	}
+
+	return nil
+}
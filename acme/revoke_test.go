@@ -0,0 +1,64 @@
+package acme
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+func TestRevokeCertificate(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+	}
+	certificate, err := acmeClient.CertificateForDomain("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from CertificateForDomain: %v", err)
+	}
+
+	// a client for another account revokes with the key of the certificate
+	revoker := &Client{Directory: server.URL + "/directory"}
+	err = revoker.RevokeCertificate(context.Background(), certificate, 1)
+	if err != nil {
+		t.Fatalf("Unexpected response from RevokeCertificate: %v", err)
+	}
+	server.mu.Lock()
+	reason, ok := server.revoked[base64.RawURLEncoding.EncodeToString(certificate.Certificate[0])]
+	server.mu.Unlock()
+	if !ok || reason != 1 {
+		t.Errorf("Got revoked: %v, reason: %v, Want revoked for reason 1", ok, reason)
+	}
+
+	// revoking again succeeds, the certificate is revoked already
+	err = revoker.RevokeCertificate(context.Background(), certificate, 0)
+	if err != nil {
+		t.Errorf("Unexpected response from RevokeCertificate for a revoked certificate: %v", err)
+	}
+
+	tests := []struct {
+		inCertificate *tls.Certificate
+	}{
+		// 0 - no certificate
+		{&tls.Certificate{PrivateKey: certificate.PrivateKey}},
+		// 1 - no private key
+		{&tls.Certificate{Certificate: certificate.Certificate}},
+	}
+
+	for i, tt := range tests {
+		err := revoker.RevokeCertificate(context.Background(), tt.inCertificate, 0)
+		if err == nil {
+			t.Errorf("Test(%v) Expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package acme
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/challenge"
+)
+
+const (
+	defaultAccountTimeout       = 1 * time.Minute
+	defaultOrderTimeout         = 1 * time.Minute
+	defaultAuthorizationTimeout = 1 * time.Minute
+	defaultFinalizeTimeout      = 1 * time.Minute
+)
+
+// Timeouts are the timeouts of the phases of issuance. Zero values use the
+// defaults: 1 minute for each request to the ACME server and 10 minutes for
+// the ACME server to validate a challenge.
+type Timeouts struct {
+	// Account limits creating or registering the account.
+	Account time.Duration
+
+	// Order limits creating the order.
+	Order time.Duration
+
+	// Authorization limits fetching each authorization of the order.
+	Authorization time.Duration
+
+	// Challenge limits how long the ACME server may take to validate a
+	// challenge once it was accepted, for performers that implement
+	// challenge.ContextPerformer. It doesn't include updating DNS and
+	// waiting for propagation, see the PropagationTimeout of the performers.
+	Challenge time.Duration
+
+	// Finalize limits waiting for the order to become ready, finalizing it
+	// and downloading the certificate.
+	Finalize time.Duration
+}
+
+func (t Timeouts) account() time.Duration {
+	return timeoutOrDefault(t.Account, defaultAccountTimeout)
+}
+
+func (t Timeouts) order() time.Duration {
+	return timeoutOrDefault(t.Order, defaultOrderTimeout)
+}
+
+func (t Timeouts) authorization() time.Duration {
+	return timeoutOrDefault(t.Authorization, defaultAuthorizationTimeout)
+}
+
+func (t Timeouts) finalize() time.Duration {
+	return timeoutOrDefault(t.Finalize, defaultFinalizeTimeout)
+}
+
+// challengeContext returns ctx with the validation timeout of challenges if
+// one is set.
+func (t Timeouts) challengeContext(ctx context.Context) context.Context {
+	if t.Challenge <= 0 {
+		return ctx
+	}
+	return challenge.WithValidationTimeout(ctx, t.Challenge)
+}
+
+func timeoutOrDefault(timeout time.Duration, defaultTimeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
@@ -0,0 +1,65 @@
+package acme
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/challenge"
+)
+
+func TestClientTimeouts(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		inTimeouts       Timeouts
+		outValidation    time.Duration
+		outAuthorization time.Duration
+	}{
+		// 0 - defaults
+		{Timeouts{}, 10 * time.Minute, 1 * time.Minute},
+		// 1 - slow dns provider
+		{Timeouts{Challenge: 30 * time.Minute}, 30 * time.Minute, 1 * time.Minute},
+		// 2 - short timeouts for ci
+		{Timeouts{Challenge: 5 * time.Second, Authorization: 2 * time.Second}, 5 * time.Second, 2 * time.Second},
+	}
+
+	for i, tt := range tests {
+		performer := &timeoutPerformer{}
+		acmeClient := &Client{
+			Directory:          server.URL + "/directory",
+			AgreeTOS:           acme.AcceptTOS,
+			Email:              "foo@example.com",
+			ChallengePerformer: performer,
+			Timeouts:           tt.inTimeouts,
+		}
+
+		_, err := acmeClient.CertificateForDomain("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CertificateForDomain: %v", i, err)
+		}
+		if got, want := performer.validation, tt.outValidation; got != want {
+			t.Errorf("Test(%v) Got validation timeout: %v, Want: %v", i, got, want)
+		}
+		if got, want := tt.inTimeouts.authorization(), tt.outAuthorization; got != want {
+			t.Errorf("Test(%v) Got authorization timeout: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+// timeoutPerformer records the validation timeout it was asked to use.
+type timeoutPerformer struct {
+	acceptingPerformer
+	validation time.Duration
+}
+
+func (p *timeoutPerformer) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	p.validation = challenge.ValidationTimeout(ctx)
+	return p.Perform(acmeClient, authorization, hostname)
+}
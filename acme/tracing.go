@@ -0,0 +1,39 @@
+package acme
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	tracerName = "github.com/mailgun/roman/acme"
+)
+
+// tracer returns the tracer for issuance: from TracerProvider, else from the
+// provider of the span in ctx, else from the global provider.
+func (c *Client) tracer(ctx context.Context) trace.Tracer {
+	if c.TracerProvider != nil {
+		return c.TracerProvider.Tracer(tracerName)
+	}
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(tracerName)
+	}
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// startSpan starts a child of the span in ctx.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name)
+}
+
+// endSpan ends span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
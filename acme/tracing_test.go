@@ -0,0 +1,63 @@
+package acme
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestClientTracing(t *testing.T) {
+	server, err := newFakeACME()
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeACME: %v", err)
+	}
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	acmeClient := &Client{
+		Directory:          server.URL + "/directory",
+		AgreeTOS:           acme.AcceptTOS,
+		Email:              "foo@example.com",
+		ChallengePerformer: &acceptingPerformer{},
+		TracerProvider:     sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}
+
+	_, err = acmeClient.CertificateForDomains([]string{"foo.example.com", "bar.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from CertificateForDomains: %v", err)
+	}
+
+	spans := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+	}
+
+	tests := []struct {
+		inName   string
+		outCount int
+	}{
+		// 0
+		{"acme.Certificate", 1},
+		// 1
+		{"acme.Account", 1},
+		// 2
+		{"acme.Order", 1},
+		// 3 - one per hostname
+		{"acme.Authorization", 2},
+		// 4
+		{"acme.WaitOrder", 1},
+		// 5
+		{"acme.CSR", 1},
+		// 6
+		{"acme.Finalize", 1},
+	}
+
+	for i, tt := range tests {
+		if got, want := spans[tt.inName], tt.outCount; got != want {
+			t.Errorf("Test(%v) Got %v %v spans, Want: %v", i, got, tt.inName, want)
+		}
+	}
+}
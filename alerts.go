@@ -0,0 +1,108 @@
+package roman
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// expiryAlertInterval is how often certificates are checked against
+// ExpiryAlerts.
+var expiryAlertInterval = 1 * time.Hour
+
+// expiryAlert is the lowest threshold of ExpiryAlerts the certificate of a
+// host crossed.
+type expiryAlert struct {
+	notAfter  time.Time
+	threshold time.Duration
+}
+
+// expiryAlertThresholds returns the positive ExpiryAlerts, smallest first.
+func (m *CertificateManager) expiryAlertThresholds() []time.Duration {
+	var thresholds []time.Duration
+	for _, threshold := range m.ExpiryAlerts {
+		if threshold > 0 {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+
+	return thresholds
+}
+
+// checkExpiryAlerts raises an alert for every host whose certificate crossed
+// a threshold of ExpiryAlerts it wasn't alerted for yet: it's logged, shows
+// in Metrics and is sent to Notifiers. It returns the events it sent.
+func (m *CertificateManager) checkExpiryAlerts() []Event {
+	thresholds := m.expiryAlertThresholds()
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	var events []Event
+	for _, hostname := range m.hosts() {
+		certificate, err := m.getCertificateFromCache(hostname)
+		if err != nil || certificate.Leaf == nil {
+			continue
+		}
+		notAfter := certificate.Leaf.NotAfter
+		remaining := notAfter.Sub(clock.UtcNow())
+
+		// the lowest threshold crossed is the one that counts
+		var crossed time.Duration
+		for _, threshold := range thresholds {
+			if remaining <= threshold {
+				crossed = threshold
+				break
+			}
+		}
+
+		m.alertsMu.Lock()
+		previous, ok := m.expiryAlerts[hostname]
+		switch {
+		case crossed == 0:
+			delete(m.expiryAlerts, hostname)
+		case !ok || !previous.notAfter.Equal(notAfter) || crossed < previous.threshold:
+			if m.expiryAlerts == nil {
+				m.expiryAlerts = make(map[string]expiryAlert)
+			}
+			m.expiryAlerts[hostname] = expiryAlert{notAfter: notAfter, threshold: crossed}
+		default:
+			crossed = 0
+		}
+		m.alertsMu.Unlock()
+
+		if crossed == 0 {
+			continue
+		}
+
+		if crossed == thresholds[0] {
+			log.Errorf("certificate for %q expires in %v (at %v), less than %v", hostname, remaining.Round(time.Minute), notAfter, crossed)
+		} else {
+			log.Warningf("certificate for %q expires in %v (at %v), less than %v", hostname, remaining.Round(time.Minute), notAfter, crossed)
+		}
+
+		event := Event{Type: EventExpiringSoon, Hostname: hostname, NotAfter: notAfter, Threshold: crossed}
+		m.notify(event)
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// checkExpiryAlertsForever calls checkExpiryAlerts every expiryAlertInterval
+// until ctx is done.
+func (m *CertificateManager) checkExpiryAlertsForever(ctx context.Context) {
+	for {
+		m.checkExpiryAlerts()
+
+		select {
+		case <-time.After(expiryAlertInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
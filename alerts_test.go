@@ -0,0 +1,79 @@
+package roman
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mailgun/timetools"
+)
+
+func TestExpiryAlerts(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)
+	frozen := &timetools.FreezedTime{CurrentTime: now}
+	clock = frozen
+
+	day := 24 * time.Hour
+	m := CertificateManager{
+		Cache:        newMapCache(),
+		KnownHosts:   []string{"foo.example.com"},
+		ExpiryAlerts: []time.Duration{2 * day, 14 * day, 7 * day},
+	}
+
+	certificate, err := generateCertificate("foo.example.com", now.Add(-80*day), now.Add(20*day))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	tests := []struct {
+		inElapsed     time.Duration // time since the certificate was cached
+		inRenewed     bool          // a new certificate replaced it
+		outThresholds string
+		outMetric     time.Duration
+	}{
+		// 0 - plenty of time left
+		{0, false, "[]", 0},
+		// 1 - first threshold
+		{7 * day, false, "[336h0m0s]", 14 * day},
+		// 2 - only once per threshold
+		{8 * day, false, "[]", 14 * day},
+		// 3 - renewal keeps failing, escalate
+		{14 * day, false, "[168h0m0s]", 7 * day},
+		// 4 - two thresholds at once only alert for the lowest
+		{19 * day, false, "[48h0m0s]", 2 * day},
+		// 5 - expired certificates stay at the lowest
+		{21 * day, false, "[]", 2 * day},
+		// 6 - a new certificate clears the alert
+		{21 * day, true, "[]", 0},
+	}
+
+	for i, tt := range tests {
+		frozen.CurrentTime = now.Add(tt.inElapsed)
+		if tt.inRenewed {
+			certificate, err := generateCertificate("foo.example.com", frozen.CurrentTime, frozen.CurrentTime.Add(90*day))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+			}
+			err = m.putCertificateInCache("foo.example.com", certificate)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+			}
+		}
+
+		var thresholds []time.Duration
+		for _, event := range m.checkExpiryAlerts() {
+			thresholds = append(thresholds, event.Threshold)
+		}
+		if got, want := fmt.Sprint(thresholds), tt.outThresholds; got != want {
+			t.Errorf("Test(%v) Got alerts: %v, Want: %v", i, got, want)
+		}
+		if got, want := m.Metrics().ExpiryAlerts["foo.example.com"], tt.outMetric; got != want {
+			t.Errorf("Test(%v) Got alert metric: %v, Want: %v", i, got, want)
+		}
+	}
+}
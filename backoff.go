@@ -0,0 +1,104 @@
+package roman
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// minRetryBackoff is how long after the first failure a renewal is
+	// retried. It doubles with every consecutive failure, which stays below
+	// the Let's Encrypt limit of 5 failed validations per hostname per hour.
+	minRetryBackoff = 5 * time.Minute
+
+	// maxRetryBackoff is the longest time between retries of a failed
+	// renewal.
+	maxRetryBackoff = 6 * time.Hour
+)
+
+// retryBackoff returns how long to wait before retrying a renewal that failed
+// failures consecutive times.
+func retryBackoff(failures int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 1; i < failures && backoff < maxRetryBackoff; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	return backoff
+}
+
+// scheduleRetry sets when the renewal of hostname is retried, the caller
+// must hold failuresMu.
+func (m *CertificateManager) scheduleRetry(hostname string, wait time.Duration) {
+	if m.retries == nil {
+		m.retries = make(map[string]time.Time)
+	}
+	m.retries[hostname] = clock.UtcNow().Add(wait)
+}
+
+// nextRetry returns when the next failed renewal is due, if there is one.
+func (m *CertificateManager) nextRetry() (time.Time, bool) {
+	m.failuresMu.Lock()
+	defer m.failuresMu.Unlock()
+
+	var next time.Time
+	for _, at := range m.retries {
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// dueRetries returns the hosts whose failed renewal is due, most at risk
+// first, dropping those that are no longer renewed.
+func (m *CertificateManager) dueRetries() []string {
+	renewalHosts := make(map[string]bool)
+	for _, hostname := range m.renewalHosts() {
+		renewalHosts[hostname] = true
+	}
+
+	m.failuresMu.Lock()
+	now := clock.UtcNow()
+
+	var hostnames []string
+	for hostname, at := range m.retries {
+		if !renewalHosts[hostname] || m.quarantined[hostname] {
+			delete(m.retries, hostname)
+			continue
+		}
+		if !at.After(now) {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	m.failuresMu.Unlock()
+
+	return m.orderByRisk(hostnames)
+}
+
+// retryRenewals retries the failed renewals that are due.
+func (m *CertificateManager) retryRenewals(ctx context.Context) []error {
+	var errs []error
+
+	for _, hostname := range m.dueRetries() {
+		if ctx.Err() != nil {
+			return append(errs, ctx.Err())
+		}
+
+		err := m.renewCertificate(ctx, hostname)
+		if ctx.Err() != nil {
+			return append(errs, ctx.Err())
+		}
+		m.recordRenewal(hostname, err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,113 @@
+package roman
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/timetools"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		inFailures int
+		outBackoff time.Duration
+	}{
+		// 0 - first failure
+		{1, 5 * time.Minute},
+		// 1 - doubles with every failure
+		{2, 10 * time.Minute},
+		// 2
+		{4, 40 * time.Minute},
+		// 3
+		{7, 320 * time.Minute},
+		// 4 - capped
+		{8, 6 * time.Hour},
+		// 5 - doesn't overflow
+		{100, 6 * time.Hour},
+	}
+
+	for i, tt := range tests {
+		if got, want := retryBackoff(tt.inFailures), tt.outBackoff; got != want {
+			t.Errorf("Test(%v) Got backoff: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestRetryRenewals(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := &timetools.FreezedTime{CurrentTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clock = now
+
+	fcfd := failingCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:  &fcfd,
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	m.renewCertificates(context.Background())
+
+	tests := []struct {
+		inElapsed time.Duration // since the last attempt
+		outCount  int
+		outNext   time.Duration // until the next retry
+	}{
+		// 0 - not due yet
+		{4 * time.Minute, 1, time.Minute},
+		// 1 - first retry
+		{time.Minute, 2, 10 * time.Minute},
+		// 2 - second retry
+		{10 * time.Minute, 3, 20 * time.Minute},
+	}
+
+	for i, tt := range tests {
+		now.CurrentTime = now.CurrentTime.Add(tt.inElapsed)
+
+		m.retryRenewals(context.Background())
+		if got, want := fcfd.count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got called CertificateForDomain %v times, Want: %v", i, got, want)
+		}
+
+		next, ok := m.nextRetry()
+		if !ok {
+			t.Fatalf("Test(%v) Expected a retry to be scheduled", i)
+		}
+		if got, want := next.Sub(now.CurrentTime), tt.outNext; got != want {
+			t.Errorf("Test(%v) Got next retry in: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// hosts that are no longer known are not retried
+	m.KnownHosts = nil
+	now.CurrentTime = now.CurrentTime.Add(time.Hour)
+	m.retryRenewals(context.Background())
+	if got, want := fcfd.count, 3; got != want {
+		t.Errorf("Got called CertificateForDomain %v times, Want: %v", got, want)
+	}
+	if _, ok := m.nextRetry(); ok {
+		t.Errorf("Expected no retry to be scheduled")
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := &timetools.FreezedTime{CurrentTime: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clock = now
+
+	m := CertificateManager{}
+	m.recordRenewal("foo.example.com", &rateLimitError{domain: "example.com", wait: time.Hour})
+
+	next, ok := m.nextRetry()
+	if !ok {
+		t.Fatalf("Expected a retry to be scheduled")
+	}
+	if got, want := next.Sub(now.CurrentTime), time.Hour; got != want {
+		t.Errorf("Got next retry in: %v, Want: %v", got, want)
+	}
+	if got, want := m.failureCount("foo.example.com"), 0; got != want {
+		t.Errorf("Got failure count: %v, Want: %v", got, want)
+	}
+}
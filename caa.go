@@ -0,0 +1,261 @@
+package roman
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsTypeCAA = dnsmessage.Type(257)
+
+	// caaFlagCritical marks properties a CA must understand to issue.
+	caaFlagCritical = 128
+
+	defaultCAANameserver = "8.8.8.8:53"
+)
+
+// CAACheck configures checking the CAA records of hosts before a certificate
+// is requested, so a CA that isn't authorized fails right away with a clear
+// error instead of after an order was created.
+type CAACheck struct {
+	// IssuerDomains are the CAA issuer domains of the CAs roman uses, for
+	// example "letsencrypt.org". Leaving it empty disables the check.
+	IssuerDomains []string
+
+	// Resolver looks up CAA records, defaults to a DNSCAAResolver that queries
+	// the first nameserver in /etc/resolv.conf.
+	Resolver CAAResolver
+}
+
+// CAARecord is a CAA resource record, RFC 8659.
+type CAARecord struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// CAAResolver looks up the CAA records of a domain name.
+type CAAResolver interface {
+	// LookupCAA returns the CAA records of name itself, without climbing
+	// the DNS tree, following CNAMEs. A name that doesn't exist has none.
+	LookupCAA(ctx context.Context, name string) ([]CAARecord, error)
+}
+
+// DNSCAAResolver is a CAAResolver that queries a recursive nameserver over UDP.
+type DNSCAAResolver struct {
+	// Nameserver is the address of the nameserver, for example
+	// "127.0.0.53:53". Defaults to the first one in /etc/resolv.conf.
+	Nameserver string
+}
+
+// LookupCAA queries the CAA records of name.
+func (r DNSCAAResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	nameserver := r.Nameserver
+	if nameserver == "" {
+		nameserver = systemNameserver()
+	}
+
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(time.Now().UnixNano()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: dnsTypeCAA, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", nameserver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	_, err = conn.Write(packed)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var response dnsmessage.Message
+	err = response.Unpack(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	if response.Header.ID != query.Header.ID {
+		return nil, fmt.Errorf("unexpected response id from %v", nameserver)
+	}
+
+	switch response.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unable to look up CAA records for %v: %v", name, response.Header.RCode)
+	}
+
+	var records []CAARecord
+	for _, answer := range response.Answers {
+		unknown, ok := answer.Body.(*dnsmessage.UnknownResource)
+		if !ok || answer.Header.Type != dnsTypeCAA {
+			continue
+		}
+		record, err := parseCAA(unknown.Data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseCAA parses the RDATA of a CAA record.
+func parseCAA(data []byte) (CAARecord, error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return CAARecord{}, fmt.Errorf("malformed CAA record")
+	}
+
+	tagLength := int(data[1])
+	return CAARecord{
+		Flag:  data[0],
+		Tag:   strings.ToLower(string(data[2 : 2+tagLength])),
+		Value: string(data[2+tagLength:]),
+	}, nil
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf.
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return defaultCAANameserver
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+
+	return defaultCAANameserver
+}
+
+// checkCAA returns an error if the CAA records of any of hostnames forbid
+// all of CAACheck.IssuerDomains to issue for it. It does nothing if no
+// issuer domains are configured.
+func (m *CertificateManager) checkCAA(ctx context.Context, hostnames []string) error {
+	if len(m.CAACheck.IssuerDomains) == 0 {
+		return nil
+	}
+
+	resolver := m.CAACheck.Resolver
+	if resolver == nil {
+		resolver = DNSCAAResolver{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, hostname := range hostnames {
+		err := checkCAA(ctx, resolver, hostname, m.CAACheck.IssuerDomains)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkCAA checks the CAA records of hostname, RFC 8659: the records of the
+// closest name in the tree that has any apply, issuewild takes precedence
+// for wildcards.
+func checkCAA(ctx context.Context, resolver CAAResolver, hostname string, issuerDomains []string) error {
+	wildcard := strings.HasPrefix(hostname, "*.")
+	name := strings.TrimSuffix(strings.TrimPrefix(hostname, "*."), ".")
+
+	for ; name != ""; name = parentDomain(name) {
+		records, err := resolver.LookupCAA(ctx, name)
+		if err != nil {
+			return fmt.Errorf("unable to look up CAA records of %q: %v", name, err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		var issue, issueWild []string
+		for _, record := range records {
+			switch record.Tag {
+			case "issue":
+				issue = append(issue, record.Value)
+			case "issuewild":
+				issueWild = append(issueWild, record.Value)
+			case "iodef", "contactemail", "contactphone", "issuemail", "issuevmc":
+			default:
+				if record.Flag&caaFlagCritical != 0 {
+					return fmt.Errorf("CAA records of %q forbid issuance for %q: unknown critical property %q", name, hostname, record.Tag)
+				}
+			}
+		}
+
+		values := issue
+		if wildcard && issueWild != nil {
+			values = issueWild
+		}
+		// records that don't restrict issuance
+		if values == nil {
+			return nil
+		}
+
+		var authorized []string
+		for _, value := range values {
+			issuer := strings.ToLower(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]))
+			if issuer == "" {
+				continue
+			}
+			for _, issuerDomain := range issuerDomains {
+				if issuer == strings.ToLower(issuerDomain) {
+					return nil
+				}
+			}
+			authorized = append(authorized, issuer)
+		}
+
+		if authorized == nil {
+			return fmt.Errorf("CAA records of %q forbid issuance for %q by any CA", name, hostname)
+		}
+		return fmt.Errorf("CAA records of %q only authorize %v to issue for %q, not %v", name, strings.Join(authorized, ", "), hostname, strings.Join(issuerDomains, ", "))
+	}
+
+	return nil
+}
+
+// parentDomain returns name without its first label, or "" for a top level
+// domain.
+func parentDomain(name string) string {
+	i := strings.Index(name, ".")
+	if i < 0 {
+		return ""
+	}
+	return name[i+1:]
+}
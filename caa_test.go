@@ -0,0 +1,148 @@
+package roman
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestCheckCAA(t *testing.T) {
+	resolver := mapCAAResolver{
+		"example.com": {
+			{Tag: "issue", Value: "letsencrypt.org"},
+			{Tag: "issuewild", Value: ";"},
+			{Tag: "iodef", Value: "mailto:security@example.com"},
+		},
+		"digicert.example.com": {{Tag: "issue", Value: "digicert.com; cansignhttpexchanges=yes"}},
+		"mail.example.com":     {{Tag: "iodef", Value: "mailto:security@example.com"}},
+		"strict.example.com":   {{Flag: 128, Tag: "tbs", Value: "unknown"}},
+		"example.net":          {{Tag: "issue", Value: "LetsEncrypt.org; validationmethods=dns-01"}},
+	}
+
+	tests := []struct {
+		inHostname string
+		outErr     bool
+	}{
+		// 0 - authorized
+		{"example.com", false},
+		// 1 - inherited from the parent
+		{"foo.example.com", false},
+		// 2 - wildcards are forbidden by issuewild
+		{"*.example.com", true},
+		// 3 - another ca on a subdomain
+		{"digicert.example.com", true},
+		// 4 - records that don't restrict issuance
+		{"mail.example.com", false},
+		// 5 - unknown critical properties
+		{"strict.example.com", true},
+		// 6 - parameters and case don't matter
+		{"www.example.net", false},
+		// 7 - no records at all
+		{"example.org", false},
+		// 8 - wildcards use issue without issuewild
+		{"*.example.net", false},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			CAACheck: CAACheck{IssuerDomains: []string{"letsencrypt.org"}, Resolver: resolver},
+		}
+
+		err := m.checkCAA(context.Background(), []string{tt.inHostname})
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+	}
+}
+
+func TestCAAFailsRenewal(t *testing.T) {
+	client := &countingCertificateForDomainer{
+		notBefore: clock.UtcNow(),
+		notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+	}
+	m := CertificateManager{
+		ACMEClient: client,
+		Cache:      newMapCache(),
+		KnownHosts: []string{"foo.example.com"},
+		CAACheck: CAACheck{
+			IssuerDomains: []string{"letsencrypt.org"},
+			Resolver:      mapCAAResolver{"example.com": {{Tag: "issue", Value: "digicert.com"}}},
+		},
+	}
+
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err == nil {
+		t.Fatalf("Expected an error when the CA isn't authorized")
+	}
+	if got, want := client.count, 0; got != want {
+		t.Errorf("Got %v certificates requested, Want: %v", got, want)
+	}
+}
+
+func TestDNSCAAResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected response from ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	// answer every query with a cname and a caa record
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if query.Unpack(buf[:n]) != nil {
+				continue
+			}
+
+			target := dnsmessage.MustNewName("ca.example.net.")
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.Header.ID, Response: true, RecursionAvailable: true},
+				Questions: query.Questions,
+				Answers: []dnsmessage.Resource{
+					{
+						Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET},
+						Body:   &dnsmessage.CNAMEResource{CNAME: target},
+					},
+					{
+						Header: dnsmessage.ResourceHeader{Name: target, Type: dnsTypeCAA, Class: dnsmessage.ClassINET},
+						Body:   &dnsmessage.UnknownResource{Type: dnsTypeCAA, Data: append([]byte{0, 5}, "issueletsencrypt.org"...)},
+					},
+				},
+			}
+			packed, err := response.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	records, err := DNSCAAResolver{Nameserver: conn.LocalAddr().String()}.LookupCAA(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from LookupCAA: %v", err)
+	}
+	if got, want := len(records), 1; got != want {
+		t.Fatalf("Got %v records, Want: %v", got, want)
+	}
+	if got, want := records[0], (CAARecord{Tag: "issue", Value: "letsencrypt.org"}); got != want {
+		t.Errorf("Got record: %+v, Want: %+v", got, want)
+	}
+}
+
+// mapCAAResolver is used in tests to look up CAA records from a map.
+type mapCAAResolver map[string][]CAARecord
+
+func (m mapCAAResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	return m[name], nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// gzipMagic starts every gzip stream, PEM never does.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Compressed is an autocert.Cache that gzip compresses data before it goes to
+// Cache, to cut storage and network cost for backends like DynamoDB and Redis.
+// Uncompressed entries written before Compressed was used are still read and
+// are compressed when they are next written.
+//
+// Compression has to happen before encryption, so wrap Encrypted with
+// Compressed and not the other way around.
+type Compressed struct {
+	Cache autocert.Cache
+
+	// Level is the gzip compression level, defaults to gzip.DefaultCompression.
+	Level int
+}
+
+// Get returns the decompressed data for key.
+func (c *Compressed) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %q: %v", key, err)
+	}
+	defer r.Close()
+
+	data, err = io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %q: %v", key, err)
+	}
+
+	return data, nil
+}
+
+// Put compresses data and writes it to the cache.
+func (c *Compressed) Put(ctx context.Context, key string, data []byte) error {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Cache.Put(ctx, key, buf.Bytes())
+}
+
+// Delete removes key from the cache.
+func (c *Compressed) Delete(ctx context.Context, key string) error {
+	return c.Cache.Delete(ctx, key)
+}
+
+// List returns the keys of the cache, if it implements Lister.
+func (c *Compressed) List(ctx context.Context) ([]string, error) {
+	return List(ctx, c.Cache)
+}
+
+// Watch returns the changes of the cache, if it can be watched.
+func (c *Compressed) Watch(ctx context.Context) <-chan KeyEvent {
+	return watchAll(ctx, c.Cache)
+}
+
+// Flush flushes the cache, if it holds writes back.
+func (c *Compressed) Flush(ctx context.Context) error {
+	return Flush(ctx, c.Cache)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestCompressed(t *testing.T) {
+	ctx := context.Background()
+	chain := []byte(strings.Repeat(testCertificatePEM, 4))
+
+	tests := []struct {
+		inLevel  int
+		outError bool
+	}{
+		// 0 - default level
+		{0, false},
+		// 1 - best compression
+		{gzip.BestCompression, false},
+		// 2 - invalid level
+		{42, true},
+	}
+
+	for i, tt := range tests {
+		backend := newFlakyCache()
+		c := &Compressed{Cache: backend, Level: tt.inLevel}
+
+		err := c.Put(ctx, "foo.example.com", chain)
+		if got, want := err != nil, tt.outError; got != want {
+			t.Fatalf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if tt.outError {
+			continue
+		}
+
+		// data is smaller in the cache and the same on the way back
+		if got, want := len(backend.get("foo.example.com")) < len(chain), true; got != want {
+			t.Errorf("Test(%v) Got %v compressed bytes for %v bytes", i, len(backend.get("foo.example.com")), len(chain))
+		}
+		data, err := c.Get(ctx, "foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Get: %v", i, err)
+		}
+		if !bytes.Equal(data, chain) {
+			t.Errorf("Test(%v) Got value: %v, Want: %v", i, string(data), string(chain))
+		}
+	}
+
+	// entries written before compression are still read
+	backend := newFlakyCache()
+	backend.Put(ctx, "foo.example.com", chain)
+	c := &Compressed{Cache: backend}
+	data, err := c.Get(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if !bytes.Equal(data, chain) {
+		t.Errorf("Got value: %v, Want: %v", string(data), string(chain))
+	}
+
+	// misses are passed on
+	_, err = c.Get(ctx, "bar.example.com")
+	if got, want := err, autocert.ErrCacheMiss; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// Dir is a hardened replacement for autocert.DirCache that can also be
+// listed. Files are written atomically (to a temporary file that is synced
+// and renamed), only readable by the owner, and the directory is synced after
+// every change. Files written by autocert.DirCache can be read by Dir and
+// vice versa.
+type Dir string
+
+// Get reads data for key from the file key in the directory.
+func (d Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return readFile(d.path(key))
+}
+
+// Put atomically writes data to the file key in the directory.
+func (d Dir) Put(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return writeFile(d.path(key), data, 0600)
+}
+
+// Delete removes the file key from the directory.
+func (d Dir) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return removeFile(d.path(key))
+}
+
+// List returns the names of the files in the directory. A directory that
+// doesn't exist yet is empty.
+func (d Dir) List(ctx context.Context) ([]string, error) {
+	return listFiles(string(d))
+}
+
+func (d Dir) path(key string) string {
+	return filepath.Join(string(d), filepath.Clean("/"+key))
+}
+
+// readFile reads path, a missing file is a cache miss.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, err
+}
+
+// writeFile atomically replaces path with data: data is written to a
+// temporary file in the same directory, synced, and renamed over path, then
+// the directory is synced so the rename survives a crash.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// temporary files start with a dot so they aren't listed
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// removeFile removes path, removing a file that doesn't exist is not an error.
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs the directory entries of dir.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// listFiles returns the names of the files in dir, skipping directories and
+// hidden files like the temporary files of writeFile.
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
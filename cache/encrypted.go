@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// Encrypted is an autocert.Cache that encrypts data with AES-GCM before it
+// goes to Cache and decrypts it on the way back, so private keys are never
+// stored in plaintext on disk or in shared stores.
+//
+// Entries are bound to their cache key, an entry copied to another key fails
+// to decrypt. To rotate keys, set Key to the new key and add the old one to
+// PreviousKeys, entries are re-encrypted with Key when they are next written.
+type Encrypted struct {
+	Cache autocert.Cache
+
+	// Key is the AES key, 16, 24, or 32 bytes for AES-128, AES-192, or
+	// AES-256.
+	Key []byte
+
+	// PreviousKeys are tried when an entry can't be decrypted with Key.
+	PreviousKeys [][]byte
+}
+
+// Get returns the decrypted data for key.
+func (e *Encrypted) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := e.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range append([][]byte{e.Key}, e.PreviousKeys...) {
+		aead, err := newAEAD(k)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < aead.NonceSize() {
+			return nil, fmt.Errorf("unable to decrypt %q: data too short", key)
+		}
+
+		plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(key))
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to decrypt %q: no key matches", key)
+}
+
+// Put encrypts data with Key and writes it to the cache.
+func (e *Encrypted) Put(ctx context.Context, key string, data []byte) error {
+	aead, err := newAEAD(e.Key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	return e.Cache.Put(ctx, key, aead.Seal(nonce, nonce, data, []byte(key)))
+}
+
+// Delete removes key from the cache.
+func (e *Encrypted) Delete(ctx context.Context, key string) error {
+	return e.Cache.Delete(ctx, key)
+}
+
+// List returns the keys of the cache, if it implements Lister.
+func (e *Encrypted) List(ctx context.Context) ([]string, error) {
+	return List(ctx, e.Cache)
+}
+
+// Watch returns the changes of the cache, if it can be watched.
+func (e *Encrypted) Watch(ctx context.Context) <-chan KeyEvent {
+	return watchAll(ctx, e.Cache)
+}
+
+// Flush flushes the cache, if it holds writes back.
+func (e *Encrypted) Flush(ctx context.Context) error {
+	return Flush(ctx, e.Cache)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
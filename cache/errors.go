@@ -0,0 +1,9 @@
+package cache
+
+import (
+	"errors"
+)
+
+var (
+	errUnavailable = errors.New("cache unavailable")
+)
@@ -0,0 +1,314 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultRetryInterval    = 1 * time.Minute
+	resyncTimeout           = 10 * time.Second
+)
+
+// Failover is an autocert.Cache that uses a primary cache (for example S3 or
+// etcd in one region) and fails over to a secondary cache (in a different
+// region) after sustained errors, so a regional outage doesn't block issuance
+// or cold-start serving.
+//
+// Writes go to both caches so the secondary is always warm. While failed
+// over, the primary is retried every RetryInterval. Keys the primary missed
+// are copied back to it in the background the next time it answers.
+// Failover must be used as a pointer.
+type Failover struct {
+	Primary   autocert.Cache
+	Secondary autocert.Cache
+
+	// FailureThreshold is the number of consecutive primary errors after
+	// which Failover switches to the secondary cache, defaults to 3.
+	FailureThreshold int
+
+	// RetryInterval is how often the primary is retried while failed over,
+	// defaults to 1 minute.
+	RetryInterval time.Duration
+
+	mu         sync.Mutex
+	failures   int                 // consecutive primary errors
+	failedOver bool                // true if we are using the secondary
+	retryAt    time.Time           // when to try the primary again
+	dirty      map[string]bool     // keys the primary missed
+	resyncing  bool                // true while a background re-sync is running
+	keyLocks   map[string]*keyLock // serialize writes and re-syncs of a key
+}
+
+// keyLock is held while a key is written or re-synced, users counts the
+// goroutines holding or waiting for it.
+type keyLock struct {
+	sync.Mutex
+	users int
+}
+
+// Get returns data for key from the primary cache, or from the secondary if
+// the primary is unavailable or doesn't have the latest data yet.
+func (f *Failover) Get(ctx context.Context, key string) ([]byte, error) {
+	if f.usePrimary() && !f.isDirty(key) {
+		data, err := f.Primary.Get(ctx, key)
+		if err == nil || err == autocert.ErrCacheMiss {
+			f.primarySucceeded()
+			return data, err
+		}
+		f.primaryFailed(err)
+	}
+
+	return f.Secondary.Get(ctx, key)
+}
+
+// Put writes data to both caches. It only fails if neither cache could be written.
+func (f *Failover) Put(ctx context.Context, key string, data []byte) error {
+	return f.write(key, func(c autocert.Cache) error {
+		return c.Put(ctx, key, data)
+	})
+}
+
+// Delete removes key from both caches. It only fails if neither cache could be written.
+func (f *Failover) Delete(ctx context.Context, key string) error {
+	return f.write(key, func(c autocert.Cache) error {
+		return c.Delete(ctx, key)
+	})
+}
+
+// List returns the keys of the primary cache, or of the secondary if the
+// primary is unavailable. Both have to implement Lister.
+func (f *Failover) List(ctx context.Context) ([]string, error) {
+	if f.usePrimary() {
+		keys, err := List(ctx, f.Primary)
+		if err == nil {
+			f.primarySucceeded()
+			return keys, nil
+		}
+		if err == ErrNotListable {
+			return nil, err
+		}
+		f.primaryFailed(err)
+	}
+
+	return List(ctx, f.Secondary)
+}
+
+// Watch returns the changes of both caches, if they can be watched.
+func (f *Failover) Watch(ctx context.Context) <-chan KeyEvent {
+	return watchAll(ctx, f.Primary, f.Secondary)
+}
+
+// Flush flushes both caches if they hold writes back, and re-syncs keys that
+// changed while the primary was unavailable, if it is available again. It
+// fails if keys are left that the primary doesn't have.
+func (f *Failover) Flush(ctx context.Context) error {
+	flushErr := flushAll(ctx, f.Primary, f.Secondary)
+
+	f.mu.Lock()
+	dirty := len(f.dirty)
+	f.mu.Unlock()
+
+	if dirty > 0 && f.usePrimary() {
+		f.resync()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.dirty) > 0 {
+		return fmt.Errorf("%v keys not synced to primary cache", len(f.dirty))
+	}
+	return flushErr
+}
+
+// write performs op against both caches, keys that could not be written to
+// the primary are marked dirty so they are re-synced once it recovers, and
+// keys it did write are up to date again.
+func (f *Failover) write(key string, op func(c autocert.Cache) error) error {
+	unlock := f.lockKey(key)
+	defer unlock()
+
+	primaryErr := errUnavailable
+	if f.usePrimary() {
+		primaryErr = op(f.Primary)
+		if primaryErr == nil {
+			f.markClean(key)
+			f.primarySucceeded()
+		} else {
+			f.primaryFailed(primaryErr)
+		}
+	}
+	if primaryErr != nil {
+		f.markDirty(key)
+	}
+
+	secondaryErr := op(f.Secondary)
+	if secondaryErr != nil && primaryErr != nil {
+		return secondaryErr
+	}
+
+	return nil
+}
+
+// usePrimary returns true if requests should be sent to the primary cache.
+func (f *Failover) usePrimary() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return !f.failedOver || !time.Now().Before(f.retryAt)
+}
+
+// primarySucceeded resets the error count, switches back to the primary if
+// we were failed over and starts re-syncing keys it missed, if any.
+func (f *Failover) primarySucceeded() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = 0
+	if f.failedOver {
+		log.Infof("primary cache recovered, re-syncing %v keys", len(f.dirty))
+		f.failedOver = false
+	}
+
+	// a single failed write doesn't fail over, so keys can be dirty while
+	// we never left the primary
+	if len(f.dirty) == 0 || f.resyncing {
+		return
+	}
+	f.resyncing = true
+
+	go func() {
+		f.resync()
+
+		f.mu.Lock()
+		f.resyncing = false
+		f.mu.Unlock()
+	}()
+}
+
+// primaryFailed records a primary error and fails over once FailureThreshold is reached.
+func (f *Failover) primaryFailed(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	threshold := f.FailureThreshold
+	if threshold == 0 {
+		threshold = defaultFailureThreshold
+	}
+	interval := f.RetryInterval
+	if interval == 0 {
+		interval = defaultRetryInterval
+	}
+
+	f.failures = f.failures + 1
+	if f.failures >= threshold {
+		if !f.failedOver {
+			log.Errorf("failing over to secondary cache after %v consecutive errors: %v", f.failures, err)
+		}
+		f.failedOver = true
+		f.retryAt = time.Now().Add(interval)
+	}
+}
+
+func (f *Failover) markDirty(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dirty == nil {
+		f.dirty = make(map[string]bool)
+	}
+	f.dirty[key] = true
+}
+
+func (f *Failover) markClean(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.dirty, key)
+}
+
+func (f *Failover) isDirty(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.dirty[key]
+}
+
+// lockKey locks key against concurrent writes and re-syncs, so a re-sync
+// can't copy data to the primary that a write has replaced in the meantime.
+func (f *Failover) lockKey(key string) (unlock func()) {
+	f.mu.Lock()
+	if f.keyLocks == nil {
+		f.keyLocks = make(map[string]*keyLock)
+	}
+	l, ok := f.keyLocks[key]
+	if !ok {
+		l = &keyLock{}
+		f.keyLocks[key] = l
+	}
+	l.users = l.users + 1
+	f.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		f.mu.Lock()
+		l.users = l.users - 1
+		if l.users == 0 {
+			delete(f.keyLocks, key)
+		}
+		f.mu.Unlock()
+	}
+}
+
+// resync copies keys that changed while the primary was unavailable from the
+// secondary back to the primary. Keys that can't be copied stay dirty and are
+// retried the next time the primary succeeds.
+func (f *Failover) resync() {
+	f.mu.Lock()
+	var keys []string
+	for key := range f.dirty {
+		keys = append(keys, key)
+	}
+	f.mu.Unlock()
+
+	for _, key := range keys {
+		f.resyncKey(key)
+	}
+}
+
+// resyncKey copies key from the secondary to the primary and marks it clean,
+// unless it was written to the primary since it was marked dirty.
+func (f *Failover) resyncKey(key string) {
+	unlock := f.lockKey(key)
+	defer unlock()
+
+	if !f.isDirty(key) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resyncTimeout)
+	defer cancel()
+
+	data, err := f.Secondary.Get(ctx, key)
+	if err == autocert.ErrCacheMiss {
+		err = f.Primary.Delete(ctx, key)
+	} else if err == nil {
+		err = f.Primary.Put(ctx, key, data)
+	}
+	if err != nil {
+		log.Errorf("unable to re-sync %q to primary cache: %v", key, err)
+		return
+	}
+
+	f.markClean(key)
+}
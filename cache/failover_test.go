@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFlakyCache()
+	secondary := newFlakyCache()
+	f := &Failover{
+		Primary:          primary,
+		Secondary:        secondary,
+		FailureThreshold: 2,
+		RetryInterval:    10 * time.Millisecond,
+	}
+
+	// writes go to both caches
+	err := f.Put(ctx, "foo.example.com", []byte("1"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	if got, want := string(primary.m["foo.example.com"]), "1"; got != want {
+		t.Errorf("Got primary value: %v, Want: %v", got, want)
+	}
+	if got, want := string(secondary.m["foo.example.com"]), "1"; got != want {
+		t.Errorf("Got secondary value: %v, Want: %v", got, want)
+	}
+
+	// the primary goes down, reads and writes keep working
+	primary.setDown(true)
+	for i := 0; i < 2; i++ {
+		data, err := f.Get(ctx, "foo.example.com")
+		if err != nil {
+			t.Fatalf("Unexpected response from Get: %v", err)
+		}
+		if got, want := string(data), "1"; got != want {
+			t.Errorf("Got value: %v, Want: %v", got, want)
+		}
+	}
+	err = f.Put(ctx, "foo.example.com", []byte("2"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	err = f.Put(ctx, "bar.example.com", []byte("3"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+
+	// we should be failed over so the primary isn't even tried anymore
+	calls := primary.callCount()
+	f.Get(ctx, "foo.example.com")
+	if got, want := primary.callCount(), calls; got != want {
+		t.Errorf("Got %v calls to primary, Want: %v", got, want)
+	}
+
+	// the primary recovers, after the retry interval it's used again and
+	// re-synced in the background
+	primary.setDown(false)
+	time.Sleep(20 * time.Millisecond)
+
+	data, err := f.Get(ctx, "baz.example.com")
+	if err != autocert.ErrCacheMiss {
+		t.Fatalf("Got %v %v from Get, Want: %v", string(data), err, autocert.ErrCacheMiss)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if got, want := string(primary.get("foo.example.com")), "2"; got != want {
+		t.Errorf("Got re-synced primary value: %v, Want: %v", got, want)
+	}
+	if got, want := string(primary.get("bar.example.com")), "3"; got != want {
+		t.Errorf("Got re-synced primary value: %v, Want: %v", got, want)
+	}
+}
+
+func TestFailoverBothDown(t *testing.T) {
+	primary := newFlakyCache()
+	secondary := newFlakyCache()
+	primary.setDown(true)
+	secondary.setDown(true)
+
+	f := &Failover{Primary: primary, Secondary: secondary}
+	err := f.Put(context.Background(), "foo.example.com", []byte("1"))
+	if err == nil {
+		t.Errorf("Expected an error when both caches are down")
+	}
+}
+
+func TestFailoverFlush(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFlakyCache()
+	secondary := newFlakyCache()
+	f := &Failover{
+		Primary:          primary,
+		Secondary:        secondary,
+		FailureThreshold: 1,
+		RetryInterval:    10 * time.Millisecond,
+	}
+
+	// nothing to flush
+	err := f.Flush(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected response from Flush: %v", err)
+	}
+
+	// a write the primary missed can't be flushed while it's down
+	primary.setDown(true)
+	f.Put(ctx, "foo.example.com", []byte("1"))
+	time.Sleep(20 * time.Millisecond)
+	err = f.Flush(ctx)
+	if err == nil {
+		t.Errorf("Expected Flush to fail with the primary down")
+	}
+
+	// but once it's back
+	primary.setDown(false)
+	time.Sleep(20 * time.Millisecond)
+	err = f.Flush(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected response from Flush: %v", err)
+	}
+	if got, want := string(primary.get("foo.example.com")), "1"; got != want {
+		t.Errorf("Got flushed primary value: %v, Want: %v", got, want)
+	}
+}
+
+func TestFailoverFlushWrapped(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFlakyCache()
+	secondary := newFlakyCache()
+	failover := &Failover{
+		Primary:          primary,
+		Secondary:        secondary,
+		FailureThreshold: 1,
+		RetryInterval:    10 * time.Millisecond,
+	}
+
+	tests := []struct {
+		inCache autocert.Cache
+	}{
+		// 0 - encrypted
+		{&Encrypted{Cache: failover, Key: make([]byte, 32)}},
+		// 1 - compressed and encrypted
+		{&Compressed{Cache: &Encrypted{Cache: failover, Key: make([]byte, 32)}}},
+		// 2 - durable cache of tiered
+		{&Tiered{Fast: &Memory{}, Durable: failover}},
+		// 3 - one of the caches of a multi writer
+		{&MultiWriter{Caches: []autocert.Cache{&Memory{}, failover}}},
+	}
+
+	for i, tt := range tests {
+		key := fmt.Sprintf("foo%v.example.com", i)
+
+		// a write the primary missed
+		primary.setDown(true)
+		tt.inCache.Put(ctx, key, []byte("1"))
+		primary.setDown(false)
+		time.Sleep(20 * time.Millisecond)
+
+		// is synced when the wrapping cache is flushed
+		err := Flush(ctx, tt.inCache)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Flush: %v", i, err)
+		}
+		if primary.get(key) == nil {
+			t.Errorf("Test(%v) Got no flushed primary value", i)
+		}
+	}
+}
+
+func TestFailoverDirty(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFlakyCache()
+	secondary := newFlakyCache()
+	f := &Failover{
+		Primary:          primary,
+		Secondary:        secondary,
+		FailureThreshold: 3,
+		RetryInterval:    time.Minute,
+	}
+
+	// a single failed write doesn't fail over, but the key is dirty
+	primary.setDown(true)
+	f.Put(ctx, "foo.example.com", []byte("1"))
+	f.Put(ctx, "bar.example.com", []byte("1"))
+	primary.setDown(false)
+	if !f.isDirty("foo.example.com") || !f.isDirty("bar.example.com") {
+		t.Fatalf("Expected keys the primary missed to be dirty")
+	}
+
+	// writing the key to the primary again makes it clean
+	err := f.Put(ctx, "foo.example.com", []byte("2"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	if f.isDirty("foo.example.com") {
+		t.Errorf("Expected key written to the primary to be clean")
+	}
+
+	// and the success re-syncs the other dirty keys, without failing over first
+	deadline := time.Now().Add(5 * time.Second)
+	for f.isDirty("bar.example.com") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := string(primary.get("bar.example.com")), "1"; got != want {
+		t.Errorf("Got re-synced primary value: %v, Want: %v", got, want)
+	}
+	if got, want := string(primary.get("foo.example.com")), "2"; got != want {
+		t.Errorf("Got primary value: %v, Want: %v", got, want)
+	}
+}
+
+func TestFailoverResyncRace(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFlakyCache()
+	secondary := &gatedCache{Cache: newFlakyCache(), started: make(chan bool, 1), release: make(chan bool)}
+	f := &Failover{Primary: primary, Secondary: secondary}
+
+	// the primary misses a write
+	primary.setDown(true)
+	f.Put(ctx, "foo.example.com", []byte("1"))
+	primary.setDown(false)
+
+	// the re-sync reads the old value from the secondary
+	secondary.gate(true)
+	resynced := make(chan bool)
+	go func() {
+		f.resync()
+		close(resynced)
+	}()
+	<-secondary.started
+
+	// while the key is written again
+	written := make(chan error)
+	go func() {
+		written <- f.Put(ctx, "foo.example.com", []byte("2"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	secondary.gate(false)
+	close(secondary.release)
+
+	<-resynced
+	err := <-written
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+
+	// the re-sync doesn't overwrite the newer value
+	if got, want := string(primary.get("foo.example.com")), "2"; got != want {
+		t.Errorf("Got primary value: %v, Want: %v", got, want)
+	}
+	if f.isDirty("foo.example.com") {
+		t.Errorf("Expected key to be clean")
+	}
+}
+
+// gatedCache is used in tests to pause reads, while gated Get signals started
+// after reading and waits for release before returning.
+type gatedCache struct {
+	autocert.Cache
+
+	mu      sync.Mutex
+	gated   bool
+	started chan bool
+	release chan bool
+}
+
+func (c *gatedCache) gate(gated bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gated = gated
+}
+
+func (c *gatedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	gated := c.gated
+	c.mu.Unlock()
+
+	data, err := c.Cache.Get(ctx, key)
+	if gated {
+		c.started <- true
+		<-c.release
+	}
+	return data, err
+}
+
+// flakyCache is used in tests as an in-memory autocert.Cache that can be taken down.
+type flakyCache struct {
+	sync.Mutex
+	m     map[string][]byte
+	down  bool
+	calls int
+}
+
+func newFlakyCache() *flakyCache {
+	return &flakyCache{m: make(map[string][]byte)}
+}
+
+func (c *flakyCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.calls = c.calls + 1
+	if c.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	data, ok := c.m[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *flakyCache) Put(ctx context.Context, key string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.calls = c.calls + 1
+	if c.down {
+		return fmt.Errorf("connection refused")
+	}
+	c.m[key] = data
+	return nil
+}
+
+func (c *flakyCache) Delete(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.calls = c.calls + 1
+	if c.down {
+		return fmt.Errorf("connection refused")
+	}
+	delete(c.m, key)
+	return nil
+}
+
+func (c *flakyCache) setDown(down bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.down = down
+}
+
+func (c *flakyCache) callCount() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.calls
+}
+
+func (c *flakyCache) get(key string) []byte {
+	c.Lock()
+	defer c.Unlock()
+	return c.m[key]
+}
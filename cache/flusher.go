@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// Flusher is implemented by caches that hold writes back, like Failover
+// while the primary is unavailable. Caches that wrap other caches implement
+// it by flushing those. roman.CertificateManager flushes its caches when it's
+// stopped.
+type Flusher interface {
+	// Flush writes pending changes to the backing store.
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes c if it implements Flusher, other caches have nothing to
+// flush.
+func Flush(ctx context.Context, c autocert.Cache) error {
+	f, ok := c.(Flusher)
+	if !ok {
+		return nil
+	}
+
+	return f.Flush(ctx)
+}
+
+// flushAll flushes all caches, it returns the first error but flushes the
+// remaining caches anyway.
+func flushAll(ctx context.Context, caches ...autocert.Cache) error {
+	var firstErr error
+	for _, c := range caches {
+		err := Flush(ctx, c)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
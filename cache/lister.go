@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// ErrNotListable is returned by List for caches that don't implement Lister.
+var ErrNotListable = errors.New("cache can't be listed")
+
+// Lister is implemented by caches that can enumerate their keys.
+type Lister interface {
+	// List returns all keys in the cache, in no particular order.
+	List(ctx context.Context) ([]string, error)
+}
+
+// List returns the keys of c if it implements Lister, ErrNotListable
+// otherwise.
+func List(ctx context.Context, c autocert.Cache) ([]string, error) {
+	l, ok := c.(Lister)
+	if !ok {
+		return nil, ErrNotListable
+	}
+
+	return l.List(ctx)
+}
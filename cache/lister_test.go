@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+
+	memory := &Memory{}
+	memory.Put(ctx, "bar.example.com", []byte("2"))
+
+	tests := []struct {
+		inCache autocert.Cache
+		outKeys string
+		outErr  error
+	}{
+		// 0 - directory
+		{Dir(dir), "[acme_account+key foo.example.com]", nil},
+		// 1 - directory that doesn't exist yet
+		{Dir(filepath.Join(dir, "missing")), "[]", nil},
+		// 2 - memory
+		{memory, "[bar.example.com]", nil},
+		// 3 - decorators list what they wrap
+		{&Encrypted{Cache: Dir(dir)}, "[acme_account+key foo.example.com]", nil},
+		// 4 - tiered lists the durable cache
+		{&Tiered{Fast: &Memory{}, Durable: Dir(dir)}, "[acme_account+key foo.example.com]", nil},
+		// 5 - multi writer lists the union
+		{&MultiWriter{Caches: []autocert.Cache{Dir(dir), memory, newFlakyCache()}}, "[acme_account+key bar.example.com foo.example.com]", nil},
+		// 6 - caches that don't implement lister
+		{autocert.DirCache(dir), "[]", ErrNotListable},
+		// 7 - decorators of caches that don't implement lister
+		{&Tiered{Fast: &Memory{}, Durable: newFlakyCache()}, "[]", ErrNotListable},
+	}
+
+	// written by autocert, read by dir
+	autocert.DirCache(dir).Put(ctx, "foo.example.com", []byte("1"))
+	autocert.DirCache(dir).Put(ctx, "acme_account+key", []byte("1"))
+	os.Mkdir(filepath.Join(dir, "subdirectory"), 0700)
+
+	for i, tt := range tests {
+		keys, err := List(ctx, tt.inCache)
+		if got, want := err, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, got, want)
+		}
+		sort.Strings(keys)
+		if got, want := fmt.Sprint(keys), tt.outKeys; got != want {
+			t.Errorf("Test(%v) Got keys: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+const (
+	// watchBuffer is how many events a watcher of Memory can fall behind
+	// before events are dropped.
+	watchBuffer = 100
+)
+
+// Memory is an in-memory autocert.Cache, typically used as the Fast cache of
+// a Tiered cache. Memory must be used as a pointer.
+type Memory struct {
+	mu       sync.RWMutex
+	m        map[string][]byte
+	watchers map[chan KeyEvent]bool
+}
+
+// Get returns data for key, or autocert.ErrCacheMiss if there is none.
+func (c *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data, ok := c.m[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+// Put stores data for key.
+func (c *Memory) Put(ctx context.Context, key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.m == nil {
+		c.m = make(map[string][]byte)
+	}
+	c.m[key] = data
+	c.notify(KeyEvent{Key: key})
+	return nil
+}
+
+// Delete removes key.
+func (c *Memory) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.m, key)
+	c.notify(KeyEvent{Key: key, Deleted: true})
+	return nil
+}
+
+// List returns all keys.
+func (c *Memory) List(ctx context.Context) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var keys []string
+	for key := range c.m {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Watch returns a channel of changes until ctx is done. Events are dropped
+// for watchers that fall more than 100 events behind.
+func (c *Memory) Watch(ctx context.Context) <-chan KeyEvent {
+	events := make(chan KeyEvent, watchBuffer)
+
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = make(map[chan KeyEvent]bool)
+	}
+	c.watchers[events] = true
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		delete(c.watchers, events)
+		close(events)
+		c.mu.Unlock()
+	}()
+
+	return events
+}
+
+// notify sends event to all watchers without blocking, the caller must hold
+// the write lock.
+func (c *Memory) notify(event KeyEvent) {
+	for events := range c.watchers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
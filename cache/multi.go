@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// MultiWriter is an autocert.Cache that writes to all of Caches (for example
+// a local directory and S3) and reads from the first one that has the key,
+// so it keeps working while some of them are down.
+//
+// Keys that could not be written to a cache are not read from it until they
+// are written to it again, so a cache that was down doesn't serve stale data.
+// This is only tracked in memory. MultiWriter must be used as a pointer.
+type MultiWriter struct {
+	Caches []autocert.Cache
+
+	mu    sync.Mutex
+	stale map[int]map[string]bool // keys per cache that missed a write
+}
+
+// Get returns data for key from the first cache that has it. If no cache has
+// it, autocert.ErrCacheMiss is returned, unless a cache failed, then its
+// error is returned since that cache might have had it.
+func (m *MultiWriter) Get(ctx context.Context, key string) ([]byte, error) {
+	var lastErr error
+
+	for i, c := range m.Caches {
+		if m.isStale(i, key) {
+			continue
+		}
+
+		data, err := c.Get(ctx, key)
+		if err == nil {
+			return data, nil
+		}
+		if err != autocert.ErrCacheMiss {
+			log.Warningf("unable to get %q from cache: %v", key, err)
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, autocert.ErrCacheMiss
+}
+
+// List returns the keys of all caches. Caches that are down or can't be
+// listed are skipped, it only fails if no cache could be listed.
+func (m *MultiWriter) List(ctx context.Context) ([]string, error) {
+	lastErr := ErrNotListable
+	succeeded := false
+
+	seen := make(map[string]bool)
+	var keys []string
+
+	for _, c := range m.Caches {
+		cacheKeys, err := List(ctx, c)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		succeeded = true
+
+		for _, key := range cacheKeys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if !succeeded {
+		return nil, lastErr
+	}
+	return keys, nil
+}
+
+// Watch returns the changes of all caches that can be watched.
+func (m *MultiWriter) Watch(ctx context.Context) <-chan KeyEvent {
+	return watchAll(ctx, m.Caches...)
+}
+
+// Flush flushes all caches that hold writes back.
+func (m *MultiWriter) Flush(ctx context.Context) error {
+	return flushAll(ctx, m.Caches...)
+}
+
+// Put writes data to all caches. It only fails if no cache could be written.
+func (m *MultiWriter) Put(ctx context.Context, key string, data []byte) error {
+	return m.write(key, func(c autocert.Cache) error {
+		return c.Put(ctx, key, data)
+	})
+}
+
+// Delete removes key from all caches. It only fails if no cache could be written.
+func (m *MultiWriter) Delete(ctx context.Context, key string) error {
+	return m.write(key, func(c autocert.Cache) error {
+		return c.Delete(ctx, key)
+	})
+}
+
+// write performs op against all caches and returns the last error if it
+// failed everywhere.
+func (m *MultiWriter) write(key string, op func(c autocert.Cache) error) error {
+	if len(m.Caches) == 0 {
+		return errUnavailable
+	}
+
+	var lastErr error
+	succeeded := false
+
+	for i, c := range m.Caches {
+		err := op(c)
+		if err != nil {
+			log.Warningf("unable to write %q to cache: %v", key, err)
+			m.setStale(i, key, true)
+			lastErr = err
+			continue
+		}
+		m.setStale(i, key, false)
+		succeeded = true
+	}
+
+	if !succeeded {
+		return lastErr
+	}
+	return nil
+}
+
+func (m *MultiWriter) setStale(i int, key string, stale bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !stale {
+		delete(m.stale[i], key)
+		return
+	}
+
+	if m.stale == nil {
+		m.stale = make(map[int]map[string]bool)
+	}
+	if m.stale[i] == nil {
+		m.stale[i] = make(map[string]bool)
+	}
+	m.stale[i][key] = true
+}
+
+func (m *MultiWriter) isStale(i int, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stale[i][key]
+}
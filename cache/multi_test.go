@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestMultiWriter(t *testing.T) {
+	ctx := context.Background()
+
+	first := newFlakyCache()
+	second := newFlakyCache()
+	m := &MultiWriter{Caches: []autocert.Cache{first, second}}
+
+	// writes go to all caches
+	err := m.Put(ctx, "foo.example.com", []byte("1"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	for i, c := range []*flakyCache{first, second} {
+		if got, want := string(c.get("foo.example.com")), "1"; got != want {
+			t.Errorf("Test(%v) Got value: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// reads are served by the first cache that has the key
+	second.Put(ctx, "bar.example.com", []byte("2"))
+	data, err := m.Get(ctx, "bar.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "2"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+
+	// one cache being down doesn't matter
+	first.setDown(true)
+	err = m.Put(ctx, "foo.example.com", []byte("3"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	data, err = m.Get(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "3"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+
+	// a miss while a cache is down is not a miss, the key might be there
+	_, err = m.Get(ctx, "baz.example.com")
+	if err == nil || err == autocert.ErrCacheMiss {
+		t.Errorf("Got error: %v, Want cache error", err)
+	}
+
+	// once the first cache is back, it doesn't serve the value it missed
+	first.setDown(false)
+	data, err = m.Get(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "3"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+	first.setDown(true)
+
+	// all caches being down does
+	second.setDown(true)
+	err = m.Put(ctx, "foo.example.com", []byte("4"))
+	if err == nil {
+		t.Errorf("Expected Put to fail with all caches down")
+	}
+	first.setDown(false)
+	second.setDown(false)
+
+	// deletes remove the key from all caches
+	err = m.Delete(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	_, err = m.Get(ctx, "foo.example.com")
+	if got, want := err, autocert.ErrCacheMiss; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
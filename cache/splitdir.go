@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+const (
+	keyFileSuffix         = ".key"
+	certificateFileSuffix = ".crt"
+)
+
+// SplitDir is like Dir but splits PEM encoded entries into a key.key file
+// with the private key, only readable by the owner, and a key.crt file with
+// the certificates, readable by everyone. This way other programs (for
+// example nginx) can use the files directly and certificates can be shared
+// without exposing the keys. Only PEM encoded data can be stored.
+type SplitDir string
+
+// Get returns the private key followed by the certificates of key.
+func (d SplitDir) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	keyBytes, keyErr := readFile(d.path(key) + keyFileSuffix)
+	if keyErr != nil && keyErr != autocert.ErrCacheMiss {
+		return nil, keyErr
+	}
+	certificateBytes, certificateErr := readFile(d.path(key) + certificateFileSuffix)
+	if certificateErr != nil && certificateErr != autocert.ErrCacheMiss {
+		return nil, certificateErr
+	}
+	if keyErr != nil && certificateErr != nil {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return append(keyBytes, certificateBytes...), nil
+}
+
+// Put splits data into private keys and everything else and atomically
+// writes the files of key. The key file is written first, a file without
+// data is removed.
+func (d SplitDir) Put(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	keyBytes, certificateBytes, err := splitPEM(data)
+	if err != nil {
+		return fmt.Errorf("unable to put %q: %v", key, err)
+	}
+
+	err = putOrRemove(d.path(key)+keyFileSuffix, keyBytes, 0600)
+	if err != nil {
+		return err
+	}
+
+	return putOrRemove(d.path(key)+certificateFileSuffix, certificateBytes, 0644)
+}
+
+// Delete removes the files of key.
+func (d SplitDir) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := removeFile(d.path(key) + certificateFileSuffix)
+	if err != nil {
+		return err
+	}
+
+	return removeFile(d.path(key) + keyFileSuffix)
+}
+
+// List returns the keys that have files in the directory.
+func (d SplitDir) List(ctx context.Context) ([]string, error) {
+	names, err := listFiles(string(d))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, name := range names {
+		key := strings.TrimSuffix(strings.TrimSuffix(name, keyFileSuffix), certificateFileSuffix)
+		if key == name || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (d SplitDir) path(key string) string {
+	return filepath.Join(string(d), filepath.Clean("/"+key))
+}
+
+func putOrRemove(path string, data []byte, perm os.FileMode) error {
+	if len(data) == 0 {
+		return removeFile(path)
+	}
+	return writeFile(path, data, perm)
+}
+
+// splitPEM splits PEM encoded data into the private key blocks and all other
+// blocks.
+func splitPEM(data []byte) ([]byte, []byte, error) {
+	var keyBuf, otherBuf bytes.Buffer
+
+	rest := data
+	for len(bytes.TrimSpace(rest)) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, nil, fmt.Errorf("data is not PEM encoded")
+		}
+
+		buf := &otherBuf
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			buf = &keyBuf
+		}
+		err := pem.Encode(buf, block)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return keyBuf.Bytes(), otherBuf.Bytes(), nil
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// SQLDialect is the flavor of SQL spoken by the database of an SQL cache.
+type SQLDialect int
+
+const (
+	Postgres SQLDialect = iota
+	MySQL
+)
+
+const (
+	defaultSQLWatchInterval = 30 * time.Second
+)
+
+const (
+	// PostgresSchema creates the certificates table for Postgres.
+	PostgresSchema = `CREATE TABLE IF NOT EXISTS certificates (
+	name       VARCHAR(255) PRIMARY KEY,
+	data       BYTEA NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`
+
+	// MySQLSchema creates the certificates table for MySQL.
+	MySQLSchema = `CREATE TABLE IF NOT EXISTS certificates (
+	name       VARCHAR(255) PRIMARY KEY,
+	data       MEDIUMBLOB NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`
+)
+
+// SQL is an autocert.Cache that stores data in the certificates table of a
+// relational database, for deployments whose only shared durable store is
+// one. The caller registers the database driver and opens DB, the table can
+// be created with CreateTable or with PostgresSchema or MySQLSchema.
+type SQL struct {
+	DB      *sql.DB
+	Dialect SQLDialect
+
+	// WatchInterval is how often Watch polls the table for changes, defaults
+	// to 30 seconds.
+	WatchInterval time.Duration
+}
+
+// CreateTable creates the certificates table if it doesn't exist yet.
+func (s *SQL) CreateTable(ctx context.Context) error {
+	schema := PostgresSchema
+	if s.Dialect == MySQL {
+		schema = MySQLSchema
+	}
+
+	_, err := s.DB.ExecContext(ctx, schema)
+	return err
+}
+
+// Get returns data for key, or autocert.ErrCacheMiss if there is none.
+func (s *SQL) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.DB.QueryRowContext(ctx, s.query("SELECT data FROM certificates WHERE name = ?"), key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %q: %v", key, err)
+	}
+
+	return data, nil
+}
+
+// Put inserts data for key or replaces the existing data.
+func (s *SQL) Put(ctx context.Context, key string, data []byte) error {
+	query := "INSERT INTO certificates (name, data, updated_at) VALUES (?, ?, ?) " +
+		"ON CONFLICT (name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at"
+	if s.Dialect == MySQL {
+		query = "INSERT INTO certificates (name, data, updated_at) VALUES (?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE data = VALUES(data), updated_at = VALUES(updated_at)"
+	}
+
+	_, err := s.DB.ExecContext(ctx, s.query(query), key, data, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("unable to put %q: %v", key, err)
+	}
+
+	return nil
+}
+
+// Delete removes key, deleting a key that doesn't exist is not an error.
+func (s *SQL) Delete(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, s.query("DELETE FROM certificates WHERE name = ?"), key)
+	if err != nil {
+		return fmt.Errorf("unable to delete %q: %v", key, err)
+	}
+
+	return nil
+}
+
+// List returns all keys in the certificates table.
+func (s *SQL) List(ctx context.Context) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT name FROM certificates")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list keys: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list keys: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Watch polls the table every WatchInterval and returns the keys that were
+// put or deleted after Watch was called, by any process. The watch ends when
+// the table can't be read.
+func (s *SQL) Watch(ctx context.Context) <-chan KeyEvent {
+	interval := s.WatchInterval
+	if interval == 0 {
+		interval = defaultSQLWatchInterval
+	}
+
+	events := make(chan KeyEvent)
+
+	last, err := s.updatedAt(ctx)
+	if err != nil {
+		log.Warningf("unable to watch certificates table: %v", err)
+		close(events)
+		return events
+	}
+
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+
+			current, err := s.updatedAt(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warningf("unable to watch certificates table: %v", err)
+				}
+				return
+			}
+
+			for _, event := range changes(last, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			last = current
+		}
+	}()
+
+	return events
+}
+
+// updatedAt returns when each key in the certificates table was last put.
+func (s *SQL) updatedAt(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT name, updated_at FROM certificates")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updated := make(map[string]time.Time)
+	for rows.Next() {
+		var key string
+		var updatedAt time.Time
+		err = rows.Scan(&key, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		updated[key] = updatedAt
+	}
+
+	return updated, rows.Err()
+}
+
+// changes returns the events that turn the table from last into current.
+func changes(last map[string]time.Time, current map[string]time.Time) []KeyEvent {
+	var events []KeyEvent
+	for key, updatedAt := range current {
+		previous, ok := last[key]
+		if !ok || !previous.Equal(updatedAt) {
+			events = append(events, KeyEvent{Key: key})
+		}
+	}
+	for key := range last {
+		if _, ok := current[key]; !ok {
+			events = append(events, KeyEvent{Key: key, Deleted: true})
+		}
+	}
+
+	return events
+}
+
+// query rewrites the ? placeholders of q to the $1, $2, ... form Postgres
+// uses. The queries in this file don't have literal question marks.
+func (s *SQL) query(q string) string {
+	if s.Dialect == MySQL {
+		return q
+	}
+
+	var rewritten []byte
+	n := 0
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			rewritten = append(rewritten, q[i])
+			continue
+		}
+		n = n + 1
+		rewritten = append(rewritten, fmt.Sprintf("$%v", n)...)
+	}
+
+	return string(rewritten)
+}
@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		inDialect SQLDialect
+		outGet    string
+		outPut    string
+		outDelete string
+		outSchema string
+	}{
+		// 0 - postgres
+		{
+			Postgres,
+			"SELECT data FROM certificates WHERE name = $1",
+			"INSERT INTO certificates (name, data, updated_at) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at",
+			"DELETE FROM certificates WHERE name = $1",
+			PostgresSchema,
+		},
+		// 1 - mysql
+		{
+			MySQL,
+			"SELECT data FROM certificates WHERE name = ?",
+			"INSERT INTO certificates (name, data, updated_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), updated_at = VALUES(updated_at)",
+			"DELETE FROM certificates WHERE name = ?",
+			MySQLSchema,
+		},
+	}
+
+	for i, tt := range tests {
+		ctx := context.Background()
+
+		// the driver isn't registered, registering a name twice panics when
+		// the test runs more than once
+		d := &fakeSQLDriver{rows: make(map[string][]byte)}
+		db := sql.OpenDB(d)
+		s := &SQL{DB: db, Dialect: tt.inDialect}
+
+		err := s.CreateTable(ctx)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CreateTable: %v", i, err)
+		}
+
+		// a key that was never written is a cache miss
+		_, err = s.Get(ctx, "foo.example.com")
+		if got, want := err, autocert.ErrCacheMiss; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, got, want)
+		}
+
+		// put inserts and then replaces the data
+		for _, data := range []string{"1", "2"} {
+			err = s.Put(ctx, "foo.example.com", []byte(data))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from Put: %v", i, err)
+			}
+			value, err := s.Get(ctx, "foo.example.com")
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from Get: %v", i, err)
+			}
+			if got, want := string(value), data; got != want {
+				t.Errorf("Test(%v) Got value: %v, Want: %v", i, got, want)
+			}
+		}
+
+		// all keys are listed
+		err = s.Put(ctx, "bar.example.com", []byte("3"))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Put: %v", i, err)
+		}
+		keys, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from List: %v", i, err)
+		}
+		if got, want := fmt.Sprint(keys), "[bar.example.com foo.example.com]"; got != want {
+			t.Errorf("Test(%v) Got keys: %v, Want: %v", i, got, want)
+		}
+
+		// deleted keys are gone, deleting them again is fine
+		for j := 0; j < 2; j++ {
+			err = s.Delete(ctx, "foo.example.com")
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from Delete: %v", i, err)
+			}
+		}
+		_, err = s.Get(ctx, "foo.example.com")
+		if got, want := err, autocert.ErrCacheMiss; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, got, want)
+		}
+
+		// errors from the database are passed on
+		d.setDown(true)
+		_, err = s.Get(ctx, "foo.example.com")
+		if err == nil || err == autocert.ErrCacheMiss {
+			t.Errorf("Test(%v) Got error: %v, Want database error", i, err)
+		}
+		if err := s.Put(ctx, "foo.example.com", []byte("3")); err == nil {
+			t.Errorf("Test(%v) Expected Put to fail", i)
+		}
+
+		queries := d.queryLog()
+		for _, want := range []string{tt.outSchema, tt.outGet, tt.outPut, tt.outDelete} {
+			if !queries[want] {
+				t.Errorf("Test(%v) Query not sent: %v", i, want)
+			}
+		}
+		if got, want := len(queries), 5; got != want {
+			t.Errorf("Test(%v) Got %v different queries, Want: %v", i, got, want)
+		}
+
+		db.Close()
+	}
+}
+
+func TestSQLWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &fakeSQLDriver{rows: make(map[string][]byte)}
+	s := &SQL{DB: sql.OpenDB(d), WatchInterval: 10 * time.Millisecond}
+	defer s.DB.Close()
+
+	err := s.Put(ctx, "foo.example.com", []byte("1"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+
+	events, ok := Watch(ctx, s)
+	if !ok {
+		t.Fatalf("Expected SQL to implement Watcher")
+	}
+
+	// changes are picked up by polling, keys that exist when the watch
+	// starts aren't reported
+	err = s.Put(ctx, "bar.example.com", []byte("1"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	err = s.Delete(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+
+	want := map[KeyEvent]bool{
+		{Key: "bar.example.com"}:                true,
+		{Key: "foo.example.com", Deleted: true}: true,
+	}
+	timeout := time.After(5 * time.Second)
+	for len(want) > 0 {
+		select {
+		case event := <-events:
+			if !want[event] {
+				t.Fatalf("Got unexpected event: %v", event)
+			}
+			delete(want, event)
+		case <-timeout:
+			t.Fatalf("Got no events for: %v", want)
+		}
+	}
+
+	// the watch ends when the table can't be read
+	d.setDown(true)
+	for range events {
+	}
+}
+
+// fakeSQLDriver is an in-memory database/sql driver that understands the
+// queries of the SQL cache.
+type fakeSQLDriver struct {
+	mu      sync.Mutex
+	rows    map[string][]byte
+	updated map[string]time.Time
+	queries map[string]bool
+	down    bool
+}
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	return &fakeSQLConn{d: d}, nil
+}
+
+// Connect and Driver make fakeSQLDriver a driver.Connector for sql.OpenDB.
+func (d *fakeSQLDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *fakeSQLDriver) Driver() driver.Driver {
+	return d
+}
+
+func (d *fakeSQLDriver) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.down = down
+}
+
+func (d *fakeSQLDriver) queryLog() map[string]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.queries
+}
+
+func (d *fakeSQLDriver) run(query string, args []driver.Value) ([][]driver.Value, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if d.queries == nil {
+		d.queries = make(map[string]bool)
+	}
+	d.queries[query] = true
+
+	switch {
+	case strings.HasPrefix(query, "CREATE"):
+		return nil, nil
+	case query == "SELECT name FROM certificates":
+		var names []string
+		for name := range d.rows {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var rows [][]driver.Value
+		for _, name := range names {
+			rows = append(rows, []driver.Value{[]byte(name)})
+		}
+		return rows, nil
+	case query == "SELECT name, updated_at FROM certificates":
+		var rows [][]driver.Value
+		for name, updated := range d.updated {
+			rows = append(rows, []driver.Value{[]byte(name), updated})
+		}
+		return rows, nil
+	case strings.HasPrefix(query, "SELECT"):
+		data, ok := d.rows[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		return [][]driver.Value{{data}}, nil
+	case strings.HasPrefix(query, "INSERT"):
+		if d.updated == nil {
+			d.updated = make(map[string]time.Time)
+		}
+		d.rows[args[0].(string)] = args[1].([]byte)
+		d.updated[args[0].(string)] = args[2].(time.Time)
+		return nil, nil
+	case strings.HasPrefix(query, "DELETE"):
+		delete(d.rows, args[0].(string))
+		delete(d.updated, args[0].(string))
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected query: %v", query)
+	}
+}
+
+type fakeSQLConn struct {
+	d *fakeSQLDriver
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{d: c.d, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions not supported")
+}
+
+type fakeSQLStmt struct {
+	d     *fakeSQLDriver
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, err := s.d.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.d.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeSQLRows{rows: rows}, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	if len(r.rows) > 0 && len(r.rows[0]) == 2 {
+		return []string{"name", "updated_at"}
+	}
+	return []string{"data"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// Tiered is an autocert.Cache that composes a fast cache (Memory, Redis) over
+// a durable cache (S3, a directory). Reads are served by Fast when possible
+// and misses are read from Durable and written back to Fast (read-repair).
+// Writes go to Durable first and then to Fast (write-through), so Durable is
+// always the source of truth and Fast can be lost at any time. A write that
+// couldn't reach Fast can leave stale data there, so give shared fast caches
+// like Redis an expiry.
+type Tiered struct {
+	Fast    autocert.Cache
+	Durable autocert.Cache
+}
+
+// Get returns data for key from Fast, or from Durable if Fast doesn't have
+// it or is unavailable.
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := t.Fast.Get(ctx, key)
+	if err == nil {
+		return data, nil
+	}
+	if err != autocert.ErrCacheMiss {
+		log.Warningf("unable to get %q from fast cache: %v", key, err)
+	}
+
+	data, err = t.Durable.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// read-repair, the next read is served by the fast cache
+	err = t.Fast.Put(ctx, key, data)
+	if err != nil {
+		log.Warningf("unable to put %q in fast cache: %v", key, err)
+	}
+
+	return data, nil
+}
+
+// Put writes data to Durable and then to Fast. It fails if Durable could not
+// be written, if only Fast fails the key is removed from it so it doesn't
+// serve stale data.
+func (t *Tiered) Put(ctx context.Context, key string, data []byte) error {
+	err := t.Durable.Put(ctx, key, data)
+	if err != nil {
+		return err
+	}
+
+	err = t.Fast.Put(ctx, key, data)
+	if err != nil {
+		log.Warningf("unable to put %q in fast cache: %v", key, err)
+		t.Fast.Delete(ctx, key)
+	}
+
+	return nil
+}
+
+// Delete removes key from both caches.
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	err := t.Durable.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return t.Fast.Delete(ctx, key)
+}
+
+// List returns the keys of Durable, if it implements Lister.
+func (t *Tiered) List(ctx context.Context) ([]string, error) {
+	return List(ctx, t.Durable)
+}
+
+// Watch returns the changes of Durable, if it can be watched. Changed keys
+// are removed from Fast first, so reading them after an event doesn't return
+// what Fast had before.
+func (t *Tiered) Watch(ctx context.Context) <-chan KeyEvent {
+	durable, ok := Watch(ctx, t.Durable)
+	if !ok {
+		return nil
+	}
+
+	events := make(chan KeyEvent)
+	go func() {
+		defer close(events)
+		for event := range durable {
+			err := t.Fast.Delete(ctx, event.Key)
+			if err != nil {
+				log.Warningf("unable to delete %q from fast cache: %v", event.Key, err)
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return events
+}
+
+// Flush flushes Durable and Fast, if they hold writes back.
+func (t *Tiered) Flush(ctx context.Context) error {
+	return flushAll(ctx, t.Durable, t.Fast)
+}
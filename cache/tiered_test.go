@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+
+	fast := newFlakyCache()
+	durable := newFlakyCache()
+	c := &Tiered{Fast: fast, Durable: durable}
+
+	// writes go through to both caches
+	err := c.Put(ctx, "foo.example.com", []byte("1"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	if got, want := string(fast.get("foo.example.com")), "1"; got != want {
+		t.Errorf("Got fast value: %v, Want: %v", got, want)
+	}
+	if got, want := string(durable.get("foo.example.com")), "1"; got != want {
+		t.Errorf("Got durable value: %v, Want: %v", got, want)
+	}
+
+	// reads are served by the fast cache
+	calls := durable.callCount()
+	data, err := c.Get(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "1"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+	if got, want := durable.callCount(), calls; got != want {
+		t.Errorf("Got %v calls to durable cache, Want: %v", got, want)
+	}
+
+	// misses are read from the durable cache and repaired
+	durable.Put(ctx, "bar.example.com", []byte("2"))
+	data, err = c.Get(ctx, "bar.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "2"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+	if got, want := string(fast.get("bar.example.com")), "2"; got != want {
+		t.Errorf("Got repaired fast value: %v, Want: %v", got, want)
+	}
+
+	// the fast cache being down doesn't matter
+	fast.setDown(true)
+	err = c.Put(ctx, "foo.example.com", []byte("3"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Put: %v", err)
+	}
+	data, err = c.Get(ctx, "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Get: %v", err)
+	}
+	if got, want := string(data), "3"; got != want {
+		t.Errorf("Got value: %v, Want: %v", got, want)
+	}
+	fast.setDown(false)
+
+	// the durable cache being down does
+	durable.setDown(true)
+	err = c.Put(ctx, "foo.example.com", []byte("4"))
+	if err == nil {
+		t.Errorf("Expected Put to fail with the durable cache down")
+	}
+	durable.setDown(false)
+
+	// deletes remove the key from both caches
+	err = c.Delete(ctx, "bar.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	_, err = c.Get(ctx, "bar.example.com")
+	if got, want := err, autocert.ErrCacheMiss; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
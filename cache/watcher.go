@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+// KeyEvent is a change of a key in a cache.
+type KeyEvent struct {
+	Key     string
+	Deleted bool // true if the key was deleted, false if it was put
+}
+
+// Watcher is implemented by caches that can notify about changes, including
+// those made by other processes sharing the cache (for example through Redis
+// keyspace notifications or etcd watches). Caches that wrap other caches
+// implement it by watching those.
+type Watcher interface {
+	// Watch returns a channel of changes that is closed when ctx is done or
+	// the watch ends. It returns nil if the cache can't be watched, like a
+	// wrapper around caches that don't implement Watcher.
+	Watch(ctx context.Context) <-chan KeyEvent
+}
+
+// Watch watches c if it can be watched, ok is false otherwise.
+func Watch(ctx context.Context, c autocert.Cache) (events <-chan KeyEvent, ok bool) {
+	w, ok := c.(Watcher)
+	if !ok {
+		return nil, false
+	}
+
+	events = w.Watch(ctx)
+	return events, events != nil
+}
+
+// watchAll merges the changes of all caches that can be watched into one
+// channel, which is closed once all their watches ended. It returns nil if
+// none of caches can be watched.
+func watchAll(ctx context.Context, caches ...autocert.Cache) <-chan KeyEvent {
+	var watches []<-chan KeyEvent
+	for _, c := range caches {
+		events, ok := Watch(ctx, c)
+		if ok {
+			watches = append(watches, events)
+		}
+	}
+	if len(watches) == 0 {
+		return nil
+	}
+	if len(watches) == 1 {
+		return watches[0]
+	}
+
+	merged := make(chan KeyEvent)
+	var wg sync.WaitGroup
+	for _, events := range watches {
+		wg.Add(1)
+		go func(events <-chan KeyEvent) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case merged <- event:
+				case <-ctx.Done():
+				}
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestMemoryWatch(t *testing.T) {
+	c := &Memory{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, ok := Watch(ctx, c)
+	if !ok {
+		t.Fatalf("Expected Memory to implement Watcher")
+	}
+
+	c.Put(ctx, "foo.example.com", []byte("1"))
+	c.Delete(ctx, "foo.example.com")
+
+	for i, want := range []KeyEvent{{Key: "foo.example.com"}, {Key: "foo.example.com", Deleted: true}} {
+		if got := <-events; got != want {
+			t.Errorf("Test(%v) Got event: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// the channel is closed when the context is done
+	cancel()
+	for range events {
+	}
+
+	// caches that don't implement it
+	_, ok = Watch(context.Background(), newFlakyCache())
+	if ok {
+		t.Errorf("Expected flakyCache not to implement Watcher")
+	}
+}
+
+func TestWrappedWatch(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		inCache  autocert.Cache
+		outWatch bool
+	}{
+		// 0 - encrypted
+		{&Encrypted{Cache: &Memory{}, Key: key}, true},
+		// 1 - compressed
+		{&Compressed{Cache: &Memory{}}, true},
+		// 2 - tiered watches durable
+		{&Tiered{Fast: newFlakyCache(), Durable: &Memory{}}, true},
+		// 3 - multi writer merges its caches
+		{&MultiWriter{Caches: []autocert.Cache{newFlakyCache(), &Memory{}, &Memory{}}}, true},
+		// 4 - failover merges primary and secondary
+		{&Failover{Primary: &Memory{}, Secondary: &Memory{}}, true},
+		// 5 - nested
+		{&Compressed{Cache: &Encrypted{Cache: &Memory{}, Key: key}}, true},
+		// 6 - wrapped cache that can't be watched
+		{&Encrypted{Cache: newFlakyCache(), Key: key}, false},
+		// 7 - none of the caches can be watched
+		{&MultiWriter{Caches: []autocert.Cache{newFlakyCache(), newFlakyCache()}}, false},
+	}
+
+	for i, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		events, ok := Watch(ctx, tt.inCache)
+		if got, want := ok, tt.outWatch; got != want {
+			t.Errorf("Test(%v) Got watch: %v, Want: %v", i, got, want)
+		}
+		if !ok {
+			cancel()
+			continue
+		}
+
+		err := tt.inCache.Put(ctx, "foo.example.com", []byte("1"))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Put: %v", i, err)
+		}
+
+		select {
+		case got := <-events:
+			if want := (KeyEvent{Key: "foo.example.com"}); got != want {
+				t.Errorf("Test(%v) Got event: %v, Want: %v", i, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Test(%v) Got no event", i)
+		}
+
+		// the channel is closed when the context is done
+		cancel()
+		for range events {
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package cfssl
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client obtains certificates from a CFSSL remote signer so teams running
+// CFSSL as their internal CA can use roman's renewal, caching, and serving
+// machinery unchanged. Client implements acme.CertificateForDomainer.
+type Client struct {
+	// Remote is the URL of the CFSSL API, for example https://ca.example.com:8888.
+	Remote string
+
+	// AuthKey is the hex encoded key used to authenticate sign requests. If
+	// empty, the unauthenticated sign endpoint is used.
+	AuthKey string
+
+	// Profile is the signing profile to use, if empty the default profile is used.
+	Profile string
+
+	// Label selects the signer on multi-root CFSSL instances.
+	Label string
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+type signRequest struct {
+	Hosts   []string `json:"hosts"`
+	Request string   `json:"certificate_request"`
+	Profile string   `json:"profile,omitempty"`
+	Label   string   `json:"label,omitempty"`
+}
+
+type authenticatedRequest struct {
+	Token   []byte `json:"token"`
+	Request []byte `json:"request"`
+}
+
+type infoRequest struct {
+	Profile string `json:"profile,omitempty"`
+	Label   string `json:"label,omitempty"`
+}
+
+type response struct {
+	Success bool `json:"success"`
+	Result  struct {
+		Certificate string `json:"certificate"`
+	} `json:"result"`
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// CertificateForDomain returns a *tls.Certificate for a given hostname.
+func (c *Client) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	// generate private key for certificate
+	certificatePrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	// create certificate request
+	cr := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: hostname,
+		},
+		DNSNames: []string{hostname},
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, cr, certificatePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// ask cfssl to sign the request
+	signedPEM, err := c.sign(signRequest{
+		Hosts:   []string{hostname},
+		Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		Profile: c.Profile,
+		Label:   c.Label,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign certificate for %q: %v", hostname, err)
+	}
+
+	// fetch the ca certificate so we serve a complete chain
+	caPEM, err := c.info()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ca certificate: %v", err)
+	}
+
+	certificateChain, err := decodeCertificates(signedPEM + "\n" + caPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificateChain[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: certificateChain,
+		PrivateKey:  certificatePrivateKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// sign sends a sign request, authenticated if an AuthKey was provided, and returns the PEM certificate.
+func (c *Client) sign(sr signRequest) (string, error) {
+	requestBytes, err := json.Marshal(sr)
+	if err != nil {
+		return "", err
+	}
+
+	if c.AuthKey == "" {
+		return c.post("/api/v1/cfssl/sign", requestBytes)
+	}
+
+	key, err := hex.DecodeString(c.AuthKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode auth key: %v", err)
+	}
+
+	// the token is a hmac-sha256 of the request
+	mac := hmac.New(sha256.New, key)
+	mac.Write(requestBytes)
+
+	authBytes, err := json.Marshal(authenticatedRequest{
+		Token:   mac.Sum(nil),
+		Request: requestBytes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return c.post("/api/v1/cfssl/authsign", authBytes)
+}
+
+// info returns the PEM encoded certificate of the signer.
+func (c *Client) info() (string, error) {
+	requestBytes, err := json.Marshal(infoRequest{Profile: c.Profile, Label: c.Label})
+	if err != nil {
+		return "", err
+	}
+
+	return c.post("/api/v1/cfssl/info", requestBytes)
+}
+
+// post sends a request to a cfssl endpoint and returns the certificate in the result.
+func (c *Client) post(endpoint string, body []byte) (string, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(strings.TrimSuffix(c.Remote, "/")+endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode response from %v: %v (%v)", endpoint, err, resp.Status)
+	}
+
+	if !r.Success {
+		if len(r.Errors) > 0 {
+			return "", fmt.Errorf("cfssl error %v: %v", r.Errors[0].Code, r.Errors[0].Message)
+		}
+		return "", fmt.Errorf("unexpected response from %v: %v", endpoint, resp.Status)
+	}
+
+	return r.Result.Certificate, nil
+}
+
+// decodeCertificates returns the DER bytes of all certificates in s.
+func decodeCertificates(s string) ([][]byte, error) {
+	var certificateChain [][]byte
+
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certificateChain = append(certificateChain, block.Bytes)
+		}
+	}
+
+	if len(certificateChain) == 0 {
+		return nil, fmt.Errorf("no certificates in response")
+	}
+
+	return certificateChain, nil
+}
@@ -0,0 +1,159 @@
+package cfssl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCertificateForDomain(t *testing.T) {
+	authKey := strings.Repeat("0f", 16)
+
+	ca, err := newFakeCFSSL(authKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from newFakeCFSSL: %v", err)
+	}
+	ts := httptest.NewServer(ca)
+	defer ts.Close()
+
+	c := &Client{
+		Remote:  ts.URL,
+		AuthKey: authKey,
+		Profile: "server",
+	}
+
+	certificate, err := c.CertificateForDomain("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from CertificateForDomain: %v", err)
+	}
+
+	if got, want := len(certificate.Certificate), 2; got != want {
+		t.Fatalf("Got %v certificates in chain, Want: %v", got, want)
+	}
+	if got, want := ca.profile, "server"; got != want {
+		t.Errorf("Got profile: %v, Want: %v", got, want)
+	}
+
+	// the chain we got back should verify against the ca
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	_, err = certificate.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "foo.example.com"})
+	if err != nil {
+		t.Errorf("Unexpected response from Verify: %v", err)
+	}
+
+	// a bad auth key is rejected
+	c.AuthKey = strings.Repeat("ff", 16)
+	_, err = c.CertificateForDomain("foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error with a bad auth key")
+	}
+}
+
+// fakeCFSSL is used in tests to mimic the parts of the cfssl api we use.
+type fakeCFSSL struct {
+	key         []byte
+	caKey       *rsa.PrivateKey
+	certificate *x509.Certificate
+	profile     string
+}
+
+func newFakeCFSSL(authKey string) (*fakeCFSSL, error) {
+	key, err := hex.DecodeString(authKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake cfssl ca"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caBytes, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(caBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeCFSSL{key: key, caKey: caKey, certificate: certificate}, nil
+}
+
+func (f *fakeCFSSL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/cfssl/info":
+		f.respond(w, f.certificate.Raw)
+	case "/api/v1/cfssl/authsign":
+		var ar authenticatedRequest
+		json.NewDecoder(r.Body).Decode(&ar)
+
+		mac := hmac.New(sha256.New, f.key)
+		mac.Write(ar.Request)
+		if !hmac.Equal(mac.Sum(nil), ar.Token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"success":false,"errors":[{"code":2400,"message":"invalid token"}]}`))
+			return
+		}
+
+		var sr signRequest
+		json.Unmarshal(ar.Request, &sr)
+		f.profile = sr.Profile
+
+		block, _ := pem.Decode([]byte(sr.Request))
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			DNSNames:     sr.Hosts,
+			NotBefore:    time.Now().Add(-1 * time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		certificateBytes, err := x509.CreateCertificate(rand.Reader, template, f.certificate, csr.PublicKey, f.caKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.respond(w, certificateBytes)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeCFSSL) respond(w http.ResponseWriter, certificateBytes []byte) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"result": map[string]string{
+			"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})),
+		},
+	})
+}
@@ -0,0 +1,143 @@
+package roman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	// maxChainLength is the most intermediates followed through AIA.
+	maxChainLength = 4
+)
+
+var (
+	aiaClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// RefreshChain rebuilds the intermediate chain of the certificate for
+// hostname (and the hosts of its CertificateGroup) from the CA Issuers URLs
+// (AIA) of its certificates, and replaces the cached chain if the CA
+// published a new intermediate. The leaf isn't reissued. It returns true if
+// the chain was replaced.
+func (m *CertificateManager) RefreshChain(hostname string) (bool, error) {
+	hostnames := m.certificateGroup(hostname)
+
+	certificate, err := m.getCertificateFromCache(hostnames[0])
+	if err != nil {
+		return false, err
+	}
+
+	_, replaced, err := m.refreshChain(hostnames, certificate)
+	return replaced, err
+}
+
+// refreshChain replaces certificate of hostnames with a copy that has the
+// chain published through AIA if its first intermediate changed, and returns
+// the certificate that is served now.
+func (m *CertificateManager) refreshChain(hostnames []string, certificate *tls.Certificate) (*tls.Certificate, bool, error) {
+	if certificate.Leaf == nil || len(certificate.Leaf.IssuingCertificateURL) == 0 {
+		return certificate, false, nil
+	}
+
+	intermediates, err := fetchChain(certificate.Leaf)
+	if err != nil {
+		return certificate, false, fmt.Errorf("unable to fetch certificate chain for %v: %v", hostnames, err)
+	}
+	if len(intermediates) == 0 {
+		return certificate, false, nil
+	}
+
+	// only a new issuer of the leaf warrants a new chain, it may have been
+	// built with cross-signs that AIA doesn't lead to
+	if len(certificate.Certificate) > 1 && bytes.Equal(certificate.Certificate[1], intermediates[0]) {
+		return certificate, false, nil
+	}
+
+	// copy the certificate, the original may be used by handshakes right now
+	refreshed := *certificate
+	refreshed.Certificate = append([][]byte{certificate.Certificate[0]}, intermediates...)
+
+	for _, hostname := range hostnames {
+		err = m.putCertificateInCache(hostname, &refreshed)
+		if err != nil {
+			return certificate, false, fmt.Errorf("unable to put certificate in cache for %q: %v", hostname, err)
+		}
+	}
+
+	log.Infof("replaced certificate chain of %v with the chain published by the CA", hostnames)
+
+	return &refreshed, true, nil
+}
+
+// fetchChain follows the CA Issuers URLs starting at leaf and returns the
+// DER encoded intermediates, without the root.
+func fetchChain(leaf *x509.Certificate) ([][]byte, error) {
+	var chain [][]byte
+
+	c := leaf
+	for i := 0; i < maxChainLength && len(c.IssuingCertificateURL) > 0; i++ {
+		issuer, err := fetchIssuer(c.IssuingCertificateURL[0])
+		if err != nil {
+			return nil, err
+		}
+		err = c.CheckSignatureFrom(issuer)
+		if err != nil {
+			return nil, fmt.Errorf("certificate from %v didn't issue %q: %v", c.IssuingCertificateURL[0], c.Subject, err)
+		}
+
+		// roots are not part of the chain
+		if bytes.Equal(issuer.RawSubject, issuer.RawIssuer) && issuer.CheckSignatureFrom(issuer) == nil {
+			break
+		}
+
+		chain = append(chain, issuer.Raw)
+		c = issuer
+	}
+
+	return chain, nil
+}
+
+// fetchIssuer downloads a DER or PEM encoded certificate from a CA Issuers
+// URL.
+func fetchIssuer(url string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := aiaClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from %v: %v", url, resp.Status)
+	}
+
+	// certificates are small, anything bigger than 1 MiB isn't one
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block != nil {
+		raw = block.Bytes
+	}
+
+	return x509.ParseCertificate(raw)
+}
@@ -0,0 +1,144 @@
+package roman
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefreshChain(t *testing.T) {
+	var published []byte
+	var rootBytes []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/intermediate.der":
+			w.Write(published)
+		case "/root.der":
+			w.Write(rootBytes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "roman test root"},
+		NotBefore:             clock.UtcNow(),
+		NotAfter:              clock.UtcNow().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootBytes, err = x509.CreateCertificate(rand.Reader, root, root, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from CreateCertificate: %v", err)
+	}
+	root, _ = x509.ParseCertificate(rootBytes)
+
+	// the ca reissues its intermediate with the same key
+	intermediateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	var intermediates [][]byte
+	for serial := int64(2); serial <= 3; serial++ {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "roman test intermediate"},
+			NotBefore:             clock.UtcNow(),
+			NotAfter:              clock.UtcNow().Add(365 * 24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			IssuingCertificateURL: []string{server.URL + "/root.der"},
+		}
+		intermediateBytes, err := x509.CreateCertificate(rand.Reader, template, root, intermediateKey.Public(), rootKey)
+		if err != nil {
+			t.Fatalf("Unexpected response from CreateCertificate: %v", err)
+		}
+		intermediates = append(intermediates, intermediateBytes)
+	}
+	intermediate, _ := x509.ParseCertificate(intermediates[0])
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(4),
+		Subject:               pkix.Name{CommonName: "foo.example.com"},
+		NotBefore:             clock.UtcNow(),
+		NotAfter:              clock.UtcNow().Add(90 * 24 * time.Hour),
+		DNSNames:              []string{"foo.example.com"},
+		IssuingCertificateURL: []string{server.URL + "/intermediate.der"},
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, intermediate, leafKey.Public(), intermediateKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from CreateCertificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(leafBytes)
+
+	m := CertificateManager{Cache: newMapCache()}
+	err = m.putCertificateInCache("foo.example.com", &tls.Certificate{
+		Certificate: [][]byte{leafBytes, intermediates[0]},
+		PrivateKey:  leafKey,
+		Leaf:        leaf,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	tests := []struct {
+		inPublished     []byte
+		outReplaced     bool
+		outIntermediate []byte
+	}{
+		// 0 - the chain is up to date
+		{intermediates[0], false, intermediates[0]},
+		// 1 - the ca published a new intermediate
+		{intermediates[1], true, intermediates[1]},
+		// 2 - which is only picked up once
+		{intermediates[1], false, intermediates[1]},
+	}
+
+	for i, tt := range tests {
+		published = tt.inPublished
+
+		replaced, err := m.RefreshChain("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from RefreshChain: %v", i, err)
+		}
+		if got, want := replaced, tt.outReplaced; got != want {
+			t.Errorf("Test(%v) Got replaced: %v, Want: %v", i, got, want)
+		}
+
+		// the new chain is in the cache, not only in memory
+		m.memoryCache = nil
+		certificate, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if got, want := len(certificate.Certificate), 2; got != want {
+			t.Fatalf("Test(%v) Got chain length: %v, Want: %v", i, got, want)
+		}
+		if !bytes.Equal(certificate.Certificate[0], leafBytes) {
+			t.Errorf("Test(%v) Leaf was replaced", i)
+		}
+		if !bytes.Equal(certificate.Certificate[1], tt.outIntermediate) {
+			t.Errorf("Test(%v) Got unexpected intermediate", i)
+		}
+	}
+}
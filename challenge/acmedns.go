@@ -0,0 +1,199 @@
+package challenge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+const (
+	acmeDNSCacheSuffix = "+acme-dns"
+	acmeDNSTimeout     = 1 * time.Minute
+)
+
+// AcmeDNS performs dns-01 challenges against an acme-dns server
+// (https://github.com/joohoi/acme-dns). Each hostname gets its own acme-dns
+// account that is registered on first use and stored in Cache. After
+// registration, _acme-challenge.<hostname> has to be delegated with a CNAME to
+// the fulldomain of the account, Perform returns an error describing the
+// record to create until it is.
+type AcmeDNS struct {
+	// Server is the URL of the acme-dns server, for example https://auth.acme-dns.io.
+	Server string
+
+	// Cache stores acme-dns account credentials, it's typically the same
+	// cache used by the roman.CertificateManager.
+	Cache autocert.Cache
+
+	// AllowFrom is an optional list of CIDR ranges allowed to update records
+	// with newly registered accounts.
+	AllowFrom []string
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+// acmeDNSAccount is what the acme-dns register endpoint returns.
+type acmeDNSAccount struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	SubDomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (a AcmeDNS) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return a.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (a AcmeDNS) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return performDNS01(ctx, acmeClient, authorization, hostname, a, a.PropagationResolver, a.PropagationTimeout)
+}
+
+// Upsert updates the TXT record of the acme-dns account for hostname.
+func (a AcmeDNS) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	ctx, cancel := context.WithTimeout(ctx, acmeDNSTimeout)
+	defer cancel()
+
+	account, err := a.account(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	// make sure the challenge is delegated to acme-dns, otherwise the acme
+	// server will never see the record
+	err = checkDelegation(hostname, account.FullDomain)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"subdomain": account.SubDomain,
+		"txt":       challengeValue,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint("/update"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-User", account.Username)
+	req.Header.Set("X-Api-Key", account.Password)
+
+	resp, err := a.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from acme-dns update: %v", resp.Status)
+	}
+
+	return nil
+}
+
+// Delete is a no-op, acme-dns only keeps the two most recent TXT records of
+// an account so old challenge values are rotated out automatically.
+func (a AcmeDNS) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	return nil
+}
+
+// account returns the acme-dns account for hostname from the cache,
+// registering a new one if it doesn't exist yet.
+func (a AcmeDNS) account(ctx context.Context, hostname string) (*acmeDNSAccount, error) {
+	var account acmeDNSAccount
+
+	accountBytes, err := a.Cache.Get(ctx, hostname+acmeDNSCacheSuffix)
+	if err == nil {
+		err = json.Unmarshal(accountBytes, &account)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode acme-dns account for %q: %v", hostname, err)
+		}
+		return &account, nil
+	}
+	if err != autocert.ErrCacheMiss {
+		return nil, err
+	}
+
+	// no account yet, register one
+	body, err := json.Marshal(map[string][]string{"allowfrom": a.AllowFrom})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint("/register"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected response from acme-dns register: %v", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&account)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode acme-dns account: %v", err)
+	}
+
+	// persist the account so we keep using the same delegation
+	accountBytes, err = json.Marshal(account)
+	if err != nil {
+		return nil, err
+	}
+	err = a.Cache.Put(ctx, hostname+acmeDNSCacheSuffix, accountBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to store acme-dns account for %q: %v", hostname, err)
+	}
+
+	return &account, nil
+}
+
+func (a AcmeDNS) endpoint(path string) string {
+	return strings.TrimSuffix(a.Server, "/") + path
+}
+
+func (a AcmeDNS) client() *http.Client {
+	if a.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return a.HTTPClient
+}
+
+var lookupCNAME = net.LookupCNAME // used to mock dns in tests
+
+// checkDelegation makes sure _acme-challenge.<hostname> is a CNAME to target.
+func checkDelegation(hostname string, target string) error {
+	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname)
+
+	cname, err := lookupCNAME(recordName)
+	if err != nil || !strings.EqualFold(strings.TrimSuffix(cname, "."), strings.TrimSuffix(target, ".")) {
+		return fmt.Errorf("%v must be a CNAME to %v for acme-dns validation to work", recordName, target)
+	}
+
+	return nil
+}
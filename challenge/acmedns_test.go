@@ -0,0 +1,109 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestAcmeDNSUpsert(t *testing.T) {
+	registrations := 0
+	var updates []map[string]string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/register":
+			registrations = registrations + 1
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"username":"user","password":"pass","fulldomain":"abc.auth.example.org","subdomain":"abc","allowfrom":[]}`)
+		case "/update":
+			if r.Header.Get("X-Api-User") != "user" || r.Header.Get("X-Api-Key") != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var u map[string]string
+			json.NewDecoder(r.Body).Decode(&u)
+			updates = append(updates, u)
+			fmt.Fprint(w, `{"txt":"value"}`)
+		}
+	}))
+	defer ts.Close()
+
+	// pretend the delegation exists
+	lookupCNAME = func(host string) (string, error) {
+		return "abc.auth.example.org.", nil
+	}
+
+	c := &testCache{m: make(map[string][]byte)}
+	a := AcmeDNS{Server: ts.URL, Cache: c}
+
+	// the first upsert registers an account
+	err := a.Upsert(context.Background(), "foo.example.com", "value1")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if _, ok := c.m["foo.example.com+acme-dns"]; !ok {
+		t.Errorf("Account was not stored in cache")
+	}
+
+	// the second re-uses it
+	err = a.Upsert(context.Background(), "foo.example.com", "value2")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+
+	if got, want := registrations, 1; got != want {
+		t.Errorf("Got %v registrations, Want: %v", got, want)
+	}
+	if got, want := fmt.Sprint(updates), "[map[subdomain:abc txt:value1] map[subdomain:abc txt:value2]]"; got != want {
+		t.Errorf("Got updates: %v, Want: %v", got, want)
+	}
+
+	// without the delegation upsert fails
+	lookupCNAME = func(host string) (string, error) {
+		return host, nil
+	}
+	err = a.Upsert(context.Background(), "foo.example.com", "value3")
+	if err == nil {
+		t.Errorf("Expected an error when the CNAME is missing")
+	}
+}
+
+// testCache is used in tests as an in-memory autocert.Cache.
+type testCache struct {
+	sync.Mutex
+	m map[string][]byte
+}
+
+func (c *testCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	data, ok := c.m[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *testCache) Put(ctx context.Context, key string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.m[key] = data
+	return nil
+}
+
+func (c *testCache) Delete(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.m, key)
+	return nil
+}
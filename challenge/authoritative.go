@@ -0,0 +1,71 @@
+package challenge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	// used to mock dns in tests
+	lookupNS = func(ctx context.Context, name string) ([]*net.NS, error) {
+		return net.DefaultResolver.LookupNS(ctx, name)
+	}
+	lookupTXTAt = func(ctx context.Context, nameserver string, fqdn string) ([]string, error) {
+		return DNSResolver{Nameserver: nameserver}.LookupTXT(ctx, fqdn)
+	}
+)
+
+// AuthoritativeResolver looks up TXT records directly on the authoritative
+// nameservers of the zone that contains the record, bypassing caches and
+// provider specific sync status. A record is only returned once every
+// authoritative nameserver serves it, so secondaries that are still
+// transferring the zone don't cause validation to fail.
+type AuthoritativeResolver struct{}
+
+// LookupTXT returns the TXT records for fqdn that all authoritative nameservers agree on.
+func (a AuthoritativeResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	nameservers, err := authoritativeNameservers(ctx, fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	// count how many nameservers serve each record
+	seen := make(map[string]int)
+	var order []string
+	for _, ns := range nameservers {
+		records, err := lookupTXTAt(ctx, net.JoinHostPort(strings.TrimSuffix(ns.Host, "."), "53"), fqdn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to query %v: %v", ns.Host, err)
+		}
+		for _, v := range records {
+			if seen[v] == 0 {
+				order = append(order, v)
+			}
+			seen[v] = seen[v] + 1
+		}
+	}
+
+	var records []string
+	for _, v := range order {
+		if seen[v] == len(nameservers) {
+			records = append(records, v)
+		}
+	}
+
+	return records, nil
+}
+
+// authoritativeNameservers returns the nameservers of the closest zone that contains fqdn.
+func authoritativeNameservers(ctx context.Context, fqdn string) ([]*net.NS, error) {
+	for _, candidate := range zoneCandidates(fqdn) {
+		nameservers, err := lookupNS(ctx, candidate+".")
+		if err == nil && len(nameservers) > 0 {
+			return nameservers, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to find authoritative nameservers for %v", fqdn)
+}
@@ -0,0 +1,57 @@
+package challenge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestAuthoritativeResolver(t *testing.T) {
+	defer func(f func(context.Context, string) ([]*net.NS, error)) { lookupNS = f }(lookupNS)
+	defer func(f func(context.Context, string, string) ([]string, error)) { lookupTXTAt = f }(lookupTXTAt)
+
+	lookupNS = func(ctx context.Context, name string) ([]*net.NS, error) {
+		if name != "example.com." {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []*net.NS{{Host: "ns1.example.net."}, {Host: "ns2.example.net."}}, nil
+	}
+
+	tests := []struct {
+		inRecords map[string][]string
+		outTXT    []string
+		outErr    bool
+	}{
+		// 0 - all nameservers agree
+		{map[string][]string{"ns1.example.net:53": {"one"}, "ns2.example.net:53": {"one"}}, []string{"one"}, false},
+		// 1 - a secondary has not caught up yet
+		{map[string][]string{"ns1.example.net:53": {"one", "two"}, "ns2.example.net:53": {"one"}}, []string{"one"}, false},
+		// 2 - nothing published yet
+		{map[string][]string{}, nil, false},
+		// 3 - a nameserver is unreachable
+		{nil, nil, true},
+	}
+
+	for i, tt := range tests {
+		lookupTXTAt = func(ctx context.Context, nameserver string, fqdn string) ([]string, error) {
+			if tt.inRecords == nil {
+				return nil, fmt.Errorf("timeout")
+			}
+			if fqdn != "_acme-challenge.foo.example.com." {
+				return nil, fmt.Errorf("unexpected name: %v", fqdn)
+			}
+			return tt.inRecords[nameserver], nil
+		}
+
+		records, err := AuthoritativeResolver{}.LookupTXT(context.Background(), "_acme-challenge.foo.example.com.")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := strings.Join(records, ","), strings.Join(tt.outTXT, ","); got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
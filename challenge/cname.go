@@ -0,0 +1,29 @@
+package challenge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// challengeRecordName returns the fully qualified name of the challenge record
+// for hostname. If followCNAME is set and _acme-challenge.<hostname> is a
+// CNAME, the end of the CNAME chain is returned instead so the record can be
+// placed in a dedicated validation zone.
+func challengeRecordName(hostname string, followCNAME bool) string {
+	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, strings.TrimSuffix(hostname, "."))
+	if !followCNAME {
+		return recordName
+	}
+
+	// lookupCNAME follows the whole chain, if there is no CNAME (or the
+	// lookup fails) the record goes where it would without delegation
+	target, err := lookupCNAME(recordName)
+	if err != nil || target == "" {
+		return recordName
+	}
+	if !strings.HasSuffix(target, ".") {
+		target = target + "."
+	}
+
+	return strings.ToLower(target)
+}
@@ -0,0 +1,41 @@
+package challenge
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChallengeRecordName(t *testing.T) {
+	defer func(f func(string) (string, error)) { lookupCNAME = f }(lookupCNAME)
+
+	lookupCNAME = func(host string) (string, error) {
+		switch host {
+		case "_acme-challenge.foo.example.com.":
+			return "foo.validation.example.org.", nil
+		case "_acme-challenge.bar.example.com.":
+			return host, nil
+		}
+		return "", fmt.Errorf("no such host")
+	}
+
+	tests := []struct {
+		inHostname    string
+		inFollowCNAME bool
+		outName       string
+	}{
+		// 0 - cname is followed
+		{"foo.example.com", true, "foo.validation.example.org."},
+		// 1 - cname is ignored when not following
+		{"foo.example.com", false, "_acme-challenge.foo.example.com."},
+		// 2 - no cname
+		{"bar.example.com", true, "_acme-challenge.bar.example.com."},
+		// 3 - lookup error
+		{"baz.example.com", true, "_acme-challenge.baz.example.com."},
+	}
+
+	for i, tt := range tests {
+		if got, want := challengeRecordName(tt.inHostname, tt.inFollowCNAME), tt.outName; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package challenge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+// Designate performs dns-01 challenges using OpenStack Designate (DNSaaS).
+// Credentials are exchanged for a token with Keystone (identity v3) before
+// every change and the Designate endpoint is taken from the service catalog
+// unless Endpoint is set.
+type Designate struct {
+	// AuthURL is the Keystone identity endpoint, for example https://keystone.example.com:5000/v3.
+	AuthURL string
+
+	Username string
+	Password string
+
+	// UserDomainName and ProjectDomainName default to "Default".
+	UserDomainName    string
+	ProjectName       string
+	ProjectDomainName string
+
+	// Region is used to pick the dns endpoint from the service catalog, if
+	// empty the first public dns endpoint is used.
+	Region string
+
+	// Endpoint overrides the Designate endpoint from the service catalog.
+	Endpoint string
+
+	// TTL of the challenge record in seconds, defaults to 60.
+	TTL int
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+type designateRecordSet struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// designateSession is a keystone token and the designate endpoint it's valid for.
+type designateSession struct {
+	d        Designate
+	token    string
+	endpoint string
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (d Designate) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return d.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (d Designate) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	resolver := d.PropagationResolver
+	if resolver == nil {
+		resolver = DNSResolver{}
+	}
+
+	return performDNS01(ctx, acmeClient, authorization, hostname, d, resolver, d.PropagationTimeout)
+}
+
+// Upsert adds challengeValue to the challenge recordset for hostname, creating it if needed.
+func (d Designate) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	s, err := d.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	zoneID, recordSet, err := s.recordSet(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	value := `"` + challengeValue + `"`
+
+	// no recordset yet, create one
+	if recordSet == nil {
+		ttl := d.TTL
+		if ttl == 0 {
+			ttl = 60
+		}
+		return s.do(ctx, http.MethodPost, "/v2/zones/"+zoneID+"/recordsets", designateRecordSet{
+			Name:    fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname),
+			Type:    "TXT",
+			TTL:     ttl,
+			Records: []string{value},
+		}, nil)
+	}
+
+	// the recordset may be shared with another challenge (for example a
+	// wildcard and its base domain), so add to it instead of replacing it
+	for _, v := range recordSet.Records {
+		if v == value {
+			return nil
+		}
+	}
+	return s.do(ctx, http.MethodPut, "/v2/zones/"+zoneID+"/recordsets/"+recordSet.ID, designateRecordSet{
+		Records: append(recordSet.Records, value),
+	}, nil)
+}
+
+// Delete removes challengeValue from the challenge recordset for hostname,
+// deleting the recordset once it's empty.
+func (d Designate) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	s, err := d.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	zoneID, recordSet, err := s.recordSet(ctx, hostname)
+	if err != nil {
+		return err
+	}
+	if recordSet == nil {
+		return nil
+	}
+
+	var records []string
+	for _, v := range recordSet.Records {
+		if v != `"`+challengeValue+`"` {
+			records = append(records, v)
+		}
+	}
+
+	if len(records) == len(recordSet.Records) {
+		return nil
+	}
+	if len(records) == 0 {
+		return s.do(ctx, http.MethodDelete, "/v2/zones/"+zoneID+"/recordsets/"+recordSet.ID, nil, nil)
+	}
+	return s.do(ctx, http.MethodPut, "/v2/zones/"+zoneID+"/recordsets/"+recordSet.ID, designateRecordSet{
+		Records: records,
+	}, nil)
+}
+
+// login requests a project scoped token from keystone.
+func (d Designate) login(ctx context.Context) (*designateSession, error) {
+	userDomain := d.UserDomainName
+	if userDomain == "" {
+		userDomain = "Default"
+	}
+	projectDomain := d.ProjectDomainName
+	if projectDomain == "" {
+		projectDomain = "Default"
+	}
+
+	var auth struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Name     string            `json:"name"`
+						Domain   map[string]string `json:"domain"`
+						Password string            `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+			Scope struct {
+				Project struct {
+					Name   string            `json:"name"`
+					Domain map[string]string `json:"domain"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	auth.Auth.Identity.Methods = []string{"password"}
+	auth.Auth.Identity.Password.User.Name = d.Username
+	auth.Auth.Identity.Password.User.Domain = map[string]string{"name": userDomain}
+	auth.Auth.Identity.Password.User.Password = d.Password
+	auth.Auth.Scope.Project.Name = d.ProjectName
+	auth.Auth.Scope.Project.Domain = map[string]string{"name": projectDomain}
+
+	body, err := json.Marshal(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(d.AuthURL, "/")+"/auth/tokens", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected response from keystone: %v", resp.Status)
+	}
+
+	var token struct {
+		Token struct {
+			Catalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					Interface string `json:"interface"`
+					Region    string `json:"region"`
+					URL       string `json:"url"`
+				} `json:"endpoints"`
+			} `json:"catalog"`
+		} `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode keystone token: %v", err)
+	}
+
+	s := &designateSession{
+		d:        d,
+		token:    resp.Header.Get("X-Subject-Token"),
+		endpoint: d.Endpoint,
+	}
+
+	// find the designate endpoint in the service catalog
+	for _, service := range token.Token.Catalog {
+		if s.endpoint != "" {
+			break
+		}
+		if service.Type != "dns" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == "public" && (d.Region == "" || endpoint.Region == d.Region) {
+				s.endpoint = endpoint.URL
+				break
+			}
+		}
+	}
+	if s.endpoint == "" {
+		return nil, fmt.Errorf("unable to find dns endpoint in keystone service catalog")
+	}
+
+	return s, nil
+}
+
+// recordSet returns the id of the zone that contains hostname and its
+// challenge recordset, or nil if the recordset doesn't exist.
+func (s *designateSession) recordSet(ctx context.Context, hostname string) (string, *designateRecordSet, error) {
+	var zoneID string
+	for _, candidate := range zoneCandidates(hostname) {
+		var zones struct {
+			Zones []struct {
+				ID string `json:"id"`
+			} `json:"zones"`
+		}
+		err := s.do(ctx, http.MethodGet, "/v2/zones?name="+url.QueryEscape(candidate+"."), nil, &zones)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(zones.Zones) > 0 {
+			zoneID = zones.Zones[0].ID
+			break
+		}
+	}
+	if zoneID == "" {
+		return "", nil, fmt.Errorf("unable to find designate zone for %v", hostname)
+	}
+
+	query := url.Values{}
+	query.Set("name", fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname))
+	query.Set("type", "TXT")
+
+	var recordSets struct {
+		RecordSets []designateRecordSet `json:"recordsets"`
+	}
+	err := s.do(ctx, http.MethodGet, "/v2/zones/"+zoneID+"/recordsets?"+query.Encode(), nil, &recordSets)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(recordSets.RecordSets) == 0 {
+		return zoneID, nil, nil
+	}
+
+	return zoneID, &recordSets.RecordSets[0], nil
+}
+
+// do sends a request to designate and decodes the response into out.
+func (s *designateSession) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Token", s.token)
+
+	resp, err := s.d.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from designate %v %v: %v", method, path, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (d Designate) client() *http.Client {
+	if d.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return d.HTTPClient
+}
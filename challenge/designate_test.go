@@ -0,0 +1,104 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestDesignateUpsertDelete(t *testing.T) {
+	var recordSet *designateRecordSet
+	var ts *httptest.Server
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/identity/auth/tokens" {
+			w.Header().Set("X-Subject-Token", "token")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":{"catalog":[{"type":"dns","endpoints":[{"interface":"public","region":"one","url":%q}]}]}}`, ts.URL+"/dns")
+			return
+		}
+		if r.Header.Get("X-Auth-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/dns/v2/zones":
+			if r.URL.Query().Get("name") != "example.com." {
+				fmt.Fprint(w, `{"zones":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"zones":[{"id":"zone"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/dns/v2/zones/zone/recordsets":
+			if recordSet == nil {
+				fmt.Fprint(w, `{"recordsets":[]}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"recordsets": []*designateRecordSet{recordSet}})
+		case r.Method == http.MethodPost && r.URL.Path == "/dns/v2/zones/zone/recordsets":
+			recordSet = &designateRecordSet{}
+			json.NewDecoder(r.Body).Decode(recordSet)
+			recordSet.ID = "recordset"
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && r.URL.Path == "/dns/v2/zones/zone/recordsets/recordset":
+			var update designateRecordSet
+			json.NewDecoder(r.Body).Decode(&update)
+			recordSet.Records = update.Records
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete && r.URL.Path == "/dns/v2/zones/zone/recordsets/recordset":
+			recordSet = nil
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	d := Designate{
+		AuthURL:     ts.URL + "/identity",
+		Username:    "user",
+		Password:    "password",
+		ProjectName: "project",
+		Region:      "one",
+	}
+
+	// 0 - create the recordset
+	err := d.Upsert(context.Background(), "foo.example.com", "one")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if got, want := recordSet.Name, "_acme-challenge.foo.example.com."; got != want {
+		t.Errorf("Got name: %v, Want: %v", got, want)
+	}
+
+	// 1 - add a second value
+	err = d.Upsert(context.Background(), "foo.example.com", "two")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if got, want := len(recordSet.Records), 2; got != want {
+		t.Fatalf("Got %v records, Want: %v", got, want)
+	}
+
+	// 2 - remove one value
+	err = d.Delete(context.Background(), "foo.example.com", "one")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if got, want := recordSet.Records[0], `"two"`; got != want {
+		t.Errorf("Got record: %v, Want: %v", got, want)
+	}
+
+	// 3 - remove the last value
+	err = d.Delete(context.Background(), "foo.example.com", "two")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if recordSet != nil {
+		t.Errorf("Recordset was not deleted")
+	}
+}
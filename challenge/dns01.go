@@ -0,0 +1,80 @@
+package challenge
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/internal/logging"
+)
+
+// dnsRecordUpdater creates and removes the challenge TXT record for a hostname.
+type dnsRecordUpdater interface {
+	Upsert(ctx context.Context, hostname string, challengeValue string) error
+	Delete(ctx context.Context, hostname string, challengeValue string) error
+}
+
+// performDNS01 performs a dns-01 challenge against an acmeClient using u to
+// publish the challenge record. If resolver is not nil, it's used to make sure
+// the record is visible before the acme server is asked to validate it.
+func performDNS01(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string,
+	u dnsRecordUpdater, resolver TXTResolver, propagationTimeout time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "dns01.Perform", hostname)
+	defer func() { endSpan(span, err) }()
+
+	// extract the dns challenge from the authorization
+	challenge, err := GetChallenge(authorization, DNSChallenge)
+	if err != nil {
+		return err
+	}
+
+	// challengeValue create from the token, it's a fingerprint of your public key
+	// and the token, hashed, then base64 encoded.
+	challengeValue, err := acmeClient.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	// update dns record with challenge value, this includes waiting for the
+	// provider to sync (like Route53 WaitForSync)
+	start := time.Now()
+	_, upsertSpan := startSpan(ctx, "dns01.Upsert", hostname)
+	err = u.Upsert(ctx, hostname, challengeValue)
+	endSpan(upsertSpan, err)
+	logging.Step(ctx, "dns_update", hostname, start, err)
+	if err != nil {
+		return fmt.Errorf("unexpected response from DNS upserter: %v", err)
+	}
+
+	// always remove the record so we don't pollute dns, even if the
+	// challenge failed
+	defer func() {
+		start := time.Now()
+		_, deleteSpan := startSpan(ctx, "dns01.Delete", hostname)
+		cleanupCtx, cancel := CleanupContext(ctx)
+		deleteErr := u.Delete(cleanupCtx, hostname, challengeValue)
+		cancel()
+		endSpan(deleteSpan, deleteErr)
+		logging.Step(ctx, "dns_cleanup", hostname, start, deleteErr)
+		if deleteErr != nil && err == nil {
+			err = deleteErr
+		}
+	}()
+
+	// if we have a resolver, make sure the record is visible before asking
+	// the acme server to validate it
+	if resolver != nil {
+		start := time.Now()
+		_, propagationSpan := startSpan(ctx, "dns01.WaitForPropagation", hostname)
+		err = WaitForPropagation(ctx, resolver, hostname, challengeValue, propagationTimeout)
+		endSpan(propagationSpan, err)
+		logging.Step(ctx, "dns_propagation", hostname, start, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ValidateChallenge(ctx, acmeClient, authorization, challenge)
+}
@@ -0,0 +1,103 @@
+package challenge
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+func TestPerformDNS01Cleanup(t *testing.T) {
+	propagationInterval = 10 * time.Millisecond
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+
+	authorization := &acme.Authorization{
+		URI: "https://acme.example.com/authorization/1",
+		Challenges: []*acme.Challenge{
+			{Type: DNSChallenge, Token: "abc"},
+		},
+	}
+
+	// the record never propagates so the challenge fails before it's accepted
+	u := &recordingUpdater{}
+	err = performDNS01(context.Background(), acmeClient, authorization, "foo.example.com", u, emptyResolver{}, 50*time.Millisecond)
+	if err == nil {
+		t.Fatalf("Expected an error when the record doesn't propagate")
+	}
+
+	if got, want := u.upserted, 1; got != want {
+		t.Errorf("Got %v upserts, Want: %v", got, want)
+	}
+	if got, want := u.deleted, 1; got != want {
+		t.Errorf("Got %v deletes, Want: %v", got, want)
+	}
+}
+
+func TestPerformDNS01Cancel(t *testing.T) {
+	propagationInterval = 10 * time.Millisecond
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+
+	authorization := &acme.Authorization{
+		URI: "https://acme.example.com/authorization/1",
+		Challenges: []*acme.Challenge{
+			{Type: DNSChallenge, Token: "abc"},
+		},
+	}
+
+	// cancel while waiting for a record that never propagates
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	u := &recordingUpdater{}
+	err = performDNS01(ctx, acmeClient, authorization, "foo.example.com", u, emptyResolver{}, time.Minute)
+	if got, want := err, context.Canceled; got != want {
+		t.Fatalf("Got %v, Want: %v", got, want)
+	}
+
+	// the record is still cleaned up with a context that isn't cancelled
+	if got, want := u.deleted, 1; got != want {
+		t.Errorf("Got %v deletes, Want: %v", got, want)
+	}
+	if u.deleteErr != nil {
+		t.Errorf("Got cleanup context error %v, Want: <nil>", u.deleteErr)
+	}
+}
+
+// recordingUpdater is used in tests to count dns record updates.
+type recordingUpdater struct {
+	upserted  int
+	deleted   int
+	deleteErr error
+}
+
+func (r *recordingUpdater) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	r.upserted = r.upserted + 1
+	return nil
+}
+
+func (r *recordingUpdater) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	r.deleted = r.deleted + 1
+	r.deleteErr = ctx.Err()
+	return nil
+}
+
+// emptyResolver is used in tests for records that never propagate.
+type emptyResolver struct{}
+
+func (emptyResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,134 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	CloudflareDoH = "https://cloudflare-dns.com/dns-query"
+	GoogleDoH     = "https://dns.google/resolve"
+)
+
+const (
+	dnsTypeTXT     = 16
+	dnsRcodeOK     = 0
+	dnsRcodeNXName = 3
+)
+
+// DoHResolver looks up TXT records using the JSON flavor of DNS-over-HTTPS
+// supported by Cloudflare and Google. It's useful in environments where
+// outbound port 53 is blocked but HTTPS egress is allowed.
+type DoHResolver struct {
+	// Endpoint is the DoH JSON API URL, for example CloudflareDoH or GoogleDoH.
+	Endpoint string
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+type dohResponse struct {
+	Status int         `json:"Status"`
+	Answer []dohAnswer `json:"Answer"`
+}
+
+type dohAnswer struct {
+	Name string `json:"name"`
+	Type int    `json:"type"`
+	Data string `json:"data"`
+}
+
+// LookupTXT returns the TXT records published for fqdn. A name that does not
+// exist yet is not an error, it simply has no records.
+func (d DoHResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	answers, err := d.query(ctx, fqdn, "TXT")
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, v := range answers {
+		if v.Type != dnsTypeTXT {
+			continue
+		}
+		records = append(records, unquoteTXT(v.Data))
+	}
+
+	return records, nil
+}
+
+// query performs a DoH JSON query and returns the answer section.
+func (d DoHResolver) query(ctx context.Context, name string, recordType string) ([]dohAnswer, error) {
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		endpoint = CloudflareDoH
+	}
+
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// build the request, cloudflare requires the accept header to be set
+	// while google ignores it
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("type", recordType)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from DoH endpoint %v: %v", endpoint, resp.Status)
+	}
+
+	var r dohResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode DoH response: %v", err)
+	}
+
+	switch r.Status {
+	case dnsRcodeOK:
+		return r.Answer, nil
+	case dnsRcodeNXName:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("DoH query for %v %v failed with rcode %v", name, recordType, r.Status)
+	}
+}
+
+// unquoteTXT turns the presentation format of a TXT record, one or more
+// quoted character strings, into the value of the record.
+func unquoteTXT(data string) string {
+	data = strings.TrimSpace(data)
+	if !strings.HasPrefix(data, `"`) {
+		return data
+	}
+
+	var buf strings.Builder
+	for _, v := range strings.Split(data, `" "`) {
+		buf.WriteString(strings.Trim(v, `"`))
+	}
+
+	return buf.String()
+}
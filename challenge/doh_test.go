@@ -0,0 +1,103 @@
+package challenge
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestDoHResolver(t *testing.T) {
+	tests := []struct {
+		inResponse string   // body returned by the DoH server
+		outRecords []string // expected records
+		outError   bool     // if an error is expected
+	}{
+		// 0 - single record
+		{
+			`{"Status":0,"Answer":[{"name":"_acme-challenge.foo.example.com.","type":16,"TTL":300,"data":"\"abc\""}]}`,
+			[]string{"abc"},
+			false,
+		},
+		// 1 - record split into multiple character strings
+		{
+			`{"Status":0,"Answer":[{"name":"_acme-challenge.foo.example.com.","type":16,"TTL":300,"data":"\"abc\" \"def\""}]}`,
+			[]string{"abcdef"},
+			false,
+		},
+		// 2 - cname in answer section is skipped
+		{
+			`{"Status":0,"Answer":[{"name":"_acme-challenge.foo.example.com.","type":5,"TTL":300,"data":"bar.example.com."},{"name":"bar.example.com.","type":16,"TTL":300,"data":"\"abc\""}]}`,
+			[]string{"abc"},
+			false,
+		},
+		// 3 - nxdomain is not an error
+		{
+			`{"Status":3}`,
+			nil,
+			false,
+		},
+		// 4 - servfail is an error
+		{
+			`{"Status":2}`,
+			nil,
+			true,
+		},
+	}
+
+	for i, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got, want := r.Header.Get("Accept"), "application/dns-json"; got != want {
+				t.Errorf("Test(%v) Got Accept header: %v, Want: %v", i, got, want)
+			}
+			if got, want := r.URL.Query().Get("type"), "TXT"; got != want {
+				t.Errorf("Test(%v) Got query type: %v, Want: %v", i, got, want)
+			}
+			fmt.Fprint(w, tt.inResponse)
+		}))
+
+		resolver := DoHResolver{Endpoint: ts.URL}
+		records, err := resolver.LookupTXT(context.Background(), "_acme-challenge.foo.example.com.")
+		ts.Close()
+
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := fmt.Sprint(records), fmt.Sprint(tt.outRecords); got != want {
+			t.Errorf("Test(%v) Got records: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	propagationInterval = 10 * time.Millisecond
+
+	// the record shows up after a few queries
+	queries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = queries + 1
+		if queries < 3 {
+			fmt.Fprint(w, `{"Status":3}`)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"_acme-challenge.foo.example.com.","type":16,"data":"\"abc\""}]}`)
+	}))
+	defer ts.Close()
+
+	err := WaitForPropagation(context.Background(), DoHResolver{Endpoint: ts.URL}, "foo.example.com", "abc", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected response from WaitForPropagation: %v", err)
+	}
+	if got, want := queries, 3; got != want {
+		t.Errorf("Got %v queries, Want: %v", got, want)
+	}
+
+	// a record that never shows up times out
+	err = WaitForPropagation(context.Background(), DoHResolver{Endpoint: ts.URL}, "foo.example.com", "def", 100*time.Millisecond)
+	if err == nil {
+		t.Errorf("Expected WaitForPropagation to time out")
+	}
+}
@@ -0,0 +1,271 @@
+package challenge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+const (
+	DynEndpoint = "https://api.dynect.net/REST"
+)
+
+// Dyn performs dns-01 challenges using the Dyn (Oracle) Managed DNS REST API.
+// A session is opened for every change, records are published to the zone
+// right away, and removed again once validation is done.
+type Dyn struct {
+	// Endpoint is the Dyn REST API endpoint, defaults to DynEndpoint.
+	Endpoint string
+
+	CustomerName string
+	UserName     string
+	Password     string
+
+	// Zone is the zone records are created in, if empty the most specific
+	// zone in the account that contains the hostname is used.
+	Zone string
+
+	// TTL of the challenge record in seconds, defaults to 60.
+	TTL int
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+// dynResponse is the envelope every Dyn API response is wrapped in.
+type dynResponse struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+	Msgs   []struct {
+		Info string `json:"INFO"`
+		Lvl  string `json:"LVL"`
+	} `json:"msgs"`
+}
+
+type dynTXTRecord struct {
+	RData struct {
+		TXTData string `json:"txtdata"`
+	} `json:"rdata"`
+}
+
+// dynSession is an authenticated Dyn API session.
+type dynSession struct {
+	d     Dyn
+	token string
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (d Dyn) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return d.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (d Dyn) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	resolver := d.PropagationResolver
+	if resolver == nil {
+		resolver = DNSResolver{}
+	}
+
+	return performDNS01(ctx, acmeClient, authorization, hostname, d, resolver, d.PropagationTimeout)
+}
+
+// Upsert creates the challenge record for hostname and publishes the zone.
+func (d Dyn) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	s, err := d.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.logout(ctx)
+
+	zone, err := s.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	ttl := d.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+
+	var record = struct {
+		RData map[string]string `json:"rdata"`
+		TTL   int               `json:"ttl"`
+	}{
+		RData: map[string]string{"txtdata": challengeValue},
+		TTL:   ttl,
+	}
+	err = s.do(ctx, http.MethodPost, "/TXTRecord/"+zone+"/"+ACMEChallengePrefix+"."+hostname+"/", record, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.publish(ctx, zone)
+}
+
+// Delete removes the challenge record for hostname and publishes the zone.
+func (d Dyn) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	s, err := d.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.logout(ctx)
+
+	zone, err := s.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	// list all txt records on the challenge name, dyn returns them as uris
+	var uris []string
+	err = s.do(ctx, http.MethodGet, "/TXTRecord/"+zone+"/"+ACMEChallengePrefix+"."+hostname+"/", nil, &uris)
+	if err != nil {
+		return err
+	}
+
+	deleted := false
+	for _, uri := range uris {
+		recordPath := strings.TrimPrefix(uri, "/REST")
+
+		var record dynTXTRecord
+		err = s.do(ctx, http.MethodGet, recordPath, nil, &record)
+		if err != nil {
+			return err
+		}
+		if record.RData.TXTData != challengeValue {
+			continue
+		}
+
+		err = s.do(ctx, http.MethodDelete, recordPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return nil
+	}
+	return s.publish(ctx, zone)
+}
+
+// login opens a new session.
+func (d Dyn) login(ctx context.Context) (*dynSession, error) {
+	s := &dynSession{d: d}
+
+	var data struct {
+		Token string `json:"token"`
+	}
+	err := s.do(ctx, http.MethodPost, "/Session/", map[string]string{
+		"customer_name": d.CustomerName,
+		"user_name":     d.UserName,
+		"password":      d.Password,
+	}, &data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to dyn: %v", err)
+	}
+
+	s.token = data.Token
+	return s, nil
+}
+
+// logout closes the session, errors are ignored since the session expires anyway.
+func (s *dynSession) logout(ctx context.Context) {
+	s.do(ctx, http.MethodDelete, "/Session/", nil, nil)
+}
+
+// publish publishes pending changes to zone.
+func (s *dynSession) publish(ctx context.Context, zone string) error {
+	return s.do(ctx, http.MethodPut, "/Zone/"+zone+"/", map[string]bool{"publish": true}, nil)
+}
+
+// findZone returns Zone if set, otherwise the most specific zone in the account that contains hostname.
+func (s *dynSession) findZone(ctx context.Context, hostname string) (string, error) {
+	if s.d.Zone != "" {
+		return strings.TrimSuffix(s.d.Zone, "."), nil
+	}
+
+	var uris []string
+	err := s.do(ctx, http.MethodGet, "/Zone/", nil, &uris)
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range zoneCandidates(hostname) {
+		for _, uri := range uris {
+			if strings.EqualFold(path.Base(strings.TrimSuffix(uri, "/")), candidate) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unable to find dyn zone for %v", hostname)
+}
+
+// do sends a request to the dyn api and decodes the data of the response into out.
+func (s *dynSession) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	endpoint := s.d.Endpoint
+	if endpoint == "" {
+		endpoint = DynEndpoint
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Auth-Token", s.token)
+	}
+
+	client := s.d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// dyn returns errors in the envelope, so decode it even on failure
+	var r dynResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return fmt.Errorf("unexpected response from dyn %v %v: %v", method, path, resp.Status)
+	}
+	if r.Status != "success" {
+		var msgs []string
+		for _, v := range r.Msgs {
+			if v.Lvl == "ERROR" {
+				msgs = append(msgs, v.Info)
+			}
+		}
+		return fmt.Errorf("unexpected response from dyn %v %v: %v %v", method, path, r.Status, strings.Join(msgs, "; "))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Data, out)
+}
@@ -0,0 +1,93 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestDynUpsertDelete(t *testing.T) {
+	var records = make(map[string]string)
+	var publishes int
+	var loggedOut bool
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/Session/" && r.Method == http.MethodPost {
+			fmt.Fprint(w, `{"status":"success","data":{"token":"token"}}`)
+			return
+		}
+		if r.Header.Get("Auth-Token") != "token" {
+			fmt.Fprint(w, `{"status":"failure","msgs":[{"LVL":"ERROR","INFO":"login: Bad or expired credentials"}]}`)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodDelete && r.URL.Path == "/Session/":
+			loggedOut = true
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/Zone/":
+			fmt.Fprint(w, `{"status":"success","data":["/REST/Zone/example.com/","/REST/Zone/example.org/"]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/TXTRecord/example.com/_acme-challenge.foo.example.com/":
+			var record dynTXTRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			records["1"] = record.RData.TXTData
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/TXTRecord/example.com/_acme-challenge.foo.example.com/":
+			fmt.Fprint(w, `{"status":"success","data":["/REST/TXTRecord/example.com/_acme-challenge.foo.example.com/1"]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/TXTRecord/example.com/_acme-challenge.foo.example.com/1":
+			fmt.Fprintf(w, `{"status":"success","data":{"rdata":{"txtdata":%q}}}`, records["1"])
+		case r.Method == http.MethodDelete && r.URL.Path == "/TXTRecord/example.com/_acme-challenge.foo.example.com/1":
+			delete(records, "1")
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/Zone/example.com/":
+			publishes = publishes + 1
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status":"failure"}`)
+		}
+	}))
+	defer ts.Close()
+
+	d := Dyn{
+		Endpoint:     ts.URL,
+		CustomerName: "customer",
+		UserName:     "user",
+		Password:     "password",
+	}
+
+	err := d.Upsert(context.Background(), "foo.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if got, want := records["1"], "value"; got != want {
+		t.Errorf("Got txtdata: %v, Want: %v", got, want)
+	}
+
+	// a different value should not be deleted
+	err = d.Delete(context.Background(), "foo.example.com", "other")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if got, want := len(records), 1; got != want {
+		t.Errorf("Got %v records, Want: %v", got, want)
+	}
+
+	err = d.Delete(context.Background(), "foo.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if got, want := len(records), 0; got != want {
+		t.Errorf("Got %v records, Want: %v", got, want)
+	}
+	if got, want := publishes, 2; got != want {
+		t.Errorf("Got %v publishes, Want: %v", got, want)
+	}
+	if !loggedOut {
+		t.Errorf("Session was not closed")
+	}
+}
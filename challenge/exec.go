@@ -0,0 +1,164 @@
+package challenge
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultExecTimeout = 2 * time.Minute
+)
+
+// Exec performs challenges by running user provided commands, which makes it
+// possible to integrate with any DNS or HTTP infrastructure without writing
+// Go. Present is run before the acme server is asked to validate the
+// challenge and Cleanup is run afterwards, whether validation succeeded or
+// not. Both get the details of the challenge in the environment:
+//
+//	ROMAN_CHALLENGE_TYPE  dns-01 or http-01
+//	ROMAN_DOMAIN          hostname being validated
+//	ROMAN_TOKEN           challenge token
+//	ROMAN_KEY_AUTH        key authorization for the token
+//	ROMAN_FQDN            dns-01 only, name of the TXT record (with a trailing dot)
+//	ROMAN_TXT_VALUE       dns-01 only, value of the TXT record
+//	ROMAN_HTTP_PATH       http-01 only, path the key authorization must be served on
+type Exec struct {
+	// Present and Cleanup are the commands to run, the first element is the
+	// executable and the rest are its arguments. Cleanup is optional.
+	Present []string
+	Cleanup []string
+
+	// ChallengeType is the type of challenge to perform, either DNSChallenge
+	// (default) or HTTPChallenge.
+	ChallengeType string
+
+	// Env is added to the environment of the commands.
+	Env []string
+
+	// Timeout limits how long each command may run, defaults to 2 minutes.
+	Timeout time.Duration
+
+	// PropagationResolver, if set, is used to make sure dns-01 records are
+	// visible before the acme server is asked to validate them.
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (e Exec) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return e.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge. Cleanup still runs when ctx is cancelled.
+func (e Exec) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	challengeType := e.ChallengeType
+	if challengeType == "" {
+		challengeType = DNSChallenge
+	}
+	if challengeType != DNSChallenge && challengeType != HTTPChallenge {
+		return fmt.Errorf("unsupported challenge type: %v", challengeType)
+	}
+
+	challenge, err := GetChallenge(authorization, challengeType)
+	if err != nil {
+		return err
+	}
+
+	env, err := challengeEnv(acmeClient, challenge, hostname)
+	if err != nil {
+		return err
+	}
+	env = append(env, e.Env...)
+
+	// present the challenge, and clean it up once we're done
+	err = e.run(ctx, e.Present, env)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if len(e.Cleanup) > 0 {
+			e.run(detachedContext{ctx}, e.Cleanup, env)
+		}
+	}()
+
+	if challengeType == DNSChallenge && e.PropagationResolver != nil {
+		challengeValue, err := acmeClient.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		err = WaitForPropagation(ctx, e.PropagationResolver, hostname, challengeValue, e.PropagationTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ValidateChallenge(ctx, acmeClient, authorization, challenge)
+}
+
+// run runs command with env added to the environment of the current process.
+// The command is killed when ctx is done or Timeout expires.
+func (e Exec) run(ctx context.Context, command []string, env []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = defaultExecTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%v failed: %v: %v", command[0], err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// challengeEnv returns the environment variables describing challenge.
+func challengeEnv(acmeClient *acme.Client, challenge *acme.Challenge, hostname string) ([]string, error) {
+	// the key authorization is the same for every challenge type
+	keyAuth, err := acmeClient.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{
+		"ROMAN_CHALLENGE_TYPE=" + challenge.Type,
+		"ROMAN_DOMAIN=" + hostname,
+		"ROMAN_TOKEN=" + challenge.Token,
+		"ROMAN_KEY_AUTH=" + keyAuth,
+	}
+
+	switch challenge.Type {
+	case DNSChallenge:
+		challengeValue, err := acmeClient.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env,
+			fmt.Sprintf("ROMAN_FQDN=%v.%v.", ACMEChallengePrefix, hostname),
+			"ROMAN_TXT_VALUE="+challengeValue)
+	case HTTPChallenge:
+		env = append(env, "ROMAN_HTTP_PATH="+acmeClient.HTTP01ChallengePath(challenge.Token))
+	}
+
+	return env, nil
+}
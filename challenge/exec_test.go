@@ -0,0 +1,95 @@
+package challenge
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+func TestChallengeEnv(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+
+	keyAuth, _ := acmeClient.HTTP01ChallengeResponse("token")
+	challengeValue, _ := acmeClient.DNS01ChallengeRecord("token")
+
+	tests := []struct {
+		inType string
+		outEnv []string
+	}{
+		// 0 - dns-01
+		{DNSChallenge, []string{
+			"ROMAN_CHALLENGE_TYPE=dns-01",
+			"ROMAN_DOMAIN=foo.example.com",
+			"ROMAN_TOKEN=token",
+			"ROMAN_KEY_AUTH=" + keyAuth,
+			"ROMAN_FQDN=_acme-challenge.foo.example.com.",
+			"ROMAN_TXT_VALUE=" + challengeValue,
+		}},
+		// 1 - http-01
+		{HTTPChallenge, []string{
+			"ROMAN_CHALLENGE_TYPE=http-01",
+			"ROMAN_DOMAIN=foo.example.com",
+			"ROMAN_TOKEN=token",
+			"ROMAN_KEY_AUTH=" + keyAuth,
+			"ROMAN_HTTP_PATH=/.well-known/acme-challenge/token",
+		}},
+	}
+
+	for i, tt := range tests {
+		env, err := challengeEnv(acmeClient, &acme.Challenge{Type: tt.inType, Token: "token"}, "foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from challengeEnv: %v", i, err)
+		}
+		if got, want := strings.Join(env, "\n"), strings.Join(tt.outEnv, "\n"); got != want {
+			t.Errorf("Test(%v) Got env:\n%v\nWant:\n%v", i, got, want)
+		}
+	}
+}
+
+func TestExecRun(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	e := Exec{}
+
+	// 0 - the environment is passed to the command
+	err := e.run(context.Background(), []string{"sh", "-c", `echo "$ROMAN_DOMAIN" > "$OUT"`}, []string{"ROMAN_DOMAIN=foo.example.com", "OUT=" + out})
+	if err != nil {
+		t.Fatalf("Unexpected response from run: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unexpected response from ReadFile: %v", err)
+	}
+	if got, want := string(b), "foo.example.com\n"; got != want {
+		t.Errorf("Got output: %q, Want: %q", got, want)
+	}
+
+	// 1 - failures include the output of the command
+	err = e.run(context.Background(), []string{"sh", "-c", "echo no such zone >&2; exit 1"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "no such zone") {
+		t.Errorf("Got error: %v, Want: output of the command", err)
+	}
+
+	// 2 - the command is killed when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err = e.run(ctx, []string{"sleep", "10"}, nil)
+	if err == nil {
+		t.Errorf("Expected an error when the context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Got command running for %v, Want: killed on cancel", elapsed)
+	}
+}
@@ -0,0 +1,192 @@
+package challenge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+const (
+	HetznerEndpoint = "https://dns.hetzner.com/api/v1"
+)
+
+// Hetzner performs dns-01 challenges using the Hetzner DNS API. The zone of
+// each hostname is discovered automatically. Hetzner doesn't report when a
+// change is live, so unless PropagationResolver is set, the system resolver
+// is used to make sure the record is visible before validation.
+type Hetzner struct {
+	// APIToken is the Hetzner DNS API token.
+	APIToken string
+
+	// Endpoint is the API endpoint, defaults to HetznerEndpoint.
+	Endpoint string
+
+	// TTL of the challenge record in seconds, defaults to 60.
+	TTL int
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+type hetznerZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type hetznerRecord struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (h Hetzner) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return h.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (h Hetzner) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	resolver := h.PropagationResolver
+	if resolver == nil {
+		resolver = DNSResolver{}
+	}
+
+	return performDNS01(ctx, acmeClient, authorization, hostname, h, resolver, h.PropagationTimeout)
+}
+
+// Upsert creates the challenge record for hostname.
+func (h Hetzner) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	zone, err := h.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	ttl := h.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+
+	return h.do(ctx, http.MethodPost, "/records", hetznerRecord{
+		ZoneID: zone.ID,
+		Type:   "TXT",
+		Name:   relativeRecordName(hostname, zone.Name),
+		Value:  challengeValue,
+		TTL:    ttl,
+	}, nil)
+}
+
+// Delete removes the challenge record for hostname, it's not an error if it doesn't exist.
+func (h Hetzner) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	zone, err := h.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	var r struct {
+		Records []hetznerRecord `json:"records"`
+	}
+	err = h.do(ctx, http.MethodGet, "/records?zone_id="+url.QueryEscape(zone.ID), nil, &r)
+	if err != nil {
+		return err
+	}
+
+	name := relativeRecordName(hostname, zone.Name)
+	for _, v := range r.Records {
+		if v.Type != "TXT" || v.Name != name || strings.Trim(v.Value, `"`) != challengeValue {
+			continue
+		}
+
+		err = h.do(ctx, http.MethodDelete, "/records/"+url.PathEscape(v.ID), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findZone returns the most specific zone in the account that contains hostname.
+func (h Hetzner) findZone(ctx context.Context, hostname string) (*hetznerZone, error) {
+	for _, candidate := range zoneCandidates(hostname) {
+		var r struct {
+			Zones []hetznerZone `json:"zones"`
+		}
+		err := h.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(candidate), nil, &r)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range r.Zones {
+			if strings.EqualFold(v.Name, candidate) {
+				return &v, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unable to find hetzner zone for %v", hostname)
+}
+
+// do sends a request to the hetzner api and decodes the response into out.
+// A 404 for a zone lookup means the zone doesn't exist and is not an error.
+func (h Hetzner) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	endpoint := h.Endpoint
+	if endpoint == "" {
+		endpoint = HetznerEndpoint
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpoint, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Auth-API-Token", h.APIToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/zones") {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from hetzner %v %v: %v", method, path, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
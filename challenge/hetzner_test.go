@@ -0,0 +1,76 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestHetznerUpsertDelete(t *testing.T) {
+	var records []hetznerRecord
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Auth-API-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			if r.URL.Query().Get("name") != "example.com" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"zones": []hetznerZone{{ID: "z1", Name: "example.com"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/records":
+			var record hetznerRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			record.ID = "r1"
+			records = append(records, record)
+			json.NewEncoder(w).Encode(map[string]interface{}{"record": record})
+		case r.Method == http.MethodGet && r.URL.Path == "/records":
+			json.NewEncoder(w).Encode(map[string]interface{}{"records": records})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/records/"):
+			records = nil
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	h := Hetzner{APIToken: "token", Endpoint: ts.URL}
+
+	err := h.Upsert(context.Background(), "foo.bar.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if got, want := len(records), 1; got != want {
+		t.Fatalf("Got %v records, Want: %v", got, want)
+	}
+	if got, want := records[0].ZoneID, "z1"; got != want {
+		t.Errorf("Got zone id: %v, Want: %v", got, want)
+	}
+	if got, want := records[0].Name, "_acme-challenge.foo.bar"; got != want {
+		t.Errorf("Got record name: %v, Want: %v", got, want)
+	}
+
+	err = h.Delete(context.Background(), "foo.bar.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if got, want := len(records), 0; got != want {
+		t.Errorf("Got %v records, Want: %v", got, want)
+	}
+
+	// hosts outside of any zone fail
+	err = h.Upsert(context.Background(), "foo.example.org", "value")
+	if err == nil {
+		t.Errorf("Expected an error for a host without a zone")
+	}
+}
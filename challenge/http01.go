@@ -0,0 +1,105 @@
+package challenge
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+// HTTP01 performs http-01 challenges by serving the key authorization on
+// /.well-known/acme-challenge/<token>. It can be used on hosts where we
+// control port 80 but not DNS.
+//
+// Responses are served by the http.Handler returned by Handler, which can be
+// mounted on an existing port 80 server. Alternatively, if Address is set, a
+// temporary server is started on it for the duration of each challenge.
+// HTTP01 must be used as a pointer.
+type HTTP01 struct {
+	// Address, if set, is where a temporary server is started while a
+	// challenge is being performed, for example ":80".
+	Address string
+
+	mu        sync.RWMutex
+	responses map[string]string // challenge path to key authorization
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (h *HTTP01) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return h.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (h *HTTP01) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	// extract the http challenge from the authorization
+	challenge, err := GetChallenge(authorization, HTTPChallenge)
+	if err != nil {
+		return err
+	}
+
+	response, err := acmeClient.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	path := acmeClient.HTTP01ChallengePath(challenge.Token)
+
+	// start serving the response, and stop once we're done
+	h.setResponse(path, response)
+	defer h.removeResponse(path)
+
+	if h.Address != "" {
+		listener, err := net.Listen("tcp", h.Address)
+		if err != nil {
+			return fmt.Errorf("unable to listen on %v: %v", h.Address, err)
+		}
+
+		server := &http.Server{Handler: h.Handler(nil)}
+		go server.Serve(listener)
+		defer server.Close()
+	}
+
+	return ValidateChallenge(ctx, acmeClient, authorization, challenge)
+}
+
+// Handler returns an http.Handler that serves challenge responses. Requests
+// for anything else are passed to fallback, or get a 404 if fallback is nil.
+func (h *HTTP01) Handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		response, ok := h.responses[r.URL.Path]
+		h.mu.RUnlock()
+
+		if ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(response))
+			return
+		}
+
+		if fallback == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+func (h *HTTP01) setResponse(path string, response string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.responses == nil {
+		h.responses = make(map[string]string)
+	}
+	h.responses[path] = response
+}
+
+func (h *HTTP01) removeResponse(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.responses, path)
+}
@@ -0,0 +1,52 @@
+package challenge
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTP01Handler(t *testing.T) {
+	h := &HTTP01{}
+	h.setResponse("/.well-known/acme-challenge/token", "token.thumbprint")
+
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		inHandler http.Handler
+		inPath    string
+		outStatus int
+		outBody   string
+	}{
+		// 0 - challenge response
+		{h.Handler(nil), "/.well-known/acme-challenge/token", http.StatusOK, "token.thumbprint"},
+		// 1 - unknown token without fallback
+		{h.Handler(nil), "/.well-known/acme-challenge/other", http.StatusNotFound, "404 page not found\n"},
+		// 2 - anything else goes to the fallback
+		{h.Handler(fallback), "/index.html", http.StatusTeapot, ""},
+	}
+
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.inHandler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.inPath, nil))
+
+		body, _ := io.ReadAll(w.Body)
+		if got, want := w.Code, tt.outStatus; got != want {
+			t.Errorf("Test(%v) Got status: %v, Want: %v", i, got, want)
+		}
+		if got, want := string(body), tt.outBody; got != want {
+			t.Errorf("Test(%v) Got body: %q, Want: %q", i, got, want)
+		}
+	}
+
+	// once the challenge is done, the response is no longer served
+	h.removeResponse("/.well-known/acme-challenge/token")
+	w := httptest.NewRecorder()
+	h.Handler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/token", nil))
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("Got status: %v, Want: %v", got, want)
+	}
+}
@@ -2,9 +2,22 @@ package challenge
 
 import (
 	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
 )
 
 type Performer interface {
 	// Perform will perform the requested challenge in *acme.Authorization against the *acme.Client.
 	Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error
 }
+
+// ContextPerformer is implemented by performers that take a context, which
+// carries the trace of the caller and cancels the challenge.
+type ContextPerformer interface {
+	// PerformContext is like Perform with a context.
+	PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error
+}
+
+type TXTResolver interface {
+	// LookupTXT returns the TXT records published for a fully qualified domain name.
+	LookupTXT(ctx context.Context, fqdn string) ([]string, error)
+}
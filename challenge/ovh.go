@@ -0,0 +1,249 @@
+package challenge
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+const (
+	OVHEurope = "https://eu.api.ovh.com/1.0"
+	OVHCanada = "https://ca.api.ovh.com/1.0"
+	OVHUS     = "https://api.us.ovhcloud.com/1.0"
+)
+
+// OVH performs dns-01 challenges using the OVH API with the consumer key
+// authentication model. The consumer key needs GET, POST, and DELETE access
+// to /domain/zone/*. Zones are discovered automatically unless Zone is set.
+type OVH struct {
+	// Endpoint is the OVH API endpoint, defaults to OVHEurope.
+	Endpoint string
+
+	ApplicationKey    string
+	ApplicationSecret string
+	ConsumerKey       string
+
+	// Zone is the zone records are created in, if empty the most specific
+	// zone in the account that contains the hostname is used.
+	Zone string
+
+	// TTL of the challenge record in seconds, defaults to 60.
+	TTL int
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	PropagationResolver TXTResolver
+	PropagationTimeout  time.Duration
+}
+
+type ovhRecord struct {
+	ID        int64  `json:"id,omitempty"`
+	FieldType string `json:"fieldType"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl,omitempty"`
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (o OVH) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return o.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (o OVH) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	resolver := o.PropagationResolver
+	if resolver == nil {
+		resolver = DNSResolver{}
+	}
+
+	return performDNS01(ctx, acmeClient, authorization, hostname, o, resolver, o.PropagationTimeout)
+}
+
+// Upsert creates the challenge record for hostname and refreshes the zone.
+func (o OVH) Upsert(ctx context.Context, hostname string, challengeValue string) error {
+	zone, err := o.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	ttl := o.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+
+	err = o.do(ctx, http.MethodPost, "/domain/zone/"+zone+"/record", ovhRecord{
+		FieldType: "TXT",
+		SubDomain: relativeRecordName(hostname, zone),
+		Target:    challengeValue,
+		TTL:       ttl,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	return o.do(ctx, http.MethodPost, "/domain/zone/"+zone+"/refresh", nil, nil)
+}
+
+// Delete removes the challenge record for hostname and refreshes the zone.
+func (o OVH) Delete(ctx context.Context, hostname string, challengeValue string) error {
+	zone, err := o.findZone(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	// find all txt records with the challenge name
+	query := url.Values{}
+	query.Set("fieldType", "TXT")
+	query.Set("subDomain", relativeRecordName(hostname, zone))
+
+	var ids []int64
+	err = o.do(ctx, http.MethodGet, "/domain/zone/"+zone+"/record?"+query.Encode(), nil, &ids)
+	if err != nil {
+		return err
+	}
+
+	deleted := false
+	for _, id := range ids {
+		recordPath := "/domain/zone/" + zone + "/record/" + strconv.FormatInt(id, 10)
+
+		var record ovhRecord
+		err = o.do(ctx, http.MethodGet, recordPath, nil, &record)
+		if err != nil {
+			return err
+		}
+		if strings.Trim(record.Target, `"`) != challengeValue {
+			continue
+		}
+
+		err = o.do(ctx, http.MethodDelete, recordPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return nil
+	}
+	return o.do(ctx, http.MethodPost, "/domain/zone/"+zone+"/refresh", nil, nil)
+}
+
+// findZone returns Zone if set, otherwise the most specific zone in the account that contains hostname.
+func (o OVH) findZone(ctx context.Context, hostname string) (string, error) {
+	if o.Zone != "" {
+		return strings.TrimSuffix(o.Zone, "."), nil
+	}
+
+	var zones []string
+	err := o.do(ctx, http.MethodGet, "/domain/zone", nil, &zones)
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range zoneCandidates(hostname) {
+		for _, v := range zones {
+			if strings.EqualFold(v, candidate) {
+				return v, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unable to find ovh zone for %v", hostname)
+}
+
+// do sends a signed request to the ovh api and decodes the response into out.
+func (o OVH) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	endpoint := o.Endpoint
+	if endpoint == "" {
+		endpoint = OVHEurope
+	}
+	u := strings.TrimSuffix(endpoint, "/") + path
+
+	// ovh rejects requests if our clock is off, so use their time
+	timestamp, err := o.time(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ovh-Application", o.ApplicationKey)
+	req.Header.Set("X-Ovh-Consumer", o.ConsumerKey)
+	req.Header.Set("X-Ovh-Timestamp", timestamp)
+	req.Header.Set("X-Ovh-Signature", ovhSignature(o.ApplicationSecret, o.ConsumerKey, method, u, string(body), timestamp))
+
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from ovh %v %v: %v", method, path, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// time returns the current time of the ovh api as a unix timestamp.
+func (o OVH) time(ctx context.Context, endpoint string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/auth/time", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var timestamp int64
+	err = json.NewDecoder(resp.Body).Decode(&timestamp)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode ovh time: %v", err)
+	}
+
+	return strconv.FormatInt(timestamp, 10), nil
+}
+
+func (o OVH) client() *http.Client {
+	if o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
+
+// ovhSignature signs a request the way the ovh api expects.
+func ovhSignature(applicationSecret string, consumerKey string, method string, u string, body string, timestamp string) string {
+	h := sha1.New()
+	h.Write([]byte(strings.Join([]string{applicationSecret, consumerKey, method, u, body, timestamp}, "+")))
+	return "$1$" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,85 @@
+package challenge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestOVHUpsertDelete(t *testing.T) {
+	var records = make(map[string]ovhRecord)
+	var refreshes int
+	var ts *httptest.Server
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/time" {
+			fmt.Fprint(w, "1136171040")
+			return
+		}
+
+		// check the signature of every other request
+		body, _ := io.ReadAll(r.Body)
+		signature := ovhSignature("secret", "consumer", r.Method, ts.URL+r.URL.RequestURI(), string(body), "1136171040")
+		if r.Header.Get("X-Ovh-Signature") != signature || r.Header.Get("X-Ovh-Application") != "application" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/domain/zone":
+			fmt.Fprint(w, `["example.com","example.org"]`)
+		case r.Method == http.MethodPost && r.URL.Path == "/domain/zone/example.com/record":
+			var record ovhRecord
+			json.Unmarshal(body, &record)
+			record.ID = 42
+			records["42"] = record
+			json.NewEncoder(w).Encode(record)
+		case r.Method == http.MethodPost && r.URL.Path == "/domain/zone/example.com/refresh":
+			refreshes = refreshes + 1
+		case r.Method == http.MethodGet && r.URL.Path == "/domain/zone/example.com/record":
+			if r.URL.Query().Get("subDomain") != "_acme-challenge.foo" {
+				fmt.Fprint(w, `[]`)
+				return
+			}
+			fmt.Fprint(w, `[42]`)
+		case r.Method == http.MethodGet && r.URL.Path == "/domain/zone/example.com/record/42":
+			json.NewEncoder(w).Encode(records["42"])
+		case r.Method == http.MethodDelete && r.URL.Path == "/domain/zone/example.com/record/42":
+			delete(records, "42")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	o := OVH{
+		Endpoint:          ts.URL,
+		ApplicationKey:    "application",
+		ApplicationSecret: "secret",
+		ConsumerKey:       "consumer",
+	}
+
+	err := o.Upsert(context.Background(), "foo.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Upsert: %v", err)
+	}
+	if got, want := records["42"].SubDomain, "_acme-challenge.foo"; got != want {
+		t.Errorf("Got subdomain: %v, Want: %v", got, want)
+	}
+
+	err = o.Delete(context.Background(), "foo.example.com", "value")
+	if err != nil {
+		t.Fatalf("Unexpected response from Delete: %v", err)
+	}
+	if got, want := len(records), 0; got != want {
+		t.Errorf("Got %v records, Want: %v", got, want)
+	}
+	if got, want := refreshes, 2; got != want {
+		t.Errorf("Got %v zone refreshes, Want: %v", got, want)
+	}
+}
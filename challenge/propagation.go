@@ -0,0 +1,85 @@
+package challenge
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultPropagationTimeout = 10 * time.Minute
+)
+
+var (
+	propagationInterval = 10 * time.Second // used to speed up tests
+)
+
+// DNSResolver looks up TXT records over plain DNS (UDP/TCP port 53). If
+// Nameserver (host:port) is empty, the system resolver is used.
+type DNSResolver struct {
+	Nameserver string
+}
+
+// LookupTXT returns the TXT records published for fqdn. A name that does not
+// exist yet is not an error, it simply has no records.
+func (d DNSResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	resolver := &net.Resolver{}
+
+	// if a nameserver was passed in, send all queries to it instead of the
+	// nameservers in the system configuration
+	if d.Nameserver != "" {
+		resolver.PreferGo = true
+		resolver.Dial = func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, d.Nameserver)
+		}
+	}
+
+	records, err := resolver.LookupTXT(ctx, fqdn)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// WaitForPropagation polls resolver until the challenge record for hostname
+// contains challengeValue, timeout expires or ctx is cancelled.
+func WaitForPropagation(parent context.Context, resolver TXTResolver, hostname string, challengeValue string, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = defaultPropagationTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname)
+
+	for {
+		records, err := resolver.LookupTXT(ctx, recordName)
+		if err == nil {
+			for _, v := range records {
+				if v == challengeValue {
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			if err != nil {
+				return fmt.Errorf("timed out waiting for %v to propagate: %v", recordName, err)
+			}
+			return fmt.Errorf("timed out waiting for %v to propagate", recordName)
+		case <-time.After(propagationInterval):
+		}
+	}
+}
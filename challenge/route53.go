@@ -21,82 +21,48 @@ type Route53 struct {
 	HostedZoneID     string
 	HostedDomainName string
 	WaitForSync      bool
-}
-
-// Perform will perform the challenge against an acmeClient.
-func (r Route53) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
-	// get a route53 client that can perform crud actions against route53
-	r53, err := newRoute53Client(r)
-	if err != nil {
-		return err
-	}
-
-	// extract the dns challenge from the authorization
-	challenge, err := getChallenge(authorization)
-	if err != nil {
-		return err
-	}
 
-	// challengeValue create from the token, it's a fingerprint of your public key
-	// and the token, hashed, then base64 encoded.
-	challengeValue, err := acmeClient.DNS01ChallengeRecord(challenge.Token)
-	if err != nil {
-		return err
-	}
+	// FollowCNAME, if set, places the challenge record at the end of the
+	// CNAME chain of _acme-challenge.<hostname> instead of the name itself,
+	// for setups that delegate validation to a dedicated zone.
+	FollowCNAME bool
 
-	// update dns record with challenge value
-	err = r53.Upsert(hostname, challengeValue)
-	if err != nil {
-		return fmt.Errorf("unexpected response from DNS upserter: %v", err)
-	}
+	// CNAMEHostedZoneID is the hosted zone CNAME targets are created in,
+	// defaults to HostedZoneID.
+	CNAMEHostedZoneID string
 
-	// the interaction with the acme server should not take longer than 10 minutes
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
+	// PropagationResolver, if set, is used to make sure the challenge record
+	// is visible before the ACME server is asked to validate it.
+	PropagationResolver TXTResolver
 
-	// notify acme server that you've updated dns
-	_, err = acmeClient.Accept(ctx, challenge)
-	if err != nil {
-		return fmt.Errorf("unexpected response from acmeClient.Accept: %v", err)
-	}
+	// PropagationTimeout is how long to wait for the challenge record to
+	// become visible, defaults to 10 minutes.
+	PropagationTimeout time.Duration
+}
 
-	// wait for acme sever to response
-	_, err = acmeClient.WaitAuthorization(ctx, authorization.URI)
-	if err != nil {
-		return err
-	}
+// Perform will perform the challenge against an acmeClient.
+func (r Route53) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return r.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
 
-	// remove the record so we don't pollute dns
-	err = r53.Delete(hostname, challengeValue)
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge.
+func (r Route53) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	// get a route53 client that can perform crud actions against route53
+	r53, err := newRoute53Client(r)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// getChallenge checks if the authorization contains a challenge that can be performed,
-// and if one is found, it is also returned.
-func getChallenge(authorization *acme.Authorization) (*acme.Challenge, error) {
-	var c *acme.Challenge
-
-	for _, v := range authorization.Challenges {
-		if v.Type == DNSChallenge {
-			c = v
-			break
-		}
-	}
-	if c == nil {
-		return c, fmt.Errorf("%v challenge type not in list of supported challenges: %v", DNSChallenge, authorization.Challenges)
-	}
-
-	return c, nil
+	return performDNS01(ctx, acmeClient, authorization, hostname, r53, r.PropagationResolver, r.PropagationTimeout)
 }
 
 type route53Client struct {
-	sess         *session.Session
-	hostedZoneID string
-	waitForSync  bool
+	sess              *session.Session
+	hostedZoneID      string
+	waitForSync       bool
+	followCNAME       bool
+	cnameHostedZoneID string
 }
 
 func newRoute53Client(c Route53) (*route53Client, error) {
@@ -121,14 +87,27 @@ func newRoute53Client(c Route53) (*route53Client, error) {
 		return nil, err
 	}
 
-	return &route53Client{sess, c.HostedZoneID, c.WaitForSync}, nil
+	return &route53Client{sess, c.HostedZoneID, c.WaitForSync, c.FollowCNAME, c.CNAMEHostedZoneID}, nil
 }
 
-func (r route53Client) Upsert(hostname string, challengeValue string) error {
+// record returns the name of the challenge record for hostname and the hosted
+// zone it's in.
+func (r route53Client) record(hostname string) (string, string) {
+	recordName := challengeRecordName(hostname, r.followCNAME)
+
+	// delegated records live in the cname zone if there is one
+	if r.cnameHostedZoneID != "" && recordName != fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname) {
+		return recordName, r.cnameHostedZoneID
+	}
+
+	return recordName, r.hostedZoneID
+}
+
+func (r route53Client) Upsert(ctx context.Context, hostname string, challengeValue string) error {
 	svc := route53.New(r.sess)
 
 	challengeValue = fmt.Sprintf(`"%v"`, challengeValue)
-	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname)
+	recordName, hostedZoneID := r.record(hostname)
 
 	// prepare upsert request
 	input := &route53.ChangeResourceRecordSetsInput{
@@ -149,11 +128,11 @@ func (r route53Client) Upsert(hostname string, challengeValue string) error {
 				},
 			},
 		},
-		HostedZoneId: aws.String(r.hostedZoneID),
+		HostedZoneId: aws.String(hostedZoneID),
 	}
 
 	// perform the upsert request
-	output, err := svc.ChangeResourceRecordSets(input)
+	output, err := svc.ChangeResourceRecordSetsWithContext(ctx, input)
 	if err != nil {
 		return err
 	}
@@ -171,7 +150,7 @@ func (r route53Client) Upsert(hostname string, challengeValue string) error {
 				in := &route53.GetChangeInput{
 					Id: output.ChangeInfo.Id,
 				}
-				out, err := svc.GetChange(in)
+				out, err := svc.GetChangeWithContext(ctx, in)
 				if err != nil {
 					return err
 				}
@@ -182,7 +161,11 @@ func (r route53Client) Upsert(hostname string, challengeValue string) error {
 				}
 
 				// wait and try again
-				time.Sleep(30 * time.Second)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(30 * time.Second):
+				}
 			}
 		}
 	}
@@ -191,21 +174,21 @@ success:
 	return nil
 }
 
-func (r route53Client) Read(hostname string) (string, error) {
+func (r route53Client) Read(ctx context.Context, hostname string) (string, error) {
 	svc := route53.New(r.sess)
 
-	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname)
+	recordName, hostedZoneID := r.record(hostname)
 
 	// prepare read request
 	input := &route53.ListResourceRecordSetsInput{
-		HostedZoneId:    aws.String(r.hostedZoneID),
+		HostedZoneId:    aws.String(hostedZoneID),
 		MaxItems:        aws.String("1"),
 		StartRecordName: aws.String(recordName),
 		StartRecordType: aws.String(route53.RRTypeTxt),
 	}
 
 	// perform read request
-	output, err := svc.ListResourceRecordSets(input)
+	output, err := svc.ListResourceRecordSetsWithContext(ctx, input)
 	if err != nil {
 		return "", err
 	}
@@ -225,11 +208,11 @@ func (r route53Client) Read(hostname string) (string, error) {
 	return strings.Trim(*rr.Value, `"`), nil
 }
 
-func (r route53Client) Delete(hostname string, challengeValue string) error {
+func (r route53Client) Delete(ctx context.Context, hostname string, challengeValue string) error {
 	svc := route53.New(r.sess)
 
 	challengeValue = fmt.Sprintf(`"%v"`, challengeValue)
-	recordName := fmt.Sprintf("%v.%v.", ACMEChallengePrefix, hostname)
+	recordName, hostedZoneID := r.record(hostname)
 
 	// prepare delete request
 	input := &route53.ChangeResourceRecordSetsInput{
@@ -250,11 +233,11 @@ func (r route53Client) Delete(hostname string, challengeValue string) error {
 				},
 			},
 		},
-		HostedZoneId: aws.String(r.hostedZoneID),
+		HostedZoneId: aws.String(hostedZoneID),
 	}
 
 	// perform the delete request
-	output, err := svc.ChangeResourceRecordSets(input)
+	output, err := svc.ChangeResourceRecordSetsWithContext(ctx, input)
 	if err != nil {
 		// if the error was not found, return success
 		if strings.Contains(err.Error(), "not found") {
@@ -277,7 +260,7 @@ func (r route53Client) Delete(hostname string, challengeValue string) error {
 				in := &route53.GetChangeInput{
 					Id: output.ChangeInfo.Id,
 				}
-				out, err := svc.GetChange(in)
+				out, err := svc.GetChangeWithContext(ctx, in)
 				if err != nil {
 					return err
 				}
@@ -288,7 +271,11 @@ func (r route53Client) Delete(hostname string, challengeValue string) error {
 				}
 
 				// wait and try again
-				time.Sleep(30 * time.Second)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(30 * time.Second):
+				}
 			}
 		}
 	}
@@ -9,6 +9,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 var _ = fmt.Printf // for testing
@@ -40,19 +42,19 @@ func TestRoute53CRUD(t *testing.T) {
 	}
 
 	// remove dns record that may exist
-	err = r53.Delete(fqdn, challengeValue)
+	err = r53.Delete(context.Background(), fqdn, challengeValue)
 	if err != nil {
 		t.Fatalf("Unexpected response from Delete: %v", err)
 	}
 
 	// create a new dns record
-	err = r53.Upsert(fqdn, challengeValue)
+	err = r53.Upsert(context.Background(), fqdn, challengeValue)
 	if err != nil {
 		t.Fatalf("Unexpected response from Upsert: %v", err)
 	}
 
 	// read in dns record
-	cv, err := r53.Read(fqdn)
+	cv, err := r53.Read(context.Background(), fqdn)
 	if err != nil {
 		t.Fatalf("Unexpected response form Read: %v", err)
 	}
@@ -63,7 +65,7 @@ func TestRoute53CRUD(t *testing.T) {
 	}
 
 	// cleanup
-	err = r53.Delete(fqdn, challengeValue)
+	err = r53.Delete(context.Background(), fqdn, challengeValue)
 	if err != nil {
 		t.Fatalf("Unexpected response from Delete: %v", err)
 	}
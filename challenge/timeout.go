@@ -0,0 +1,30 @@
+package challenge
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultValidationTimeout = 10 * time.Minute
+)
+
+type validationTimeoutKey struct{}
+
+// WithValidationTimeout returns a copy of ctx that limits how long the ACME
+// server may take to validate challenges performed with it, instead of 10
+// minutes. It's set by acme.Client from its Timeouts.
+func WithValidationTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, validationTimeoutKey{}, timeout)
+}
+
+// ValidationTimeout returns the validation timeout set in ctx, or 10
+// minutes. Performers that validate challenges themselves should use it.
+func ValidationTimeout(ctx context.Context) time.Duration {
+	timeout, ok := ctx.Value(validationTimeoutKey{}).(time.Duration)
+	if !ok || timeout <= 0 {
+		return defaultValidationTimeout
+	}
+	return timeout
+}
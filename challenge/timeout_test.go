@@ -0,0 +1,35 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestValidationTimeout(t *testing.T) {
+	tests := []struct {
+		inTimeout  time.Duration
+		outTimeout time.Duration
+	}{
+		// 0 - not set
+		{0, 10 * time.Minute},
+		// 1 - longer for a slow ca
+		{30 * time.Minute, 30 * time.Minute},
+		// 2 - shorter for ci
+		{5 * time.Second, 5 * time.Second},
+		// 3 - negative values are ignored
+		{-1, 10 * time.Minute},
+	}
+
+	for i, tt := range tests {
+		ctx := context.Background()
+		if tt.inTimeout != 0 {
+			ctx = WithValidationTimeout(ctx, tt.inTimeout)
+		}
+
+		if got, want := ValidationTimeout(ctx), tt.outTimeout; got != want {
+			t.Errorf("Test(%v) Got timeout: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package challenge
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	tracerName = "github.com/mailgun/roman/challenge"
+)
+
+// startSpan starts a span for hostname with the tracer provider of the span
+// in ctx, which does nothing if there is none.
+func startSpan(ctx context.Context, name string, hostname string) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("roman.hostname", hostname)))
+}
+
+// endSpan ends span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,49 @@
+package challenge
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+)
+
+func TestPerformDNS01Tracing(t *testing.T) {
+	propagationInterval = 10 * time.Millisecond
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	authorization := &acme.Authorization{
+		URI: "https://acme.example.com/authorization/1",
+		Challenges: []*acme.Challenge{
+			{Type: DNSChallenge, Token: "abc"},
+		},
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	performDNS01(ctx, &acme.Client{Key: key}, authorization, "foo.example.com", &recordingUpdater{}, emptyResolver{}, 50*time.Millisecond)
+	parent.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.Parent().TraceID() != parent.SpanContext().TraceID() && span.Name() != "parent" {
+			t.Errorf("Span %v is not part of the trace", span.Name())
+		}
+		names = append(names, span.Name())
+	}
+	if got, want := fmt.Sprint(names), "[dns01.Upsert dns01.WaitForPropagation dns01.Delete dns01.Perform parent]"; got != want {
+		t.Errorf("Got spans: %v, Want: %v", got, want)
+	}
+}
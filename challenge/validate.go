@@ -0,0 +1,82 @@
+package challenge
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/internal/logging"
+)
+
+const (
+	defaultCleanupTimeout = time.Minute
+)
+
+// ValidateChallenge asks the acme server to validate challenge and waits for
+// the authorization to become valid. It takes ValidationTimeout(ctx) at most
+// and stops when ctx is cancelled. Performers outside this package should use
+// it so they behave like the ones in it.
+func ValidateChallenge(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, challenge *acme.Challenge) (err error) {
+	ctx, span := startSpan(ctx, "challenge.Validate", authorization.Identifier.Value)
+	defer func() { endSpan(span, err) }()
+
+	// the interaction with the acme server should not take longer than 10
+	// minutes, unless the caller asked for another timeout
+	ctx, cancel := context.WithTimeout(ctx, ValidationTimeout(ctx))
+	defer cancel()
+
+	start := time.Now()
+	defer func() { logging.Step(ctx, "validation", authorization.Identifier.Value, start, err) }()
+
+	// notify acme server that we're ready to be validated
+	_, err = acmeClient.Accept(ctx, challenge)
+	if err != nil {
+		return fmt.Errorf("unexpected response from acmeClient.Accept: %w", err)
+	}
+
+	// wait for the acme server to respond
+	_, err = acmeClient.WaitAuthorization(ctx, authorization.URI)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetChallenge checks if the authorization contains a challenge of challengeType,
+// and if one is found, it is also returned.
+func GetChallenge(authorization *acme.Authorization, challengeType string) (*acme.Challenge, error) {
+	var c *acme.Challenge
+
+	for _, v := range authorization.Challenges {
+		if v.Type == challengeType {
+			c = v
+			break
+		}
+	}
+	if c == nil {
+		return c, fmt.Errorf("%v challenge type not in list of supported challenges: %v", challengeType, authorization.Challenges)
+	}
+
+	return c, nil
+}
+
+// CleanupContext returns a context to remove a challenge with once it's done.
+// It carries the values (and trace) of ctx but isn't cancelled with it, so
+// records are cleaned up after a cancelled challenge too, and expires after a
+// minute.
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, defaultCleanupTimeout)
+}
+
+// detachedContext carries the values of its parent but is never cancelled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detachedContext) Done() <-chan struct{}             { return nil }
+func (d detachedContext) Err() error                        { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
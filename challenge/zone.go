@@ -0,0 +1,32 @@
+package challenge
+
+import (
+	"strings"
+)
+
+// zoneCandidates returns the names a hosted zone for hostname could have,
+// longest first. For example foo.bar.example.com returns foo.bar.example.com,
+// bar.example.com, and example.com.
+func zoneCandidates(hostname string) []string {
+	labels := strings.Split(strings.TrimSuffix(hostname, "."), ".")
+
+	var candidates []string
+	for i := 0; i < len(labels)-1; i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+
+	return candidates
+}
+
+// relativeRecordName returns the name of the challenge record for hostname
+// relative to zone, for example _acme-challenge.foo for foo.example.com in
+// example.com.
+func relativeRecordName(hostname string, zone string) string {
+	hostname = strings.TrimSuffix(hostname, ".")
+	zone = strings.TrimSuffix(zone, ".")
+
+	if hostname == zone {
+		return ACMEChallengePrefix
+	}
+	return ACMEChallengePrefix + "." + strings.TrimSuffix(hostname, "."+zone)
+}
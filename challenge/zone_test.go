@@ -0,0 +1,30 @@
+package challenge
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestZoneCandidates(t *testing.T) {
+	if got, want := fmt.Sprint(zoneCandidates("foo.bar.example.com.")), "[foo.bar.example.com bar.example.com example.com]"; got != want {
+		t.Errorf("Got zone candidates: %v, Want: %v", got, want)
+	}
+}
+
+func TestRelativeRecordName(t *testing.T) {
+	tests := []struct {
+		inHostname string
+		inZone     string
+		out        string
+	}{
+		{"foo.example.com", "example.com", "_acme-challenge.foo"},
+		{"foo.bar.example.com", "example.com.", "_acme-challenge.foo.bar"},
+		{"example.com", "example.com", "_acme-challenge"},
+	}
+
+	for i, tt := range tests {
+		if got, want := relativeRecordName(tt.inHostname, tt.inZone), tt.out; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package roman
+
+import (
+	"strings"
+
+	"github.com/mailgun/roman/acme"
+)
+
+// clientForHost returns the CertificateForDomainer used to obtain
+// certificates for hostname. An exact match in ACMEClients wins, then the
+// longest matching "*." pattern, then ACMEClient.
+func (m *CertificateManager) clientForHost(hostname string) acme.CertificateForDomainer {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+
+	if key := m.matchClient(hostname); key != "" {
+		return m.ACMEClients[key]
+	}
+
+	return m.ACMEClient
+}
+
+// clientKey returns the key in ACMEClients used for hostname, or an empty
+// string if hostname uses ACMEClient.
+func (m *CertificateManager) clientKey(hostname string) string {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+
+	return m.matchClient(hostname)
+}
+
+// matchClient is clientKey, the caller must hold settingsMu.
+func (m *CertificateManager) matchClient(hostname string) string {
+	if _, ok := m.ACMEClients[hostname]; ok {
+		return hostname
+	}
+
+	var match string
+	for pattern := range m.ACMEClients {
+		if !strings.HasPrefix(pattern, "*.") {
+			continue
+		}
+		if strings.HasSuffix(hostname, pattern[1:]) && len(pattern) > len(match) {
+			match = pattern
+		}
+	}
+
+	return match
+}
@@ -0,0 +1,51 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	"github.com/mailgun/roman/acme"
+)
+
+// namedCertificateForDomainer is used to tell CertificateForDomainers apart in tests.
+type namedCertificateForDomainer string
+
+func (n namedCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	return nil, fmt.Errorf("%v can't issue certificates", n)
+}
+
+func TestClientForHost(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient: namedCertificateForDomainer("public"),
+		ACMEClients: map[string]acme.CertificateForDomainer{
+			"*.corp.example.com":    namedCertificateForDomainer("internal"),
+			"*.eu.corp.example.com": namedCertificateForDomainer("internal-eu"),
+			"vpn.corp.example.com":  namedCertificateForDomainer("vpn"),
+		},
+	}
+
+	tests := []struct {
+		inHostname string
+		outClient  string
+	}{
+		// 0 - no match uses the default
+		{"www.example.com", "public"},
+		// 1 - wildcard pattern
+		{"git.corp.example.com", "internal"},
+		// 2 - deeper subdomains match too
+		{"a.b.corp.example.com", "internal"},
+		// 3 - longest pattern wins
+		{"git.eu.corp.example.com", "internal-eu"},
+		// 4 - exact match wins over patterns
+		{"vpn.corp.example.com", "vpn"},
+		// 5 - the pattern itself doesn't match the base domain
+		{"corp.example.com", "public"},
+	}
+
+	for i, tt := range tests {
+		if got, want := fmt.Sprint(m.clientForHost(tt.inHostname)), tt.outClient; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
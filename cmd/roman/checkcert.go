@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/mailgun/roman"
+)
+
+// standard monitoring plugin exit codes
+const (
+	statusOK       = 0
+	statusWarning  = 1
+	statusCritical = 2
+	statusUnknown  = 3
+)
+
+var statusNames = map[int]string{
+	statusOK:       "OK",
+	statusWarning:  "WARNING",
+	statusCritical: "CRITICAL",
+	statusUnknown:  "UNKNOWN",
+}
+
+// checkCert looks up the cached certificate for a host and exits with a
+// nagios/zabbix compatible exit code and a one line status.
+func checkCert(args []string) int {
+	flags := flag.NewFlagSet("checkcert", flag.ContinueOnError)
+	var cachePath = flags.String("cache-path", ".", "path to certificate cache")
+	var hostname = flags.String("host", "", "hostname of the certificate to check")
+	var warn = flags.String("warn", "21d", "warn when the certificate expires within this duration")
+	var crit = flags.String("crit", "7d", "critical when the certificate expires within this duration")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return statusUnknown
+	}
+
+	if *hostname == "" {
+		fmt.Printf("UNKNOWN - hostname is required\n")
+		return statusUnknown
+	}
+
+	warnDuration, err := parseDuration(*warn)
+	if err != nil {
+		fmt.Printf("UNKNOWN - invalid warn threshold: %v\n", err)
+		return statusUnknown
+	}
+	critDuration, err := parseDuration(*crit)
+	if err != nil {
+		fmt.Printf("UNKNOWN - invalid crit threshold: %v\n", err)
+		return statusUnknown
+	}
+
+	// read the certificate the same way a CertificateManager would
+	m := roman.CertificateManager{
+		Cache:     autocert.DirCache(*cachePath),
+		ServeOnly: true, // only read, never migrate cache records
+	}
+	certificate, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: *hostname})
+	if err != nil {
+		if err == autocert.ErrCacheMiss {
+			fmt.Printf("CRITICAL - %v no certificate in cache\n", *hostname)
+			return statusCritical
+		}
+		fmt.Printf("UNKNOWN - %v unable to read certificate: %v\n", *hostname, err)
+		return statusUnknown
+	}
+
+	status, message := evaluateExpiry(*hostname, certificate.Leaf.NotAfter, time.Now(), warnDuration, critDuration)
+	fmt.Printf("%v - %v\n", statusNames[status], message)
+
+	return status
+}
+
+// evaluateExpiry returns the monitoring status and message for a certificate that expires at notAfter.
+func evaluateExpiry(hostname string, notAfter time.Time, now time.Time, warn time.Duration, crit time.Duration) (int, string) {
+	remaining := notAfter.Sub(now)
+
+	if remaining <= 0 {
+		return statusCritical, fmt.Sprintf("%v certificate expired on %v", hostname, notAfter.UTC().Format(time.RFC3339))
+	}
+
+	message := fmt.Sprintf("%v certificate expires in %v (%v)", hostname, formatDuration(remaining), notAfter.UTC().Format(time.RFC3339))
+
+	switch {
+	case remaining <= crit:
+		return statusCritical, message
+	case remaining <= warn:
+		return statusWarning, message
+	default:
+		return statusOK, message
+	}
+}
+
+// parseDuration is like time.ParseDuration but also accepts days, like 21d.
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// formatDuration formats a duration in whole days, or hours when less than a day remains.
+func formatDuration(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%vh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%vd", int(d.Hours()/24))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in       string
+		out      time.Duration
+		outError bool
+	}{
+		{"21d", 21 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"xd", 0, true},
+		{"foo", 0, true},
+	}
+
+	for i, tt := range tests {
+		d, err := parseDuration(tt.in)
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := d, tt.out; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestEvaluateExpiry(t *testing.T) {
+	now := time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)
+	warn := 21 * 24 * time.Hour
+	crit := 7 * 24 * time.Hour
+
+	tests := []struct {
+		inNotAfter time.Time
+		outStatus  int
+	}{
+		// 0 - plenty of time left
+		{now.Add(60 * 24 * time.Hour), statusOK},
+		// 1 - inside warning threshold
+		{now.Add(14 * 24 * time.Hour), statusWarning},
+		// 2 - inside critical threshold
+		{now.Add(2 * 24 * time.Hour), statusCritical},
+		// 3 - already expired
+		{now.Add(-1 * time.Hour), statusCritical},
+	}
+
+	for i, tt := range tests {
+		status, _ := evaluateExpiry("foo.example.com", tt.inNotAfter, now, warn, crit)
+		if got, want := status, tt.outStatus; got != want {
+			t.Errorf("Test(%v) Got status: %v, Want: %v", i, got, want)
+		}
+	}
+}
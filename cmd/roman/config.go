@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/config"
+	"github.com/mailgun/roman/export"
+)
+
+// managerFlags are the flags of commands that request certificates.
+type managerFlags struct {
+	configPath *string
+	exportDir  *string
+}
+
+// addManagerFlags defines the flags of commands that request certificates in
+// flags.
+func addManagerFlags(flags *flag.FlagSet) *managerFlags {
+	return &managerFlags{
+		configPath: flags.String("config", "roman.yaml", "path to roman configuration file (.yaml, .toml or .json)"),
+		exportDir:  flags.String("export-dir", "", "directory to write fullchain.pem, privkey.pem and chain.pem of every host to after each renewal"),
+	}
+}
+
+// newManager returns the CertificateManager of the configuration file.
+func (f *managerFlags) newManager() (*roman.CertificateManager, error) {
+	c, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.manager(c)
+}
+
+// manager returns the CertificateManager of c, which exports certificates to
+// -export-dir if it's set.
+func (f *managerFlags) manager(c *config.Config) (*roman.CertificateManager, error) {
+	m, err := c.Manager()
+	if err != nil {
+		return nil, err
+	}
+	if *f.exportDir != "" {
+		m.Exporters = append(m.Exporters, export.PEMFiles{Directory: *f.exportDir})
+	}
+
+	return m, nil
+}
+
+// load reads the configuration file.
+func (f *managerFlags) load() (*config.Config, error) {
+	return config.Load(*f.configPath)
+}
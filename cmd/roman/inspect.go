@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/cache"
+)
+
+// inspectResult is the certificate of a host, or why it can't be read.
+type inspectResult struct {
+	Hostname string
+	*roman.CertificateInfo
+	Error string `json:",omitempty"`
+}
+
+// inspect prints the details of the cached certificates of the hostnames
+// passed as arguments.
+func inspect(args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	var cachePath = flags.String("cache-path", ".", "path to certificate cache")
+	var renewBefore = flags.Duration("renew-before", 30*24*time.Hour, "how long before certificate expiration a new certificate will be requested")
+	output := addOutputFlag(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+	err = output.check()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 255
+	}
+
+	hostnames := flags.Args()
+	if len(hostnames) == 0 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+
+	m := roman.CertificateManager{
+		Cache:       cache.Dir(*cachePath),
+		RenewBefore: *renewBefore,
+		ServeOnly:   true, // only read, never migrate cache records
+	}
+
+	status := 0
+	results := []inspectResult{}
+	for _, hostname := range hostnames {
+		result := inspectResult{Hostname: hostname}
+		info, err := m.InspectCertificate(hostname)
+		if err != nil {
+			result.Error = err.Error()
+			status = 1
+		}
+		result.CertificateInfo = info
+		results = append(results, result)
+	}
+
+	if output.json() {
+		printJSON(os.Stdout, results)
+		return status
+	}
+	for i, result := range results {
+		if i > 0 {
+			fmt.Printf("\n")
+		}
+		if result.Error != "" {
+			fmt.Printf("%v\tunable to read certificate: %v\n", result.Hostname, result.Error)
+			continue
+		}
+		printCertificateInfo(os.Stdout, result.CertificateInfo)
+	}
+
+	return status
+}
+
+// printCertificateInfo writes info to w, one field per line.
+func printCertificateInfo(w io.Writer, info *roman.CertificateInfo) {
+	fmt.Fprintf(w, "Hostname:       %v\n", info.Hostname)
+	fmt.Fprintf(w, "Names:          %v\n", strings.Join(info.Names, ", "))
+	fmt.Fprintf(w, "Issuer:         %v\n", info.Issuer)
+	fmt.Fprintf(w, "Serial Number:  %v\n", info.SerialNumber)
+	fmt.Fprintf(w, "Not Before:     %v\n", info.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Not After:      %v (%vd)\n", info.NotAfter.UTC().Format(time.RFC3339), info.DaysRemaining)
+	fmt.Fprintf(w, "Renew At:       %v\n", info.RenewAt.UTC().Format(time.RFC3339))
+
+	ocsp := "none"
+	if info.OCSPStatus != "" {
+		ocsp = fmt.Sprintf("%v until %v", info.OCSPStatus, info.OCSPNextUpdate.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "OCSP Staple:    %v\n", ocsp)
+
+	trusted := "yes"
+	if !info.Trusted {
+		trusted = "no, " + info.ChainError
+	}
+	fmt.Fprintf(w, "Trusted:        %v\n", trusted)
+}
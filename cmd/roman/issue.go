@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/mailgun/roman"
+)
+
+// issue requests a new certificate for the hostnames passed as arguments, all
+// of them share the certificate, and caches it.
+func issue(args []string) int {
+	flags := flag.NewFlagSet("issue", flag.ContinueOnError)
+	managerFlags := addManagerFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+
+	hostnames := flags.Args()
+	if len(hostnames) == 0 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+
+	m, err := managerFlags.newManager()
+	if err != nil {
+		fmt.Printf("Unable to create CertificateManager: %v\n", err)
+		return 255
+	}
+	m.KnownHosts = hostnames
+	m.CertificateGroups = [][]string{hostnames}
+
+	err = m.Renew(hostnames[0], true)
+	if err != nil {
+		fmt.Printf("Unable to issue certificate for %v: %v\n", hostnames, err)
+		return 1
+	}
+
+	return printExpiration(m, hostnames)
+}
+
+// printExpiration prints when the certificates of hostnames expire, like list.
+func printExpiration(m *roman.CertificateManager, hostnames []string) int {
+	for _, hostname := range hostnames {
+		info, err := m.InspectCertificate(hostname)
+		if err != nil {
+			fmt.Printf("%v\tunable to read certificate: %v\n", hostname, err)
+			return 1
+		}
+		fmt.Printf("%v\t%v\n", hostname, info.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/cache"
+)
+
+// listEntry is a host with a certificate in the cache.
+type listEntry struct {
+	Hostname string
+	NotAfter time.Time
+	Error    string `json:",omitempty"`
+}
+
+// list prints the hosts that have a certificate in the cache and when their
+// certificates expire.
+func list(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	var cachePath = flags.String("cache-path", ".", "path to certificate cache")
+	output := addOutputFlag(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+	err = output.check()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 255
+	}
+
+	m := roman.CertificateManager{
+		Cache:     cache.Dir(*cachePath),
+		ServeOnly: true, // only read, never migrate cache records
+	}
+	hostnames, err := m.CachedHosts()
+	if err != nil {
+		fmt.Printf("Unable to list cache: %v\n", err)
+		return 1
+	}
+	sort.Strings(hostnames)
+
+	entries := []listEntry{}
+	for _, hostname := range hostnames {
+		entry := listEntry{Hostname: hostname}
+		certificate, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: hostname})
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.NotAfter = certificate.Leaf.NotAfter
+		}
+		entries = append(entries, entry)
+	}
+
+	if output.json() {
+		printJSON(os.Stdout, entries)
+		return 0
+	}
+	for _, entry := range entries {
+		if entry.Error != "" {
+			fmt.Printf("%v\tunable to read certificate: %v\n", entry.Hostname, entry.Error)
+			continue
+		}
+		fmt.Printf("%v\t%v\n", entry.Hostname, entry.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	return 0
+}
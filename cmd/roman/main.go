@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a roman subcommand, run is passed the arguments after the
+// subcommand name and returns the exit code of the process.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{"checkcert", "check certificate expiration, nagios/zabbix compatible", checkCert},
+	{"inspect", "print the details of cached certificates", inspect},
+	{"issue", "request a new certificate shared by hostnames", issue},
+	{"list", "list cached certificates and their expiration", list},
+	{"precache", "obtain certificates for configured hosts ahead of a deployment", precache},
+	{"renew", "renew cached certificates that are due for renewal", renew},
+	{"revoke", "revoke a cached certificate and remove it from the cache", revoke},
+	{"serve", "serve certificates over HTTPS, like a service using roman", serve},
+}
+
+func usage() {
+	fmt.Printf("Usage: roman <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Printf("  %-12v %v\n", c.name, c.description)
+	}
+	fmt.Printf("\nRun roman <command> -h for command flags.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(255)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Printf("Unknown command: %v\n\n", os.Args[1])
+	usage()
+	os.Exit(255)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Formats of -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFlag is the -output flag of commands that print results.
+type outputFlag struct {
+	format *string
+}
+
+// addOutputFlag defines -output in flags.
+func addOutputFlag(flags *flag.FlagSet) *outputFlag {
+	return &outputFlag{
+		format: flags.String("output", outputText, "output format, text or json"),
+	}
+}
+
+// check returns an error if the format isn't known.
+func (f *outputFlag) check() error {
+	switch *f.format {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use text or json", *f.format)
+}
+
+// json returns true if results are printed as JSON.
+func (f *outputFlag) json() bool {
+	return *f.format == outputJSON
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/mailgun/roman"
+)
+
+func TestOutputFlag(t *testing.T) {
+	tests := []struct {
+		inArgs   []string
+		outJSON  bool
+		outError bool
+	}{
+		// 0 - text by default
+		{nil, false, false},
+		// 1 - json
+		{[]string{"-output", "json"}, true, false},
+		{[]string{"--output=json"}, true, false},
+		// 3 - unknown formats
+		{[]string{"-output", "yaml"}, false, true},
+	}
+
+	for i, tt := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		output := addOutputFlag(flags)
+		err := flags.Parse(tt.inArgs)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Parse: %v", i, err)
+		}
+		if got, want := output.check() != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, got, want)
+		}
+		if got, want := output.json(), tt.outJSON; got != want {
+			t.Errorf("Test(%v) Got json: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	notAfter := time.Date(2006, 4, 5, 3, 4, 0, 0, time.UTC)
+
+	tests := []struct {
+		in  interface{}
+		out string
+	}{
+		// 0 - hosts without a certificate only have an error
+		{
+			inspectResult{Hostname: "foo.example.com", Error: "acme/autocert: certificate cache miss"},
+			`{"Hostname":"foo.example.com","Error":"acme/autocert: certificate cache miss"}`,
+		},
+		// 1 - the certificate info is inlined
+		{
+			inspectResult{Hostname: "foo.example.com", CertificateInfo: &roman.CertificateInfo{Hostname: "foo.example.com", NotAfter: notAfter}},
+			`{"Hostname":"foo.example.com","Names":null,"Issuer":"","SerialNumber":"","NotBefore":"0001-01-01T00:00:00Z","NotAfter":"2006-04-05T03:04:00Z","DaysRemaining":0,"RenewAt":"0001-01-01T00:00:00Z","OCSPStatus":"","OCSPNextUpdate":"0001-01-01T00:00:00Z","Trusted":false,"ChainError":""}`,
+		},
+		// 2 - renew results
+		{
+			[]renewResult{{Hostname: "foo.example.com", Status: renewStatusRenewed, NotAfter: notAfter}},
+			`[{"Hostname":"foo.example.com","Status":"renewed","NotAfter":"2006-04-05T03:04:00Z"}]`,
+		},
+		// 3 - list entries
+		{
+			[]listEntry{{Hostname: "foo.example.com", NotAfter: notAfter}},
+			`[{"Hostname":"foo.example.com","NotAfter":"2006-04-05T03:04:00Z"}]`,
+		},
+	}
+
+	for i, tt := range tests {
+		var b bytes.Buffer
+		err := printJSON(&b, tt.in)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from printJSON: %v", i, err)
+		}
+
+		var compact bytes.Buffer
+		err = json.Compact(&compact, b.Bytes())
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Compact: %v", i, err)
+		}
+		if got, want := compact.String(), tt.out; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/mailgun/roman"
+)
+
+// Statuses of precache -check.
+const (
+	renewStatusMissing = "missing"
+	renewStatusDue     = "due"
+)
+
+// precache obtains the certificates of all hosts of the configuration, or the
+// hostnames passed as arguments, that aren't cached yet or are due for
+// renewal, so a service deployed with the same cache serves them right away
+// instead of waiting for the CA on start. With -check it only reports hosts
+// without a valid certificate, for deployment pipelines to gate on. It returns
+// 1 if a host is left without a valid certificate.
+func precache(args []string) int {
+	flags := flag.NewFlagSet("precache", flag.ContinueOnError)
+	managerFlags := addManagerFlags(flags)
+	var check = flags.Bool("check", false, "only report hosts without a valid certificate, don't request any")
+	output := addOutputFlag(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+	err = output.check()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 255
+	}
+
+	m, err := managerFlags.newManager()
+	if err != nil {
+		fmt.Printf("Unable to create CertificateManager: %v\n", err)
+		return 255
+	}
+
+	// hosts passed as arguments replace those of the configuration, like
+	// for serve
+	if flags.NArg() > 0 {
+		m.KnownHosts = flags.Args()
+		m.CertificateGroups = nil
+	}
+	groups := configuredGroups(m.KnownHosts, m.CertificateGroups)
+	if len(groups) == 0 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+
+	var results []renewResult
+	if *check {
+		results = checkGroups(m, groups, time.Now())
+	} else {
+		results = renewGroups(m, groups, false)
+	}
+	if output.json() {
+		printJSON(os.Stdout, results)
+	} else {
+		printRenewResults(os.Stdout, results)
+	}
+
+	for _, result := range results {
+		if result.Status != renewStatusRenewed && result.Status != renewStatusValid {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// checkGroups returns whether the hosts of groups have a cached certificate
+// that isn't due for renewal at now, without requesting any.
+func checkGroups(m *roman.CertificateManager, groups [][]string, now time.Time) []renewResult {
+	results := []renewResult{}
+	for _, group := range groups {
+		for _, hostname := range group {
+			result := renewResult{Hostname: hostname}
+			info, err := m.InspectCertificate(hostname)
+			switch {
+			case err == autocert.ErrCacheMiss:
+				result.Status = renewStatusMissing
+			case err != nil:
+				result.Status = renewStatusFailed
+				result.Error = err.Error()
+			case !now.Before(info.RenewAt):
+				result.Status = renewStatusDue
+				result.NotAfter = info.NotAfter
+			default:
+				result.Status = renewStatusValid
+				result.NotAfter = info.NotAfter
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/cache"
+)
+
+// selfSigner issues self-signed certificates valid for 90 days.
+type selfSigner struct{}
+
+func (selfSigner) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		DNSNames:     []string{hostname},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func TestPrecache(t *testing.T) {
+	m := &roman.CertificateManager{
+		ACMEClient: selfSigner{},
+		Cache:      &cache.Memory{},
+		KnownHosts: []string{"foo.example.com", "bar.example.com"},
+	}
+	groups := configuredGroups(m.KnownHosts, nil)
+
+	// nothing is cached yet
+	for i, result := range checkGroups(m, groups, time.Now()) {
+		if got, want := result.Status, renewStatusMissing; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// precache obtains missing certificates and leaves valid ones alone
+	tests := []struct {
+		outStatus string
+	}{
+		// 0 - missing
+		{renewStatusRenewed},
+		// 1 - cached
+		{renewStatusValid},
+	}
+
+	for i, tt := range tests {
+		for _, result := range renewGroups(m, groups, false) {
+			if got, want := result.Status, tt.outStatus; got != want {
+				t.Errorf("Test(%v) Got %v: %v (%v), Want: %v", i, result.Hostname, got, result.Error, want)
+			}
+		}
+	}
+
+	// certificates are due a third of their lifetime before they expire
+	checks := []struct {
+		inNow     time.Time
+		outStatus string
+	}{
+		// 0 - fresh
+		{time.Now(), renewStatusValid},
+		// 1 - due
+		{time.Now().Add(70 * 24 * time.Hour), renewStatusDue},
+	}
+
+	for i, tt := range checks {
+		for _, result := range checkGroups(m, groups, tt.inNow) {
+			if got, want := result.Status, tt.outStatus; got != want {
+				t.Errorf("Test(%v) Got %v: %v, Want: %v", i, result.Hostname, got, want)
+			}
+		}
+	}
+}
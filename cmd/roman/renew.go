@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mailgun/roman"
+)
+
+// Statuses of renewResult.
+const (
+	renewStatusRenewed = "renewed"
+	renewStatusValid   = "valid"
+	renewStatusFailed  = "failed"
+)
+
+// renewResult is the outcome of renewing the certificate of a host.
+type renewResult struct {
+	Hostname string
+	Status   string
+	NotAfter time.Time
+	Error    string `json:",omitempty"`
+}
+
+// renew renews the cached certificates of the hostnames passed as arguments,
+// or of all hosts of the configuration with -all, that are due for renewal,
+// or all of them with -force. Certificates are renewed for all the names on
+// them. It prints the outcome for every host and returns 1 if a renewal
+// failed.
+func renew(args []string) int {
+	flags := flag.NewFlagSet("renew", flag.ContinueOnError)
+	managerFlags := addManagerFlags(flags)
+	var force = flags.Bool("force", false, "renew certificates even if they aren't due for renewal")
+	var all = flags.Bool("all", false, "renew the certificates of all hosts of the configuration, obtaining missing ones")
+	output := addOutputFlag(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+	err = output.check()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 255
+	}
+
+	hostnames := flags.Args()
+	if *all && len(hostnames) > 0 {
+		fmt.Printf("Unable to combine -all with hostnames\n")
+		return 255
+	}
+	if !*all && len(hostnames) == 0 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+
+	m, err := managerFlags.newManager()
+	if err != nil {
+		fmt.Printf("Unable to create CertificateManager: %v\n", err)
+		return 255
+	}
+
+	var groups [][]string
+	if *all {
+		groups = configuredGroups(m.KnownHosts, m.CertificateGroups)
+		if len(groups) == 0 {
+			fmt.Printf("Unable to renew certificates, the configuration has no hosts\n")
+			return 255
+		}
+	} else {
+		m.KnownHosts = nil
+		m.CertificateGroups = nil
+
+		// certificates are renewed for the names they were issued for
+		for _, hostname := range hostnames {
+			info, err := m.InspectCertificate(hostname)
+			if err != nil {
+				fmt.Printf("Unable to read certificate for %v, use roman issue for new hosts: %v\n", hostname, err)
+				return 1
+			}
+			names := certificateNames(info.Chain[0])
+			if len(names) == 0 {
+				fmt.Printf("Unable to renew certificate for %v, it has no names\n", hostname)
+				return 1
+			}
+			if hasGroup(m.CertificateGroups, names[0]) {
+				continue
+			}
+			m.CertificateGroups = append(m.CertificateGroups, names)
+			m.KnownHosts = append(m.KnownHosts, names...)
+		}
+		groups = m.CertificateGroups
+	}
+
+	results := renewGroups(m, groups, *force)
+	if output.json() {
+		printJSON(os.Stdout, results)
+	} else {
+		printRenewResults(os.Stdout, results)
+	}
+
+	for _, result := range results {
+		if result.Status == renewStatusFailed {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// configuredGroups returns the groups of hosts that share a certificate:
+// groups, then every host of hosts that isn't in one on its own.
+func configuredGroups(hosts []string, groups [][]string) [][]string {
+	grouped := make(map[string]bool)
+	all := [][]string{}
+	for _, group := range groups {
+		all = append(all, group)
+		for _, hostname := range group {
+			grouped[hostname] = true
+		}
+	}
+	for _, hostname := range hosts {
+		if grouped[hostname] {
+			continue
+		}
+		grouped[hostname] = true
+		all = append(all, []string{hostname})
+	}
+
+	return all
+}
+
+// renewGroups renews the certificate of every group of m that is due for
+// renewal, or missing, or all of them if force is set, and returns the
+// outcome for every host. A certificate counts as renewed if its serial
+// number changed.
+func renewGroups(m *roman.CertificateManager, groups [][]string, force bool) []renewResult {
+	results := []renewResult{}
+	for _, group := range groups {
+		var serial string
+		if info, err := m.InspectCertificate(group[0]); err == nil {
+			serial = info.SerialNumber
+		}
+
+		renewErr := m.Renew(group[0], force)
+		for _, hostname := range group {
+			result := renewResult{Hostname: hostname}
+			if renewErr != nil {
+				result.Status = renewStatusFailed
+				result.Error = renewErr.Error()
+				results = append(results, result)
+				continue
+			}
+
+			info, err := m.InspectCertificate(hostname)
+			if err != nil {
+				result.Status = renewStatusFailed
+				result.Error = err.Error()
+				results = append(results, result)
+				continue
+			}
+			result.NotAfter = info.NotAfter
+			result.Status = renewStatusValid
+			if info.SerialNumber != serial {
+				result.Status = renewStatusRenewed
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// printRenewResults writes one tab separated line per result to w: the
+// host, its status, when its certificate expires and the error, if any.
+func printRenewResults(w io.Writer, results []renewResult) {
+	sanitize := strings.NewReplacer("\t", " ", "\n", " ")
+	for _, result := range results {
+		var notAfter string
+		if !result.NotAfter.IsZero() {
+			notAfter = result.NotAfter.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", result.Hostname, result.Status, notAfter, sanitize.Replace(result.Error))
+	}
+}
+
+// certificateNames returns the names certificate was requested for, common
+// name first.
+func certificateNames(certificate *x509.Certificate) []string {
+	names := []string{}
+	if certificate.Subject.CommonName != "" {
+		names = append(names, certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		if name != certificate.Subject.CommonName {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// hasGroup returns true if one of groups starts with name.
+func hasGroup(groups [][]string, name string) bool {
+	for _, group := range groups {
+		if group[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
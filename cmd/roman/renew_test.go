@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificateNames(t *testing.T) {
+	tests := []struct {
+		inCommonName string
+		inDNSNames   []string
+		outNames     string
+	}{
+		// 0 - common name first, even if the ca sorted the names
+		{"foo.example.com", []string{"bar.example.com", "foo.example.com"}, "foo.example.com,bar.example.com"},
+		// 1 - single name
+		{"foo.example.com", []string{"foo.example.com"}, "foo.example.com"},
+		// 2 - no common name
+		{"", []string{"foo.example.com", "bar.example.com"}, "foo.example.com,bar.example.com"},
+	}
+
+	for i, tt := range tests {
+		certificate := &x509.Certificate{Subject: pkix.Name{CommonName: tt.inCommonName}, DNSNames: tt.inDNSNames}
+		if got, want := strings.Join(certificateNames(certificate), ","), tt.outNames; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestConfiguredGroups(t *testing.T) {
+	tests := []struct {
+		inHosts   []string
+		inGroups  [][]string
+		outGroups [][]string
+	}{
+		// 0 - hosts on their own
+		{[]string{"foo.example.com", "bar.example.com"}, nil, [][]string{{"foo.example.com"}, {"bar.example.com"}}},
+		// 1 - grouped hosts only once, groups first
+		{
+			[]string{"bar.example.com", "foo.example.com", "www.foo.example.com"},
+			[][]string{{"foo.example.com", "www.foo.example.com"}},
+			[][]string{{"foo.example.com", "www.foo.example.com"}, {"bar.example.com"}},
+		},
+		// 2 - duplicate hosts
+		{[]string{"foo.example.com", "foo.example.com"}, nil, [][]string{{"foo.example.com"}}},
+	}
+
+	for i, tt := range tests {
+		if got, want := configuredGroups(tt.inHosts, tt.inGroups), tt.outGroups; !reflect.DeepEqual(got, want) {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestPrintRenewResults(t *testing.T) {
+	notAfter := time.Date(2006, 4, 5, 3, 4, 0, 0, time.UTC)
+	results := []renewResult{
+		{Hostname: "foo.example.com", Status: renewStatusRenewed, NotAfter: notAfter},
+		{Hostname: "bar.example.com", Status: renewStatusValid, NotAfter: notAfter},
+		{Hostname: "baz.example.com", Status: renewStatusFailed, Error: "acme: rate limited\n\tretry later"},
+	}
+
+	var b bytes.Buffer
+	printRenewResults(&b, results)
+
+	want := "foo.example.com\trenewed\t2006-04-05T03:04:00Z\t\n" +
+		"bar.example.com\tvalid\t2006-04-05T03:04:00Z\t\n" +
+		"baz.example.com\tfailed\t\tacme: rate limited  retry later\n"
+	if got := b.String(); got != want {
+		t.Errorf("Got: %q, Want: %q", got, want)
+	}
+}
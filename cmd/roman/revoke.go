@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+// reasons are the CRL reason codes (RFC 5280) ACME servers accept.
+var reasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// revoke revokes the cached certificate of the hostname passed as argument
+// and removes it from the cache.
+func revoke(args []string) int {
+	flags := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	managerFlags := addManagerFlags(flags)
+	var reason = flags.String("reason", "unspecified", "revocation reason, a CRL reason code or one of unspecified, keyCompromise, affiliationChanged, superseded, cessationOfOperation")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+	hostname := flags.Arg(0)
+
+	reasonCode, err := parseReason(*reason)
+	if err != nil {
+		fmt.Printf("Invalid revocation reason: %v\n", err)
+		return 255
+	}
+
+	m, err := managerFlags.newManager()
+	if err != nil {
+		fmt.Printf("Unable to create CertificateManager: %v\n", err)
+		return 255
+	}
+	err = m.Revoke(context.Background(), hostname, reasonCode)
+	if err != nil {
+		fmt.Printf("Unable to revoke certificate: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%v\trevoked\n", hostname)
+	return 0
+}
+
+// parseReason parses a CRL reason code or its name.
+func parseReason(s string) (int, error) {
+	if code, ok := reasons[s]; ok {
+		return code, nil
+	}
+
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown reason %q", s)
+	}
+	for _, v := range reasons {
+		if v == code {
+			return code, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported reason code %v", code)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseReason(t *testing.T) {
+	tests := []struct {
+		in       string
+		out      int
+		outError bool
+	}{
+		{"keyCompromise", 1, false},
+		{"4", 4, false},
+		{"2", 0, true},
+		{"foo", 0, true},
+	}
+
+	for i, tt := range tests {
+		code, err := parseReason(tt.in)
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := code, tt.out; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
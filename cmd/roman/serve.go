@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/config"
+)
+
+// shutdownTimeout is how long serve waits for requests in flight and the
+// CertificateManager to stop.
+const shutdownTimeout = 30 * time.Second
+
+// serve obtains certificates for the hosts of the configuration, or the
+// hostnames passed as arguments, and serves them over HTTPS, renewing them in
+// the background. Every request is echoed, which makes it easy to check
+// certificates with curl. It runs until SIGINT or SIGTERM, SIGHUP reloads the
+// configuration. Under systemd it serves on the sockets passed by socket
+// activation instead of -hostport and reports its state with sd_notify.
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	managerFlags := addManagerFlags(flags)
+	var hostport = flags.String("hostport", ":443", "hostname:port that the local server should listen on")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 255
+	}
+
+	c, err := managerFlags.load()
+	if err != nil {
+		fmt.Printf("Unable to read configuration: %v\n", err)
+		return 255
+	}
+	m, err := managerFlags.manager(c)
+	if err != nil {
+		fmt.Printf("Unable to create CertificateManager: %v\n", err)
+		return 255
+	}
+
+	// hosts passed as arguments replace those of the configuration
+	if flags.NArg() > 0 {
+		m.KnownHosts = flags.Args()
+		m.CertificateGroups = nil
+	}
+	if len(m.KnownHosts) == 0 {
+		fmt.Printf("Unable to read in hostname\n")
+		return 255
+	}
+
+	listeners, err := systemdListeners()
+	if err != nil {
+		fmt.Printf("Unable to use sockets passed by systemd: %v\n", err)
+		return 255
+	}
+
+	// keep the systemd watchdog happy, obtaining certificates can take
+	// minutes
+	watchdogDone := make(chan struct{})
+	defer close(watchdogDone)
+	go sdWatchdog(watchdogDone)
+
+	// catch signals before starting, so an early SIGHUP doesn't kill us
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	fmt.Printf("Roman: Starting CertificateManager...\n")
+	sdNotify("STATUS=Obtaining certificates")
+
+	// start the certificate manager, this is a blocking call that
+	// ensures that certificates are ready before the server starts
+	// accepting connections
+	err = m.Start()
+	if err != nil {
+		fmt.Printf("Unable to start CertificateManager: %v\n", err)
+		return 1
+	}
+
+	if len(listeners) == 0 {
+		l, err := net.Listen("tcp", *hostport)
+		if err != nil {
+			fmt.Printf("Roman: Unable to start web server: %v\n", err)
+			m.Stop(context.Background())
+			return 1
+		}
+		listeners = []net.Listener{l}
+	}
+	for _, l := range listeners {
+		fmt.Printf("Roman: CertificateManager started, starting web server and listening on %v...\n", l.Addr())
+	}
+
+	// start the http server a *tls.Config that uses the certificate manager
+	// to obtain certificates
+	s := &http.Server{
+		Handler:   http.HandlerFunc(echo),
+		TLSConfig: &tls.Config{GetCertificate: m.GetCertificate},
+	}
+	serveErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			serveErr <- s.ServeTLS(l, "", "")
+		}(l)
+	}
+	sdNotify("READY=1\nSTATUS=Serving")
+
+	for {
+		select {
+		case err := <-serveErr:
+			fmt.Printf("Roman: Web server failed: %v\n", err)
+			m.Stop(context.Background())
+			return 1
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				sdNotify("RELOADING=1")
+				err := reload(m, c, managerFlags, flags.Args())
+				if err != nil {
+					fmt.Printf("Roman: Unable to reload configuration, keeping the current one: %v\n", err)
+					sdNotify("READY=1\nSTATUS=Serving, unable to reload configuration: " + err.Error())
+					continue
+				}
+				fmt.Printf("Roman: Configuration reloaded\n")
+				sdNotify("READY=1\nSTATUS=Serving")
+				continue
+			}
+
+			fmt.Printf("Roman: Received %v, shutting down...\n", sig)
+			sdNotify("STOPPING=1")
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			s.Shutdown(ctx)
+			err := m.Stop(ctx)
+			if err != nil {
+				fmt.Printf("Roman: Unable to stop CertificateManager: %v\n", err)
+				return 1
+			}
+			return 0
+		}
+	}
+}
+
+// reload reads the configuration file again and replaces the hosts and
+// challenge providers of m, which was created from current. Connections and
+// cached certificates are kept. hostnames, if any, replace the hosts of the
+// configuration like on start.
+func reload(m *roman.CertificateManager, current *config.Config, managerFlags *managerFlags, hostnames []string) error {
+	c, err := managerFlags.load()
+	if err != nil {
+		return err
+	}
+	if c.Cache != current.Cache {
+		return fmt.Errorf("cache changed, restart to use the new one")
+	}
+
+	settings, err := c.Settings(m.Cache)
+	if err != nil {
+		return err
+	}
+	if len(hostnames) > 0 {
+		settings.KnownHosts = hostnames
+		settings.CertificateGroups = nil
+	}
+
+	m.Reload(settings)
+	return nil
+}
+
+// echo logs every request and writes it back.
+func echo(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("Method: %v; URL: %v; ContentLength: %v\n", r.Method, r.URL, r.ContentLength)
+	fmt.Fprintf(w, "Method: %v; URL: %v, ContentLength: %v\n", r.Method, r.URL, r.ContentLength)
+}
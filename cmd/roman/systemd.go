@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation, after stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// systemdListeners returns the sockets systemd passed to the process
+// (LISTEN_FDS), nil if it wasn't socket activated. The environment variables
+// are removed so children don't pick the sockets up.
+func systemdListeners() ([]net.Listener, error) {
+	count, err := listenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getpid())
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen on socket %v passed by systemd: %v", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// listenFDs returns the number of sockets passed to the process with pid
+// ownPID, given the values of LISTEN_PID and LISTEN_FDS.
+func listenFDs(listenPID string, listenFDs string, ownPID int) (int, error) {
+	if listenPID == "" || listenFDs == "" {
+		return 0, nil
+	}
+
+	// the sockets were meant for another process, like our parent
+	pid, err := strconv.Atoi(listenPID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LISTEN_PID %q", listenPID)
+	}
+	if pid != ownPID {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(listenFDs)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid LISTEN_FDS %q", listenFDs)
+	}
+
+	return count, nil
+}
+
+// sdNotify sends state, like "READY=1", to the service manager
+// (NOTIFY_SOCKET). It does nothing if the process wasn't started by systemd
+// with Type=notify.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// sockets in the abstract namespace start with @
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often the service manager expects a
+// "WATCHDOG=1" from the process with pid ownPID, given the values of
+// WATCHDOG_USEC and WATCHDOG_PID. It's half the watchdog timeout, zero if the
+// watchdog isn't enabled.
+func watchdogInterval(watchdogUSec string, watchdogPID string, ownPID int) time.Duration {
+	if watchdogUSec == "" {
+		return 0
+	}
+	if watchdogPID != "" {
+		pid, err := strconv.Atoi(watchdogPID)
+		if err != nil || pid != ownPID {
+			return 0
+		}
+	}
+
+	usec, err := strconv.ParseInt(watchdogUSec, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog sends "WATCHDOG=1" to the service manager until done is closed,
+// if the watchdog is enabled (WatchdogSec).
+func sdWatchdog(done <-chan struct{}) {
+	interval := watchdogInterval(os.Getenv("WATCHDOG_USEC"), os.Getenv("WATCHDOG_PID"), os.Getpid())
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sdNotify("WATCHDOG=1")
+		case <-done:
+			return
+		}
+	}
+}
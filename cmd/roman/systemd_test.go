@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenFDs(t *testing.T) {
+	tests := []struct {
+		inPID    string
+		inFDs    string
+		outCount int
+		outError bool
+	}{
+		// 0 - not socket activated
+		{"", "", 0, false},
+		// 1 - sockets for us
+		{"42", "2", 2, false},
+		// 2 - sockets for another process
+		{"7", "2", 0, false},
+		// 3 - invalid values
+		{"x", "2", 0, true},
+		{"42", "-1", 0, true},
+	}
+
+	for i, tt := range tests {
+		count, err := listenFDs(tt.inPID, tt.inFDs, 42)
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		inUSec      string
+		inPID       string
+		outInterval time.Duration
+	}{
+		// 0 - watchdog disabled
+		{"", "", 0},
+		// 1 - half the timeout
+		{"30000000", "", 15 * time.Second},
+		{"30000000", "42", 15 * time.Second},
+		// 3 - watchdog of another process
+		{"30000000", "7", 0},
+		// 4 - invalid values
+		{"soon", "", 0},
+	}
+
+	for i, tt := range tests {
+		if got, want := watchdogInterval(tt.inUSec, tt.inPID, 42), tt.outInterval; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestSDNotify(t *testing.T) {
+	// without NOTIFY_SOCKET there's nothing to do
+	t.Setenv("NOTIFY_SOCKET", "")
+	err := sdNotify("READY=1")
+	if err != nil {
+		t.Errorf("Unexpected response from sdNotify: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("Unable to listen on unixgram socket: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	err = sdNotify("READY=1\nSTATUS=Serving")
+	if err != nil {
+		t.Fatalf("Unexpected response from sdNotify: %v", err)
+	}
+
+	b := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatalf("Unexpected response from Read: %v", err)
+	}
+	if got, want := string(b[:n]), "READY=1\nSTATUS=Serving"; got != want {
+		t.Errorf("Got: %q, Want: %q", got, want)
+	}
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/mailgun/roman/challenge"
+)
+
+// Challenge is a challenge provider, exactly one of the provider sections
+// must be set.
+type Challenge struct {
+	// Domains are the hosts solved with this provider, exact names or
+	// patterns like "*.example.com". The provider without domains solves
+	// all other hosts.
+	Domains []string `json:"domains" yaml:"domains" toml:"domains"`
+
+	// CheckAuthoritative waits for dns-01 records to be visible on all
+	// authoritative nameservers, DoHEndpoint for them to be visible to a DNS
+	// over HTTPS resolver. PropagationTimeout is how long to wait, a Go
+	// duration.
+	CheckAuthoritative bool   `json:"check_authoritative" yaml:"check_authoritative" toml:"check_authoritative"`
+	DoHEndpoint        string `json:"doh_endpoint" yaml:"doh_endpoint" toml:"doh_endpoint"`
+	PropagationTimeout string `json:"propagation_timeout" yaml:"propagation_timeout" toml:"propagation_timeout"`
+
+	Route53   *Route53   `json:"route53" yaml:"route53" toml:"route53"`
+	Hetzner   *Hetzner   `json:"hetzner" yaml:"hetzner" toml:"hetzner"`
+	OVH       *OVH       `json:"ovh" yaml:"ovh" toml:"ovh"`
+	Dyn       *Dyn       `json:"dyn" yaml:"dyn" toml:"dyn"`
+	Designate *Designate `json:"designate" yaml:"designate" toml:"designate"`
+	AcmeDNS   *AcmeDNS   `json:"acme_dns" yaml:"acme_dns" toml:"acme_dns"`
+	Exec      *Exec      `json:"exec" yaml:"exec" toml:"exec"`
+	HTTP01    *HTTP01    `json:"http01" yaml:"http01" toml:"http01"`
+}
+
+// Route53 configures challenge.Route53. Credentials default to those of the
+// environment.
+type Route53 struct {
+	Region            string `json:"region" yaml:"region" toml:"region"`
+	AccessKeyID       string `json:"access_key_id" yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey   string `json:"secret_access_key" yaml:"secret_access_key" toml:"secret_access_key"`
+	HostedZoneID      string `json:"hosted_zone_id" yaml:"hosted_zone_id" toml:"hosted_zone_id"`
+	HostedDomainName  string `json:"hosted_domain_name" yaml:"hosted_domain_name" toml:"hosted_domain_name"`
+	WaitForSync       bool   `json:"wait_for_sync" yaml:"wait_for_sync" toml:"wait_for_sync"`
+	FollowCNAME       bool   `json:"follow_cname" yaml:"follow_cname" toml:"follow_cname"`
+	CNAMEHostedZoneID string `json:"cname_hosted_zone_id" yaml:"cname_hosted_zone_id" toml:"cname_hosted_zone_id"`
+}
+
+// Hetzner configures challenge.Hetzner.
+type Hetzner struct {
+	APIToken string `json:"api_token" yaml:"api_token" toml:"api_token"`
+	Endpoint string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	TTL      int    `json:"ttl" yaml:"ttl" toml:"ttl"`
+}
+
+// OVH configures challenge.OVH.
+type OVH struct {
+	Endpoint          string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	ApplicationKey    string `json:"application_key" yaml:"application_key" toml:"application_key"`
+	ApplicationSecret string `json:"application_secret" yaml:"application_secret" toml:"application_secret"`
+	ConsumerKey       string `json:"consumer_key" yaml:"consumer_key" toml:"consumer_key"`
+	Zone              string `json:"zone" yaml:"zone" toml:"zone"`
+	TTL               int    `json:"ttl" yaml:"ttl" toml:"ttl"`
+}
+
+// Dyn configures challenge.Dyn.
+type Dyn struct {
+	Endpoint     string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	CustomerName string `json:"customer_name" yaml:"customer_name" toml:"customer_name"`
+	UserName     string `json:"user_name" yaml:"user_name" toml:"user_name"`
+	Password     string `json:"password" yaml:"password" toml:"password"`
+	Zone         string `json:"zone" yaml:"zone" toml:"zone"`
+	TTL          int    `json:"ttl" yaml:"ttl" toml:"ttl"`
+}
+
+// Designate configures challenge.Designate.
+type Designate struct {
+	AuthURL           string `json:"auth_url" yaml:"auth_url" toml:"auth_url"`
+	Username          string `json:"username" yaml:"username" toml:"username"`
+	Password          string `json:"password" yaml:"password" toml:"password"`
+	UserDomainName    string `json:"user_domain_name" yaml:"user_domain_name" toml:"user_domain_name"`
+	ProjectName       string `json:"project_name" yaml:"project_name" toml:"project_name"`
+	ProjectDomainName string `json:"project_domain_name" yaml:"project_domain_name" toml:"project_domain_name"`
+	Region            string `json:"region" yaml:"region" toml:"region"`
+	Endpoint          string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	TTL               int    `json:"ttl" yaml:"ttl" toml:"ttl"`
+}
+
+// AcmeDNS configures challenge.AcmeDNS, accounts are stored in the cache of
+// the CertificateManager.
+type AcmeDNS struct {
+	Server    string   `json:"server" yaml:"server" toml:"server"`
+	AllowFrom []string `json:"allow_from" yaml:"allow_from" toml:"allow_from"`
+}
+
+// Exec configures challenge.Exec, Timeout is a Go duration.
+type Exec struct {
+	Present       []string `json:"present" yaml:"present" toml:"present"`
+	Cleanup       []string `json:"cleanup" yaml:"cleanup" toml:"cleanup"`
+	ChallengeType string   `json:"challenge_type" yaml:"challenge_type" toml:"challenge_type"`
+	Env           []string `json:"env" yaml:"env" toml:"env"`
+	Timeout       string   `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// HTTP01 configures challenge.HTTP01, Address is where the challenge server
+// listens, like ":80".
+type HTTP01 struct {
+	Address string `json:"address" yaml:"address" toml:"address"`
+}
+
+// validate returns a *FieldError for the first value of c that isn't valid,
+// field is the key of c.
+func (c Challenge) validate(field string) error {
+	for i, domain := range c.Domains {
+		name := strings.TrimPrefix(domain, "*.")
+		if name == "" || strings.Contains(name, "*") || strings.ContainsAny(name, " /:") {
+			return &FieldError{Field: fmt.Sprintf("%v.domains[%v]", field, i), Reason: fmt.Sprintf("invalid domain %q", domain)}
+		}
+	}
+
+	if c.CheckAuthoritative && c.DoHEndpoint != "" {
+		return &FieldError{Field: field + ".doh_endpoint", Reason: "can't be combined with check_authoritative"}
+	}
+	if c.PropagationTimeout != "" {
+		d, err := time.ParseDuration(c.PropagationTimeout)
+		if err != nil || d < 0 {
+			return &FieldError{Field: field + ".propagation_timeout", Reason: fmt.Sprintf("invalid duration %q", c.PropagationTimeout)}
+		}
+	}
+
+	var providers []string
+	required := func(provider string, values ...string) error {
+		providers = append(providers, provider)
+		for i := 0; i < len(values); i = i + 2 {
+			if values[i+1] == "" {
+				return &FieldError{Field: field + "." + provider + "." + values[i], Reason: "required"}
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if c.Route53 != nil {
+		err = firstError(err, required("route53", "region", c.Route53.Region))
+	}
+	if c.Hetzner != nil {
+		err = firstError(err, required("hetzner", "api_token", c.Hetzner.APIToken))
+	}
+	if c.OVH != nil {
+		err = firstError(err, required("ovh",
+			"application_key", c.OVH.ApplicationKey,
+			"application_secret", c.OVH.ApplicationSecret,
+			"consumer_key", c.OVH.ConsumerKey))
+	}
+	if c.Dyn != nil {
+		err = firstError(err, required("dyn",
+			"customer_name", c.Dyn.CustomerName,
+			"user_name", c.Dyn.UserName,
+			"password", c.Dyn.Password))
+	}
+	if c.Designate != nil {
+		err = firstError(err, required("designate",
+			"auth_url", c.Designate.AuthURL,
+			"username", c.Designate.Username,
+			"password", c.Designate.Password))
+	}
+	if c.AcmeDNS != nil {
+		err = firstError(err, required("acme_dns", "server", c.AcmeDNS.Server))
+	}
+	if c.Exec != nil {
+		err = firstError(err, required("exec", "present", strings.Join(c.Exec.Present, " ")))
+		switch c.Exec.ChallengeType {
+		case "", challenge.DNSChallenge, challenge.HTTPChallenge:
+		default:
+			err = firstError(err, &FieldError{Field: field + ".exec.challenge_type", Reason: fmt.Sprintf("must be %q or %q", challenge.DNSChallenge, challenge.HTTPChallenge)})
+		}
+		if c.Exec.Timeout != "" {
+			if _, parseErr := time.ParseDuration(c.Exec.Timeout); parseErr != nil {
+				err = firstError(err, &FieldError{Field: field + ".exec.timeout", Reason: fmt.Sprintf("invalid duration %q", c.Exec.Timeout)})
+			}
+		}
+	}
+	if c.HTTP01 != nil {
+		err = firstError(err, required("http01", "address", c.HTTP01.Address))
+	}
+	if err != nil {
+		return err
+	}
+
+	switch len(providers) {
+	case 0:
+		return &FieldError{Field: field, Reason: "no challenge provider"}
+	case 1:
+		return nil
+	default:
+		return &FieldError{Field: field, Reason: fmt.Sprintf("only one challenge provider may be set, got %v", strings.Join(providers, ", "))}
+	}
+}
+
+// performer returns the challenge performer of c, acme-dns accounts are kept
+// in accountCache.
+func (c Challenge) performer(accountCache autocert.Cache) (challenge.Performer, error) {
+	var resolver challenge.TXTResolver
+	if c.CheckAuthoritative {
+		resolver = challenge.AuthoritativeResolver{}
+	}
+	if c.DoHEndpoint != "" {
+		resolver = challenge.DoHResolver{Endpoint: c.DoHEndpoint}
+	}
+	var timeout time.Duration
+	if c.PropagationTimeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(c.PropagationTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case c.Route53 != nil:
+		return challenge.Route53{
+			Region:              c.Route53.Region,
+			AccessKeyID:         c.Route53.AccessKeyID,
+			SecretAccessKey:     c.Route53.SecretAccessKey,
+			HostedZoneID:        c.Route53.HostedZoneID,
+			HostedDomainName:    c.Route53.HostedDomainName,
+			WaitForSync:         c.Route53.WaitForSync,
+			FollowCNAME:         c.Route53.FollowCNAME,
+			CNAMEHostedZoneID:   c.Route53.CNAMEHostedZoneID,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.Hetzner != nil:
+		return challenge.Hetzner{
+			APIToken:            c.Hetzner.APIToken,
+			Endpoint:            c.Hetzner.Endpoint,
+			TTL:                 c.Hetzner.TTL,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.OVH != nil:
+		return challenge.OVH{
+			Endpoint:            c.OVH.Endpoint,
+			ApplicationKey:      c.OVH.ApplicationKey,
+			ApplicationSecret:   c.OVH.ApplicationSecret,
+			ConsumerKey:         c.OVH.ConsumerKey,
+			Zone:                c.OVH.Zone,
+			TTL:                 c.OVH.TTL,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.Dyn != nil:
+		return challenge.Dyn{
+			Endpoint:            c.Dyn.Endpoint,
+			CustomerName:        c.Dyn.CustomerName,
+			UserName:            c.Dyn.UserName,
+			Password:            c.Dyn.Password,
+			Zone:                c.Dyn.Zone,
+			TTL:                 c.Dyn.TTL,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.Designate != nil:
+		return challenge.Designate{
+			AuthURL:             c.Designate.AuthURL,
+			Username:            c.Designate.Username,
+			Password:            c.Designate.Password,
+			UserDomainName:      c.Designate.UserDomainName,
+			ProjectName:         c.Designate.ProjectName,
+			ProjectDomainName:   c.Designate.ProjectDomainName,
+			Region:              c.Designate.Region,
+			Endpoint:            c.Designate.Endpoint,
+			TTL:                 c.Designate.TTL,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.AcmeDNS != nil:
+		return challenge.AcmeDNS{
+			Server:              c.AcmeDNS.Server,
+			Cache:               accountCache,
+			AllowFrom:           c.AcmeDNS.AllowFrom,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.Exec != nil:
+		var execTimeout time.Duration
+		if c.Exec.Timeout != "" {
+			var err error
+			execTimeout, err = time.ParseDuration(c.Exec.Timeout)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return challenge.Exec{
+			Present:             c.Exec.Present,
+			Cleanup:             c.Exec.Cleanup,
+			ChallengeType:       c.Exec.ChallengeType,
+			Env:                 c.Exec.Env,
+			Timeout:             execTimeout,
+			PropagationResolver: resolver,
+			PropagationTimeout:  timeout,
+		}, nil
+	case c.HTTP01 != nil:
+		return &challenge.HTTP01{Address: c.HTTP01.Address}, nil
+	}
+
+	return nil, fmt.Errorf("no challenge provider")
+}
+
+// firstError returns err if it's set, next otherwise.
+func firstError(err error, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	golang_acme "golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/roman/cache"
+)
+
+// Formats of configuration files.
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// Config is the configuration of a roman.CertificateManager, as read from a
+// YAML, TOML or JSON file. Keys are snake_case in all formats.
+type Config struct {
+	// Hosts are the hosts certificates are obtained for (KnownHosts).
+	Hosts []string `json:"hosts" yaml:"hosts" toml:"hosts"`
+
+	// Groups are groups of Hosts that share a certificate
+	// (CertificateGroups).
+	Groups [][]string `json:"groups" yaml:"groups" toml:"groups"`
+
+	// Email is the contact of the ACME account.
+	Email string `json:"email" yaml:"email" toml:"email"`
+
+	// Directory is "staging" (the default) or "production" for Let's
+	// Encrypt, or the directory URL of another CA.
+	Directory string `json:"directory" yaml:"directory" toml:"directory"`
+
+	// RenewBefore is how long before expiration certificates are renewed,
+	// a Go duration or a number of days like "30d". If empty, certificates
+	// are renewed with a third of their lifetime left.
+	RenewBefore string `json:"renew_before" yaml:"renew_before" toml:"renew_before"`
+
+	Cache Cache `json:"cache" yaml:"cache" toml:"cache"`
+
+	// Challenges are the providers challenges are solved with, see
+	// Challenge.
+	Challenges []Challenge `json:"challenges" yaml:"challenges" toml:"challenges"`
+}
+
+// Cache configures where certificates are cached.
+type Cache struct {
+	// Type is "dir" (the default), "splitdir" or "memory".
+	Type string `json:"type" yaml:"type" toml:"type"`
+
+	// Path is the directory of dir and splitdir caches.
+	Path string `json:"path" yaml:"path" toml:"path"`
+}
+
+// FieldError is returned for configuration values that aren't valid, Field
+// is the key of the value, like "challenges[0].route53.region".
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Field, e.Reason)
+}
+
+// Load reads and validates the configuration file at path, its format is
+// picked by extension (.yaml, .yml, .toml or .json).
+func Load(path string) (*Config, error) {
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = FormatYAML
+	case ".toml":
+		format = FormatTOML
+	case ".json":
+		format = FormatJSON
+	default:
+		return nil, fmt.Errorf("unknown configuration format of %v, use .yaml, .toml or .json", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %v: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Parse decodes and validates a configuration in format. Unknown keys are
+// errors, so typos don't go unnoticed.
+func Parse(data []byte, format string) (*Config, error) {
+	var c Config
+
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err := decoder.Decode(&c)
+		if err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		metadata, err := toml.Decode(string(data), &c)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return nil, &FieldError{Field: undecoded[0].String(), Reason: "unknown field"}
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&c)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Validate returns a *FieldError for the first value of c that isn't valid.
+func (c *Config) Validate() error {
+	hosts := make(map[string]bool)
+	for i, hostname := range c.Hosts {
+		if strings.TrimSpace(hostname) == "" {
+			return &FieldError{Field: fmt.Sprintf("hosts[%v]", i), Reason: "empty host"}
+		}
+		hosts[hostname] = true
+	}
+	for i, group := range c.Groups {
+		if len(group) == 0 {
+			return &FieldError{Field: fmt.Sprintf("groups[%v]", i), Reason: "empty group"}
+		}
+		for j, hostname := range group {
+			if !hosts[hostname] {
+				return &FieldError{Field: fmt.Sprintf("groups[%v][%v]", i, j), Reason: fmt.Sprintf("%q is not in hosts", hostname)}
+			}
+		}
+	}
+
+	if c.Email == "" {
+		return &FieldError{Field: "email", Reason: "required"}
+	}
+
+	switch c.Directory {
+	case "", "staging", "production":
+	default:
+		u, err := url.Parse(c.Directory)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return &FieldError{Field: "directory", Reason: `must be "staging", "production" or a directory URL`}
+		}
+	}
+
+	if c.RenewBefore != "" {
+		d, err := parseDuration(c.RenewBefore)
+		if err != nil || d < 0 {
+			return &FieldError{Field: "renew_before", Reason: fmt.Sprintf("invalid duration %q", c.RenewBefore)}
+		}
+	}
+
+	switch c.Cache.Type {
+	case "", "dir", "splitdir":
+		if c.Cache.Path == "" {
+			return &FieldError{Field: "cache.path", Reason: "required"}
+		}
+	case "memory":
+	default:
+		return &FieldError{Field: "cache.type", Reason: fmt.Sprintf("unknown cache type %q", c.Cache.Type)}
+	}
+
+	if len(c.Challenges) == 0 {
+		return &FieldError{Field: "challenges", Reason: "at least one challenge provider is required"}
+	}
+	domains := make(map[string]string)
+	for i, challenge := range c.Challenges {
+		field := fmt.Sprintf("challenges[%v]", i)
+		err := challenge.validate(field)
+		if err != nil {
+			return err
+		}
+
+		// every host is solved by one provider, at most one is the default
+		keys := challenge.Domains
+		if len(keys) == 0 {
+			keys = []string{""}
+		}
+		for j, domain := range keys {
+			if previous, ok := domains[domain]; ok {
+				if domain == "" {
+					return &FieldError{Field: field + ".domains", Reason: "only one provider may omit domains, " + previous + " does already"}
+				}
+				return &FieldError{Field: fmt.Sprintf("%v.domains[%v]", field, j), Reason: fmt.Sprintf("%q is solved by %v already", domain, previous)}
+			}
+			domains[domain] = field
+		}
+	}
+
+	return nil
+}
+
+// Manager returns a CertificateManager for c, which must be valid, see
+// Settings for its clients.
+func (c *Config) Manager() (*roman.CertificateManager, error) {
+	m := &roman.CertificateManager{
+		Cache: c.newCache(),
+	}
+
+	s, err := c.Settings(m.Cache)
+	if err != nil {
+		return nil, err
+	}
+	m.KnownHosts = s.KnownHosts
+	m.CertificateGroups = s.CertificateGroups
+	m.ACMEClient = s.ACMEClient
+	m.ACMEClients = s.ACMEClients
+	m.RenewBefore = s.RenewBefore
+
+	return m, nil
+}
+
+// Settings returns the settings of c that a running CertificateManager can
+// Reload. Each challenge provider gets its own ACME client, providers with
+// domains are used for them (ACMEClients), the one without for all other
+// hosts. acme-dns accounts are kept in accountCache, the Cache of the
+// CertificateManager.
+func (c *Config) Settings(accountCache autocert.Cache) (roman.Settings, error) {
+	s := roman.Settings{
+		KnownHosts:        c.Hosts,
+		CertificateGroups: c.Groups,
+	}
+	if c.RenewBefore != "" {
+		renewBefore, err := parseDuration(c.RenewBefore)
+		if err != nil {
+			return roman.Settings{}, &FieldError{Field: "renew_before", Reason: fmt.Sprintf("invalid duration %q", c.RenewBefore)}
+		}
+		s.RenewBefore = renewBefore
+	}
+
+	for i, challenge := range c.Challenges {
+		performer, err := challenge.performer(accountCache)
+		if err != nil {
+			return roman.Settings{}, fmt.Errorf("challenges[%v]: %v", i, err)
+		}
+
+		client := &acme.Client{
+			Directory:          c.DirectoryURL(),
+			AgreeTOS:           golang_acme.AcceptTOS,
+			Email:              c.Email,
+			ChallengePerformer: performer,
+		}
+		if len(challenge.Domains) == 0 {
+			s.ACMEClient = client
+			continue
+		}
+		if s.ACMEClients == nil {
+			s.ACMEClients = make(map[string]acme.CertificateForDomainer)
+		}
+		for _, domain := range challenge.Domains {
+			s.ACMEClients[domain] = client
+		}
+	}
+
+	return s, nil
+}
+
+// DirectoryURL returns the URL of Directory.
+func (c *Config) DirectoryURL() string {
+	switch c.Directory {
+	case "", "staging":
+		return acme.LetsEncryptStaging
+	case "production":
+		return acme.LetsEncryptProduction
+	}
+	return c.Directory
+}
+
+// newCache returns the configured cache.
+func (c *Config) newCache() autocert.Cache {
+	switch c.Cache.Type {
+	case "splitdir":
+		return cache.SplitDir(c.Cache.Path)
+	case "memory":
+		return &cache.Memory{}
+	}
+	return cache.Dir(c.Cache.Path)
+}
+
+// parseDuration parses a Go duration or a number of days like "30d".
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
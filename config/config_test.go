@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/roman/cache"
+	"github.com/mailgun/roman/challenge"
+)
+
+var yamlConfiguration = `
+hosts: [foo.example.com, www.foo.example.com, bar.example.org]
+groups:
+  - [foo.example.com, www.foo.example.com]
+email: ops@example.com
+directory: production
+renew_before: 30d
+cache:
+  path: /etc/roman/tls
+challenges:
+  - route53:
+      region: us-east-1
+      hosted_zone_id: Z123
+    check_authoritative: true
+  - domains: ["*.example.org", bar.example.org]
+    hetzner:
+      api_token: secret
+`
+
+var tomlConfiguration = `
+hosts = ["foo.example.com", "www.foo.example.com", "bar.example.org"]
+groups = [["foo.example.com", "www.foo.example.com"]]
+email = "ops@example.com"
+directory = "production"
+renew_before = "30d"
+
+[cache]
+path = "/etc/roman/tls"
+
+[[challenges]]
+check_authoritative = true
+[challenges.route53]
+region = "us-east-1"
+hosted_zone_id = "Z123"
+
+[[challenges]]
+domains = ["*.example.org", "bar.example.org"]
+[challenges.hetzner]
+api_token = "secret"
+`
+
+var jsonConfiguration = `{
+  "hosts": ["foo.example.com", "www.foo.example.com", "bar.example.org"],
+  "groups": [["foo.example.com", "www.foo.example.com"]],
+  "email": "ops@example.com",
+  "directory": "production",
+  "renew_before": "30d",
+  "cache": {"path": "/etc/roman/tls"},
+  "challenges": [
+    {"route53": {"region": "us-east-1", "hosted_zone_id": "Z123"}, "check_authoritative": true},
+    {"domains": ["*.example.org", "bar.example.org"], "hetzner": {"api_token": "secret"}}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		Hosts:       []string{"foo.example.com", "www.foo.example.com", "bar.example.org"},
+		Groups:      [][]string{{"foo.example.com", "www.foo.example.com"}},
+		Email:       "ops@example.com",
+		Directory:   "production",
+		RenewBefore: "30d",
+		Cache:       Cache{Path: "/etc/roman/tls"},
+		Challenges: []Challenge{
+			{CheckAuthoritative: true, Route53: &Route53{Region: "us-east-1", HostedZoneID: "Z123"}},
+			{Domains: []string{"*.example.org", "bar.example.org"}, Hetzner: &Hetzner{APIToken: "secret"}},
+		},
+	}
+
+	tests := []struct {
+		inData   string
+		inFormat string
+	}{
+		// 0 - yaml
+		{yamlConfiguration, FormatYAML},
+		// 1 - toml
+		{tomlConfiguration, FormatTOML},
+		// 2 - json
+		{jsonConfiguration, FormatJSON},
+	}
+
+	for i, tt := range tests {
+		c, err := Parse([]byte(tt.inData), tt.inFormat)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Parse: %v", i, err)
+		}
+		if got := c; !reflect.DeepEqual(got, want) {
+			t.Errorf("Test(%v) Got: %+v, Want: %+v", i, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := "email: ops@example.com\ncache: {path: .}\nchallenges: [{route53: {region: us-east-1}}]\n"
+
+	tests := []struct {
+		inData   string
+		inFormat string
+		outField string // field named by the error, empty for decoding errors
+	}{
+		// 0 - unknown keys
+		{valid + "renew_befor: 30d\n", FormatYAML, ""},
+		{"email = \"ops@example.com\"\nrenew_befor = \"30d\"\n", FormatTOML, "renew_befor"},
+		{`{"email": "ops@example.com", "renew_befor": "30d"}`, FormatJSON, ""},
+		// 3 - missing values
+		{"cache: {path: .}\nchallenges: [{route53: {region: us-east-1}}]\n", FormatYAML, "email"},
+		{"email: ops@example.com\nchallenges: [{route53: {region: us-east-1}}]\n", FormatYAML, "cache.path"},
+		{"email: ops@example.com\ncache: {path: .}\n", FormatYAML, "challenges"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{route53: {}}]\n", FormatYAML, "challenges[0].route53.region"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{route53: {region: us-east-1}}, {domains: [a.example.com], ovh: {application_key: k}}]\n", FormatYAML, "challenges[1].ovh.application_secret"},
+		// 8 - invalid values
+		{valid + "renew_before: soon\n", FormatYAML, "renew_before"},
+		{valid + "directory: ftp://example.com\n", FormatYAML, "directory"},
+		{valid + "hosts: [foo.example.com, '']\n", FormatYAML, "hosts[1]"},
+		{valid + "hosts: [foo.example.com]\ngroups: [[foo.example.com, bar.example.com]]\n", FormatYAML, "groups[0][1]"},
+		{"email: ops@example.com\ncache: {type: s3}\nchallenges: [{route53: {region: us-east-1}}]\n", FormatYAML, "cache.type"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{exec: {present: [x], challenge_type: tls-alpn-01}}]\n", FormatYAML, "challenges[0].exec.challenge_type"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{propagation_timeout: 5, route53: {region: us-east-1}}]\n", FormatYAML, "challenges[0].propagation_timeout"},
+		// 15 - providers
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{domains: [a.example.com]}]\n", FormatYAML, "challenges[0]"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{route53: {region: us-east-1}, hetzner: {api_token: t}}]\n", FormatYAML, "challenges[0]"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{route53: {region: us-east-1}}, {hetzner: {api_token: t}}]\n", FormatYAML, "challenges[1].domains"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{domains: ['*.example.com'], route53: {region: us-east-1}}, {domains: [a.example.com, '*.example.com'], hetzner: {api_token: t}}]\n", FormatYAML, "challenges[1].domains[1]"},
+		{"email: ops@example.com\ncache: {path: .}\nchallenges: [{domains: ['*.*.example.com'], route53: {region: us-east-1}}]\n", FormatYAML, "challenges[0].domains[0]"},
+	}
+
+	for i, tt := range tests {
+		_, err := Parse([]byte(tt.inData), tt.inFormat)
+		if err == nil {
+			t.Errorf("Test(%v) Expected an error", i)
+			continue
+		}
+
+		var fieldErr *FieldError
+		if tt.outField == "" {
+			if !strings.Contains(err.Error(), "renew_befor") {
+				t.Errorf("Test(%v) Got error: %v, Want it to name renew_befor", i, err)
+			}
+			continue
+		}
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("Test(%v) Got error: %v, Want a *FieldError", i, err)
+			continue
+		}
+		if got, want := fieldErr.Field, tt.outField; got != want {
+			t.Errorf("Test(%v) Got field: %v (%v), Want: %v", i, got, err, want)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	c, err := Parse([]byte(yamlConfiguration), FormatYAML)
+	if err != nil {
+		t.Fatalf("Unexpected response from Parse: %v", err)
+	}
+
+	m, err := c.Manager()
+	if err != nil {
+		t.Fatalf("Unexpected response from Manager: %v", err)
+	}
+
+	if got, want := m.RenewBefore, 30*24*time.Hour; got != want {
+		t.Errorf("Got RenewBefore: %v, Want: %v", got, want)
+	}
+	if got, want := m.Cache, cache.Dir("/etc/roman/tls"); got != want {
+		t.Errorf("Got Cache: %v, Want: %v", got, want)
+	}
+	if got, want := m.KnownHosts, c.Hosts; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got KnownHosts: %v, Want: %v", got, want)
+	}
+
+	// the default client
+	client, ok := m.ACMEClient.(*acme.Client)
+	if !ok {
+		t.Fatalf("Got ACMEClient: %T, Want: *acme.Client", m.ACMEClient)
+	}
+	if got, want := client.Directory, acme.LetsEncryptProduction; got != want {
+		t.Errorf("Got Directory: %v, Want: %v", got, want)
+	}
+	route53, ok := client.ChallengePerformer.(challenge.Route53)
+	if !ok || route53.HostedZoneID != "Z123" || route53.PropagationResolver != (challenge.AuthoritativeResolver{}) {
+		t.Errorf("Got ChallengePerformer: %+v, Want the route53 provider", client.ChallengePerformer)
+	}
+
+	// clients of providers with domains
+	if got, want := len(m.ACMEClients), 2; got != want {
+		t.Fatalf("Got %v ACMEClients, Want: %v", got, want)
+	}
+	for _, domain := range []string{"*.example.org", "bar.example.org"} {
+		client, ok := m.ACMEClients[domain].(*acme.Client)
+		if !ok {
+			t.Fatalf("Got ACMEClients[%v]: %T, Want: *acme.Client", domain, m.ACMEClients[domain])
+		}
+		if _, ok := client.ChallengePerformer.(challenge.Hetzner); !ok {
+			t.Errorf("Got ChallengePerformer for %v: %T, Want: challenge.Hetzner", domain, client.ChallengePerformer)
+		}
+	}
+}
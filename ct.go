@@ -0,0 +1,317 @@
+package roman
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	encodingasn1 "encoding/asn1"
+	"fmt"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	defaultMinSCTs = 2
+)
+
+var (
+	// oidSCTList is the extension that holds the SCTs embedded in a
+	// certificate, RFC 6962 section 3.3.
+	oidSCTList = encodingasn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// CertificateTransparency configures checking the Signed Certificate
+// Timestamps (SCTs) embedded in newly issued certificates before they are
+// cached and served. SCTs are the promise of a CT log to publish the
+// precertificate, the check makes sure enough logs trusted by clients made
+// it. Inclusion itself can't be checked before the certificate is served,
+// logs have up to 24 hours to add it.
+type CertificateTransparency struct {
+	// Logs are the CT logs whose SCTs count, for example those of the Chrome
+	// or Apple CT policies. Leaving it empty disables the check.
+	Logs []CTLog
+
+	// MinSCTs is the number of valid SCTs from different Logs a certificate
+	// needs, defaults to 2.
+	MinSCTs int
+
+	// Enforce fails the renewal if the certificate doesn't have enough valid
+	// SCTs, so it's never served. Otherwise the certificate is served and
+	// EventCTCheckFailed is sent to Notifiers.
+	Enforce bool
+}
+
+// CTLog is a Certificate Transparency log.
+type CTLog struct {
+	// Description is the name of the log, used in errors.
+	Description string
+
+	// PublicKey is the ECDSA or RSA key of the log, the log ID is derived
+	// from it.
+	PublicKey crypto.PublicKey
+}
+
+// signedCertificateTimestamp is a parsed SCT, RFC 6962 section 3.2.
+type signedCertificateTimestamp struct {
+	logID      []byte
+	timestamp  uint64
+	extensions []byte
+	hash       uint8
+	signature  []byte
+}
+
+// checkCertificateTransparency returns an error if certificate doesn't have
+// MinSCTs valid SCTs from different CertificateTransparency.Logs. It does
+// nothing if no logs are configured.
+func (m *CertificateManager) checkCertificateTransparency(certificate *tls.Certificate) error {
+	ct := m.CertificateTransparency
+	if len(ct.Logs) == 0 {
+		return nil
+	}
+
+	minSCTs := ct.MinSCTs
+	if minSCTs <= 0 {
+		minSCTs = defaultMinSCTs
+	}
+
+	valid, err := verifyEmbeddedSCTs(certificate, ct.Logs)
+	if err != nil {
+		return err
+	}
+	if len(valid) < minSCTs {
+		return fmt.Errorf("certificate has %v valid SCTs from known logs %v, %v are required", len(valid), valid, minSCTs)
+	}
+
+	return nil
+}
+
+// verifyEmbeddedSCTs verifies the SCTs embedded in the leaf of certificate
+// and returns the descriptions of the logs with a valid SCT.
+func verifyEmbeddedSCTs(certificate *tls.Certificate, logs []CTLog) ([]string, error) {
+	if certificate.Leaf == nil || len(certificate.Certificate) < 2 {
+		return nil, fmt.Errorf("no certificate chain to verify SCTs with")
+	}
+	issuer, err := x509.ParseCertificate(certificate.Certificate[1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse issuer: %v", err)
+	}
+
+	var sctList []byte
+	for _, extension := range certificate.Leaf.Extensions {
+		if extension.Id.Equal(oidSCTList) {
+			sctList = extension.Value
+		}
+	}
+	if sctList == nil {
+		return nil, fmt.Errorf("certificate has no embedded SCTs")
+	}
+
+	scts, err := parseSCTList(sctList)
+	if err != nil {
+		return nil, err
+	}
+
+	// the logs signed the precertificate, which is the certificate without
+	// the scts
+	tbs, err := removeExtension(certificate.Leaf.RawTBSCertificate, oidSCTList)
+	if err != nil {
+		return nil, err
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	seen := make(map[string]bool)
+	var valid []string
+	for _, sct := range scts {
+		for _, ctLog := range logs {
+			logID, err := ctLogID(ctLog.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key for CT log %q: %v", ctLog.Description, err)
+			}
+			if !bytes.Equal(logID, sct.logID) || seen[string(logID)] {
+				continue
+			}
+			if verifySCT(ctLog.PublicKey, sct, issuerKeyHash[:], tbs) != nil {
+				continue
+			}
+			seen[string(logID)] = true
+			valid = append(valid, ctLog.Description)
+		}
+	}
+
+	return valid, nil
+}
+
+// parseSCTList parses the TLS encoded SignedCertificateTimestampList in the
+// value of the SCT list extension.
+func parseSCTList(value []byte) ([]signedCertificateTimestamp, error) {
+	var octets cryptobyte.String
+	input := cryptobyte.String(value)
+	if !input.ReadASN1(&octets, asn1.OCTET_STRING) {
+		return nil, fmt.Errorf("malformed SCT list extension")
+	}
+
+	var list cryptobyte.String
+	if !octets.ReadUint16LengthPrefixed(&list) || !octets.Empty() {
+		return nil, fmt.Errorf("malformed SCT list")
+	}
+
+	var scts []signedCertificateTimestamp
+	for !list.Empty() {
+		var raw, extensions, signature cryptobyte.String
+		var version, hash, algorithm uint8
+		var sct signedCertificateTimestamp
+		if !list.ReadUint16LengthPrefixed(&raw) ||
+			!raw.ReadUint8(&version) ||
+			!raw.ReadBytes(&sct.logID, 32) ||
+			!raw.ReadUint64(&sct.timestamp) ||
+			!raw.ReadUint16LengthPrefixed(&extensions) ||
+			!raw.ReadUint8(&hash) ||
+			!raw.ReadUint8(&algorithm) ||
+			!raw.ReadUint16LengthPrefixed(&signature) {
+			return nil, fmt.Errorf("malformed SCT")
+		}
+		// only v1 scts exist
+		if version != 0 {
+			continue
+		}
+		sct.extensions = extensions
+		sct.hash = hash
+		sct.signature = signature
+		scts = append(scts, sct)
+	}
+
+	return scts, nil
+}
+
+// verifySCT verifies the signature of sct over the precertificate entry of
+// tbs, RFC 6962 section 3.2.
+func verifySCT(publicKey crypto.PublicKey, sct signedCertificateTimestamp, issuerKeyHash []byte, tbs []byte) error {
+	// only sha-256 is allowed
+	if sct.hash != 4 {
+		return fmt.Errorf("unsupported SCT hash algorithm: %v", sct.hash)
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(0) // v1
+	b.AddUint8(0) // certificate_timestamp
+	b.AddUint64(sct.timestamp)
+	b.AddUint16(1) // precert_entry
+	b.AddBytes(issuerKeyHash)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(tbs) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sct.extensions) })
+	signed, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sct.signature) {
+			return fmt.Errorf("invalid SCT signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sct.signature)
+	default:
+		return fmt.Errorf("unsupported CT log key type: %T", publicKey)
+	}
+}
+
+// ctLogID returns the ID of the log with publicKey, the SHA-256 hash of its
+// DER encoded SubjectPublicKeyInfo.
+func ctLogID(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(der)
+	return id[:], nil
+}
+
+// removeExtension returns the DER encoded TBSCertificate tbs without the
+// extension oid.
+func removeExtension(tbs []byte, oid encodingasn1.ObjectIdentifier) ([]byte, error) {
+	input := cryptobyte.String(tbs)
+	var fields cryptobyte.String
+	if !input.ReadASN1(&fields, asn1.SEQUENCE) {
+		return nil, fmt.Errorf("malformed TBSCertificate")
+	}
+
+	extensionsTag := asn1.Tag(3).Constructed().ContextSpecific()
+
+	var b cryptobyte.Builder
+	var failed bool
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !fields.Empty() {
+			var field cryptobyte.String
+			var tag asn1.Tag
+			if !fields.ReadAnyASN1Element(&field, &tag) {
+				failed = true
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(field)
+				continue
+			}
+
+			var explicit, extensions cryptobyte.String
+			if !field.ReadASN1(&explicit, extensionsTag) || !explicit.ReadASN1(&extensions, asn1.SEQUENCE) {
+				failed = true
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var extension, contents cryptobyte.String
+						var id encodingasn1.ObjectIdentifier
+						if !extensions.ReadASN1Element(&extension, asn1.SEQUENCE) {
+							failed = true
+							return
+						}
+						element := extension
+						if !element.ReadASN1(&contents, asn1.SEQUENCE) || !contents.ReadASN1ObjectIdentifier(&id) {
+							failed = true
+							return
+						}
+						if id.Equal(oid) {
+							continue
+						}
+						b.AddBytes(extension)
+					}
+				})
+			})
+		}
+	})
+	if failed {
+		return nil, fmt.Errorf("malformed TBSCertificate")
+	}
+
+	return b.Bytes()
+}
+
+// checkTransparencyOf checks certificate for hostnames and decides if it may
+// be served, see CertificateTransparency.Enforce.
+func (m *CertificateManager) checkTransparencyOf(hostnames []string, certificate *tls.Certificate) error {
+	err := m.checkCertificateTransparency(certificate)
+	if err == nil {
+		return nil
+	}
+	if m.CertificateTransparency.Enforce {
+		return fmt.Errorf("certificate transparency check failed for %v: %v", hostnames, err)
+	}
+
+	log.Errorf("serving certificate for %v although the certificate transparency check failed: %v", hostnames, err)
+	for _, hostname := range hostnames {
+		m.notify(Event{Type: EventCTCheckFailed, Hostname: hostname, NotAfter: certificate.Leaf.NotAfter, Error: err.Error()})
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package roman
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/net/context"
+)
+
+func TestCertificateTransparency(t *testing.T) {
+	var logKeys []*ecdsa.PrivateKey
+	var logs []CTLog
+	for i := 0; i < 3; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Unexpected response from GenerateKey: %v", err)
+		}
+		logKeys = append(logKeys, key)
+		logs = append(logs, CTLog{Description: string(rune('a' + i)), PublicKey: key.Public()})
+	}
+
+	tests := []struct {
+		inSigners []*ecdsa.PrivateKey // logs that signed an sct
+		inLogs    []CTLog
+		inMinSCTs int
+		inTamper  bool
+		outErr    bool
+	}{
+		// 0 - two scts from known logs
+		{logKeys[:2], logs, 0, false, false},
+		// 1 - not enough scts
+		{logKeys[:1], logs, 0, false, true},
+		// 2 - unless fewer are required
+		{logKeys[:1], logs, 1, false, false},
+		// 3 - scts from unknown logs don't count
+		{logKeys[:2], logs[1:], 0, false, true},
+		// 4 - scts that don't match the certificate don't count
+		{logKeys[:2], logs, 0, true, true},
+		// 5 - no scts at all
+		{nil, logs, 0, false, true},
+	}
+
+	for i, tt := range tests {
+		certificate, err := generateCTCertificate("foo.example.com", tt.inSigners, tt.inTamper)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCTCertificate: %v", i, err)
+		}
+
+		m := CertificateManager{
+			CertificateTransparency: CertificateTransparency{Logs: tt.inLogs, MinSCTs: tt.inMinSCTs},
+		}
+		err = m.checkCertificateTransparency(certificate)
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+	}
+}
+
+func TestCertificateTransparencyEnforce(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	certificate, err := generateCTCertificate("foo.example.com", nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCTCertificate: %v", err)
+	}
+
+	tests := []struct {
+		inEnforce bool
+		outErr    bool
+		outEvents int
+	}{
+		// 0 - the certificate is served, but somebody is told
+		{false, false, 1},
+		// 1 - the certificate is never served
+		{true, true, 0},
+	}
+
+	for i, tt := range tests {
+		n := channelNotifier(make(chan Event, 10))
+		m := CertificateManager{
+			ACMEClient: fixedCertificateForDomainer{certificate},
+			Cache:      newMapCache(),
+			KnownHosts: []string{"foo.example.com"},
+			CertificateTransparency: CertificateTransparency{
+				Logs:    []CTLog{{Description: "a", PublicKey: key.Public()}},
+				Enforce: tt.inEnforce,
+			},
+			Notifiers: []Notifier{n},
+		}
+
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		_, err = m.getCertificateFromCache("foo.example.com")
+		if got, want := err == nil, !tt.inEnforce; got != want {
+			t.Errorf("Test(%v) Got cached: %v, Want: %v", i, got, want)
+		}
+
+		var events int
+		timeout := time.After(100 * time.Millisecond)
+	receive:
+		for {
+			select {
+			case event := <-n:
+				if event.Type == EventCTCheckFailed {
+					events++
+				}
+			case <-timeout:
+				break receive
+			}
+		}
+		if got, want := events, tt.outEvents; got != want {
+			t.Errorf("Test(%v) Got %v ct events, Want: %v", i, got, want)
+		}
+	}
+}
+
+// fixedCertificateForDomainer is used in tests to always issue the same
+// certificate.
+type fixedCertificateForDomainer struct {
+	certificate *tls.Certificate
+}
+
+func (f fixedCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	return f.certificate, nil
+}
+
+// generateCTCertificate returns a certificate for hostname, signed by a
+// throwaway ca, with an embedded sct from each of logs. If tamper is set, the
+// scts are for a different certificate.
+func generateCTCertificate(hostname string, logs []*ecdsa.PrivateKey, tamper bool) (*tls.Certificate, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "roman test ca"},
+		NotBefore:             clock.UtcNow(),
+		NotAfter:              clock.UtcNow().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    clock.UtcNow(),
+		NotAfter:     clock.UtcNow().Add(90 * 24 * time.Hour),
+		DNSNames:     []string{hostname},
+	}
+
+	if logs != nil {
+		// the logs sign the certificate without the scts
+		precertificateBytes, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+		if err != nil {
+			return nil, err
+		}
+		precertificate, err := x509.ParseCertificate(precertificateBytes)
+		if err != nil {
+			return nil, err
+		}
+		tbs := precertificate.RawTBSCertificate
+		if tamper {
+			tbs = append([]byte{}, tbs...)
+			tbs[len(tbs)-1] ^= 0xff
+		}
+		issuerKeyHash := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+
+		var list cryptobyte.Builder
+		list.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, logKey := range logs {
+				logID, err := ctLogID(logKey.Public())
+				if err != nil {
+					b.SetError(err)
+					return
+				}
+				sct := signedCertificateTimestamp{logID: logID, timestamp: uint64(clock.UtcNow().UnixMilli()), hash: 4}
+
+				var signed cryptobyte.Builder
+				signed.AddUint8(0)
+				signed.AddUint8(0)
+				signed.AddUint64(sct.timestamp)
+				signed.AddUint16(1)
+				signed.AddBytes(issuerKeyHash[:])
+				signed.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(tbs) })
+				signed.AddUint16(0)
+				digest := sha256.Sum256(signed.BytesOrPanic())
+				signature, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+				if err != nil {
+					b.SetError(err)
+					return
+				}
+
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8(0)
+					b.AddBytes(sct.logID)
+					b.AddUint64(sct.timestamp)
+					b.AddUint16(0)
+					b.AddUint8(4)
+					b.AddUint8(3)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(signature) })
+				})
+			}
+		})
+		listBytes, err := list.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		value, err := asn1.Marshal(listBytes)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: oidSCTList, Value: value}}
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificateBytes, caBytes},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestGetCertificateDefault(t *testing.T) {
+	fooCertificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	defaultCertificate, err := generateCertificate("default.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	tests := []struct {
+		inServerName         string
+		inDefaultHost        string
+		inDefaultCertificate *tls.Certificate
+		outCertificate       *tls.Certificate
+	}{
+		// 0 - known host
+		{"foo.example.com", "", defaultCertificate, fooCertificate},
+		// 1 - unknown host without a default
+		{"bar.example.com", "", nil, nil},
+		// 2 - unknown host
+		{"bar.example.com", "", defaultCertificate, defaultCertificate},
+		// 3 - no server name
+		{"", "", defaultCertificate, defaultCertificate},
+		// 4 - no server name without a default
+		{"", "", nil, nil},
+		// 5 - default host
+		{"", "foo.example.com", nil, fooCertificate},
+		// 6 - default host takes precedence
+		{"bar.example.com", "foo.example.com", defaultCertificate, fooCertificate},
+		// 7 - default host without a certificate
+		{"bar.example.com", "baz.example.com", defaultCertificate, defaultCertificate},
+		// 8 - default host without a certificate and no default
+		{"bar.example.com", "baz.example.com", nil, nil},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			Cache:              &cache.Memory{},
+			DefaultHost:        tt.inDefaultHost,
+			DefaultCertificate: tt.inDefaultCertificate,
+		}
+		err := m.putCertificateInCache("foo.example.com", fooCertificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		certificate, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.inServerName})
+		if got, want := err != nil, tt.outCertificate == nil; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := certificate, tt.outCertificate; got != want {
+			t.Errorf("Test(%v) Got certificate: %p, Want: %p", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package roman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// notifyRenewed calls OnIssue or OnRenew for each of hostnames after
+// certificate was obtained, depending on if it replaced previous, and sends
+// the event to Notifiers.
+func (m *CertificateManager) notifyRenewed(hostnames []string, previous *tls.Certificate, certificate *tls.Certificate) {
+	for _, hostname := range hostnames {
+		switch {
+		case previous == nil && m.OnIssue != nil:
+			m.OnIssue(hostname, certificate)
+		case previous != nil && m.OnRenew != nil:
+			m.OnRenew(hostname, certificate)
+		}
+
+		event := Event{Type: EventIssued, Hostname: hostname, NotAfter: certificate.Leaf.NotAfter}
+		if previous != nil {
+			event.Type = EventRenewed
+		}
+		m.notify(event)
+	}
+}
+
+// notifyExpireSoon calls OnExpireSoon and sends the event to Notifiers if the
+// certificate of hostname is still served although it should have been
+// renewed long ago.
+func (m *CertificateManager) notifyExpireSoon(hostname string) {
+	if m.OnExpireSoon == nil && len(m.Notifiers) == 0 {
+		return
+	}
+
+	certificate, err := m.getCertificateFromCache(hostname)
+	if err != nil || certificate.Leaf == nil {
+		return
+	}
+
+	if expiresSoon(certificate.Leaf, m.renewBefore(certificate.Leaf)) {
+		if m.OnExpireSoon != nil {
+			m.OnExpireSoon(hostname, certificate.Leaf.NotAfter)
+		}
+		m.notify(Event{Type: EventExpiringSoon, Hostname: hostname, NotAfter: certificate.Leaf.NotAfter})
+	}
+}
+
+// expiresSoon returns true if leaf is more than halfway through its renewal
+// window, 15 days before expiration with a RenewBefore of 30 days.
+func expiresSoon(leaf *x509.Certificate, renewBefore time.Duration) bool {
+	return clock.UtcNow().Add(renewalWindow(leaf, renewBefore) / 2).After(leaf.NotAfter)
+}
@@ -0,0 +1,96 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestIssueRenewEvents(t *testing.T) {
+	var events []string
+
+	ccfd := &countingCertificateForDomainer{
+		notBefore: clock.UtcNow(),
+		notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+	}
+	m := CertificateManager{
+		ACMEClient:  ccfd,
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+		OnIssue: func(hostname string, certificate *tls.Certificate) {
+			events = append(events, "issue "+hostname)
+		},
+		OnRenew: func(hostname string, certificate *tls.Certificate) {
+			events = append(events, "renew "+hostname)
+		},
+	}
+
+	// first certificate
+	m.renewCertificates(context.Background())
+
+	// nothing to do
+	m.renewCertificates(context.Background())
+
+	// replace it with one that needs to be renewed
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(-80*24*time.Hour), clock.UtcNow().Add(10*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+	m.renewCertificates(context.Background())
+
+	if got, want := fmt.Sprint(events), "[issue foo.example.com renew foo.example.com]"; got != want {
+		t.Errorf("Got events: %v, Want: %v", got, want)
+	}
+}
+
+func TestFailureEvents(t *testing.T) {
+	tests := []struct {
+		inExpiresIn time.Duration
+		outEvents   string
+	}{
+		// 0 - renewal failed but there's plenty of time left
+		{20 * 24 * time.Hour, "[failure foo.example.com]"},
+		// 1 - renewal failed and the certificate expires soon
+		{10 * 24 * time.Hour, "[failure foo.example.com expire soon foo.example.com]"},
+	}
+
+	for i, tt := range tests {
+		var events []string
+
+		m := CertificateManager{
+			ACMEClient:  &failingCertificateForDomainer{},
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+			OnRenewFailure: func(hostname string, err error) {
+				events = append(events, "failure "+hostname)
+			},
+			OnExpireSoon: func(hostname string, notAfter time.Time) {
+				events = append(events, "expire soon "+hostname)
+			},
+		}
+
+		certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(-80*24*time.Hour), clock.UtcNow().Add(tt.inExpiresIn))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		m.renewCertificates(context.Background())
+
+		if got, want := fmt.Sprint(events), tt.outEvents; got != want {
+			t.Errorf("Test(%v) Got events: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PEMFiles writes certificates the way certbot does, for servers like nginx
+// and HAProxy that read PEM files. Each host gets a directory
+// Directory/hostname with:
+//
+//	privkey.pem    the private key
+//	fullchain.pem  the certificate followed by the intermediates
+//	chain.pem      the intermediates only
+//
+// The private key is written with 0600 permissions, the certificates with
+// 0644. Each file is replaced atomically, but not all of them at once, so
+// servers should be reloaded after renewals rather than watch the files.
+type PEMFiles struct {
+	// Directory is where the directories of hosts are created.
+	Directory string
+}
+
+// Export writes the PEM files for hostname.
+func (p PEMFiles) Export(hostname string, certificate *tls.Certificate) error {
+	keyPEM, fullChainPEM, err := encodePEM(certificate)
+	if err != nil {
+		return err
+	}
+
+	var chain bytes.Buffer
+	for _, certificateBytes := range certificate.Certificate[1:] {
+		err = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+		if err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Join(p.Directory, hostname)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for %v: %v", hostname, err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{"privkey.pem", keyPEM, 0600},
+		{"fullchain.pem", fullChainPEM, 0644},
+		{"chain.pem", chain.Bytes(), 0644},
+	}
+	for _, f := range files {
+		err = writeFileAtomic(filepath.Join(dir, f.name), f.data, f.perm)
+		if err != nil {
+			return fmt.Errorf("unable to write %v for %v: %v", f.name, hostname, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package export
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPEMFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	intermediate, err := generateCertificate("intermediate")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	certificate.Certificate = append(certificate.Certificate, intermediate.Certificate[0])
+
+	p := PEMFiles{Directory: dir}
+	err = p.Export("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from Export: %v", err)
+	}
+
+	// the key and the full chain make up the certificate again
+	hostDir := filepath.Join(dir, "foo.example.com")
+	loaded, err := tls.LoadX509KeyPair(filepath.Join(hostDir, "fullchain.pem"), filepath.Join(hostDir, "privkey.pem"))
+	if err != nil {
+		t.Fatalf("Unexpected response from LoadX509KeyPair: %v", err)
+	}
+	if got, want := len(loaded.Certificate), 2; got != want {
+		t.Errorf("Got %v certificates in fullchain.pem, Want: %v", got, want)
+	}
+
+	// chain.pem only holds the intermediate
+	b, err := os.ReadFile(filepath.Join(hostDir, "chain.pem"))
+	if err != nil {
+		t.Fatalf("Unexpected response from ReadFile: %v", err)
+	}
+	block, rest := pem.Decode(b)
+	if block == nil || !bytes.Equal(block.Bytes, intermediate.Certificate[0]) || len(rest) != 0 {
+		t.Errorf("Got chain.pem: %s, Want the intermediate only", b)
+	}
+
+	tests := []struct {
+		inName  string
+		outPerm os.FileMode
+	}{
+		// 0 - the private key is only readable by its owner
+		{"privkey.pem", 0600},
+		// 1 - certificates are public
+		{"fullchain.pem", 0644},
+		{"chain.pem", 0644},
+	}
+
+	for i, tt := range tests {
+		info, err := os.Stat(filepath.Join(hostDir, tt.inName))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Stat: %v", i, err)
+		}
+		if got, want := info.Mode().Perm(), tt.outPerm; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestPEMFilesEmptyChain(t *testing.T) {
+	dir := t.TempDir()
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	certificate.Certificate = nil
+
+	p := PEMFiles{Directory: dir}
+	err = p.Export("foo.example.com", certificate)
+	if err == nil {
+		t.Fatalf("Expected an error when the certificate chain is empty")
+	}
+
+	// nothing is written for a broken certificate
+	_, err = os.Stat(filepath.Join(dir, "foo.example.com"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Got Stat error: %v, Want: not exist", err)
+	}
+}
@@ -0,0 +1,10 @@
+package export
+
+import (
+	"crypto/tls"
+)
+
+type Exporter interface {
+	// Export publishes the certificate for a given hostname outside of roman.
+	Export(hostname string, certificate *tls.Certificate) error
+}
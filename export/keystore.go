@@ -0,0 +1,241 @@
+package export
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf16"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	KeyStoreJKS    = "jks"
+	KeyStorePKCS12 = "pkcs12"
+)
+
+const (
+	jksMagic           = 0xfeedfeed
+	jksVersion         = 2
+	jksPrivateKeyEntry = 1
+	jksWhitener        = "Mighty Aphrodite"
+)
+
+var (
+	// oidKeyProtector is the algorithm Sun's KeyProtector uses to protect private keys in a JKS.
+	oidKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+)
+
+// KeyStore maintains a Java KeyStore (JKS) or PKCS#12 keystore file per host
+// for JVM services that can't read PEM files directly. Each keystore holds a
+// single private key entry with the full certificate chain.
+type KeyStore struct {
+	// Directory is where keystores are written, one file per host named
+	// hostname.jks or hostname.p12.
+	Directory string
+
+	// Format is either KeyStoreJKS (default) or KeyStorePKCS12.
+	Format string
+
+	// Alias is the alias of the key entry, defaults to the hostname.
+	Alias string
+
+	// Password protects both the keystore and the private key entry.
+	Password string
+}
+
+// Export writes the keystore for hostname.
+func (k KeyStore) Export(hostname string, certificate *tls.Certificate) error {
+	err := checkExportable(certificate)
+	if err != nil {
+		return err
+	}
+
+	chain, err := parseChain(certificate)
+	if err != nil {
+		return err
+	}
+
+	alias := k.Alias
+	if alias == "" {
+		alias = hostname
+	}
+
+	var keyStoreBytes []byte
+	var extension string
+
+	switch k.Format {
+	case KeyStoreJKS, "":
+		extension = ".jks"
+		keyStoreBytes, err = encodeJKS(alias, certificate.PrivateKey, chain, k.Password)
+	case KeyStorePKCS12:
+		extension = ".p12"
+		keyStoreBytes, err = pkcs12.Modern.Encode(certificate.PrivateKey, chain[0], chain[1:], k.Password)
+	default:
+		return fmt.Errorf("unsupported keystore format: %v", k.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to encode keystore for %v: %v", hostname, err)
+	}
+
+	return writeFileAtomic(filepath.Join(k.Directory, hostname+extension), keyStoreBytes, 0600)
+}
+
+// encodeJKS encodes a Sun JKS keystore containing a single private key entry.
+func encodeJKS(alias string, privateKey interface{}, chain []*x509.Certificate, password string) ([]byte, error) {
+	passwordBytes := jksPassword(password)
+
+	protectedKey, err := jksProtectKey(privateKey, passwordBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	// header, we only ever write a single entry
+	binary.Write(&buf, binary.BigEndian, uint32(jksMagic))
+	binary.Write(&buf, binary.BigEndian, uint32(jksVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+
+	// private key entry
+	binary.Write(&buf, binary.BigEndian, uint32(jksPrivateKeyEntry))
+	err = jksWriteUTF(&buf, alias)
+	if err != nil {
+		return nil, err
+	}
+	binary.Write(&buf, binary.BigEndian, uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	binary.Write(&buf, binary.BigEndian, uint32(len(protectedKey)))
+	buf.Write(protectedKey)
+
+	// certificate chain
+	binary.Write(&buf, binary.BigEndian, uint32(len(chain)))
+	for _, c := range chain {
+		err = jksWriteUTF(&buf, "X.509")
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(len(c.Raw)))
+		buf.Write(c.Raw)
+	}
+
+	// integrity check over everything written so far
+	digest := sha1.New()
+	digest.Write(passwordBytes)
+	digest.Write([]byte(jksWhitener))
+	digest.Write(buf.Bytes())
+	buf.Write(digest.Sum(nil))
+
+	return buf.Bytes(), nil
+}
+
+// jksProtectKey protects a private key the way Sun's KeyProtector does and
+// returns the DER encoded EncryptedPrivateKeyInfo.
+func jksProtectKey(privateKey interface{}, passwordBytes []byte) ([]byte, error) {
+	plaintext, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, sha1.Size)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// build the keystream by repeatedly hashing the password and the
+	// previous digest, starting with the salt
+	var keystream []byte
+	digest := salt
+	for len(keystream) < len(plaintext) {
+		h := sha1.New()
+		h.Write(passwordBytes)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		keystream = append(keystream, digest...)
+	}
+
+	encrypted := make([]byte, len(plaintext))
+	for i := range plaintext {
+		encrypted[i] = plaintext[i] ^ keystream[i]
+	}
+
+	check := sha1.New()
+	check.Write(passwordBytes)
+	check.Write(plaintext)
+
+	var protectedKey []byte
+	protectedKey = append(protectedKey, salt...)
+	protectedKey = append(protectedKey, encrypted...)
+	protectedKey = append(protectedKey, check.Sum(nil)...)
+
+	return asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidKeyProtector,
+			Parameters: asn1.NullRawValue,
+		},
+		Data: protectedKey,
+	})
+}
+
+// jksPassword returns the password as big-endian UTF-16, the way Java hashes it.
+func jksPassword(password string) []byte {
+	var b []byte
+	for _, v := range utf16.Encode([]rune(password)) {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// jksWriteUTF writes s the way Java's DataOutput.writeUTF does. Aliases and
+// certificate types are ASCII in practice, so plain UTF-8 is used.
+func jksWriteUTF(w io.Writer, s string) error {
+	if len(s) > 0xffff {
+		return fmt.Errorf("string too long: %v", len(s))
+	}
+
+	err := binary.Write(w, binary.BigEndian, uint16(len(s)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+func TestKeyStoreJKS(t *testing.T) {
+	dir := t.TempDir()
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	k := KeyStore{Directory: dir, Password: "changeit"}
+	err = k.Export("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from Export: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "foo.example.com.jks"))
+	if err != nil {
+		t.Fatalf("Unexpected response from ReadFile: %v", err)
+	}
+
+	// check the integrity digest at the end of the file
+	passwordBytes := jksPassword("changeit")
+	body, digest := b[:len(b)-sha1.Size], b[len(b)-sha1.Size:]
+	h := sha1.New()
+	h.Write(passwordBytes)
+	h.Write([]byte(jksWhitener))
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		t.Fatalf("Keystore digest does not match")
+	}
+
+	// walk the header and the entry
+	r := bytes.NewReader(body)
+	var magic, version, count, tag uint32
+	binary.Read(r, binary.BigEndian, &magic)
+	binary.Read(r, binary.BigEndian, &version)
+	binary.Read(r, binary.BigEndian, &count)
+	binary.Read(r, binary.BigEndian, &tag)
+	if magic != jksMagic || version != jksVersion || count != 1 || tag != jksPrivateKeyEntry {
+		t.Fatalf("Unexpected header: %x %v %v %v", magic, version, count, tag)
+	}
+	if got, want := readUTF(r), "foo.example.com"; got != want {
+		t.Errorf("Got alias: %v, Want: %v", got, want)
+	}
+
+	var timestamp uint64
+	var keyLength uint32
+	binary.Read(r, binary.BigEndian, &timestamp)
+	binary.Read(r, binary.BigEndian, &keyLength)
+	encryptedKey := make([]byte, keyLength)
+	r.Read(encryptedKey)
+
+	// recover the private key and make sure it's the one we exported
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}
+	_, err = asn1.Unmarshal(encryptedKey, &info)
+	if err != nil {
+		t.Fatalf("Unexpected response from asn1.Unmarshal: %v", err)
+	}
+	salt := info.Data[:sha1.Size]
+	encrypted := info.Data[sha1.Size : len(info.Data)-sha1.Size]
+
+	var keystream []byte
+	d := salt
+	for len(keystream) < len(encrypted) {
+		h := sha1.New()
+		h.Write(passwordBytes)
+		h.Write(d)
+		d = h.Sum(nil)
+		keystream = append(keystream, d...)
+	}
+	plaintext := make([]byte, len(encrypted))
+	for i := range encrypted {
+		plaintext[i] = encrypted[i] ^ keystream[i]
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(plaintext)
+	if err != nil {
+		t.Fatalf("Unexpected response from ParsePKCS8PrivateKey: %v", err)
+	}
+	if !privateKey.(*rsa.PrivateKey).Equal(certificate.PrivateKey) {
+		t.Errorf("Recovered private key does not match")
+	}
+
+	// and finally the chain
+	var chainLength, certificateLength uint32
+	binary.Read(r, binary.BigEndian, &chainLength)
+	if got, want := int(chainLength), len(certificate.Certificate); got != want {
+		t.Fatalf("Got chain length: %v, Want: %v", got, want)
+	}
+	if got, want := readUTF(r), "X.509"; got != want {
+		t.Errorf("Got certificate type: %v, Want: %v", got, want)
+	}
+	binary.Read(r, binary.BigEndian, &certificateLength)
+	certificateBytes := make([]byte, certificateLength)
+	r.Read(certificateBytes)
+	if !bytes.Equal(certificateBytes, certificate.Certificate[0]) {
+		t.Errorf("Certificate in keystore does not match")
+	}
+}
+
+func TestKeyStorePKCS12(t *testing.T) {
+	dir := t.TempDir()
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	k := KeyStore{Directory: dir, Format: KeyStorePKCS12, Password: "changeit"}
+	err = k.Export("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from Export: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "foo.example.com.p12"))
+	if err != nil {
+		t.Fatalf("Unexpected response from ReadFile: %v", err)
+	}
+
+	privateKey, leaf, _, err := pkcs12.DecodeChain(b, "changeit")
+	if err != nil {
+		t.Fatalf("Unexpected response from DecodeChain: %v", err)
+	}
+	if !privateKey.(*rsa.PrivateKey).Equal(certificate.PrivateKey) {
+		t.Errorf("Private key in keystore does not match")
+	}
+	if !bytes.Equal(leaf.Raw, certificate.Certificate[0]) {
+		t.Errorf("Certificate in keystore does not match")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "foo.example.com.p12"))
+	if err != nil {
+		t.Fatalf("Unexpected response from Stat: %v", err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("Got permissions: %v, Want: %v", got, want)
+	}
+}
+
+func readUTF(r *bytes.Reader) string {
+	var length uint16
+	binary.Read(r, binary.BigEndian, &length)
+	b := make([]byte, length)
+	r.Read(b)
+	return string(b)
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultNomadAddress = "http://127.0.0.1:4646"
+	defaultNomadPath    = "roman/certificates"
+)
+
+// Nomad writes certificates into Nomad Variables so Nomad jobs that consume
+// TLS material (for example through template blocks with workload identity)
+// pick up rotations without being redeployed. Each hostname gets its own
+// variable at Path/hostname with the items "cert" (full chain) and "key".
+type Nomad struct {
+	// Address is the Nomad HTTP API address, defaults to http://127.0.0.1:4646.
+	Address string
+
+	// Token is the ACL token used to write variables, sent as X-Nomad-Token.
+	Token string
+
+	// Namespace is the namespace variables are written to, defaults to the
+	// namespace of the token.
+	Namespace string
+
+	// Path is the prefix of the variable path, defaults to roman/certificates.
+	// To make variables readable by a job through workload identity, use
+	// nomad/jobs/<job name>.
+	Path string
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+type nomadVariable struct {
+	Namespace string            `json:"Namespace,omitempty"`
+	Path      string            `json:"Path"`
+	Items     map[string]string `json:"Items"`
+}
+
+// Export writes the certificate and private key for hostname into a Nomad Variable.
+func (n Nomad) Export(hostname string, certificate *tls.Certificate) error {
+	keyPEM, chainPEM, err := encodePEM(certificate)
+	if err != nil {
+		return err
+	}
+
+	prefix := n.Path
+	if prefix == "" {
+		prefix = defaultNomadPath
+	}
+	path := strings.Trim(prefix, "/") + "/" + hostname
+
+	body, err := json.Marshal(nomadVariable{
+		Namespace: n.Namespace,
+		Path:      path,
+		Items: map[string]string{
+			"cert": string(chainPEM),
+			"key":  string(keyPEM),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// build the request
+	address := n.Address
+	if address == "" {
+		address = defaultNomadAddress
+	}
+	u := strings.TrimSuffix(address, "/") + "/v1/var/" + path
+	if n.Namespace != "" {
+		u = u + "?namespace=" + url.QueryEscape(n.Namespace)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Token != "" {
+		req.Header.Set("X-Nomad-Token", n.Token)
+	}
+
+	client := n.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from nomad for variable %v: %v", path, resp.Status)
+	}
+
+	return nil
+}
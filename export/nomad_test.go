@@ -0,0 +1,59 @@
+package export
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNomadExport(t *testing.T) {
+	var gotPath string
+	var gotNamespace string
+	var gotToken string
+	var gotVariable nomadVariable
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotNamespace = r.URL.Query().Get("namespace")
+		gotToken = r.Header.Get("X-Nomad-Token")
+		json.NewDecoder(r.Body).Decode(&gotVariable)
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	n := Nomad{
+		Address:   ts.URL,
+		Token:     "secret",
+		Namespace: "edge",
+		Path:      "nomad/jobs/proxy",
+	}
+	err = n.Export("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from Export: %v", err)
+	}
+
+	if got, want := gotPath, "/v1/var/nomad/jobs/proxy/foo.example.com"; got != want {
+		t.Errorf("Got path: %v, Want: %v", got, want)
+	}
+	if got, want := gotNamespace, "edge"; got != want {
+		t.Errorf("Got namespace: %v, Want: %v", got, want)
+	}
+	if got, want := gotToken, "secret"; got != want {
+		t.Errorf("Got token: %v, Want: %v", got, want)
+	}
+	if got, want := gotVariable.Path, "nomad/jobs/proxy/foo.example.com"; got != want {
+		t.Errorf("Got variable path: %v, Want: %v", got, want)
+	}
+
+	_, err = tls.X509KeyPair([]byte(gotVariable.Items["cert"]), []byte(gotVariable.Items["key"]))
+	if err != nil {
+		t.Errorf("Unexpected response from tls.X509KeyPair: %v", err)
+	}
+}
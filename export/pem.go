@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyNotExportable is returned by exporters for certificates whose private
+// key can't be exported, like keys held by a KMS or an HSM.
+var ErrKeyNotExportable = errors.New("private key can't be exported")
+
+// checkExportable returns ErrKeyNotExportable if the private key of
+// certificate can't be encoded.
+func checkExportable(certificate *tls.Certificate) error {
+	switch certificate.PrivateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return nil
+	default:
+		return ErrKeyNotExportable
+	}
+}
+
+// encodePEM returns the PEM encoded private key and certificate chain of a *tls.Certificate.
+func encodePEM(certificate *tls.Certificate) ([]byte, []byte, error) {
+	if len(certificate.Certificate) == 0 {
+		return nil, nil, fmt.Errorf("certificate chain is empty")
+	}
+
+	var keyBlock *pem.Block
+
+	switch privateKey := certificate.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		keyBlock = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}
+	case *ecdsa.PrivateKey:
+		keyBytes, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: keyBytes,
+		}
+	case ed25519.PrivateKey:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyBlock = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: keyBytes,
+		}
+	default:
+		return nil, nil, ErrKeyNotExportable
+	}
+
+	// loop over the certificate chain and make them into pem blocks
+	var chain bytes.Buffer
+	for _, certificateBytes := range certificate.Certificate {
+		err := pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return pem.EncodeToMemory(keyBlock), chain.Bytes(), nil
+}
+
+// parseChain returns the parsed certificate chain of a *tls.Certificate, leaf first.
+func parseChain(certificate *tls.Certificate) ([]*x509.Certificate, error) {
+	if len(certificate.Certificate) == 0 {
+		return nil, fmt.Errorf("certificate chain is empty")
+	}
+
+	var chain []*x509.Certificate
+	for _, certificateBytes := range certificate.Certificate {
+		c, err := x509.ParseCertificate(certificateBytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEncodePEM(t *testing.T) {
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	tests := []struct {
+		inPrivateKey crypto.PrivateKey
+		outBlockType string
+		outErr       error
+	}{
+		// 0 - rsa
+		{certificate.PrivateKey, "RSA PRIVATE KEY", nil},
+		// 1 - ed25519
+		{ed25519Key, "PRIVATE KEY", nil},
+		// 2 - keys held by a kms or hsm
+		{opaqueKey{ed25519Key}, "", ErrKeyNotExportable},
+	}
+
+	for i, tt := range tests {
+		c := *certificate
+		c.PrivateKey = tt.inPrivateKey
+
+		keyPEM, _, err := encodePEM(&c)
+		if got, want := err, tt.outErr; !errors.Is(got, want) {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, got, want)
+		}
+		if err != nil {
+			continue
+		}
+		block, _ := pem.Decode(keyPEM)
+		if got, want := block.Type, tt.outBlockType; got != want {
+			t.Errorf("Test(%v) Got block type: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// keystores need the key too
+	c := *certificate
+	c.PrivateKey = opaqueKey{ed25519Key}
+	err = KeyStore{Directory: t.TempDir()}.Export("foo.example.com", &c)
+	if !errors.Is(err, ErrKeyNotExportable) {
+		t.Errorf("Got error: %v, Want: %v", err, ErrKeyNotExportable)
+	}
+}
+
+// opaqueKey is a crypto.Signer that can't be exported.
+type opaqueKey struct {
+	signer crypto.Signer
+}
+
+func (k opaqueKey) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+func (k opaqueKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.signer.Sign(rand, digest, opts)
+}
@@ -0,0 +1,218 @@
+package export
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	defaultEtcdEndpoint = "http://127.0.0.1:2379"
+	defaultVulcandKey   = "/vulcand"
+)
+
+// Vulcand pushes certificates into the etcd-backed host settings of vulcand
+// (hostSettings.KeyPair) so vulcand proxies pick up roman managed certificates.
+// Vulcand only accepts sealed key pairs, so SealKey must be the same key
+// vulcand was started with (the hex string printed by "vctl secret new_key").
+// Etcd is accessed over its v2 HTTP API.
+type Vulcand struct {
+	// Endpoint is the etcd endpoint, defaults to http://127.0.0.1:2379.
+	Endpoint string
+
+	// Key is the etcd key vulcand was started with, defaults to /vulcand.
+	Key string
+
+	// SealKey is the hex encoded secretbox key vulcand uses to seal key pairs.
+	SealKey string
+
+	// HTTPClient is used to make requests, if nil http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// vulcandHost mirrors how vulcand stores a host in etcd. Settings other than
+// the key pair are kept as-is so we don't clobber settings managed by vulcand.
+type vulcandHost struct {
+	Name     string
+	Settings map[string]json.RawMessage
+}
+
+type vulcandKeyPair struct {
+	Key  []byte
+	Cert []byte
+}
+
+type vulcandSealedValue struct {
+	Version int
+	Value   vulcandSealedBytes
+}
+
+type vulcandSealedBytes struct {
+	Encryption vulcandEncryption
+	Value      []byte
+}
+
+type vulcandEncryption struct {
+	Type  string
+	Nonce []byte
+}
+
+type etcdResponse struct {
+	Node struct {
+		Value string `json:"value"`
+	} `json:"node"`
+}
+
+// Export upserts the vulcand host for hostname with the certificate as its key pair.
+func (v Vulcand) Export(hostname string, certificate *tls.Certificate) error {
+	keyPEM, chainPEM, err := encodePEM(certificate)
+	if err != nil {
+		return err
+	}
+
+	// seal the key pair the same way vulcand does
+	keyPairBytes, err := json.Marshal(vulcandKeyPair{Key: keyPEM, Cert: chainPEM})
+	if err != nil {
+		return err
+	}
+	sealedKeyPair, err := v.seal(keyPairBytes)
+	if err != nil {
+		return err
+	}
+
+	// read the existing host (if any) so we only update the key pair
+	hostKey := fmt.Sprintf("%v/hosts/%v/host", v.key(), hostname)
+	host, err := v.getHost(hostKey)
+	if err != nil {
+		return err
+	}
+	host.Name = hostname
+	host.Settings["KeyPair"] = sealedKeyPair
+
+	hostBytes, err := json.Marshal(host)
+	if err != nil {
+		return err
+	}
+
+	return v.put(hostKey, string(hostBytes))
+}
+
+// seal encrypts value with SealKey using secretbox and returns the JSON
+// encoded sealed value vulcand expects.
+func (v Vulcand) seal(value []byte) ([]byte, error) {
+	keyBytes, err := hex.DecodeString(v.SealKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode vulcand seal key: %v", err)
+	}
+	if len(keyBytes) != 32 {
+		return nil, fmt.Errorf("vulcand seal key must be 32 bytes, got: %v", len(keyBytes))
+	}
+
+	var key [32]byte
+	copy(key[:], keyBytes)
+
+	var nonce [24]byte
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(vulcandSealedValue{
+		Version: 1,
+		Value: vulcandSealedBytes{
+			Encryption: vulcandEncryption{
+				Type:  "secretbox.v1",
+				Nonce: nonce[:],
+			},
+			Value: secretbox.Seal(nil, value, &nonce, &key),
+		},
+	})
+}
+
+// getHost reads a vulcand host from etcd, if the host does not exist an empty one is returned.
+func (v Vulcand) getHost(key string) (*vulcandHost, error) {
+	resp, err := v.client().Get(v.endpoint() + "/v2/keys" + key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	host := &vulcandHost{Settings: make(map[string]json.RawMessage)}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return host, nil
+	default:
+		return nil, fmt.Errorf("unexpected response from etcd for %v: %v", key, resp.Status)
+	}
+
+	var r etcdResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(r.Node.Value), host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode vulcand host %v: %v", key, err)
+	}
+	if host.Settings == nil {
+		host.Settings = make(map[string]json.RawMessage)
+	}
+
+	return host, nil
+}
+
+// put writes value to key in etcd.
+func (v Vulcand) put(key string, value string) error {
+	form := url.Values{}
+	form.Set("value", value)
+
+	req, err := http.NewRequest(http.MethodPut, v.endpoint()+"/v2/keys"+key, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected response from etcd for %v: %v", key, resp.Status)
+	}
+
+	return nil
+}
+
+func (v Vulcand) endpoint() string {
+	if v.Endpoint == "" {
+		return defaultEtcdEndpoint
+	}
+	return strings.TrimSuffix(v.Endpoint, "/")
+}
+
+func (v Vulcand) key() string {
+	if v.Key == "" {
+		return defaultVulcandKey
+	}
+	return "/" + strings.Trim(v.Key, "/")
+}
+
+func (v Vulcand) client() *http.Client {
+	if v.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return v.HTTPClient
+}
@@ -0,0 +1,163 @@
+package export
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+func TestVulcandExport(t *testing.T) {
+	sealKey := strings.Repeat("ab", 32)
+
+	etcd := newFakeEtcd()
+	ts := httptest.NewServer(etcd)
+	defer ts.Close()
+
+	// pretend vulcand already knows about the host
+	etcd.values["/v2/keys/vulcand/hosts/foo.example.com/host"] = `{"Name":"foo.example.com","Settings":{"Default":true}}`
+
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	v := Vulcand{Endpoint: ts.URL, SealKey: sealKey}
+	err = v.Export("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from Export: %v", err)
+	}
+
+	// read back what was written and make sure other settings were kept
+	var host vulcandHost
+	err = json.Unmarshal([]byte(etcd.values["/v2/keys/vulcand/hosts/foo.example.com/host"]), &host)
+	if err != nil {
+		t.Fatalf("Unexpected response from json.Unmarshal: %v", err)
+	}
+	if got, want := string(host.Settings["Default"]), "true"; got != want {
+		t.Errorf("Got Default: %v, Want: %v", got, want)
+	}
+
+	// unseal the key pair and check the certificate
+	var sealed vulcandSealedValue
+	err = json.Unmarshal(host.Settings["KeyPair"], &sealed)
+	if err != nil {
+		t.Fatalf("Unexpected response from json.Unmarshal: %v", err)
+	}
+
+	var key [32]byte
+	var nonce [24]byte
+	keyBytes, _ := hex.DecodeString(sealKey)
+	copy(key[:], keyBytes)
+	copy(nonce[:], sealed.Value.Encryption.Nonce)
+
+	keyPairBytes, ok := secretbox.Open(nil, sealed.Value.Value, &nonce, &key)
+	if !ok {
+		t.Fatalf("Unable to open sealed key pair")
+	}
+
+	var keyPair vulcandKeyPair
+	err = json.Unmarshal(keyPairBytes, &keyPair)
+	if err != nil {
+		t.Fatalf("Unexpected response from json.Unmarshal: %v", err)
+	}
+
+	_, err = tls.X509KeyPair(keyPair.Cert, keyPair.Key)
+	if err != nil {
+		t.Errorf("Unexpected response from tls.X509KeyPair: %v", err)
+	}
+}
+
+func TestVulcandBadSealKey(t *testing.T) {
+	certificate, err := generateCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	v := Vulcand{Endpoint: "http://127.0.0.1:0", SealKey: "abcd"}
+	err = v.Export("foo.example.com", certificate)
+	if err == nil {
+		t.Errorf("Expected an error for a short seal key")
+	}
+}
+
+// fakeEtcd is used in tests to mimic the parts of the etcd v2 keys API we use.
+type fakeEtcd struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{values: make(map[string]string)}
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		value, ok := f.values[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action": "get",
+			"node":   map[string]string{"key": r.URL.Path, "value": value},
+		})
+	case http.MethodPut:
+		f.values[r.URL.Path] = r.FormValue("value")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// generateCertificate is used in tests to create dummy certificates.
+func generateCertificate(hostname string) (*tls.Certificate, error) {
+	keypair, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"foo"},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{hostname},
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, keypair.Public(), keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificateBytes},
+		PrivateKey:  keypair,
+		Leaf:        leaf,
+	}, nil
+}
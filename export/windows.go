@@ -0,0 +1,175 @@
+//go:build windows
+
+package export
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	defaultWindowsStore = "MY"
+)
+
+// WindowsCertStore installs certificates into the Windows local machine
+// certificate store so they can be bound to IIS sites, WinRM listeners, etc.
+// Certificates for the same hostname from the same issuer that have been
+// superseded are removed from the store.
+type WindowsCertStore struct {
+	// Store is the name of the local machine store the certificate is
+	// installed into, defaults to MY (Personal).
+	Store string
+
+	// Exportable marks the imported private key as exportable.
+	Exportable bool
+
+	// KeepSuperseded stops superseded certificates from being removed.
+	KeepSuperseded bool
+}
+
+// Export installs the certificate for hostname into the certificate store.
+func (w WindowsCertStore) Export(hostname string, certificate *tls.Certificate) error {
+	err := checkExportable(certificate)
+	if err != nil {
+		return err
+	}
+
+	chain, err := parseChain(certificate)
+	if err != nil {
+		return err
+	}
+	leaf := chain[0]
+
+	// windows imports private keys through pfx files, so build one in memory
+	// protected with a throwaway password
+	passwordBytes := make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, passwordBytes)
+	if err != nil {
+		return err
+	}
+	password := hex.EncodeToString(passwordBytes)
+
+	pfx, err := pkcs12.Modern.Encode(certificate.PrivateKey, leaf, chain[1:], password)
+	if err != nil {
+		return fmt.Errorf("unable to encode pfx: %v", err)
+	}
+
+	passwordUTF16, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return err
+	}
+
+	flags := uint32(windows.CRYPT_MACHINE_KEYSET)
+	if w.Exportable {
+		flags = flags | windows.CRYPT_EXPORTABLE
+	}
+
+	// import the pfx into a temporary in-memory store, this also persists
+	// the private key in the machine key set
+	pfxStore, err := windows.PFXImportCertStore(&windows.CryptDataBlob{
+		Size: uint32(len(pfx)),
+		Data: &pfx[0],
+	}, passwordUTF16, flags)
+	if err != nil {
+		return fmt.Errorf("unable to import pfx: %v", err)
+	}
+	defer windows.CertCloseStore(pfxStore, 0)
+
+	// open the system store we are going to install the certificate into
+	store, err := openSystemStore(w.storeName())
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	// find the leaf in the temporary store and copy it into the system store
+	var ctx *windows.CertContext
+	for {
+		ctx, err = windows.CertEnumCertificatesInStore(pfxStore, ctx)
+		if ctx == nil {
+			return fmt.Errorf("unable to find certificate for %v in imported pfx", hostname)
+		}
+		if bytes.Equal(certContextBytes(ctx), leaf.Raw) {
+			break
+		}
+	}
+	err = windows.CertAddCertificateContextToStore(store, ctx, windows.CERT_STORE_ADD_REPLACE_EXISTING, nil)
+	windows.CertFreeCertificateContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to add certificate to %v store: %v", w.storeName(), err)
+	}
+
+	if w.KeepSuperseded {
+		return nil
+	}
+
+	return removeSuperseded(store, hostname, leaf)
+}
+
+// removeSuperseded deletes certificates for hostname from the same issuer
+// that were issued before leaf.
+func removeSuperseded(store windows.Handle, hostname string, leaf *x509.Certificate) error {
+	var ctx *windows.CertContext
+	for {
+		ctx, _ = windows.CertEnumCertificatesInStore(store, ctx)
+		if ctx == nil {
+			return nil
+		}
+
+		c, err := x509.ParseCertificate(certContextBytes(ctx))
+		if err != nil {
+			continue
+		}
+
+		// skip anything that is not an older certificate for this hostname
+		if c.VerifyHostname(hostname) != nil {
+			continue
+		}
+		if !bytes.Equal(c.RawIssuer, leaf.RawIssuer) || !c.NotBefore.Before(leaf.NotBefore) {
+			continue
+		}
+
+		// deleting frees the context which we need to continue enumerating,
+		// so delete a duplicate of it instead
+		err = windows.CertDeleteCertificateFromStore(windows.CertDuplicateCertificateContext(ctx))
+		if err != nil {
+			windows.CertFreeCertificateContext(ctx)
+			return fmt.Errorf("unable to remove superseded certificate %v: %v", c.SerialNumber, err)
+		}
+	}
+}
+
+func openSystemStore(name string) (windows.Handle, error) {
+	nameUTF16, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0,
+		windows.CERT_SYSTEM_STORE_LOCAL_MACHINE, uintptr(unsafe.Pointer(nameUTF16)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to open %v store: %v", name, err)
+	}
+
+	return store, nil
+}
+
+func certContextBytes(ctx *windows.CertContext) []byte {
+	return unsafe.Slice(ctx.EncodedCert, ctx.Length)
+}
+
+func (w WindowsCertStore) storeName() string {
+	if w.Store == "" {
+		return defaultWindowsStore
+	}
+	return w.Store
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package export
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// WindowsCertStore installs certificates into the Windows local machine
+// certificate store. It's only supported on Windows.
+type WindowsCertStore struct {
+	Store          string
+	Exportable     bool
+	KeepSuperseded bool
+}
+
+// Export always fails on platforms other than Windows.
+func (w WindowsCertStore) Export(hostname string, certificate *tls.Certificate) error {
+	return fmt.Errorf("the windows certificate store is only supported on windows")
+}
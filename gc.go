@@ -0,0 +1,116 @@
+package roman
+
+import (
+	"crypto/tls"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	defaultGCExpiredFor = 30 * 24 * time.Hour
+)
+
+// GarbageCollection configures the periodic removal of certificates from
+// Cache that are no longer needed, keeping shared stores from growing
+// unbounded. Cache has to implement cache.Lister.
+type GarbageCollection struct {
+	// Interval is how often Cache is scanned, zero disables garbage
+	// collection.
+	Interval time.Duration
+
+	// ExpiredFor is how long after they expired certificates are deleted,
+	// defaults to 30 days.
+	ExpiredFor time.Duration
+
+	// UnknownHosts also deletes the certificates of hosts that are not in
+	// KnownHosts or HostSource and not allowed by HostPolicy. Only enable
+	// this if no other CertificateManager with different KnownHosts shares
+	// Cache.
+	UnknownHosts bool
+}
+
+// collectGarbage deletes the certificates in Cache that expired more than
+// ExpiredFor ago and, if enabled, those of unknown hosts. It returns the
+// hostnames whose certificates were deleted.
+func (m *CertificateManager) collectGarbage() ([]string, error) {
+	hostnames, err := m.CachedHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	expiredFor := m.GarbageCollection.ExpiredFor
+	if expiredFor == 0 {
+		expiredFor = defaultGCExpiredFor
+	}
+
+	knownHosts := make(map[string]bool)
+	for _, hostname := range m.hosts() {
+		knownHosts[hostname] = true
+	}
+
+	var deleted []string
+	for _, hostname := range hostnames {
+		reason := ""
+		switch {
+		case m.GarbageCollection.UnknownHosts && !knownHosts[hostname] && !m.allowedOnDemand(hostname):
+			reason = "unknown host"
+		default:
+			// don't use the in-memory cache, unknown hosts shouldn't end up
+			// in it
+			certificate, err := m.readCertificate(hostname)
+			if err != nil {
+				log.Warningf("unable to read certificate for %q during garbage collection: %v", hostname, err)
+				continue
+			}
+			if clock.UtcNow().Sub(certificate.Leaf.NotAfter) > expiredFor {
+				reason = "expired on " + certificate.Leaf.NotAfter.UTC().Format(time.RFC3339)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		err = m.deleteCertificateFromCache(hostname)
+		if err != nil {
+			log.Warningf("unable to delete certificate for %q during garbage collection: %v", hostname, err)
+			continue
+		}
+		log.Infof("deleted certificate for %q from cache: %v", hostname, reason)
+
+		err = m.deleteStaple(hostname)
+		if err != nil {
+			log.Warningf("unable to delete ocsp staple for %q during garbage collection: %v", hostname, err)
+		}
+		deleted = append(deleted, hostname)
+	}
+
+	return deleted, nil
+}
+
+func (m *CertificateManager) readCertificate(hostname string) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	certificate, _, err := m.loadCertificate(ctx, hostname)
+	return certificate, err
+}
+
+// collectGarbageForever calls collectGarbage every GarbageCollection.Interval
+// until ctx is done.
+func (m *CertificateManager) collectGarbageForever(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(m.GarbageCollection.Interval):
+		case <-ctx.Done():
+			return
+		}
+
+		_, err := m.collectGarbage()
+		if err != nil {
+			log.Errorf("unable to collect garbage: %v", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package roman
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	tests := []struct {
+		inHostname     string
+		inExpiredFor   time.Duration // how long ago the certificate expired
+		inUnknownHosts bool
+		outDeleted     bool
+	}{
+		// 0 - valid certificate of a known host
+		{"foo.example.com", -30 * 24 * time.Hour, false, false},
+		// 1 - recently expired certificate
+		{"foo.example.com", 24 * time.Hour, false, false},
+		// 2 - certificate that expired long ago
+		{"foo.example.com", 31 * 24 * time.Hour, false, true},
+		// 3 - unknown hosts are kept by default
+		{"bar.example.com", -30 * 24 * time.Hour, false, false},
+		// 4 - unless enabled
+		{"bar.example.com", -30 * 24 * time.Hour, true, true},
+		// 5 - that doesn't affect known hosts
+		{"foo.example.com", -30 * 24 * time.Hour, true, false},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			Cache:      &cache.Memory{},
+			KnownHosts: []string{"foo.example.com"},
+			GarbageCollection: GarbageCollection{
+				Interval:     time.Hour,
+				UnknownHosts: tt.inUnknownHosts,
+			},
+		}
+
+		notAfter := clock.UtcNow().Add(-tt.inExpiredFor)
+		certificate, err := generateCertificate(tt.inHostname, notAfter.Add(-90*24*time.Hour), notAfter)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+		err = m.putCertificateInCache(tt.inHostname, certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		deleted, err := m.collectGarbage()
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from collectGarbage: %v", i, err)
+		}
+		if got, want := len(deleted) == 1, tt.outDeleted; got != want {
+			t.Errorf("Test(%v) Got deleted: %v, Want deleted: %v", i, deleted, want)
+		}
+
+		hostnames, err := m.CachedHosts()
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CachedHosts: %v", i, err)
+		}
+		if got, want := len(hostnames) == 0, tt.outDeleted; got != want {
+			t.Errorf("Test(%v) Got cached hosts: %v", i, hostnames)
+		}
+		if _, ok := m.memoryCache[tt.inHostname]; ok && tt.outDeleted {
+			t.Errorf("Test(%v) Got deleted certificate in memoryCache", i)
+		}
+	}
+}
+
+func TestCollectGarbageNotListable(t *testing.T) {
+	m := CertificateManager{
+		Cache:             newMapCache(),
+		ACMEClient:        &countingCertificateForDomainer{},
+		GarbageCollection: GarbageCollection{Interval: time.Hour},
+	}
+
+	err := m.Start()
+	if got, want := fmt.Sprint(err), "unable to garbage collect cache: cache can't be listed"; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
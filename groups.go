@@ -0,0 +1,99 @@
+package roman
+
+import (
+	"crypto"
+	"crypto/tls"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+)
+
+// certificateGroup returns the hosts that share a certificate with hostname,
+// or just hostname if it's not in any of the CertificateGroups.
+func (m *CertificateManager) certificateGroup(hostname string) []string {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+
+	for _, group := range m.CertificateGroups {
+		for _, v := range group {
+			if v == hostname {
+				return group
+			}
+		}
+	}
+
+	return []string{hostname}
+}
+
+// groupCached returns true if certificate covers all hostnames and is cached
+// for all of them. This is false when the group changed, for example when a
+// host was added to it.
+func (m *CertificateManager) groupCached(certificate *tls.Certificate, hostnames []string) bool {
+	for _, hostname := range hostnames {
+		if certificate.Leaf.VerifyHostname(hostname) != nil {
+			return false
+		}
+
+		cached, err := m.getCertificateFromCache(hostname)
+		if err != nil || !cached.Leaf.Equal(certificate.Leaf) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// certificateForHosts requests a single certificate for hostnames. If ReuseKey
+// is set, the key of previous (if any) is used for the new certificate,
+// otherwise KeyProvider creates one if it's set. Clients that take a context
+// continue the trace in ctx.
+func (m *CertificateManager) certificateForHosts(ctx context.Context, hostnames []string, previous *tls.Certificate) (*tls.Certificate, error) {
+	client := m.clientForHost(hostnames[0])
+
+	if m.ReuseKey && previous != nil {
+		privateKey, ok := previous.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", previous.PrivateKey)
+		}
+		return certificateForKey(ctx, client, hostnames, privateKey)
+	}
+
+	if m.KeyProvider != nil {
+		privateKey, err := m.createKey(ctx, hostnames)
+		if err != nil {
+			return nil, err
+		}
+		return certificateForKey(ctx, client, hostnames, privateKey)
+	}
+
+	if contextClient, ok := client.(acme.ContextCertificateForDomainer); ok {
+		return contextClient.CertificateForDomainsContext(ctx, hostnames)
+	}
+
+	if len(hostnames) == 1 {
+		return client.CertificateForDomain(hostnames[0])
+	}
+
+	multiClient, ok := client.(acme.MultiCertificateForDomainer)
+	if !ok {
+		return nil, fmt.Errorf("%T can't request certificates for multiple hostnames", client)
+	}
+
+	return multiClient.CertificateForDomains(hostnames)
+}
+
+// certificateForKey requests a single certificate for hostnames and
+// privateKey from client.
+func certificateForKey(ctx context.Context, client acme.CertificateForDomainer, hostnames []string, privateKey crypto.Signer) (*tls.Certificate, error) {
+	if contextClient, ok := client.(acme.ContextCertificateForKeyer); ok {
+		return contextClient.CertificateForKeyContext(ctx, hostnames, privateKey)
+	}
+	keyClient, ok := client.(acme.CertificateForKeyer)
+	if !ok {
+		return nil, fmt.Errorf("%T can't request certificates for an existing key", client)
+	}
+
+	return keyClient.CertificateForKey(hostnames, privateKey)
+}
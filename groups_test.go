@@ -0,0 +1,205 @@
+package roman
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCertificateGroups(t *testing.T) {
+	client := &multiCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:        client,
+		Cache:             newMapCache(),
+		KnownHosts:        []string{"foo.example.com", "bar.example.com", "baz.example.com"},
+		RenewBefore:       30 * 24 * time.Hour, // 30 days
+		CertificateGroups: [][]string{{"foo.example.com", "bar.example.com"}},
+	}
+
+	errs := m.renewCertificates(context.Background())
+	if errs != nil {
+		t.Fatalf("Unexpected response from renewCertificates: %v", errs)
+	}
+
+	// one certificate for the group, one for the host outside of it
+	if got, want := client.count, 2; got != want {
+		t.Errorf("Got %v certificates issued, Want: %v", got, want)
+	}
+
+	foo, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	bar, err := m.getCertificateFromCache("bar.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	if !foo.Leaf.Equal(bar.Leaf) {
+		t.Errorf("Hosts in a group don't share a certificate")
+	}
+
+	// nothing is renewed while the certificates are valid
+	errs = m.renewCertificates(context.Background())
+	if errs != nil {
+		t.Fatalf("Unexpected response from renewCertificates: %v", errs)
+	}
+	if got, want := client.count, 2; got != want {
+		t.Errorf("Got %v certificates issued, Want: %v", got, want)
+	}
+
+	// adding a host to the group gets a new certificate
+	m.KnownHosts = append(m.KnownHosts, "qux.example.com")
+	m.CertificateGroups = [][]string{{"foo.example.com", "bar.example.com", "qux.example.com"}}
+	errs = m.renewCertificates(context.Background())
+	if errs != nil {
+		t.Fatalf("Unexpected response from renewCertificates: %v", errs)
+	}
+	if got, want := client.count, 3; got != want {
+		t.Errorf("Got %v certificates issued, Want: %v", got, want)
+	}
+	qux, err := m.getCertificateFromCache("qux.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	if err = qux.Leaf.VerifyHostname("foo.example.com"); err != nil {
+		t.Errorf("Unexpected response from VerifyHostname: %v", err)
+	}
+}
+
+func TestCertificateGroupsUnsupported(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient:        &countingCertificateForDomainer{},
+		Cache:             newMapCache(),
+		KnownHosts:        []string{"foo.example.com", "bar.example.com"},
+		RenewBefore:       30 * 24 * time.Hour, // 30 days
+		CertificateGroups: [][]string{{"foo.example.com", "bar.example.com"}},
+	}
+
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error when the client can't request multiple hostnames")
+	}
+}
+
+func TestReuseKey(t *testing.T) {
+	tests := []struct {
+		inReuseKey bool
+		outSameKey bool
+	}{
+		// 0 - fresh key on every renewal
+		{false, false},
+		// 1 - key is reused
+		{true, true},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			ACMEClient:  &multiCertificateForDomainer{},
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 100 * 24 * time.Hour, // always renew
+			ReuseKey:    tt.inReuseKey,
+		}
+
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from renewCertificate: %v", i, err)
+		}
+		first, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+
+		err = m.renewCertificate(context.Background(), "foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from renewCertificate: %v", i, err)
+		}
+		second, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+
+		if first.Leaf.Equal(second.Leaf) {
+			t.Errorf("Test(%v) Certificate was not renewed", i)
+		}
+		sameKey := first.PrivateKey.(*rsa.PrivateKey).Equal(second.PrivateKey)
+		if got, want := sameKey, tt.outSameKey; got != want {
+			t.Errorf("Test(%v) Got same key: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestReuseKeyUnsupported(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient:  &countingCertificateForDomainer{},
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 100 * 24 * time.Hour, // always renew
+		ReuseKey:    true,
+	}
+
+	// the first certificate doesn't need a key to be reused
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+
+	err = m.renewCertificate(context.Background(), "foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error when the client can't reuse keys")
+	}
+}
+
+// multiCertificateForDomainer is used in tests to issue certificates for multiple hostnames.
+type multiCertificateForDomainer struct {
+	count int
+}
+
+func (n *multiCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	return n.CertificateForDomains([]string{hostname})
+}
+
+func (n *multiCertificateForDomainer) CertificateForDomains(hostnames []string) (*tls.Certificate, error) {
+	keypair, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.CertificateForKey(hostnames, keypair)
+}
+
+func (n *multiCertificateForDomainer) CertificateForKey(hostnames []string, keypair crypto.Signer) (*tls.Certificate, error) {
+	n.count = n.count + 1
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(int64(n.count)),
+		Subject:      pkix.Name{CommonName: hostnames[0]},
+		NotBefore:    clock.UtcNow(),
+		NotAfter:     clock.UtcNow().Add(90 * 24 * time.Hour),
+		DNSNames:     hostnames,
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, keypair.Public(), keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificateBytes},
+		PrivateKey:  keypair,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package roman
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Healthy returns an error if any of the KnownHosts (or the hosts of
+// HostSource) doesn't have a valid certificate in the cache, or has one that
+// should have been renewed long ago: more than halfway through its renewal
+// window, like OnExpireSoon. It's meant for readiness probes.
+func (m *CertificateManager) Healthy() error {
+	var problems []string
+	for _, hostname := range m.hosts() {
+		err := m.hostHealthy(hostname)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if problems != nil {
+		return fmt.Errorf("unhealthy: %v", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// hostHealthy returns an error if hostname doesn't have a valid certificate
+// or its renewal is overdue.
+func (m *CertificateManager) hostHealthy(hostname string) error {
+	certificate, err := m.getCertificateFromCache(hostname)
+	if err != nil {
+		return fmt.Errorf("no certificate for %q: %v", hostname, err)
+	}
+	if certificate.Leaf == nil {
+		return fmt.Errorf("no parsed certificate for %q", hostname)
+	}
+
+	now := clock.UtcNow()
+	if now.Before(certificate.Leaf.NotBefore) || now.After(certificate.Leaf.NotAfter) {
+		return fmt.Errorf("certificate for %q is not valid at %v", hostname, now)
+	}
+	if expiresSoon(certificate.Leaf, m.renewBefore(certificate.Leaf)) {
+		return fmt.Errorf("renewal of certificate for %q is overdue, it expires at %v", hostname, certificate.Leaf.NotAfter)
+	}
+
+	return nil
+}
+
+// HealthHandler returns an http.Handler for readiness probes that responds
+// with 200 OK if Healthy returns nil and with 503 Service Unavailable and the
+// error otherwise.
+func (m *CertificateManager) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := m.Healthy()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,63 @@
+package roman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthy(t *testing.T) {
+	tests := []struct {
+		inNotBefore time.Duration
+		inNotAfter  time.Duration
+		inCached    bool
+		outHealthy  bool
+	}{
+		// 0 - valid certificate
+		{-10 * 24 * time.Hour, 80 * 24 * time.Hour, true, true},
+		// 1 - in the renewal window, but not overdue yet
+		{-70 * 24 * time.Hour, 20 * 24 * time.Hour, true, true},
+		// 2 - renewal is overdue
+		{-80 * 24 * time.Hour, 10 * 24 * time.Hour, true, false},
+		// 3 - expired
+		{-90 * 24 * time.Hour, -1 * time.Hour, true, false},
+		// 4 - no certificate
+		{0, 0, false, false},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+		}
+
+		if tt.inCached {
+			certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(tt.inNotBefore), clock.UtcNow().Add(tt.inNotAfter))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+			}
+			err = m.putCertificateInCache("foo.example.com", certificate)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+			}
+		}
+
+		err := m.Healthy()
+		if got, want := err == nil, tt.outHealthy; got != want {
+			t.Errorf("Test(%v) Got healthy: %v (%v), Want: %v", i, got, err, want)
+		}
+
+		w := httptest.NewRecorder()
+		m.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+		wantCode := http.StatusServiceUnavailable
+		if tt.outHealthy {
+			wantCode = http.StatusOK
+		}
+		if got, want := w.Code, wantCode; got != want {
+			t.Errorf("Test(%v) Got status code: %v, Want: %v", i, got, want)
+		}
+	}
+}
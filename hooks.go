@@ -0,0 +1,125 @@
+package roman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultHookTimeout = 2 * time.Minute
+)
+
+// RenewalHook is run for each hostname of a certificate right before it's
+// requested from the CA (PreRenewalHooks) or after it was obtained, cached
+// and exported (PostRenewalHooks), for example to reload HAProxy or copy the
+// certificate to a sibling service. Pre renewal hooks get the certificate
+// that is about to be replaced, which is nil for new hosts.
+type RenewalHook interface {
+	RunHook(ctx context.Context, hostname string, certificate *tls.Certificate) error
+}
+
+// RenewalHookFunc is an adapter to use an ordinary function as a RenewalHook.
+type RenewalHookFunc func(ctx context.Context, hostname string, certificate *tls.Certificate) error
+
+// RunHook calls f(ctx, hostname, certificate).
+func (f RenewalHookFunc) RunHook(ctx context.Context, hostname string, certificate *tls.Certificate) error {
+	return f(ctx, hostname, certificate)
+}
+
+// ExecHook is a RenewalHook that runs a command. The command gets the
+// hostname and certificate in the environment:
+//
+//	ROMAN_HOSTNAME     hostname the certificate was renewed for
+//	ROMAN_NOT_AFTER    expiration of the certificate (RFC 3339), if there is one
+//	ROMAN_CERTIFICATE  PEM encoded certificate chain, if there is one
+//
+// The private key isn't passed on, use an Exporter to write it somewhere the
+// command can read it.
+type ExecHook struct {
+	// Command is the command to run, the first element is the executable and
+	// the rest are its arguments.
+	Command []string
+
+	// Hostnames, if set, limits the hook to these hostnames.
+	Hostnames []string
+
+	// Env is added to the environment of the command.
+	Env []string
+
+	// Timeout limits how long the command may run, defaults to 2 minutes.
+	Timeout time.Duration
+}
+
+// RunHook runs Command for hostname.
+func (e ExecHook) RunHook(ctx context.Context, hostname string, certificate *tls.Certificate) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+	if len(e.Hostnames) > 0 && !containsString(e.Hostnames, hostname) {
+		return nil
+	}
+
+	env := []string{"ROMAN_HOSTNAME=" + hostname}
+	if certificate != nil {
+		chain, err := chainToBytes(certificate)
+		if err != nil {
+			return err
+		}
+		env = append(env, "ROMAN_CERTIFICATE="+string(chain))
+		if certificate.Leaf != nil {
+			env = append(env, "ROMAN_NOT_AFTER="+certificate.Leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Env = append(append(os.Environ(), e.Env...), env...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%v failed: %v: %v", e.Command[0], err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// runRenewalHooks runs hooks for each of hostnames, and stops at the first
+// one that fails.
+func runRenewalHooks(ctx context.Context, hooks []RenewalHook, hostnames []string, certificate *tls.Certificate) error {
+	for _, hostname := range hostnames {
+		for _, hook := range hooks {
+			err := hook.RunHook(ctx, hostname, certificate)
+			if err != nil {
+				return fmt.Errorf("renewal hook for %q failed: %v", hostname, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRenewalHooks(t *testing.T) {
+	tests := []struct {
+		inPreErr   error
+		inPostErr  error
+		outIssued  int
+		outPost    int
+		outErr     bool
+		outPrevNil bool
+	}{
+		// 0 - both hooks run around a new certificate
+		{nil, nil, 1, 1, false, true},
+		// 1 - a failed pre renewal hook stops the renewal
+		{fmt.Errorf("unable to open firewall"), nil, 0, 0, true, true},
+		// 2 - a failed post renewal hook is a failed renewal
+		{nil, fmt.Errorf("unable to reload haproxy"), 1, 1, true, true},
+	}
+
+	for i, tt := range tests {
+		var pre, post []string
+		var previous *tls.Certificate
+		client := &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		}
+		m := CertificateManager{
+			ACMEClient:  client,
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour,
+			PreRenewalHooks: []RenewalHook{RenewalHookFunc(func(ctx context.Context, hostname string, certificate *tls.Certificate) error {
+				pre = append(pre, hostname)
+				previous = certificate
+				return tt.inPreErr
+			})},
+			PostRenewalHooks: []RenewalHook{RenewalHookFunc(func(ctx context.Context, hostname string, certificate *tls.Certificate) error {
+				if certificate == nil {
+					t.Errorf("Test(%v) Got no certificate in post renewal hook", i)
+				}
+				post = append(post, hostname)
+				return tt.inPostErr
+			})},
+		}
+
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := strings.Join(pre, ","), "foo.example.com"; got != want {
+			t.Errorf("Test(%v) Got pre renewal hook for: %v, Want: %v", i, got, want)
+		}
+		if got, want := previous == nil, tt.outPrevNil; got != want {
+			t.Errorf("Test(%v) Got no previous certificate: %v, Want: %v", i, got, want)
+		}
+		if got, want := client.count, tt.outIssued; got != want {
+			t.Errorf("Test(%v) Got %v certificates issued, Want: %v", i, got, want)
+		}
+		if got, want := len(post), tt.outPost; got != want {
+			t.Errorf("Test(%v) Got %v post renewal hooks, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestExecHook(t *testing.T) {
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	tests := []struct {
+		inHostnames []string
+		inHostname  string
+		outRan      bool
+	}{
+		// 0 - runs for every hostname
+		{nil, "foo.example.com", true},
+		// 1 - runs for the hostnames it's limited to
+		{[]string{"foo.example.com"}, "foo.example.com", true},
+		// 2 - and not for others
+		{[]string{"bar.example.com"}, "foo.example.com", false},
+	}
+
+	for i, tt := range tests {
+		out := filepath.Join(t.TempDir(), "out")
+		hook := ExecHook{
+			Command:   []string{"sh", "-c", `printf '%s %s %s' "$ROMAN_HOSTNAME" "$ROMAN_NOT_AFTER" "$EXTRA" > "$OUT"; echo "$ROMAN_CERTIFICATE" >> "$OUT"`},
+			Hostnames: tt.inHostnames,
+			Env:       []string{"OUT=" + out, "EXTRA=extra"},
+		}
+
+		err := hook.RunHook(context.Background(), tt.inHostname, certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from RunHook: %v", i, err)
+		}
+
+		b, err := os.ReadFile(out)
+		if got, want := err == nil, tt.outRan; got != want {
+			t.Fatalf("Test(%v) Got ran: %v, Want: %v", i, got, want)
+		}
+		if !tt.outRan {
+			continue
+		}
+		want := fmt.Sprintf("%v %v extra", tt.inHostname, certificate.Leaf.NotAfter.Format(time.RFC3339))
+		if got := string(b); !strings.HasPrefix(got, want) {
+			t.Errorf("Test(%v) Got output: %q, Want prefix: %q", i, got, want)
+		}
+		if !strings.Contains(string(b), "BEGIN CERTIFICATE") {
+			t.Errorf("Test(%v) Got no certificate in the environment", i)
+		}
+	}
+
+	// failures include the output of the command
+	err = ExecHook{Command: []string{"sh", "-c", "echo reload failed; exit 1"}}.RunHook(context.Background(), "foo.example.com", certificate)
+	if err == nil || !strings.Contains(err.Error(), "reload failed") {
+		t.Errorf("Got error: %v, Want: output of the command", err)
+	}
+}
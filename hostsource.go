@@ -0,0 +1,74 @@
+package roman
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// HostSource provides the hosts the CertificateManager obtains certificates
+// for, so the list can live in a database, Consul, or an API instead of a
+// static slice.
+type HostSource interface {
+	// Hosts returns the current list of hosts.
+	Hosts(ctx context.Context) ([]string, error)
+}
+
+// HostSourceFunc is an adapter to use an ordinary function as a HostSource.
+type HostSourceFunc func(ctx context.Context) ([]string, error)
+
+// Hosts calls f(ctx).
+func (f HostSourceFunc) Hosts(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// updateHosts queries HostSource, if set. If it fails, the hosts it returned
+// last are kept.
+func (m *CertificateManager) updateHosts(ctx context.Context) error {
+	if m.HostSource == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	hostnames, err := m.HostSource.Hosts(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get hosts from HostSource: %v", err)
+	}
+
+	m.Lock()
+	m.sourceHosts = hostnames
+	m.Unlock()
+
+	return nil
+}
+
+// hosts returns KnownHosts and the hosts HostSource returned last.
+func (m *CertificateManager) hosts() []string {
+	m.RLock()
+	sourceHosts := m.sourceHosts
+	m.RUnlock()
+
+	m.settingsMu.RLock()
+	knownHosts := m.KnownHosts
+	m.settingsMu.RUnlock()
+
+	if len(sourceHosts) == 0 {
+		return knownHosts
+	}
+
+	hostnames := make([]string, 0, len(knownHosts)+len(sourceHosts))
+	seen := make(map[string]bool, cap(hostnames))
+	for _, list := range [][]string{knownHosts, sourceHosts} {
+		for _, hostname := range list {
+			if !seen[hostname] {
+				seen[hostname] = true
+				hostnames = append(hostnames, hostname)
+			}
+		}
+	}
+
+	return hostnames
+}
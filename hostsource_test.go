@@ -0,0 +1,62 @@
+package roman
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestHostSource(t *testing.T) {
+	var sourceHosts []string
+	var sourceErr error
+
+	client := &countingCertificateForDomainer{
+		notBefore: clock.UtcNow(),
+		notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+	}
+	m := CertificateManager{
+		Cache:      &cache.Memory{},
+		ACMEClient: client,
+		KnownHosts: []string{"foo.example.com"},
+		HostSource: HostSourceFunc(func(ctx context.Context) ([]string, error) {
+			return sourceHosts, sourceErr
+		}),
+	}
+
+	tests := []struct {
+		inHosts    []string
+		inError    error
+		outHosts   []string
+		outCount   int // certificates requested so far
+		outErrored bool
+	}{
+		// 0 - known hosts only
+		{nil, nil, []string{"foo.example.com"}, 1, false},
+		// 1 - hosts added to the source are renewed in the next cycle
+		{[]string{"bar.example.com", "foo.example.com"}, nil, []string{"foo.example.com", "bar.example.com"}, 2, false},
+		// 2 - the last hosts are kept if the source fails
+		{nil, fmt.Errorf("unavailable"), []string{"foo.example.com", "bar.example.com"}, 2, true},
+		// 3 - hosts removed from the source are no longer renewed
+		{[]string{"baz.example.com"}, nil, []string{"foo.example.com", "baz.example.com"}, 3, false},
+	}
+
+	for i, tt := range tests {
+		sourceHosts, sourceErr = tt.inHosts, tt.inError
+
+		errs := m.renewCertificates(context.Background())
+		if got, want := len(errs) > 0, tt.outErrored; got != want {
+			t.Errorf("Test(%v) Got errors: %v, Want errors: %v", i, errs, want)
+		}
+		if got, want := m.hosts(), tt.outHosts; !reflect.DeepEqual(got, want) {
+			t.Errorf("Test(%v) Got hosts: %v, Want: %v", i, got, want)
+		}
+		if got, want := client.count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got count: %v, Want: %v", i, got, want)
+		}
+	}
+}
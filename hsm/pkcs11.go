@@ -0,0 +1,115 @@
+package hsm
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/ThalesIgnite/crypto11"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	referencePrefix = "pkcs11:id="
+)
+
+// Context are the methods of *crypto11.Context that PKCS11 uses.
+type Context interface {
+	GenerateECDSAKeyPairWithLabel(id, label []byte, curve elliptic.Curve) (crypto11.Signer, error)
+	GenerateRSAKeyPairWithLabel(id, label []byte, bits int) (crypto11.SignerDecrypter, error)
+	FindKeyPair(id, label []byte) (crypto11.Signer, error)
+}
+
+// PKCS11 is a roman.KeyProvider that generates keys in a PKCS #11 token, like
+// an HSM or SoftHSM, so private keys never leave it. CSRs and TLS handshakes
+// are signed by the token. Keys are referenced by a PKCS #11 URI with their
+// CKA_ID, RFC 7512.
+type PKCS11 struct {
+	// Context is a token opened with crypto11.Configure.
+	Context Context
+
+	// Curve of new ECDSA keys, defaults to P-256.
+	Curve elliptic.Curve
+
+	// RSABits, if set, makes new keys RSA keys of that size instead.
+	RSABits int
+}
+
+// CreateKey generates a new key pair in the token for hostnames, labeled
+// "roman <hostname>".
+func (p *PKCS11) CreateKey(ctx context.Context, hostnames []string) (crypto.Signer, error) {
+	id := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return nil, err
+	}
+	label := []byte("roman " + hostnames[0])
+
+	var signer crypto.Signer
+	if p.RSABits > 0 {
+		signer, err = p.Context.GenerateRSAKeyPairWithLabel(id, label, p.RSABits)
+	} else {
+		curve := p.Curve
+		if curve == nil {
+			curve = elliptic.P256()
+		}
+		signer, err = p.Context.GenerateECDSAKeyPairWithLabel(id, label, curve)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key pair: %v", err)
+	}
+
+	return &pkcs11Key{Signer: signer, id: id}, nil
+}
+
+// LoadKey finds the key pair with the PKCS #11 URI reference in the token.
+func (p *PKCS11) LoadKey(ctx context.Context, reference string) (crypto.Signer, error) {
+	id, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := p.Context.FindKeyPair(id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find key pair: %v", err)
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("no key pair %v in token", reference)
+	}
+
+	return &pkcs11Key{Signer: signer, id: id}, nil
+}
+
+// pkcs11Key is a key pair in a PKCS #11 token.
+type pkcs11Key struct {
+	crypto.Signer
+	id []byte
+}
+
+// KeyReference returns the PKCS #11 URI of the key pair.
+func (k *pkcs11Key) KeyReference() string {
+	var b strings.Builder
+	b.WriteString(referencePrefix)
+	for _, c := range k.id {
+		fmt.Fprintf(&b, "%%%02x", c)
+	}
+	return b.String()
+}
+
+// parseReference returns the CKA_ID in a PKCS #11 URI.
+func parseReference(reference string) ([]byte, error) {
+	if !strings.HasPrefix(reference, referencePrefix) {
+		return nil, fmt.Errorf("invalid PKCS #11 key reference %q", reference)
+	}
+
+	id, err := url.PathUnescape(strings.TrimPrefix(reference, referencePrefix))
+	if err != nil || id == "" {
+		return nil, fmt.Errorf("invalid PKCS #11 key reference %q", reference)
+	}
+	return []byte(id), nil
+}
@@ -0,0 +1,131 @@
+package hsm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+
+	"github.com/ThalesIgnite/crypto11"
+
+	"golang.org/x/net/context"
+)
+
+func TestPKCS11(t *testing.T) {
+	ctx := context.Background()
+	token := &fakeToken{}
+
+	tests := []struct {
+		inProvider *PKCS11
+		outKey     interface{}
+	}{
+		// 0 - p256 by default
+		{&PKCS11{Context: token}, &ecdsa.PublicKey{}},
+		// 1 - rsa
+		{&PKCS11{Context: token, RSABits: 2048}, &rsa.PublicKey{}},
+	}
+
+	for i, tt := range tests {
+		signer, err := tt.inProvider.CreateKey(ctx, []string{"foo.example.com"})
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from CreateKey: %v", i, err)
+		}
+		if got, want := string(token.labels[len(token.labels)-1]), "roman foo.example.com"; got != want {
+			t.Errorf("Test(%v) Got label: %v, Want: %v", i, got, want)
+		}
+
+		reference := signer.(interface{ KeyReference() string }).KeyReference()
+		loaded, err := tt.inProvider.LoadKey(ctx, reference)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from LoadKey: %v", i, err)
+		}
+		publicKey, ok := loaded.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !publicKey.Equal(signer.Public()) {
+			t.Errorf("Test(%v) Got a different key from LoadKey", i)
+		}
+		if got, want := loaded.(interface{ KeyReference() string }).KeyReference(), reference; got != want {
+			t.Errorf("Test(%v) Got reference: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// references that aren't in the token or invalid
+	for _, reference := range []string{"pkcs11:id=%00%01", "pkcs11:id=", "arn:aws:kms:us-east-1:123456789012:key/0"} {
+		_, err := (&PKCS11{Context: token}).LoadKey(ctx, reference)
+		if err == nil {
+			t.Errorf("Expected an error for reference %q", reference)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	key := &pkcs11Key{id: []byte{0x00, 0xab, '/'}}
+
+	reference := key.KeyReference()
+	if got, want := reference, "pkcs11:id=%00%ab%2f"; got != want {
+		t.Errorf("Got reference: %v, Want: %v", got, want)
+	}
+
+	id, err := parseReference(reference)
+	if err != nil {
+		t.Fatalf("Unexpected response from parseReference: %v", err)
+	}
+	if got, want := id, key.id; !bytes.Equal(got, want) {
+		t.Errorf("Got id: %x, Want: %x", got, want)
+	}
+}
+
+// fakeToken is used in tests as a PKCS #11 token that holds software keys.
+type fakeToken struct {
+	ids    [][]byte
+	labels [][]byte
+	keys   []crypto.Signer
+}
+
+func (f *fakeToken) GenerateECDSAKeyPairWithLabel(id, label []byte, curve elliptic.Curve) (crypto11.Signer, error) {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return f.add(id, label, privateKey), nil
+}
+
+func (f *fakeToken) GenerateRSAKeyPairWithLabel(id, label []byte, bits int) (crypto11.SignerDecrypter, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return f.add(id, label, privateKey), nil
+}
+
+func (f *fakeToken) FindKeyPair(id, label []byte) (crypto11.Signer, error) {
+	for i, v := range f.ids {
+		if bytes.Equal(v, id) {
+			return fakeKeyPair{f.keys[i]}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeToken) add(id, label []byte, privateKey crypto.Signer) fakeKeyPair {
+	f.ids = append(f.ids, id)
+	f.labels = append(f.labels, label)
+	f.keys = append(f.keys, privateKey)
+	return fakeKeyPair{privateKey}
+}
+
+// fakeKeyPair is a key pair of fakeToken.
+type fakeKeyPair struct {
+	crypto.Signer
+}
+
+func (k fakeKeyPair) Delete() error {
+	return nil
+}
+
+func (k fakeKeyPair) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return k.Signer.(crypto.Decrypter).Decrypt(rand, msg, opts)
+}
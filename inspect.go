@@ -0,0 +1,125 @@
+package roman
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// CertificateInfo are the details of the certificate served for a host, for
+// CLIs and admin UIs. It marshals to JSON.
+type CertificateInfo struct {
+	Hostname string
+
+	// Chain is the parsed certificate chain, leaf first.
+	Chain []*x509.Certificate `json:"-"`
+
+	// Names are the subject alternative names of the leaf.
+	Names        []string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+
+	// DaysRemaining is the number of whole days until the certificate
+	// expires, negative once it expired.
+	DaysRemaining int
+
+	// RenewAt is when the certificate is due for renewal.
+	RenewAt time.Time
+
+	// OCSPStatus is the status of the stapled OCSP response ("good",
+	// "revoked", "unknown" or "invalid"), empty if the certificate is served
+	// without a staple. OCSPNextUpdate is when the staple expires.
+	OCSPStatus     string
+	OCSPNextUpdate time.Time
+
+	// Trusted is true if the chain verifies against the system roots for
+	// Hostname, ChainError is why it doesn't otherwise.
+	Trusted    bool
+	ChainError string
+}
+
+// InspectCertificate returns the details of the certificate served for
+// hostname, from the in-memory cache or Cache. Wildcard certificates and
+// certificates with hostname as subject alternative name are found like in a
+// handshake. It doesn't make any requests to the CA or OCSP responder.
+func (m *CertificateManager) InspectCertificate(hostname string) (*CertificateInfo, error) {
+	certificate, err := m.matchCertificate(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	for _, certificateBytes := range certificate.Certificate {
+		c, err := x509.ParseCertificate(certificateBytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate chain for %q: %v", hostname, err)
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates in chain for %q", hostname)
+	}
+	leaf := chain[0]
+
+	now := clock.UtcNow()
+	info := &CertificateInfo{
+		Hostname:      hostname,
+		Chain:         chain,
+		Names:         leaf.DNSNames,
+		Issuer:        leaf.Issuer.String(),
+		SerialNumber:  leaf.SerialNumber.String(),
+		NotBefore:     leaf.NotBefore,
+		NotAfter:      leaf.NotAfter,
+		DaysRemaining: int(leaf.NotAfter.Sub(now) / (24 * time.Hour)),
+		RenewAt:       leaf.NotAfter.Add(-renewalWindow(leaf, m.renewBefore(leaf))),
+	}
+
+	if certificate.OCSPStaple != nil {
+		info.OCSPStatus, info.OCSPNextUpdate = ocspStatus(certificate.OCSPStaple, chain)
+	}
+
+	// the system roots are used if Roots is nil
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	if err != nil {
+		info.ChainError = err.Error()
+	} else {
+		info.Trusted = true
+	}
+
+	return info, nil
+}
+
+// ocspStatus returns the status of staple and when it expires, the status is
+// "invalid" if staple can't be parsed or isn't signed by the issuer.
+func ocspStatus(staple []byte, chain []*x509.Certificate) (string, time.Time) {
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+
+	response, err := ocsp.ParseResponseForCert(staple, chain[0], issuer)
+	if err != nil {
+		return "invalid", time.Time{}
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		return "good", response.NextUpdate
+	case ocsp.Revoked:
+		return "revoked", response.NextUpdate
+	default:
+		return "unknown", response.NextUpdate
+	}
+}
@@ -0,0 +1,79 @@
+package roman
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/mailgun/timetools"
+)
+
+func TestInspectCertificate(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := &timetools.FreezedTime{CurrentTime: time.Now().UTC().Truncate(time.Second)}
+	clock = now
+
+	server := newOCSPResponder(t, ocsp.Good)
+	defer server.Close()
+
+	certificate, err := generateStapleCertificate("foo.example.com", server.URL, true, server.issuer, server.issuerKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from generateStapleCertificate: %v", err)
+	}
+
+	m := CertificateManager{
+		Cache:       newMapCache(),
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	// not stapled yet
+	info, err := m.InspectCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from InspectCertificate: %v", err)
+	}
+	if got, want := len(info.Chain), 2; got != want {
+		t.Errorf("Got chain length: %v, Want: %v", got, want)
+	}
+	if got, want := info.DaysRemaining, int(certificate.Leaf.NotAfter.Sub(now.CurrentTime)/(24*time.Hour)); got != want {
+		t.Errorf("Got days remaining: %v, Want: %v", got, want)
+	}
+	if got, want := info.RenewAt, certificate.Leaf.NotAfter.Add(-30*24*time.Hour); !got.Equal(want) {
+		t.Errorf("Got renew at: %v, Want: %v", got, want)
+	}
+	if got, want := info.OCSPStatus, ""; got != want {
+		t.Errorf("Got ocsp status: %q, Want: %q", got, want)
+	}
+
+	// the test ca is not a system root
+	if got, want := info.Trusted, false; got != want {
+		t.Errorf("Got trusted: %v, Want: %v", got, want)
+	}
+	if info.ChainError == "" {
+		t.Errorf("Got no chain error")
+	}
+
+	m.stapleCertificate([]string{"foo.example.com"}, certificate)
+
+	info, err = m.InspectCertificate("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from InspectCertificate: %v", err)
+	}
+	if got, want := info.OCSPStatus, "good"; got != want {
+		t.Errorf("Got ocsp status: %q, Want: %q", got, want)
+	}
+	if info.OCSPNextUpdate.IsZero() {
+		t.Errorf("Got no ocsp next update")
+	}
+
+	// unknown hosts
+	_, err = m.InspectCertificate("bar.example.com")
+	if got, want := err, autocert.ErrCacheMiss; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
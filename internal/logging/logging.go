@@ -0,0 +1,39 @@
+// Package logging emits the structured log events of issuance steps. The
+// logger travels with the context, like the trace, so the acme and challenge
+// packages log to the logger of the CertificateManager.
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger in ctx, or the default logger if there is
+// none.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(contextKey{}).(*slog.Logger)
+	if !ok || logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// Step logs the outcome of step for host, which started at start: at error
+// level if it failed, at debug level otherwise.
+func Step(ctx context.Context, step string, host string, start time.Time, err error) {
+	logger := FromContext(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "issuance step failed", "host", host, "step", step, "duration", time.Since(start), "error", err)
+		return
+	}
+	logger.DebugContext(ctx, "issuance step done", "host", host, "step", step, "duration", time.Since(start))
+}
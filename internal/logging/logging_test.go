@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		inErr    error
+		outLevel string
+		outError bool
+	}{
+		// 0 - successful steps are debug events
+		{nil, "level=DEBUG", false},
+		// 1 - failed steps are errors
+		{fmt.Errorf("dns provider unavailable"), "level=ERROR", true},
+	}
+
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		ctx := NewContext(context.Background(), logger)
+
+		Step(ctx, "order", "foo.example.com", time.Now(), tt.inErr)
+
+		line := buf.String()
+		for _, want := range []string{tt.outLevel, "host=foo.example.com", "step=order", "duration="} {
+			if !strings.Contains(line, want) {
+				t.Errorf("Test(%v) Got log line: %q, Want: %q in it", i, line, want)
+			}
+		}
+		if got, want := strings.Contains(line, "error="), tt.outError; got != want {
+			t.Errorf("Test(%v) Got error in log line: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got, want := FromContext(context.Background()), slog.Default(); got != want {
+		t.Errorf("Got logger: %v, Want: %v", got, want)
+	}
+}
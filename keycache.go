@@ -0,0 +1,153 @@
+package roman
+
+import (
+	"crypto"
+	"crypto/tls"
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// loadCertificate reads the certificate for hostname from Cache, and its
+// private key from KeyCache if that is set. Records written before records
+// were versioned are migrated, unless this is a ServeOnly replica.
+func (m *CertificateManager) loadCertificate(ctx context.Context, hostname string) (*tls.Certificate, keyInfo, error) {
+	certificate, version, key, err := m.loadRecords(ctx, hostname)
+	if err != nil {
+		return nil, keyInfo{}, err
+	}
+
+	if version < recordVersion && !m.ServeOnly {
+		log.Infof("migrating cache record for %q from version %v to %v", hostname, version, recordVersion)
+
+		err = m.storeCertificate(ctx, hostname, certificate, key)
+		if err != nil {
+			log.Warningf("unable to migrate cache record for %q: %v", hostname, err)
+		}
+	}
+
+	return certificate, key, nil
+}
+
+// loadRecords reads and decodes the records of the certificate for hostname
+// and returns the lowest version among them and the metadata of the key.
+func (m *CertificateManager) loadRecords(ctx context.Context, hostname string) (*tls.Certificate, int, keyInfo, error) {
+	if m.KeyCache == nil {
+		r, err := getRecord(ctx, m.Cache, hostname)
+		if err != nil {
+			return nil, 0, keyInfo{}, err
+		}
+		certificateBytes, err := decryptPrivateKey(r.Body, m.KeyPassphrase)
+		if err != nil {
+			return nil, 0, keyInfo{}, fmt.Errorf("unable to get private key for %q: %v", hostname, err)
+		}
+		privateKey, chainBytes, err := m.decodePrivateKey(ctx, certificateBytes)
+		if err != nil {
+			return nil, 0, keyInfo{}, err
+		}
+		certificate, err := bytesToChain(chainBytes)
+		if err != nil {
+			return nil, 0, keyInfo{}, err
+		}
+		certificate.PrivateKey = privateKey
+		return certificate, r.Version, r.Key, nil
+	}
+
+	chainRecord, err := getRecord(ctx, m.Cache, hostname)
+	if err != nil {
+		return nil, 0, keyInfo{}, err
+	}
+	certificate, err := bytesToChain(chainRecord.Body)
+	if err != nil {
+		return nil, 0, keyInfo{}, err
+	}
+
+	privateKeyRecord, err := getRecord(ctx, m.KeyCache, hostname)
+	if err != nil {
+		return nil, 0, keyInfo{}, fmt.Errorf("unable to get private key for %q: %v", hostname, err)
+	}
+	privateKeyBytes, err := decryptPrivateKey(privateKeyRecord.Body, m.KeyPassphrase)
+	if err != nil {
+		return nil, 0, keyInfo{}, fmt.Errorf("unable to get private key for %q: %v", hostname, err)
+	}
+	privateKey, _, err := m.decodePrivateKey(ctx, privateKeyBytes)
+	if err != nil {
+		return nil, 0, keyInfo{}, err
+	}
+
+	// the two writes of storeCertificate aren't atomic, make sure we don't
+	// serve a chain with the key of another certificate
+	publicKey, ok := privateKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.Leaf.PublicKey) {
+		return nil, 0, keyInfo{}, fmt.Errorf("private key for %q doesn't match its certificate", hostname)
+	}
+	certificate.PrivateKey = privateKey
+
+	version := chainRecord.Version
+	if privateKeyRecord.Version < version {
+		version = privateKeyRecord.Version
+	}
+
+	return certificate, version, privateKeyRecord.Key, nil
+}
+
+// storeCertificate writes the certificate for hostname to Cache, or the
+// private key to KeyCache and the chain to Cache if KeyCache is set. The
+// metadata of the key goes with the key.
+func (m *CertificateManager) storeCertificate(ctx context.Context, hostname string, certificate *tls.Certificate, key keyInfo) error {
+	keyType := keyTypeName(certificate.PrivateKey)
+
+	privateKeyBytes, err := privateKeyToBytes(certificate)
+	if err != nil {
+		return err
+	}
+	privateKeyBytes, err = m.sealPrivateKey(privateKeyBytes)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt private key for %q: %v", hostname, err)
+	}
+	chainBytes, err := chainToBytes(certificate)
+	if err != nil {
+		return err
+	}
+
+	if m.KeyCache == nil {
+		r := record{KeyType: keyType, Names: certificate.Leaf.DNSNames, Key: key, Body: append(privateKeyBytes, chainBytes...)}
+		return m.Cache.Put(ctx, hostname, encodeRecord(r))
+	}
+
+	err = m.KeyCache.Put(ctx, hostname, encodeRecord(record{KeyType: keyType, Key: key, Body: privateKeyBytes}))
+	if err != nil {
+		return fmt.Errorf("unable to put private key for %q: %v", hostname, err)
+	}
+
+	r := record{KeyType: keyType, Names: certificate.Leaf.DNSNames, Body: chainBytes}
+	return m.Cache.Put(ctx, hostname, encodeRecord(r))
+}
+
+// getRecord gets and decodes the record for key from c.
+func getRecord(ctx context.Context, c autocert.Cache, key string) (*record, error) {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRecord(data)
+}
+
+// removeCertificate deletes the certificate for hostname from Cache, and its
+// private key from KeyCache if that is set.
+func (m *CertificateManager) removeCertificate(ctx context.Context, hostname string) error {
+	err := m.Cache.Delete(ctx, hostname)
+	if err != nil {
+		return err
+	}
+
+	if m.KeyCache == nil {
+		return nil
+	}
+
+	return m.KeyCache.Delete(ctx, hostname)
+}
@@ -0,0 +1,72 @@
+package roman
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestKeyCache(t *testing.T) {
+	chains := newMapCache()
+	keys := newMapCache()
+	m := CertificateManager{Cache: chains, KeyCache: keys}
+
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	// the private key only goes to the key cache
+	if bytes.Contains(chains.m["foo.example.com"], []byte("PRIVATE KEY")) {
+		t.Errorf("Got private key in Cache")
+	}
+	if !bytes.Contains(chains.m["foo.example.com"], []byte("CERTIFICATE")) {
+		t.Errorf("Got no certificate in Cache")
+	}
+	if !bytes.Contains(keys.m["foo.example.com"], []byte("PRIVATE KEY")) {
+		t.Errorf("Got no private key in KeyCache")
+	}
+
+	// a fresh manager puts them back together
+	m = CertificateManager{Cache: chains, KeyCache: keys}
+	cached, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	if got, want := cached.Leaf.SerialNumber.String(), certificate.Leaf.SerialNumber.String(); got != want {
+		t.Errorf("Got SerialNumber: %v, Want: %v", got, want)
+	}
+	if cached.PrivateKey == nil {
+		t.Errorf("Got no private key")
+	}
+
+	// a key that doesn't match the chain is not served
+	other, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	otherKey, err := privateKeyToBytes(other)
+	if err != nil {
+		t.Fatalf("Unexpected response from privateKeyToBytes: %v", err)
+	}
+	keys.m["foo.example.com"] = otherKey
+
+	m = CertificateManager{Cache: chains, KeyCache: keys}
+	_, err = m.getCertificateFromCache("foo.example.com")
+	if err == nil {
+		t.Errorf("Expected a mismatched private key to fail")
+	}
+
+	// deletes remove both
+	err = m.deleteCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from deleteCertificateFromCache: %v", err)
+	}
+	if got, want := len(chains.m)+len(keys.m), 0; got != want {
+		t.Errorf("Got %v cached items, Want: %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package roman
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestKeyPassphrase(t *testing.T) {
+	defer func(n int) { scryptN = n }(scryptN)
+	scryptN = 1 << 10
+
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	tests := []struct {
+		inKeyCache bool
+	}{
+		// 0 - key and chain in Cache
+		{false},
+		// 1 - key in KeyCache
+		{true},
+	}
+
+	for i, tt := range tests {
+		chains := newMapCache()
+		keys := chains
+		var keyCache autocert.Cache
+		if tt.inKeyCache {
+			keys = newMapCache()
+			keyCache = keys
+		}
+
+		m := CertificateManager{Cache: chains, KeyCache: keyCache, KeyPassphrase: []byte("secret")}
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		// the key is only written encrypted
+		if !bytes.Contains(keys.m["foo.example.com"], []byte(encryptedKeyBlockType)) {
+			t.Errorf("Test(%v) Got no encrypted private key", i)
+		}
+		if bytes.Contains(keys.m["foo.example.com"], []byte("RSA PRIVATE KEY")) {
+			t.Errorf("Test(%v) Got unencrypted private key", i)
+		}
+
+		// the right passphrase decrypts it
+		m = CertificateManager{Cache: chains, KeyCache: keyCache, KeyPassphrase: []byte("secret")}
+		cached, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if got, want := cached.Leaf.SerialNumber.String(), certificate.Leaf.SerialNumber.String(); got != want {
+			t.Errorf("Test(%v) Got SerialNumber: %v, Want: %v", i, got, want)
+		}
+		if cached.PrivateKey == nil {
+			t.Errorf("Test(%v) Got no private key", i)
+		}
+
+		// a wrong or missing passphrase doesn't
+		for _, passphrase := range [][]byte{[]byte("wrong"), nil} {
+			m = CertificateManager{Cache: chains, KeyCache: keyCache, KeyPassphrase: passphrase}
+			_, err = m.getCertificateFromCache("foo.example.com")
+			if err == nil {
+				t.Errorf("Test(%v) Expected an error with passphrase %q", i, passphrase)
+			}
+		}
+	}
+}
+
+func TestKeyPassphraseUnencrypted(t *testing.T) {
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	// keys written before a passphrase was set can still be read
+	cache := newMapCache()
+	m := CertificateManager{Cache: cache}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	m = CertificateManager{Cache: cache, KeyPassphrase: []byte("secret")}
+	_, err = m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Errorf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+}
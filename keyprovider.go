@@ -0,0 +1,99 @@
+package roman
+
+import (
+	"crypto"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// keyReferenceBlockType is the type of the PEM block that is stored
+	// instead of private keys that can't be exported, it holds their
+	// KeyReference.
+	keyReferenceBlockType = "ROMAN KEY REFERENCE"
+
+	// spkiReferencePrefix starts the references of keys that can't be
+	// exported and don't implement KeyReferencer.
+	spkiReferencePrefix = "spki-sha256:"
+)
+
+// KeyProvider creates the private keys of certificates somewhere they never
+// leave, like AWS KMS or GCP KMS (see the kms package). Caches only hold a
+// reference to keys it creates, which is passed to LoadKey to get them back.
+type KeyProvider interface {
+	// CreateKey creates a new private key for a certificate for hostnames.
+	// The key should implement KeyReferencer.
+	CreateKey(ctx context.Context, hostnames []string) (crypto.Signer, error)
+
+	// LoadKey returns the key with reference, as returned by its
+	// KeyReference. Keys that don't implement KeyReferencer, for example
+	// those of an ACME client that keeps keys in an HSM, are referenced by
+	// "spki-sha256:" and the SPKIHash of their public key.
+	LoadKey(ctx context.Context, reference string) (crypto.Signer, error)
+}
+
+// KeyReferencer is implemented by private keys that can't be exported, for
+// example keys held by a KMS. Their reference is stored in caches instead of
+// the key.
+type KeyReferencer interface {
+	// KeyReference returns a string that identifies the key, like the ARN
+	// of a KMS key.
+	KeyReference() string
+}
+
+// keyReference returns the reference privateKey, which can't be exported, is
+// stored by.
+func keyReference(privateKey crypto.PrivateKey) (string, error) {
+	if referencer, ok := privateKey.(KeyReferencer); ok {
+		return referencer.KeyReference(), nil
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return "", fmt.Errorf("unsupported private key type: %T", privateKey)
+	}
+	pin, err := SPKIHash(signer.Public())
+	if err != nil {
+		return "", fmt.Errorf("unsupported private key type %T: %v", privateKey, err)
+	}
+
+	return spkiReferencePrefix + pin, nil
+}
+
+// createKey creates a key for hostnames with KeyProvider.
+func (m *CertificateManager) createKey(ctx context.Context, hostnames []string) (crypto.Signer, error) {
+	privateKey, err := m.KeyProvider.CreateKey(ctx, hostnames)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key for %v: %v", hostnames, err)
+	}
+
+	return privateKey, nil
+}
+
+// decodePrivateKey decodes the PEM encoded private key at the start of data,
+// loading it from KeyProvider if it's a reference, and returns it with the
+// rest of data.
+func (m *CertificateManager) decodePrivateKey(ctx context.Context, data []byte) (crypto.Signer, []byte, error) {
+	privateKeyBlock, rest := pem.Decode(data)
+	if privateKeyBlock == nil {
+		return nil, nil, fmt.Errorf("unable to decode private key")
+	}
+
+	if privateKeyBlock.Type != keyReferenceBlockType {
+		privateKey, err := parsePrivateKey(privateKeyBlock)
+		return privateKey, rest, err
+	}
+
+	reference := string(privateKeyBlock.Bytes)
+	if m.KeyProvider == nil {
+		return nil, nil, fmt.Errorf("unable to load key %q without a KeyProvider", reference)
+	}
+	privateKey, err := m.KeyProvider.LoadKey(ctx, reference)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load key %q: %v", reference, err)
+	}
+
+	return privateKey, rest, nil
+}
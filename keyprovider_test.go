@@ -0,0 +1,187 @@
+package roman
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/export"
+)
+
+func TestKeyProvider(t *testing.T) {
+	provider := &memoryKeyProvider{keys: make(map[string]crypto.Signer)}
+	cache := newMapCache()
+
+	m := CertificateManager{
+		ACMEClient:  &multiCertificateForDomainer{},
+		Cache:       cache,
+		KnownHosts:  []string{"foo.example.com"},
+		KeyProvider: provider,
+	}
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+
+	// only the reference is cached
+	if got, want := len(provider.keys), 1; got != want {
+		t.Fatalf("Got %v keys created, Want: %v", got, want)
+	}
+	if bytes.Contains(cache.m["foo.example.com"], []byte("PRIVATE KEY")) {
+		t.Errorf("Got private key in Cache")
+	}
+	if !bytes.Contains(cache.m["foo.example.com"], []byte(keyReferenceBlockType)) {
+		t.Errorf("Got no key reference in Cache")
+	}
+
+	// a fresh manager loads the key from the provider
+	m = CertificateManager{Cache: cache, KeyProvider: provider}
+	cached, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	privateKey, ok := cached.PrivateKey.(*referencedKey)
+	if !ok || provider.keys[privateKey.reference] == nil {
+		t.Errorf("Got private key: %v, Want a key of the provider", cached.PrivateKey)
+	}
+
+	// and can't do without it
+	m = CertificateManager{Cache: cache}
+	_, err = m.getCertificateFromCache("foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error without a KeyProvider")
+	}
+}
+
+func TestOpaqueKeys(t *testing.T) {
+	// a key of the client that can't be exported and has no reference
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	certificate, err := generateCertificateForKey("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour), opaqueKey{privateKey})
+	if err != nil {
+		t.Fatalf("Unable to generate certificate: %v", err)
+	}
+	pin, err := SPKIHash(privateKey.Public())
+	if err != nil {
+		t.Fatalf("Unable to hash key: %v", err)
+	}
+
+	cache := newMapCache()
+	m := CertificateManager{
+		ACMEClient: fixedCertificateForDomainer{certificate},
+		Cache:      cache,
+		KnownHosts: []string{"foo.example.com"},
+		Exporters:  []export.Exporter{export.KeyStore{Directory: t.TempDir()}},
+	}
+
+	// exporters that need the key are skipped
+	err = m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+
+	// the key is stored by the hash of its public key
+	r, err := decodeRecord(cache.m["foo.example.com"])
+	if err != nil {
+		t.Fatalf("Unexpected response from decodeRecord: %v", err)
+	}
+	block, _ := pem.Decode(r.Body)
+	if got, want := block.Type+" "+string(block.Bytes), keyReferenceBlockType+" spki-sha256:"+pin; got != want {
+		t.Errorf("Got key block: %v, Want: %v", got, want)
+	}
+	if got, want := r.KeyType, "ecdsa"; got != want {
+		t.Errorf("Got KeyType: %v, Want: %v", got, want)
+	}
+
+	// and served until a restart, after that it's loaded from the provider
+	cached, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil || cached.PrivateKey != certificate.PrivateKey {
+		t.Errorf("Got certificate: %v, %v, Want the issued one", cached, err)
+	}
+
+	provider := &memoryKeyProvider{keys: map[string]crypto.Signer{"spki-sha256:" + pin: privateKey}}
+	m = CertificateManager{Cache: cache, KeyProvider: provider}
+	cached, err = m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	if _, ok := cached.PrivateKey.(*referencedKey); !ok {
+		t.Errorf("Got private key: %T, Want a key of the provider", cached.PrivateKey)
+	}
+}
+
+// memoryKeyProvider is used in tests as a KeyProvider whose keys can't be
+// exported.
+type memoryKeyProvider struct {
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+func (p *memoryKeyProvider) CreateKey(ctx context.Context, hostnames []string) (crypto.Signer, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reference := fmt.Sprintf("key-%v", len(p.keys))
+	p.keys[reference] = privateKey
+	return &referencedKey{privateKey, reference}, nil
+}
+
+func (p *memoryKeyProvider) LoadKey(ctx context.Context, reference string) (crypto.Signer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	privateKey, ok := p.keys[reference]
+	if !ok {
+		return nil, fmt.Errorf("no key %q", reference)
+	}
+	return &referencedKey{privateKey, reference}, nil
+}
+
+// referencedKey is a crypto.Signer that hides the key type of the key it
+// wraps, like the keys of a KMS.
+type referencedKey struct {
+	signer    crypto.Signer
+	reference string
+}
+
+func (k *referencedKey) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+func (k *referencedKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.signer.Sign(rand, digest, opts)
+}
+
+func (k *referencedKey) KeyReference() string {
+	return k.reference
+}
+
+// opaqueKey is a crypto.Signer that can't be exported and has no reference.
+type opaqueKey struct {
+	signer crypto.Signer
+}
+
+func (k opaqueKey) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+func (k opaqueKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.signer.Sign(rand, digest, opts)
+}
@@ -0,0 +1,89 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// KeyRotation forces a new private key on renewal once the current one was
+// used for too many certificates or for too long, even if ReuseKey is set.
+// Rotations are recorded in the cache record of the key (Key-Rotation) for
+// audits. The zero value never rotates keys.
+type KeyRotation struct {
+	// Renewals rotates keys after they were used for this many
+	// certificates.
+	Renewals int
+
+	// MaxAge rotates keys that were first used longer ago than this.
+	MaxAge time.Duration
+}
+
+// keyInfo is the issuance metadata of a private key, stored in the cache
+// record that holds the key.
+type keyInfo struct {
+	Created  time.Time // when the key was first used for a certificate
+	Uses     int       // number of certificates issued for the key, 0 if unknown
+	Rotation string    // why KeyRotation replaced the previous key, if it did
+}
+
+// due returns why key must be rotated, or "" if it can be reused.
+func (r KeyRotation) due(key keyInfo, now time.Time) string {
+	if r.Renewals > 0 && key.Uses >= r.Renewals {
+		return fmt.Sprintf("used for %v certificates", key.Uses)
+	}
+	if r.MaxAge > 0 && key.Uses > 0 && now.Sub(key.Created) >= r.MaxAge {
+		return fmt.Sprintf("first used %v ago", now.Sub(key.Created).Round(time.Hour))
+	}
+
+	return ""
+}
+
+// keyToReuse returns the certificate whose key the renewal of hostname
+// reuses, nil for a new key, and why the key is rotated if it is.
+func (m *CertificateManager) keyToReuse(hostname string, previous *tls.Certificate) (*tls.Certificate, string) {
+	if !m.ReuseKey || previous == nil {
+		return nil, ""
+	}
+
+	rotation := m.KeyRotation.due(m.getKeyInfo(hostname, previous), clock.UtcNow())
+	if rotation != "" {
+		return nil, rotation
+	}
+
+	return previous, ""
+}
+
+// getKeyInfo returns the metadata of the key of previous, the certificate
+// for hostname. Keys written before their metadata was recorded are assumed
+// to have been used once, since previous was issued.
+func (m *CertificateManager) getKeyInfo(hostname string, previous *tls.Certificate) keyInfo {
+	m.RLock()
+	key, ok := m.keyInfos[hostname]
+	m.RUnlock()
+	if ok && key.Uses > 0 {
+		return key
+	}
+
+	return keyInfo{Created: previous.Leaf.NotBefore, Uses: 1}
+}
+
+// nextKeyInfo returns the metadata of the key of a certificate issued for
+// hostname, reusing the key of reused (if any) or rotated for rotation.
+func (m *CertificateManager) nextKeyInfo(hostname string, reused *tls.Certificate, rotation string) keyInfo {
+	if reused == nil {
+		return keyInfo{Created: clock.UtcNow(), Uses: 1, Rotation: rotation}
+	}
+
+	key := m.getKeyInfo(hostname, reused)
+	return keyInfo{Created: key.Created, Uses: key.Uses + 1}
+}
+
+// setKeyInfo records the metadata of the key of the certificate for
+// hostname, the caller must hold the write lock.
+func (m *CertificateManager) setKeyInfo(hostname string, key keyInfo) {
+	if m.keyInfos == nil {
+		m.keyInfos = make(map[string]keyInfo)
+	}
+	m.keyInfos[hostname] = key
+}
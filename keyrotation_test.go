@@ -0,0 +1,116 @@
+package roman
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestKeyRotationDue(t *testing.T) {
+	now := time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	tests := []struct {
+		inRotation KeyRotation
+		inKey      keyInfo
+		outDue     bool
+	}{
+		// 0 - zero value never rotates
+		{KeyRotation{}, keyInfo{Created: now.Add(-365 * 24 * time.Hour), Uses: 10}, false},
+		// 1 - not used often enough yet
+		{KeyRotation{Renewals: 3}, keyInfo{Created: now, Uses: 2}, false},
+		// 2 - used often enough
+		{KeyRotation{Renewals: 3}, keyInfo{Created: now, Uses: 3}, true},
+		// 3 - not old enough yet
+		{KeyRotation{MaxAge: 180 * 24 * time.Hour}, keyInfo{Created: now.Add(-179 * 24 * time.Hour), Uses: 3}, false},
+		// 4 - old enough
+		{KeyRotation{MaxAge: 180 * 24 * time.Hour}, keyInfo{Created: now.Add(-180 * 24 * time.Hour), Uses: 3}, true},
+		// 5 - keys without metadata are never too old
+		{KeyRotation{MaxAge: 180 * 24 * time.Hour}, keyInfo{}, false},
+	}
+
+	for i, tt := range tests {
+		if got, want := tt.inRotation.due(tt.inKey, now) != "", tt.outDue; got != want {
+			t.Errorf("Test(%v) Got due: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	cache := newMapCache()
+	m := CertificateManager{
+		ACMEClient:  &multiCertificateForDomainer{},
+		Cache:       cache,
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 365 * 24 * time.Hour, // renew every time
+		ReuseKey:    true,
+		KeyRotation: KeyRotation{Renewals: 2},
+	}
+
+	tests := []struct {
+		outUses     int
+		outReused   bool
+		outRotation bool
+	}{
+		// 0 - first certificate gets a new key
+		{1, false, false},
+		// 1 - which is reused once
+		{2, true, false},
+		// 2 - and then rotated
+		{1, false, true},
+		// 3 - the new key is reused again
+		{2, true, false},
+	}
+
+	var previous crypto.PublicKey
+	for i, tt := range tests {
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from renewCertificate: %v", i, err)
+		}
+		certificate, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+
+		publicKey := certificate.PrivateKey.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool })
+		if got, want := previous != nil && publicKey.Equal(previous), tt.outReused; got != want {
+			t.Errorf("Test(%v) Got key reused: %v, Want: %v", i, got, want)
+		}
+		previous = publicKey
+
+		// the metadata is recorded in the cache
+		r, err := decodeRecord(cache.m["foo.example.com"])
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from decodeRecord: %v", i, err)
+		}
+		if got, want := r.Key.Uses, tt.outUses; got != want {
+			t.Errorf("Test(%v) Got Key-Uses: %v, Want: %v", i, got, want)
+		}
+		if got, want := r.Key.Rotation != "", tt.outRotation; got != want {
+			t.Errorf("Test(%v) Got Key-Rotation: %q, Want rotation: %v", i, r.Key.Rotation, want)
+		}
+	}
+
+	// a fresh manager picks up the metadata and rotates the key
+	m = CertificateManager{
+		ACMEClient:  &multiCertificateForDomainer{},
+		Cache:       cache,
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 365 * 24 * time.Hour,
+		ReuseKey:    true,
+		KeyRotation: KeyRotation{Renewals: 2},
+	}
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+	r, err := decodeRecord(cache.m["foo.example.com"])
+	if err != nil {
+		t.Fatalf("Unexpected response from decodeRecord: %v", err)
+	}
+	if r.Key.Uses != 1 || r.Key.Rotation == "" {
+		t.Errorf("Got Key-Uses: %v, Key-Rotation: %q, Want a rotated key", r.Key.Uses, r.Key.Rotation)
+	}
+}
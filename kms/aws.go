@@ -0,0 +1,148 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awskms "github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"golang.org/x/net/context"
+)
+
+// AWS is a roman.KeyProvider that creates asymmetric signing keys in AWS KMS.
+// Keys are referenced by their ARN.
+type AWS struct {
+	Client kmsiface.KMSAPI
+
+	// KeySpec is the spec of new keys, like "ECC_NIST_P384" or "RSA_2048".
+	// Defaults to "ECC_NIST_P256".
+	KeySpec string
+
+	// Tags are added to new keys, for example to scope IAM policies to them.
+	Tags map[string]string
+}
+
+// CreateKey creates a new key for hostnames.
+func (a *AWS) CreateKey(ctx context.Context, hostnames []string) (crypto.Signer, error) {
+	keySpec := a.KeySpec
+	if keySpec == "" {
+		keySpec = awskms.KeySpecEccNistP256
+	}
+
+	var tags []*awskms.Tag
+	for k, v := range a.Tags {
+		tags = append(tags, &awskms.Tag{TagKey: aws.String(k), TagValue: aws.String(v)})
+	}
+
+	output, err := a.Client.CreateKeyWithContext(ctx, &awskms.CreateKeyInput{
+		Description: aws.String("roman certificate key for " + strings.Join(hostnames, ", ")),
+		KeySpec:     aws.String(keySpec),
+		KeyUsage:    aws.String(awskms.KeyUsageTypeSignVerify),
+		Tags:        tags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key: %v", err)
+	}
+
+	return a.LoadKey(ctx, aws.StringValue(output.KeyMetadata.Arn))
+}
+
+// LoadKey returns the key with the ARN reference.
+func (a *AWS) LoadKey(ctx context.Context, reference string) (crypto.Signer, error) {
+	output, err := a.Client.GetPublicKeyWithContext(ctx, &awskms.GetPublicKeyInput{
+		KeyId: aws.String(reference),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get public key: %v", err)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(output.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %v", err)
+	}
+
+	return &awsKey{client: a.Client, arn: reference, publicKey: publicKey}, nil
+}
+
+// awsKey is a key in AWS KMS.
+type awsKey struct {
+	client    kmsiface.KMSAPI
+	arn       string
+	publicKey crypto.PublicKey
+}
+
+// Public returns the public key.
+func (k *awsKey) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs digest with the key in KMS.
+func (k *awsKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, err := awsSigningAlgorithm(k.publicKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := k.client.Sign(&awskms.SignInput{
+		KeyId:            aws.String(k.arn),
+		Message:          digest,
+		MessageType:      aws.String(awskms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(algorithm),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with %v: %v", k.arn, err)
+	}
+
+	return output.Signature, nil
+}
+
+// KeyReference returns the ARN of the key.
+func (k *awsKey) KeyReference() string {
+	return k.arn
+}
+
+// awsSigningAlgorithm returns the KMS signing algorithm for a signature with
+// opts by publicKey. KMS uses the hash length as salt length of PSS
+// signatures, like TLS.
+func awsSigningAlgorithm(publicKey crypto.PublicKey, opts crypto.SignerOpts) (string, error) {
+	_, pss := opts.(*rsa.PSSOptions)
+
+	var algorithms map[crypto.Hash]string
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey:
+		algorithms = map[crypto.Hash]string{
+			crypto.SHA256: awskms.SigningAlgorithmSpecEcdsaSha256,
+			crypto.SHA384: awskms.SigningAlgorithmSpecEcdsaSha384,
+			crypto.SHA512: awskms.SigningAlgorithmSpecEcdsaSha512,
+		}
+	case *rsa.PublicKey:
+		if pss {
+			algorithms = map[crypto.Hash]string{
+				crypto.SHA256: awskms.SigningAlgorithmSpecRsassaPssSha256,
+				crypto.SHA384: awskms.SigningAlgorithmSpecRsassaPssSha384,
+				crypto.SHA512: awskms.SigningAlgorithmSpecRsassaPssSha512,
+			}
+		} else {
+			algorithms = map[crypto.Hash]string{
+				crypto.SHA256: awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+				crypto.SHA384: awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+				crypto.SHA512: awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+			}
+		}
+	default:
+		return "", fmt.Errorf("unsupported key type: %T", publicKey)
+	}
+
+	algorithm, ok := algorithms[opts.HashFunc()]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash for %T: %v", publicKey, opts.HashFunc())
+	}
+	return algorithm, nil
+}
@@ -0,0 +1,142 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awskms "github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"golang.org/x/net/context"
+)
+
+func TestAWS(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeAWSKMS{keys: make(map[string]*ecdsa.PrivateKey)}
+	provider := &AWS{Client: client, Tags: map[string]string{"owner": "roman"}}
+
+	signer, err := provider.CreateKey(ctx, []string{"foo.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from CreateKey: %v", err)
+	}
+	if got, want := client.created.Tags[0].String(), (&awskms.Tag{TagKey: aws.String("owner"), TagValue: aws.String("roman")}).String(); got != want {
+		t.Errorf("Got tag: %v, Want: %v", got, want)
+	}
+
+	reference := signer.(interface{ KeyReference() string }).KeyReference()
+	if got, want := reference, "arn:aws:kms:us-east-1:123456789012:key/0"; got != want {
+		t.Errorf("Got reference: %v, Want: %v", got, want)
+	}
+
+	// a loaded key signs with the key in kms
+	loaded, err := provider.LoadKey(ctx, reference)
+	if err != nil {
+		t.Fatalf("Unexpected response from LoadKey: %v", err)
+	}
+	digest := sha256.Sum256([]byte("roman"))
+	signature, err := loaded.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Unexpected response from Sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(loaded.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Errorf("Got invalid signature")
+	}
+	if got, want := client.algorithm, awskms.SigningAlgorithmSpecEcdsaSha256; got != want {
+		t.Errorf("Got signing algorithm: %v, Want: %v", got, want)
+	}
+}
+
+func TestAWSSigningAlgorithm(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	tests := []struct {
+		inPublicKey crypto.PublicKey
+		inOpts      crypto.SignerOpts
+		outAlg      string
+		outErr      bool
+	}{
+		// 0 - ecdsa
+		{ecdsaKey.Public(), crypto.SHA384, awskms.SigningAlgorithmSpecEcdsaSha384, false},
+		// 1 - rsa pkcs1
+		{rsaKey.Public(), crypto.SHA256, awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha256, false},
+		// 2 - rsa pss
+		{rsaKey.Public(), &rsa.PSSOptions{Hash: crypto.SHA512}, awskms.SigningAlgorithmSpecRsassaPssSha512, false},
+		// 3 - unsupported hash
+		{ecdsaKey.Public(), crypto.SHA1, "", true},
+	}
+
+	for i, tt := range tests {
+		alg, err := awsSigningAlgorithm(tt.inPublicKey, tt.inOpts)
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := alg, tt.outAlg; got != want {
+			t.Errorf("Test(%v) Got algorithm: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+// fakeAWSKMS is used in tests as a KMS that holds ECDSA keys.
+type fakeAWSKMS struct {
+	kmsiface.KMSAPI
+
+	keys      map[string]*ecdsa.PrivateKey
+	created   *awskms.CreateKeyInput
+	algorithm string
+}
+
+func (f *fakeAWSKMS) CreateKeyWithContext(ctx aws.Context, input *awskms.CreateKeyInput, opts ...request.Option) (*awskms.CreateKeyOutput, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	arn := fmt.Sprintf("arn:aws:kms:us-east-1:123456789012:key/%v", len(f.keys))
+	f.keys[arn] = privateKey
+	f.created = input
+
+	return &awskms.CreateKeyOutput{KeyMetadata: &awskms.KeyMetadata{Arn: aws.String(arn)}}, nil
+}
+
+func (f *fakeAWSKMS) GetPublicKeyWithContext(ctx aws.Context, input *awskms.GetPublicKeyInput, opts ...request.Option) (*awskms.GetPublicKeyOutput, error) {
+	privateKey, ok := f.keys[aws.StringValue(input.KeyId)]
+	if !ok {
+		return nil, fmt.Errorf("NotFoundException")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &awskms.GetPublicKeyOutput{PublicKey: der}, nil
+}
+
+func (f *fakeAWSKMS) Sign(input *awskms.SignInput) (*awskms.SignOutput, error) {
+	privateKey, ok := f.keys[aws.StringValue(input.KeyId)]
+	if !ok {
+		return nil, fmt.Errorf("NotFoundException")
+	}
+	f.algorithm = aws.StringValue(input.SigningAlgorithm)
+
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, input.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &awskms.SignOutput{Signature: signature}, nil
+}
@@ -0,0 +1,178 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/googleapis/gax-go/v2"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	// gcpPollInterval is how often the state of a new key is checked until
+	// it's generated. It's a var so tests can lower it.
+	gcpPollInterval = time.Second
+
+	invalidKeyIDCharacters = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// GCPClient are the methods of *kms.KeyManagementClient (package
+// cloud.google.com/go/kms/apiv1) that GCP uses.
+type GCPClient interface {
+	CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKeyRequest, opts ...gax.CallOption) (*kmspb.CryptoKey, error)
+	GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest, opts ...gax.CallOption) (*kmspb.CryptoKeyVersion, error)
+	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error)
+	AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+}
+
+// GCP is a roman.KeyProvider that creates asymmetric signing keys in GCP
+// Cloud KMS. Keys are referenced by the resource name of their key version.
+type GCP struct {
+	Client GCPClient
+
+	// KeyRing is the resource name of the key ring new keys are created in,
+	// like "projects/p/locations/global/keyRings/roman".
+	KeyRing string
+
+	// Algorithm of new keys, defaults to EC_SIGN_P256_SHA256. A key only
+	// signs with the hash of its algorithm.
+	Algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+
+	// ProtectionLevel of new keys, defaults to SOFTWARE. Use HSM to keep
+	// keys in Cloud HSM.
+	ProtectionLevel kmspb.ProtectionLevel
+
+	// Labels are added to new keys.
+	Labels map[string]string
+}
+
+// CreateKey creates a new key for hostnames and waits until it's generated.
+func (g *GCP) CreateKey(ctx context.Context, hostnames []string) (crypto.Signer, error) {
+	algorithm := g.Algorithm
+	if algorithm == kmspb.CryptoKeyVersion_CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED {
+		algorithm = kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256
+	}
+	protectionLevel := g.ProtectionLevel
+	if protectionLevel == kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED {
+		protectionLevel = kmspb.ProtectionLevel_SOFTWARE
+	}
+
+	cryptoKey, err := g.Client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      g.KeyRing,
+		CryptoKeyId: gcpKeyID(hostnames[0], time.Now()),
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				Algorithm:       algorithm,
+				ProtectionLevel: protectionLevel,
+			},
+			Labels: g.Labels,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key: %v", err)
+	}
+
+	// the first version of asymmetric keys is generated in the background
+	name := cryptoKey.Name + "/cryptoKeyVersions/1"
+	for {
+		version, err := g.Client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: name})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get key version: %v", err)
+		}
+		if version.State == kmspb.CryptoKeyVersion_ENABLED {
+			break
+		}
+		if version.State != kmspb.CryptoKeyVersion_PENDING_GENERATION {
+			return nil, fmt.Errorf("key version %v is %v", name, version.State)
+		}
+
+		select {
+		case <-time.After(gcpPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return g.LoadKey(ctx, name)
+}
+
+// LoadKey returns the key version with the resource name reference.
+func (g *GCP) LoadKey(ctx context.Context, reference string) (crypto.Signer, error) {
+	response, err := g.Client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: reference})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get public key: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(response.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %v", err)
+	}
+
+	return &gcpKey{client: g.Client, name: reference, publicKey: publicKey}, nil
+}
+
+// gcpKey is a key version in GCP Cloud KMS.
+type gcpKey struct {
+	client    GCPClient
+	name      string
+	publicKey crypto.PublicKey
+}
+
+// Public returns the public key.
+func (k *gcpKey) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs digest with the key version in KMS. The hash of opts must be
+// the one of the algorithm of the key.
+func (k *gcpKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var d kmspb.Digest
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		d.Digest = &kmspb.Digest_Sha256{Sha256: digest}
+	case crypto.SHA384:
+		d.Digest = &kmspb.Digest_Sha384{Sha384: digest}
+	case crypto.SHA512:
+		d.Digest = &kmspb.Digest_Sha512{Sha512: digest}
+	default:
+		return nil, fmt.Errorf("unsupported hash: %v", opts.HashFunc())
+	}
+
+	response, err := k.client.AsymmetricSign(context.Background(), &kmspb.AsymmetricSignRequest{
+		Name:   k.name,
+		Digest: &d,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with %v: %v", k.name, err)
+	}
+
+	return response.Signature, nil
+}
+
+// KeyReference returns the resource name of the key version.
+func (k *gcpKey) KeyReference() string {
+	return k.name
+}
+
+// gcpKeyID returns a unique crypto key ID for hostname, IDs can't be reused
+// since keys are never deleted.
+func gcpKeyID(hostname string, now time.Time) string {
+	id := invalidKeyIDCharacters.ReplaceAllString(strings.Replace(hostname, "*", "wildcard", -1), "-")
+	if len(id) > 40 {
+		id = id[:40]
+	}
+	return fmt.Sprintf("roman-%v-%v", id, now.UTC().Format("20060102150405"))
+}
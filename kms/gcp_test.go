@@ -0,0 +1,117 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/googleapis/gax-go/v2"
+
+	"golang.org/x/net/context"
+)
+
+func TestGCP(t *testing.T) {
+	defer func(d time.Duration) { gcpPollInterval = d }(gcpPollInterval)
+	gcpPollInterval = time.Millisecond
+
+	ctx := context.Background()
+	client := &fakeGCPKMS{keys: make(map[string]*ecdsa.PrivateKey), pending: 2}
+	provider := &GCP{Client: client, KeyRing: "projects/p/locations/global/keyRings/roman"}
+
+	signer, err := provider.CreateKey(ctx, []string{"*.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from CreateKey: %v", err)
+	}
+
+	reference := signer.(interface{ KeyReference() string }).KeyReference()
+	if !strings.HasPrefix(reference, "projects/p/locations/global/keyRings/roman/cryptoKeys/roman-wildcard-example-com-") ||
+		!strings.HasSuffix(reference, "/cryptoKeyVersions/1") {
+		t.Errorf("Got reference: %v", reference)
+	}
+	if got, want := client.pending, 0; got != want {
+		t.Errorf("Got %v polls left, Want: %v", got, want)
+	}
+
+	// a loaded key signs with the key in kms
+	loaded, err := provider.LoadKey(ctx, reference)
+	if err != nil {
+		t.Fatalf("Unexpected response from LoadKey: %v", err)
+	}
+	digest := sha256.Sum256([]byte("roman"))
+	signature, err := loaded.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Unexpected response from Sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(loaded.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Errorf("Got invalid signature")
+	}
+
+	_, err = loaded.Sign(rand.Reader, digest[:], crypto.SHA1)
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported hash")
+	}
+}
+
+// fakeGCPKMS is used in tests as a Cloud KMS that holds ECDSA keys. New
+// keys are pending for the first pending polls.
+type fakeGCPKMS struct {
+	keys    map[string]*ecdsa.PrivateKey
+	pending int
+}
+
+func (f *fakeGCPKMS) CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKeyRequest, opts ...gax.CallOption) (*kmspb.CryptoKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.Parent + "/cryptoKeys/" + req.CryptoKeyId
+	f.keys[name+"/cryptoKeyVersions/1"] = privateKey
+	return &kmspb.CryptoKey{Name: name}, nil
+}
+
+func (f *fakeGCPKMS) GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest, opts ...gax.CallOption) (*kmspb.CryptoKeyVersion, error) {
+	if _, ok := f.keys[req.Name]; !ok {
+		return nil, fmt.Errorf("NotFound")
+	}
+	if f.pending > 0 {
+		f.pending = f.pending - 1
+		return &kmspb.CryptoKeyVersion{Name: req.Name, State: kmspb.CryptoKeyVersion_PENDING_GENERATION}, nil
+	}
+	return &kmspb.CryptoKeyVersion{Name: req.Name, State: kmspb.CryptoKeyVersion_ENABLED}, nil
+}
+
+func (f *fakeGCPKMS) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error) {
+	privateKey, ok := f.keys[req.Name]
+	if !ok {
+		return nil, fmt.Errorf("NotFound")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.PublicKey{Pem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}, nil
+}
+
+func (f *fakeGCPKMS) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error) {
+	privateKey, ok := f.keys[req.Name]
+	if !ok {
+		return nil, fmt.Errorf("NotFound")
+	}
+
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, req.GetDigest().GetSha256())
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.AsymmetricSignResponse{Signature: signature}, nil
+}
@@ -0,0 +1,136 @@
+// Package lego adapts go-acme/lego challenge providers to roman's
+// challenge.Performer interface, which gives roman access to every DNS (and
+// HTTP) provider lego supports.
+package lego
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/challenge"
+)
+
+// Provider has the same method set as lego's challenge.Provider, so any lego
+// provider (for example one returned by dns.NewDNSChallengeProviderByName)
+// satisfies it without roman depending on lego.
+type Provider interface {
+	Present(domain, token, keyAuth string) error
+	CleanUp(domain, token, keyAuth string) error
+}
+
+// ContextProvider is implemented by providers that take a context, which
+// carries the trace of the caller and cancels the request. Performer uses it
+// instead of Provider when it's implemented.
+type ContextProvider interface {
+	PresentContext(ctx context.Context, domain, token, keyAuth string) error
+	CleanUpContext(ctx context.Context, domain, token, keyAuth string) error
+}
+
+// ProviderTimeout has the same method set as lego's
+// challenge.ProviderTimeout. Providers that implement it tell us how long
+// their records take to propagate.
+type ProviderTimeout interface {
+	Timeout() (timeout, interval time.Duration)
+}
+
+// Performer performs challenges using a lego Provider.
+type Performer struct {
+	// Provider is the lego provider used to present and clean up challenges.
+	Provider Provider
+
+	// ChallengeType is the type of challenge Provider solves, either
+	// challenge.DNSChallenge (default) or challenge.HTTPChallenge.
+	ChallengeType string
+
+	// PropagationResolver, if set, is used to make sure dns-01 records are
+	// visible before the acme server is asked to validate them.
+	PropagationResolver challenge.TXTResolver
+
+	// PropagationTimeout is how long to wait for dns-01 records to become
+	// visible, defaults to the timeout of Provider if it implements
+	// ProviderTimeout, otherwise 10 minutes.
+	PropagationTimeout time.Duration
+}
+
+// Perform will perform the challenge against an acmeClient.
+func (p Performer) Perform(acmeClient *acme.Client, authorization *acme.Authorization, hostname string) error {
+	return p.PerformContext(context.Background(), acmeClient, authorization, hostname)
+}
+
+// PerformContext is like Perform, ctx carries the trace of the caller and
+// cancels the challenge. Cleanup still runs when ctx is cancelled, its error
+// is returned if the challenge succeeded.
+func (p Performer) PerformContext(ctx context.Context, acmeClient *acme.Client, authorization *acme.Authorization, hostname string) (err error) {
+	challengeType := p.ChallengeType
+	if challengeType == "" {
+		challengeType = challenge.DNSChallenge
+	}
+
+	// extract the challenge from the authorization
+	c, err := challenge.GetChallenge(authorization, challengeType)
+	if err != nil {
+		return err
+	}
+
+	// lego providers derive the record (or response) from the key authorization
+	keyAuth, err := acmeClient.HTTP01ChallengeResponse(c.Token)
+	if err != nil {
+		return err
+	}
+
+	err = p.present(ctx, hostname, c.Token, keyAuth)
+	if err != nil {
+		return fmt.Errorf("unexpected response from lego provider: %v", err)
+	}
+	// always remove the record so we don't pollute dns, even if the
+	// challenge failed
+	defer func() {
+		cleanupCtx, cancel := challenge.CleanupContext(ctx)
+		defer cancel()
+		cleanUpErr := p.cleanUp(cleanupCtx, hostname, c.Token, keyAuth)
+		if cleanUpErr != nil && err == nil {
+			err = fmt.Errorf("unexpected response from lego provider: %v", cleanUpErr)
+		}
+	}()
+
+	if challengeType == challenge.DNSChallenge && p.PropagationResolver != nil {
+		challengeValue, err := acmeClient.DNS01ChallengeRecord(c.Token)
+		if err != nil {
+			return err
+		}
+		err = challenge.WaitForPropagation(ctx, p.PropagationResolver, hostname, challengeValue, p.propagationTimeout())
+		if err != nil {
+			return err
+		}
+	}
+
+	return challenge.ValidateChallenge(ctx, acmeClient, authorization, c)
+}
+
+func (p Performer) present(ctx context.Context, domain, token, keyAuth string) error {
+	if c, ok := p.Provider.(ContextProvider); ok {
+		return c.PresentContext(ctx, domain, token, keyAuth)
+	}
+	return p.Provider.Present(domain, token, keyAuth)
+}
+
+func (p Performer) cleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	if c, ok := p.Provider.(ContextProvider); ok {
+		return c.CleanUpContext(ctx, domain, token, keyAuth)
+	}
+	return p.Provider.CleanUp(domain, token, keyAuth)
+}
+
+func (p Performer) propagationTimeout() time.Duration {
+	if p.PropagationTimeout != 0 {
+		return p.PropagationTimeout
+	}
+	if t, ok := p.Provider.(ProviderTimeout); ok {
+		timeout, _ := t.Timeout()
+		return timeout
+	}
+	return 0
+}
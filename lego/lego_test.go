@@ -0,0 +1,259 @@
+package lego
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/challenge"
+)
+
+type fakeProvider struct {
+	presented []string
+	cleaned   []string
+	err       error
+	cleanErr  error
+}
+
+func (f *fakeProvider) Present(domain, token, keyAuth string) error {
+	f.presented = append(f.presented, domain+" "+token+" "+keyAuth)
+	return f.err
+}
+
+func (f *fakeProvider) CleanUp(domain, token, keyAuth string) error {
+	f.cleaned = append(f.cleaned, domain+" "+token+" "+keyAuth)
+	return f.cleanErr
+}
+
+type fakeProviderTimeout struct {
+	fakeProvider
+}
+
+func (f *fakeProviderTimeout) Timeout() (time.Duration, time.Duration) {
+	return 3 * time.Minute, 5 * time.Second
+}
+
+func TestPerformerPresent(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+	keyAuth, _ := acmeClient.HTTP01ChallengeResponse("token")
+
+	authorization := &acme.Authorization{
+		Challenges: []*acme.Challenge{{Type: challenge.DNSChallenge, Token: "token"}},
+	}
+
+	// 0 - the provider gets the key authorization, and a failure stops the challenge
+	f := &fakeProvider{err: fmt.Errorf("zone not found")}
+	err = Performer{Provider: f}.Perform(acmeClient, authorization, "foo.example.com")
+	if err == nil {
+		t.Fatalf("Expected an error when Present fails")
+	}
+	if got, want := fmt.Sprint(f.presented), "[foo.example.com token "+keyAuth+"]"; got != want {
+		t.Errorf("Got presented: %v, Want: %v", got, want)
+	}
+	if got, want := len(f.cleaned), 0; got != want {
+		t.Errorf("Got %v cleanups, Want: %v", got, want)
+	}
+
+	// 1 - unsupported challenge type
+	f = &fakeProvider{}
+	err = Performer{Provider: f, ChallengeType: challenge.HTTPChallenge}.Perform(acmeClient, authorization, "foo.example.com")
+	if err == nil {
+		t.Errorf("Expected an error when the challenge type is missing")
+	}
+	if got, want := len(f.presented), 0; got != want {
+		t.Errorf("Got %v presents, Want: %v", got, want)
+	}
+}
+
+func TestPerformerPropagationTimeout(t *testing.T) {
+	tests := []struct {
+		inPerformer Performer
+		outTimeout  time.Duration
+	}{
+		// 0 - default
+		{Performer{Provider: &fakeProvider{}}, 0},
+		// 1 - from the provider
+		{Performer{Provider: &fakeProviderTimeout{}}, 3 * time.Minute},
+		// 2 - explicit timeout wins
+		{Performer{Provider: &fakeProviderTimeout{}, PropagationTimeout: time.Minute}, time.Minute},
+	}
+
+	for i, tt := range tests {
+		if got, want := tt.inPerformer.propagationTimeout(), tt.outTimeout; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestPerformerCancel(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+
+	authorization := &acme.Authorization{
+		Challenges: []*acme.Challenge{{Type: challenge.DNSChallenge, Token: "token"}},
+	}
+
+	// cancel while waiting for a record that never propagates
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	f := &fakeProvider{}
+	p := Performer{Provider: f, PropagationResolver: emptyResolver{}, PropagationTimeout: time.Minute}
+	err = p.PerformContext(ctx, acmeClient, authorization, "foo.example.com")
+	if got, want := err, context.Canceled; got != want {
+		t.Fatalf("Got %v, Want: %v", got, want)
+	}
+	if got, want := len(f.cleaned), 1; got != want {
+		t.Errorf("Got %v cleanups, Want: %v", got, want)
+	}
+}
+
+func TestPerformerContextProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+	acmeClient := &acme.Client{Key: key}
+
+	authorization := &acme.Authorization{
+		Challenges: []*acme.Challenge{{Type: challenge.DNSChallenge, Token: "token"}},
+	}
+
+	// cancel while waiting for a record that never propagates
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	f := &fakeContextProvider{}
+	p := Performer{Provider: f, PropagationResolver: emptyResolver{}, PropagationTimeout: time.Minute}
+	p.PerformContext(ctx, acmeClient, authorization, "foo.example.com")
+
+	// the context methods are used, cleanup gets a context that isn't cancelled
+	if got, want := len(f.presented), 1; got != want {
+		t.Errorf("Got %v presents, Want: %v", got, want)
+	}
+	if got, want := len(f.cleaned), 1; got != want {
+		t.Errorf("Got %v cleanups, Want: %v", got, want)
+	}
+	if f.cleanUpErr != nil {
+		t.Errorf("Got cleanup context error %v, Want: <nil>", f.cleanUpErr)
+	}
+}
+
+func TestPerformerCleanUpError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+
+	ts := newFakeACME()
+	defer ts.Close()
+
+	tests := []struct {
+		inCleanErr error
+		outErr     bool
+	}{
+		// 0 - cleanup succeeds
+		{nil, false},
+		// 1 - a failed cleanup fails the challenge, the record is left behind
+		{fmt.Errorf("zone not found"), true},
+	}
+
+	for i, tt := range tests {
+		acmeClient := &acme.Client{Key: key, KID: acme.KeyID(ts.URL + "/account"), DirectoryURL: ts.URL + "/directory"}
+		authorization := &acme.Authorization{
+			URI:        ts.URL + "/authorization",
+			Identifier: acme.AuthzID{Type: "dns", Value: "foo.example.com"},
+			Challenges: []*acme.Challenge{{Type: challenge.DNSChallenge, Token: "token", URI: ts.URL + "/challenge"}},
+		}
+
+		f := &fakeProvider{cleanErr: tt.inCleanErr}
+		err = Performer{Provider: f}.PerformContext(context.Background(), acmeClient, authorization, "foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := len(f.cleaned), 1; got != want {
+			t.Errorf("Test(%v) Got %v cleanups, Want: %v", i, got, want)
+		}
+	}
+}
+
+// newFakeACME is used in tests as an acme server that validates every
+// challenge. It doesn't verify signatures.
+func newFakeACME() *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/directory":
+			json.NewEncoder(w).Encode(map[string]string{
+				"newNonce":   ts.URL + "/nonce",
+				"newAccount": ts.URL + "/account",
+				"newOrder":   ts.URL + "/order",
+			})
+		case "/nonce":
+		case "/challenge":
+			json.NewEncoder(w).Encode(map[string]string{
+				"type":   challenge.DNSChallenge,
+				"url":    ts.URL + "/challenge",
+				"token":  "token",
+				"status": "valid",
+			})
+		case "/authorization":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"identifier": map[string]string{"type": "dns", "value": "foo.example.com"},
+				"status":     "valid",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return ts
+}
+
+// fakeContextProvider is used in tests to check the context methods are preferred.
+type fakeContextProvider struct {
+	fakeProvider
+	cleanUpErr error
+}
+
+func (f *fakeContextProvider) Present(domain, token, keyAuth string) error {
+	return fmt.Errorf("Present called instead of PresentContext")
+}
+
+func (f *fakeContextProvider) CleanUp(domain, token, keyAuth string) error {
+	return fmt.Errorf("CleanUp called instead of CleanUpContext")
+}
+
+func (f *fakeContextProvider) PresentContext(ctx context.Context, domain, token, keyAuth string) error {
+	return f.fakeProvider.Present(domain, token, keyAuth)
+}
+
+func (f *fakeContextProvider) CleanUpContext(ctx context.Context, domain, token, keyAuth string) error {
+	f.cleanUpErr = ctx.Err()
+	return f.fakeProvider.CleanUp(domain, token, keyAuth)
+}
+
+// emptyResolver is used in tests for records that never propagate.
+type emptyResolver struct{}
+
+func (emptyResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	defaultRenewalLockTTL = 15 * time.Minute
+)
+
+// renewalLockPollInterval is how often a lock held by another instance is
+// tried again.
+var renewalLockPollInterval = 1 * time.Second
+
+// Locker is a lock shared by the CertificateManagers that share a Cache, so
+// only one of them requests a certificate at a time. Implementations can use
+// Redis SETNX, DynamoDB conditional writes or etcd leases, see the lock
+// package.
+type Locker interface {
+	// TryLock acquires the lock for key until it's unlocked or ttl passed,
+	// and returns false if another instance holds it. Acquiring a lock this
+	// instance already holds extends it.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// Unlock releases the lock for key if this instance holds it.
+	Unlock(ctx context.Context, key string) error
+}
+
+// lockRenewal acquires the renewal lock of the certificate for hostnames,
+// waiting while another instance holds it, and returns the function that
+// releases it. It does nothing without a RenewalLock.
+func (m *CertificateManager) lockRenewal(ctx context.Context, hostnames []string) (func(), error) {
+	if m.RenewalLock == nil {
+		return func() {}, nil
+	}
+
+	ttl := m.RenewalLockTTL
+	if ttl <= 0 {
+		ttl = defaultRenewalLockTTL
+	}
+
+	// the lock of an instance that died expires after ttl
+	key := hostnames[0]
+	deadline := clock.UtcNow().Add(ttl)
+	for {
+		ok, err := m.RenewalLock.TryLock(ctx, key, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("unable to lock renewal of %q: %v", key, err)
+		}
+		if ok {
+			break
+		}
+		if clock.UtcNow().After(deadline) {
+			return nil, fmt.Errorf("unable to lock renewal of %q: held by another instance for more than %v", key, ttl)
+		}
+
+		select {
+		case <-time.After(renewalLockPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		err := m.RenewalLock.Unlock(context.Background(), key)
+		if err != nil {
+			log.Warningf("unable to unlock renewal of %q: %v", key, err)
+		}
+	}, nil
+}
+
+// renewedElsewhere returns the certificate for hostnames from Cache, and the
+// metadata of its key, if another instance renewed it while this one waited
+// for the renewal lock.
+func (m *CertificateManager) renewedElsewhere(hostnames []string) (*tls.Certificate, keyInfo, bool) {
+	if m.RenewalLock == nil {
+		return nil, keyInfo{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cacheGetTimeout())
+	defer cancel()
+
+	certificate, key, err := m.loadCertificate(ctx, hostnames[0])
+	if err != nil || certificate.Leaf == nil || needToRenew(certificate.Leaf, m.renewBefore(certificate.Leaf)) {
+		return nil, keyInfo{}, false
+	}
+	for _, hostname := range hostnames {
+		if certificate.Leaf.VerifyHostname(hostname) != nil {
+			return nil, keyInfo{}, false
+		}
+	}
+
+	return certificate, key, true
+}
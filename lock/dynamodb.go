@@ -0,0 +1,125 @@
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"golang.org/x/net/context"
+)
+
+// DynamoDB is a roman.Locker that holds locks as items of a DynamoDB table
+// with conditional writes. The table needs a string partition key called
+// "name", the "expires" attribute holds the unix time a lock expires at and
+// can be used as the TTL attribute of the table.
+type DynamoDB struct {
+	Client dynamodbiface.DynamoDBAPI
+	Table  string
+
+	// Owner identifies this instance, it must be different for every
+	// CertificateManager. Defaults to the hostname and a random suffix.
+	Owner string
+
+	ownerOnce sync.Once
+	owner     string
+}
+
+// TryLock puts the lock item for key unless another owner holds a lock that
+// hasn't expired yet.
+func (d *DynamoDB) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	owner := d.getOwner()
+
+	_, err := d.Client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"name":    {S: aws.String(key)},
+			"owner":   {S: aws.String(owner)},
+			"expires": {N: aws.String(strconv.FormatInt(now.Add(ttl).Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#name) OR #expires < :now OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#name":    aws.String("name"),
+			"#expires": aws.String("expires"),
+			"#owner":   aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":   {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":owner": {S: aws.String(owner)},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to put lock %q: %v", key, err)
+	}
+
+	return true, nil
+}
+
+// Unlock deletes the lock item for key if this instance owns it. A lock that
+// expired and was taken over by another owner is left alone.
+func (d *DynamoDB) Unlock(ctx context.Context, key string) error {
+	_, err := d.Client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"name": {S: aws.String(key)},
+		},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(d.getOwner())},
+		},
+	})
+	if err != nil && !isConditionalCheckFailed(err) {
+		return fmt.Errorf("unable to delete lock %q: %v", key, err)
+	}
+
+	return nil
+}
+
+// getOwner returns Owner or, if it's not set, a generated owner that stays
+// the same for the lifetime of d.
+func (d *DynamoDB) getOwner() string {
+	if d.Owner != "" {
+		return d.Owner
+	}
+
+	d.ownerOnce.Do(func() {
+		d.owner = randomOwner()
+	})
+	return d.owner
+}
+
+// randomOwner returns the hostname with a random suffix, so the owner of a
+// lock can be told apart in the table.
+func randomOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "roman"
+	}
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+// isConditionalCheckFailed returns true if err is the error of a conditional
+// write whose condition didn't hold.
+func isConditionalCheckFailed(err error) bool {
+	e, ok := err.(awserr.Error)
+	return ok && e.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
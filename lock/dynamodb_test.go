@@ -0,0 +1,123 @@
+package lock
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"golang.org/x/net/context"
+)
+
+func TestDynamoDB(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{items: make(map[string]fakeLock)}
+
+	a := &DynamoDB{Client: client, Table: "locks", Owner: "a"}
+	b := &DynamoDB{Client: client, Table: "locks", Owner: "b"}
+
+	tests := []struct {
+		inLocker *DynamoDB
+		inUnlock bool
+		inTTL    time.Duration
+		outOk    bool
+	}{
+		// 0 - free lock
+		{a, false, time.Hour, true},
+		// 1 - held by another owner
+		{b, false, time.Hour, false},
+		// 2 - the owner can extend it
+		{a, false, -time.Hour, true},
+		// 3 - expired locks can be taken over
+		{b, false, time.Hour, true},
+		// 4 - unlocking a lock of another owner does nothing
+		{a, true, 0, false},
+		// 5 - unlocked locks are free
+		{b, true, 0, false},
+		{a, false, time.Hour, true},
+	}
+
+	for i, tt := range tests {
+		if tt.inUnlock {
+			err := tt.inLocker.Unlock(ctx, "foo.example.com")
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from Unlock: %v", i, err)
+			}
+			continue
+		}
+
+		ok, err := tt.inLocker.TryLock(ctx, "foo.example.com", tt.inTTL)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from TryLock: %v", i, err)
+		}
+		if got, want := ok, tt.outOk; got != want {
+			t.Errorf("Test(%v) Got locked: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestDynamoDBOwner(t *testing.T) {
+	d := &DynamoDB{}
+	if d.getOwner() == "" || d.getOwner() != d.getOwner() {
+		t.Errorf("Got unstable owner: %q", d.getOwner())
+	}
+	if got, want := d.getOwner() == (&DynamoDB{}).getOwner(), false; got != want {
+		t.Errorf("Got same owner for different instances: %v, Want: %v", got, want)
+	}
+}
+
+// fakeLock is a lock item in fakeDynamoDB.
+type fakeLock struct {
+	owner   string
+	expires int64
+}
+
+// fakeDynamoDB is used in tests to evaluate the conditions of the lock items
+// like DynamoDB does.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	mu    sync.Mutex
+	items map[string]fakeLock
+}
+
+func (f *fakeDynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Item["name"].S)
+	owner := aws.StringValue(input.ExpressionAttributeValues[":owner"].S)
+	now, _ := strconv.ParseInt(aws.StringValue(input.ExpressionAttributeValues[":now"].N), 10, 64)
+
+	current, ok := f.items[name]
+	if ok && current.expires >= now && current.owner != owner {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	expires, _ := strconv.ParseInt(aws.StringValue(input.Item["expires"].N), 10, 64)
+	f.items[name] = fakeLock{owner: aws.StringValue(input.Item["owner"].S), expires: expires}
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Key["name"].S)
+	owner := aws.StringValue(input.ExpressionAttributeValues[":owner"].S)
+
+	current, ok := f.items[name]
+	if !ok || current.owner != owner {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	delete(f.items, name)
+
+	return &dynamodb.DeleteItemOutput{}, nil
+}
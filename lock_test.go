@@ -0,0 +1,101 @@
+package roman
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRenewalLock(t *testing.T) {
+	defer func(interval time.Duration) { renewalLockPollInterval = interval }(renewalLockPollInterval)
+	renewalLockPollInterval = 10 * time.Millisecond
+
+	// two instances share the cache and the lock
+	mc := newMapCache()
+	locks := &testLocks{held: make(map[string]string)}
+	client := &concurrentCertificateForDomainer{t: 100 * time.Millisecond, counts: make(map[string]int)}
+
+	var managers []*CertificateManager
+	for _, owner := range []string{"a", "b"} {
+		managers = append(managers, &CertificateManager{
+			ACMEClient:  client,
+			Cache:       mc,
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+			RenewalLock: &testLocker{locks: locks, owner: owner},
+		})
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(managers))
+	for i, m := range managers {
+		wg.Add(1)
+		go func(i int, m *CertificateManager) {
+			defer wg.Done()
+			errs[i] = m.renewCertificate(context.Background(), "foo.example.com")
+		}(i, m)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Manager(%v) Unexpected response from renewCertificate: %v", i, err)
+		}
+	}
+	if got, want := client.total(), 1; got != want {
+		t.Errorf("Got %v certificate requests, Want: %v", got, want)
+	}
+
+	// both serve the same certificate
+	var serials []string
+	for i, m := range managers {
+		certificate, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Manager(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		serials = append(serials, string(certificate.Certificate[0]))
+	}
+	if serials[0] != serials[1] {
+		t.Errorf("Got different certificates")
+	}
+
+	if got, want := len(locks.held), 0; got != want {
+		t.Errorf("Got %v locks held, Want: %v", got, want)
+	}
+}
+
+// testLocks are the locks shared by testLockers.
+type testLocks struct {
+	mu   sync.Mutex
+	held map[string]string
+}
+
+// testLocker is used in tests as the Locker of one instance.
+type testLocker struct {
+	locks *testLocks
+	owner string
+}
+
+func (l *testLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+
+	owner, ok := l.locks.held[key]
+	if ok && owner != l.owner {
+		return false, nil
+	}
+	l.locks.held[key] = l.owner
+	return true, nil
+}
+
+func (l *testLocker) Unlock(ctx context.Context, key string) error {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+
+	if l.locks.held[key] == l.owner {
+		delete(l.locks.held, key)
+	}
+	return nil
+}
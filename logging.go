@@ -0,0 +1,14 @@
+package roman
+
+import (
+	"log/slog"
+)
+
+// logger returns the logger for issuance events, Logger or the default
+// logger.
+func (m *CertificateManager) logger() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,50 @@
+package roman
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+)
+
+func TestIssuanceLogging(t *testing.T) {
+	tests := []struct {
+		inClient  acme.CertificateForDomainer
+		outEvents []string
+	}{
+		// 0 - issued certificates are logged at info level
+		{
+			&countingCertificateForDomainer{notBefore: clock.UtcNow(), notAfter: clock.UtcNow().Add(90 * 24 * time.Hour)},
+			[]string{"level=DEBUG msg=\"issuance step done\" host=foo.example.com step=cache", "level=INFO msg=\"certificate issued\" host=foo.example.com step=issue"},
+		},
+		// 1 - failures at error level
+		{
+			&failingCertificateForDomainer{},
+			[]string{"level=DEBUG msg=\"issuance step done\" host=foo.example.com step=cache", "level=ERROR msg=\"issuance step failed\" host=foo.example.com step=issue"},
+		},
+	}
+
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		m := CertificateManager{
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+			ACMEClient:  tt.inClient,
+			Logger:      slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		}
+
+		m.renewCertificate(context.Background(), "foo.example.com")
+
+		for _, event := range tt.outEvents {
+			if !strings.Contains(buf.String(), event) {
+				t.Errorf("Test(%v) Got log: %q, Want: %q in it", i, buf.String(), event)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package roman
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// matchCertificate returns the certificate to serve for a server name: the
+// one cached under that name, else the one cached under the matching wildcard
+// (*.example.com for foo.example.com), else any certificate in the in-memory
+// cache with the name as a subject alternative name.
+func (m *CertificateManager) matchCertificate(serverName string) (*tls.Certificate, error) {
+	certificate, err := m.getCertificateFromCache(serverName)
+	if err != autocert.ErrCacheMiss {
+		return certificate, err
+	}
+
+	hostname := strings.ToLower(strings.TrimSuffix(serverName, "."))
+
+	wildcard := wildcardName(hostname)
+	if wildcard != "" {
+		certificate, err := m.getCertificateFromCache(wildcard)
+		if err != nil && err != autocert.ErrCacheMiss {
+			return nil, err
+		}
+		if err == nil && certificate.Leaf != nil && certificate.Leaf.VerifyHostname(hostname) == nil {
+			return certificate, nil
+		}
+	}
+
+	certificate = m.memoryCertificateFor(hostname)
+	if certificate == nil {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return certificate, nil
+}
+
+// wildcardName returns the wildcard name that matches hostname, or an empty
+// string if there is none. Wildcards only match a single label and never a
+// top level domain.
+func wildcardName(hostname string) string {
+	i := strings.Index(hostname, ".")
+	if i <= 0 || !strings.Contains(hostname[i+1:], ".") {
+		return ""
+	}
+
+	return "*" + hostname[i:]
+}
+
+// memoryCertificateFor returns the certificate in the in-memory cache that
+// expires last among those valid for hostname, or nil if there is none.
+func (m *CertificateManager) memoryCertificateFor(hostname string) *tls.Certificate {
+	m.RLock()
+	defer m.RUnlock()
+
+	var match *tls.Certificate
+	for _, certificate := range m.memoryCache {
+		if certificate.Leaf == nil || certificate.Leaf.VerifyHostname(hostname) != nil {
+			continue
+		}
+		if match == nil || certificate.Leaf.NotAfter.After(match.Leaf.NotAfter) {
+			match = certificate
+		}
+	}
+
+	return match
+}
@@ -0,0 +1,83 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestGetCertificateWildcard(t *testing.T) {
+	tests := []struct {
+		inCached     string
+		inServerName string
+		outError     error
+	}{
+		// 0 - exact match
+		{"foo.example.com", "foo.example.com", nil},
+		// 1 - wildcard match
+		{"*.example.com", "foo.example.com", nil},
+		// 2 - server names are normalized
+		{"*.example.com", "FOO.example.com.", nil},
+		// 3 - wildcards only match a single label
+		{"*.example.com", "bar.foo.example.com", autocert.ErrCacheMiss},
+		// 4 - wildcards don't match the parent
+		{"*.example.com", "example.com", autocert.ErrCacheMiss},
+		// 5 - no match
+		{"foo.example.com", "bar.example.com", autocert.ErrCacheMiss},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			Cache: &cache.Memory{},
+		}
+
+		certificate, err := generateCertificate(tt.inCached, clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+		err = m.putCertificateInCache(tt.inCached, certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		// start with an empty in-memory cache so the wildcard is loaded
+		// from Cache
+		m.memoryCache = nil
+
+		got, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.inServerName})
+		if err != tt.outError {
+			t.Errorf("Test(%v) Got error: %v, Want: %v", i, err, tt.outError)
+		}
+		if err == nil && !got.Leaf.Equal(certificate.Leaf) {
+			t.Errorf("Test(%v) Got certificate for: %v, Want: %v", i, got.Leaf.DNSNames, tt.inCached)
+		}
+	}
+}
+
+func TestGetCertificateSAN(t *testing.T) {
+	m := CertificateManager{
+		Cache: &cache.Memory{},
+	}
+
+	// a certificate cached under another name that covers the host
+	certificate, err := generateCertificate("*.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	err = m.putCertificateInCache("example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	got, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from GetCertificate: %v", err)
+	}
+	if !got.Leaf.Equal(certificate.Leaf) {
+		t.Errorf("Got certificate for: %v, Want: %v", got.Leaf.DNSNames, certificate.Leaf.DNSNames)
+	}
+}
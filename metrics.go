@@ -0,0 +1,167 @@
+package roman
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+)
+
+// IssuanceDurationBuckets are the upper bounds of the IssuanceDuration
+// histogram buckets. Issuance with DNS challenges that wait for propagation
+// takes minutes.
+var IssuanceDurationBuckets = []time.Duration{
+	1 * time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	1 * time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+}
+
+// Metrics is a snapshot of the counters of a CertificateManager, see the
+// metrics package for a Prometheus collector.
+type Metrics struct {
+	// IssuanceAttempts is the number of certificates requested from a CA.
+	IssuanceAttempts uint64
+
+	// IssuanceFailures are the failed requests by reason, the ACME problem
+	// type (like "rateLimited" or "dns"), "timeout" or "other".
+	IssuanceFailures map[string]uint64
+
+	// IssuanceDuration is how long requests took.
+	IssuanceDuration Histogram
+
+	// CacheHits and CacheMisses count the handshakes that did and didn't
+	// find a certificate in the cache.
+	CacheHits   uint64
+	CacheMisses uint64
+
+	// Expiry is when the certificate of each host in the in-memory cache
+	// expires.
+	Expiry map[string]time.Time
+
+	// States is the state of the certificate of each host in the in-memory
+	// cache, StateRenewing for certificates that are still served while
+	// their renewal fails.
+	States map[string]CertificateState
+
+	// ExpiryAlerts is the lowest threshold of ExpiryAlerts the certificate
+	// of each alerting host crossed.
+	ExpiryAlerts map[string]time.Duration
+}
+
+// Histogram is a snapshot of a histogram.
+type Histogram struct {
+	Count uint64
+	Sum   time.Duration
+
+	// Buckets are the cumulative counts by upper bound, the bounds are
+	// IssuanceDurationBuckets.
+	Buckets map[time.Duration]uint64
+}
+
+// Metrics returns a snapshot of the counters of the CertificateManager.
+func (m *CertificateManager) Metrics() Metrics {
+	m.metricsMu.Lock()
+	snapshot := Metrics{
+		IssuanceAttempts: m.metrics.IssuanceAttempts,
+		IssuanceFailures: make(map[string]uint64, len(m.metrics.IssuanceFailures)),
+		IssuanceDuration: Histogram{
+			Count:   m.metrics.IssuanceDuration.Count,
+			Sum:     m.metrics.IssuanceDuration.Sum,
+			Buckets: make(map[time.Duration]uint64, len(IssuanceDurationBuckets)),
+		},
+		CacheHits:    m.metrics.CacheHits,
+		CacheMisses:  m.metrics.CacheMisses,
+		Expiry:       make(map[string]time.Time),
+		States:       make(map[string]CertificateState),
+		ExpiryAlerts: make(map[string]time.Duration),
+	}
+	for reason, count := range m.metrics.IssuanceFailures {
+		snapshot.IssuanceFailures[reason] = count
+	}
+	for _, bound := range IssuanceDurationBuckets {
+		snapshot.IssuanceDuration.Buckets[bound] = m.metrics.IssuanceDuration.Buckets[bound]
+	}
+	m.metricsMu.Unlock()
+
+	m.RLock()
+	for hostname, certificate := range m.memoryCache {
+		if certificate.Leaf != nil {
+			snapshot.Expiry[hostname] = certificate.Leaf.NotAfter
+		}
+		snapshot.States[hostname] = certificateState(certificate.Leaf, m.renewBefore(certificate.Leaf))
+	}
+	m.RUnlock()
+
+	m.alertsMu.Lock()
+	for hostname, alert := range m.expiryAlerts {
+		snapshot.ExpiryAlerts[hostname] = alert.threshold
+	}
+	m.alertsMu.Unlock()
+
+	return snapshot
+}
+
+// observeIssuance records a certificate request that took duration and
+// failed with err, if it isn't nil.
+func (m *CertificateManager) observeIssuance(duration time.Duration, err error) {
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+
+	m.metrics.IssuanceAttempts++
+
+	h := &m.metrics.IssuanceDuration
+	if h.Buckets == nil {
+		h.Buckets = make(map[time.Duration]uint64, len(IssuanceDurationBuckets))
+	}
+	h.Count++
+	h.Sum = h.Sum + duration
+	for _, bound := range IssuanceDurationBuckets {
+		if duration <= bound {
+			h.Buckets[bound]++
+		}
+	}
+
+	if err != nil {
+		if m.metrics.IssuanceFailures == nil {
+			m.metrics.IssuanceFailures = make(map[string]uint64)
+		}
+		m.metrics.IssuanceFailures[failureReason(err)]++
+	}
+}
+
+// observeHandshake records if a handshake found a certificate in the cache.
+func (m *CertificateManager) observeHandshake(hit bool) {
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+
+	if hit {
+		m.metrics.CacheHits++
+	} else {
+		m.metrics.CacheMisses++
+	}
+}
+
+// failureReason returns the reason a certificate request failed with err.
+func failureReason(err error) string {
+	var p *acme.Problem
+	if errors.As(err, &p) {
+		// the first subproblem is more specific than a compound problem
+		if len(p.Subproblems) > 0 && p.Subproblems[0].Type != "" {
+			return p.Subproblems[0].Type
+		}
+		if p.Type != "" {
+			return p.Type
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "other"
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mailgun/roman"
+)
+
+var (
+	issuanceAttemptsDesc = prometheus.NewDesc(
+		"roman_issuance_attempts_total",
+		"Number of certificates requested from a CA.",
+		nil, nil)
+	issuanceFailuresDesc = prometheus.NewDesc(
+		"roman_issuance_failures_total",
+		"Number of failed certificate requests by reason.",
+		[]string{"reason"}, nil)
+	issuanceDurationDesc = prometheus.NewDesc(
+		"roman_issuance_duration_seconds",
+		"How long certificate requests took.",
+		nil, nil)
+	cacheHitsDesc = prometheus.NewDesc(
+		"roman_cache_hits_total",
+		"Number of handshakes that found a certificate in the cache.",
+		nil, nil)
+	cacheMissesDesc = prometheus.NewDesc(
+		"roman_cache_misses_total",
+		"Number of handshakes that didn't find a certificate in the cache.",
+		nil, nil)
+	expiryDesc = prometheus.NewDesc(
+		"roman_certificate_expiry_timestamp_seconds",
+		"When the certificate of a host expires, in seconds since the epoch.",
+		[]string{"hostname"}, nil)
+	stateDesc = prometheus.NewDesc(
+		"roman_certificate_state",
+		"The state of the certificate of a host (valid, renewing or expired), always 1.",
+		[]string{"hostname", "state"}, nil)
+	expiryAlertDesc = prometheus.NewDesc(
+		"roman_certificate_expiry_alert_threshold_seconds",
+		"The lowest expiry alert threshold the certificate of a host crossed.",
+		[]string{"hostname"}, nil)
+)
+
+// Collector is a prometheus.Collector for the metrics of a
+// CertificateManager:
+//
+//	prometheus.MustRegister(metrics.Collector{Manager: m})
+type Collector struct {
+	Manager *roman.CertificateManager
+}
+
+// Describe sends the descriptors of all metrics to ch.
+func (c Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- issuanceAttemptsDesc
+	ch <- issuanceFailuresDesc
+	ch <- issuanceDurationDesc
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- expiryDesc
+	ch <- stateDesc
+	ch <- expiryAlertDesc
+}
+
+// Collect sends a snapshot of the metrics of Manager to ch.
+func (c Collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.Manager.Metrics()
+
+	ch <- prometheus.MustNewConstMetric(issuanceAttemptsDesc, prometheus.CounterValue, float64(m.IssuanceAttempts))
+	for reason, count := range m.IssuanceFailures {
+		ch <- prometheus.MustNewConstMetric(issuanceFailuresDesc, prometheus.CounterValue, float64(count), reason)
+	}
+
+	buckets := make(map[float64]uint64, len(m.IssuanceDuration.Buckets))
+	for bound, count := range m.IssuanceDuration.Buckets {
+		buckets[bound.Seconds()] = count
+	}
+	ch <- prometheus.MustNewConstHistogram(issuanceDurationDesc, m.IssuanceDuration.Count, m.IssuanceDuration.Sum.Seconds(), buckets)
+
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(m.CacheHits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(m.CacheMisses))
+
+	for hostname, notAfter := range m.Expiry {
+		ch <- prometheus.MustNewConstMetric(expiryDesc, prometheus.GaugeValue, float64(notAfter.Unix()), hostname)
+	}
+	for hostname, state := range m.States {
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 1, hostname, string(state))
+	}
+	for hostname, threshold := range m.ExpiryAlerts {
+		ch <- prometheus.MustNewConstMetric(expiryAlertDesc, prometheus.GaugeValue, threshold.Seconds(), hostname)
+	}
+}
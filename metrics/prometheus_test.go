@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mailgun/roman"
+	"github.com/mailgun/roman/cache"
+)
+
+func TestCollector(t *testing.T) {
+	m := &roman.CertificateManager{
+		Cache: &cache.Memory{},
+	}
+	m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+
+	registry := prometheus.NewRegistry()
+	err := registry.Register(Collector{Manager: m})
+	if err != nil {
+		t.Fatalf("Unexpected response from Register: %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Unexpected response from Gather: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetCounter() != nil {
+				values[family.GetName()] = metric.GetCounter().GetValue()
+			}
+			if metric.GetHistogram() != nil {
+				values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	tests := []struct {
+		inName   string
+		outValue float64
+	}{
+		// 0
+		{"roman_issuance_attempts_total", 0},
+		// 1
+		{"roman_issuance_duration_seconds", 0},
+		// 2
+		{"roman_cache_hits_total", 0},
+		// 3
+		{"roman_cache_misses_total", 1},
+	}
+
+	for i, tt := range tests {
+		value, ok := values[tt.inName]
+		if !ok {
+			t.Errorf("Test(%v) Missing metric %v", i, tt.inName)
+			continue
+		}
+		if got, want := value, tt.outValue; got != want {
+			t.Errorf("Test(%v) Got %v: %v, Want: %v", i, tt.inName, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/roman/cache"
+)
+
+func TestMetrics(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient: &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		},
+		ACMEClients: map[string]acme.CertificateForDomainer{
+			"bar.example.com": &failingCertificateForDomainer{},
+		},
+		Cache:       &cache.Memory{},
+		KnownHosts:  []string{"foo.example.com", "bar.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	m.renewCertificates(context.Background())
+	m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	m.GetCertificate(&tls.ClientHelloInfo{ServerName: "baz.example.com"})
+
+	metrics := m.Metrics()
+	if got, want := metrics.IssuanceAttempts, uint64(2); got != want {
+		t.Errorf("Got issuance attempts: %v, Want: %v", got, want)
+	}
+	if got, want := fmt.Sprint(metrics.IssuanceFailures), "map[other:1]"; got != want {
+		t.Errorf("Got issuance failures: %v, Want: %v", got, want)
+	}
+	if got, want := metrics.IssuanceDuration.Count, uint64(2); got != want {
+		t.Errorf("Got issuance duration count: %v, Want: %v", got, want)
+	}
+	if got, want := metrics.IssuanceDuration.Buckets[10*time.Minute], uint64(2); got != want {
+		t.Errorf("Got issuance duration bucket: %v, Want: %v", got, want)
+	}
+	if got, want := metrics.CacheHits, uint64(1); got != want {
+		t.Errorf("Got cache hits: %v, Want: %v", got, want)
+	}
+	if got, want := metrics.CacheMisses, uint64(1); got != want {
+		t.Errorf("Got cache misses: %v, Want: %v", got, want)
+	}
+	if _, ok := metrics.Expiry["foo.example.com"]; !ok || len(metrics.Expiry) != 1 {
+		t.Errorf("Got expiry: %v, Want: foo.example.com", metrics.Expiry)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		inError   error
+		outReason string
+	}{
+		// 0 - acme problem
+		{fmt.Errorf("unable to request certificate: %w", &acme.Problem{Type: acme.ProblemRateLimited}), "rateLimited"},
+		// 1 - the subproblem is more specific
+		{&acme.Problem{Type: acme.ProblemMalformed, Subproblems: []*acme.Problem{{Type: acme.ProblemDNS}}}, "dns"},
+		// 2 - timeout
+		{fmt.Errorf("unable to wait for sync: %w", context.DeadlineExceeded), "timeout"},
+		// 3 - anything else
+		{fmt.Errorf("caa record forbids issuance"), "other"},
+	}
+
+	for i, tt := range tests {
+		if got, want := failureReason(tt.inError), tt.outReason; got != want {
+			t.Errorf("Test(%v) Got reason: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package roman
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	notifyTimeout = 5 * time.Minute
+)
+
+// EventType is the kind of certificate lifecycle event.
+type EventType string
+
+const (
+	EventIssued        EventType = "issued"
+	EventRenewed       EventType = "renewed"
+	EventRenewalFailed EventType = "renewal-failed"
+	EventExpiringSoon  EventType = "expiring-soon"
+	EventCTCheckFailed EventType = "ct-check-failed"
+)
+
+// Event is a certificate lifecycle event sent to Notifiers.
+type Event struct {
+	Type     EventType `json:"type"`
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+
+	// NotAfter is the expiration of the new certificate for EventIssued and
+	// EventRenewed, and of the certificate that is still served for
+	// EventExpiringSoon. It's zero for EventRenewalFailed.
+	NotAfter time.Time `json:"not_after"`
+
+	// Threshold is the threshold of ExpiryAlerts the certificate crossed,
+	// for EventExpiringSoon raised by ExpiryAlerts.
+	Threshold time.Duration `json:"threshold,omitempty"`
+
+	// Error is why the renewal failed, for EventRenewalFailed, or why the
+	// certificate doesn't meet CertificateTransparency, for
+	// EventCTCheckFailed.
+	Error string `json:"error,omitempty"`
+}
+
+// Notifier sends certificate lifecycle events to external systems, see the
+// notify package for implementations.
+type Notifier interface {
+	// Notify sends event, retrying if it makes sense. It's called in the
+	// background and may block until ctx is done.
+	Notify(ctx context.Context, event Event) error
+}
+
+// notify sends event to all Notifiers in the background so slow or
+// unreachable endpoints don't hold up renewals.
+func (m *CertificateManager) notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = clock.UtcNow()
+	}
+
+	for _, n := range m.Notifiers {
+		go func(n Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+
+			err := n.Notify(ctx, event)
+			if err != nil {
+				log.Warningf("unable to send %v event for %q: %v", event.Type, event.Hostname, err)
+			}
+		}(n)
+	}
+}
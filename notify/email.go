@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+// sendMail sends mail, it's replaced in tests.
+var sendMail = smtp.SendMail
+
+// Email is a roman.Notifier that sends events by email through an SMTP
+// server.
+type Email struct {
+	// Addr is the address of the SMTP server, for example
+	// "smtp.example.com:587". STARTTLS is used if the server supports it.
+	Addr string
+
+	// Auth, if set, authenticates with the SMTP server, for example
+	// smtp.PlainAuth.
+	Auth smtp.Auth
+
+	// From is the sender and To are the recipients of the emails.
+	From string
+	To   []string
+
+	// Events, if set, are the types of events that are sent, see
+	// Slack.Events.
+	Events []roman.EventType
+
+	// MaxRetries is how often sending is retried, see Webhook.MaxRetries.
+	MaxRetries int
+}
+
+// Notify sends an email describing event.
+func (e Email) Notify(ctx context.Context, event roman.Event) error {
+	if !wants(e.Events, event) {
+		return nil
+	}
+	if len(e.To) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	// errors can be long, they are in the body
+	subject := message(event)
+	if event.Type == roman.EventRenewalFailed {
+		subject = fmt.Sprintf("Unable to renew certificate for %v", event.Hostname)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [roman] %v\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %v\r\n", event.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%v\r\n", message(event))
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "Event:     %v\r\n", event.Type)
+	fmt.Fprintf(&msg, "Hostname:  %v\r\n", event.Hostname)
+	fmt.Fprintf(&msg, "Time:      %v\r\n", event.Time.Format(time.RFC3339))
+	if !event.NotAfter.IsZero() {
+		fmt.Fprintf(&msg, "Not After: %v\r\n", event.NotAfter.Format(time.RFC3339))
+	}
+	if event.Error != "" {
+		fmt.Fprintf(&msg, "Error:     %v\r\n", event.Error)
+	}
+
+	return retry(ctx, e.MaxRetries, func() error {
+		return sendMail(e.Addr, e.Auth, e.From, e.To, msg.Bytes())
+	})
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+func TestEmail(t *testing.T) {
+	defer func(f func(string, smtp.Auth, string, []string, []byte) error) { sendMail = f }(sendMail)
+	retryInterval = 10 * time.Millisecond
+
+	var sent []string
+	var attempts int
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("421 service not available")
+		}
+		sent = append(sent, string(msg))
+		return nil
+	}
+
+	e := Email{
+		Addr: "smtp.example.com:587",
+		From: "roman@example.com",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	}
+	err := e.Notify(context.Background(), roman.Event{
+		Type:     roman.EventRenewalFailed,
+		Hostname: "foo.example.com",
+		Time:     time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Error:    "caa record forbids issuance",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected response from Notify: %v", err)
+	}
+
+	if got, want := len(sent), 1; got != want {
+		t.Fatalf("Got %v emails, Want: %v", got, want)
+	}
+	for _, want := range []string{
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Subject: [roman] Unable to renew certificate for foo.example.com\r\n",
+		"Error:     caa record forbids issuance\r\n",
+	} {
+		if !strings.Contains(sent[0], want) {
+			t.Errorf("Got email:\n%v\nWant it to contain: %q", sent[0], want)
+		}
+	}
+}
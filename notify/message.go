@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"fmt"
+
+	"github.com/mailgun/roman"
+)
+
+// message returns a one line, human readable description of event.
+func message(event roman.Event) string {
+	switch event.Type {
+	case roman.EventIssued:
+		return fmt.Sprintf("Issued certificate for %v, expires %v", event.Hostname, event.NotAfter.Format("2006-01-02 15:04 MST"))
+	case roman.EventRenewed:
+		return fmt.Sprintf("Renewed certificate for %v, expires %v", event.Hostname, event.NotAfter.Format("2006-01-02 15:04 MST"))
+	case roman.EventRenewalFailed:
+		return fmt.Sprintf("Unable to renew certificate for %v: %v", event.Hostname, event.Error)
+	case roman.EventExpiringSoon:
+		return fmt.Sprintf("Certificate for %v expires %v and hasn't been renewed", event.Hostname, event.NotAfter.Format("2006-01-02 15:04 MST"))
+	case roman.EventCTCheckFailed:
+		return fmt.Sprintf("Certificate for %v doesn't meet certificate transparency requirements: %v", event.Hostname, event.Error)
+	default:
+		return fmt.Sprintf("Certificate event %v for %v", event.Type, event.Hostname)
+	}
+}
+
+// wants returns true if event is one of types, or if types is empty.
+func wants(types []roman.EventType, event roman.Event) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// PagerDuty is a roman.Notifier that sends events to the PagerDuty Events API
+// v2. Failed renewals trigger an alert (error severity) that escalates to
+// critical once the certificate is about to expire, and a new certificate
+// resolves it. Alerts are deduplicated per hostname.
+type PagerDuty struct {
+	// RoutingKey is the integration key of the PagerDuty service.
+	RoutingKey string
+
+	// Source is the source of the alerts, defaults to the hostname of the
+	// certificate.
+	Source string
+
+	// URL is the Events API endpoint, defaults to
+	// https://events.pagerduty.com/v2/enqueue.
+	URL string
+
+	// Client is used for the requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	// MaxRetries is how often a request is retried, see Webhook.MaxRetries.
+	MaxRetries int
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string      `json:"summary"`
+	Source        string      `json:"source"`
+	Severity      string      `json:"severity"`
+	Timestamp     string      `json:"timestamp"`
+	Component     string      `json:"component"`
+	CustomDetails roman.Event `json:"custom_details"`
+}
+
+// Notify triggers or resolves the alert for the hostname of event.
+func (p PagerDuty) Notify(ctx context.Context, event roman.Event) error {
+	e := pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    "roman/" + event.Hostname,
+	}
+
+	switch event.Type {
+	case roman.EventIssued, roman.EventRenewed:
+		e.EventAction = "resolve"
+	default:
+		source := p.Source
+		if source == "" {
+			source = event.Hostname
+		}
+		severity := "error"
+		if event.Type == roman.EventExpiringSoon {
+			severity = "critical"
+		}
+		e.Payload = &pagerDutyPayload{
+			Summary:       message(event),
+			Source:        source,
+			Severity:      severity,
+			Timestamp:     event.Time.Format(time.RFC3339),
+			Component:     "roman",
+			CustomDetails: event,
+		}
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	url := p.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+
+	return retry(ctx, p.MaxRetries, func() error {
+		return postJSON(ctx, p.Client, url, nil, body)
+	})
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+func TestPagerDuty(t *testing.T) {
+	var received pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = pagerDutyEvent{}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		inType      roman.EventType
+		outAction   string
+		outSeverity string
+	}{
+		// 0 - failed renewals page
+		{roman.EventRenewalFailed, "trigger", "error"},
+		// 1 - and escalate when the certificate is about to expire
+		{roman.EventExpiringSoon, "trigger", "critical"},
+		// 2 - a new certificate resolves the alert
+		{roman.EventRenewed, "resolve", ""},
+	}
+
+	for i, tt := range tests {
+		p := PagerDuty{RoutingKey: "key", URL: server.URL}
+		err := p.Notify(context.Background(), roman.Event{
+			Type:     tt.inType,
+			Hostname: "foo.example.com",
+			Time:     time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Notify: %v", i, err)
+		}
+
+		if got, want := received.RoutingKey, "key"; got != want {
+			t.Errorf("Test(%v) Got routing key: %v, Want: %v", i, got, want)
+		}
+		if got, want := received.DedupKey, "roman/foo.example.com"; got != want {
+			t.Errorf("Test(%v) Got dedup key: %v, Want: %v", i, got, want)
+		}
+		if got, want := received.EventAction, tt.outAction; got != want {
+			t.Errorf("Test(%v) Got action: %v, Want: %v", i, got, want)
+		}
+		var severity string
+		if received.Payload != nil {
+			severity = received.Payload.Severity
+		}
+		if got, want := severity, tt.outSeverity; got != want {
+			t.Errorf("Test(%v) Got severity: %v, Want: %v", i, got, want)
+		}
+	}
+}
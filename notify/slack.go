@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+// Slack is a roman.Notifier that posts events to a Slack incoming webhook.
+type Slack struct {
+	// WebhookURL is the URL of the incoming webhook, which determines the
+	// channel messages are posted to.
+	WebhookURL string
+
+	// Events, if set, are the types of events that are posted, for example
+	// only roman.EventRenewalFailed and roman.EventExpiringSoon.
+	Events []roman.EventType
+
+	// Client is used for the requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	// MaxRetries is how often a request is retried, see Webhook.MaxRetries.
+	MaxRetries int
+}
+
+// Notify posts a message describing event.
+func (s Slack) Notify(ctx context.Context, event roman.Event) error {
+	if !wants(s.Events, event) {
+		return nil
+	}
+
+	text := message(event)
+	if event.Type == roman.EventRenewalFailed || event.Type == roman.EventExpiringSoon {
+		text = ":warning: " + text
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, s.MaxRetries, func() error {
+		return postJSON(ctx, s.Client, s.WebhookURL, nil, body)
+	})
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+func TestSlack(t *testing.T) {
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		texts = append(texts, body.Text)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		inEvents []roman.EventType
+		inEvent  roman.Event
+		outText  string
+	}{
+		// 0 - all events
+		{nil, roman.Event{Type: roman.EventRenewed, Hostname: "foo.example.com", NotAfter: time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)},
+			"Renewed certificate for foo.example.com, expires 2006-01-02 15:04 UTC"},
+		// 1 - failures stand out
+		{nil, roman.Event{Type: roman.EventRenewalFailed, Hostname: "foo.example.com", Error: "caa record forbids issuance"},
+			":warning: Unable to renew certificate for foo.example.com: caa record forbids issuance"},
+		// 2 - filtered out
+		{[]roman.EventType{roman.EventRenewalFailed}, roman.Event{Type: roman.EventIssued, Hostname: "foo.example.com"},
+			""},
+	}
+
+	for i, tt := range tests {
+		texts = nil
+
+		s := Slack{WebhookURL: server.URL, Events: tt.inEvents}
+		err := s.Notify(context.Background(), tt.inEvent)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Notify: %v", i, err)
+		}
+
+		var got string
+		if len(texts) > 0 {
+			got = texts[0]
+		}
+		if want := tt.outText; got != want {
+			t.Errorf("Test(%v) Got text: %q, Want: %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+const (
+	defaultMaxRetries = 5
+)
+
+// retryInterval is how long to wait before the first retry, it doubles with
+// every retry.
+var retryInterval = 1 * time.Second
+
+// Webhook is a roman.Notifier that POSTs events as JSON to URLs:
+//
+//	{
+//	  "type": "renewal-failed",
+//	  "hostname": "foo.example.com",
+//	  "time": "2006-01-02T15:04:05Z",
+//	  "not_after": "0001-01-01T00:00:00Z",
+//	  "error": "unable to request certificate ..."
+//	}
+//
+// Requests that fail or get a response other than 2xx are retried with
+// exponential backoff.
+type Webhook struct {
+	// URLs are the endpoints every event is posted to.
+	URLs []string
+
+	// Header is added to every request, for example for authentication.
+	Header http.Header
+
+	// Client is used for the requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	// MaxRetries is how often a request is retried, defaults to 5. A
+	// negative value disables retries.
+	MaxRetries int
+}
+
+// Notify posts event to all URLs and returns the errors of those that failed
+// after all retries.
+func (w Webhook) Notify(ctx context.Context, event roman.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, url := range w.URLs {
+		err = retry(ctx, w.MaxRetries, func() error {
+			return w.post(ctx, url, body)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", url, err))
+		}
+	}
+
+	if errs != nil {
+		return fmt.Errorf("unable to post event: %v", errs)
+	}
+
+	return nil
+}
+
+// post sends body to url once.
+func (w Webhook) post(ctx context.Context, url string, body []byte) error {
+	return postJSON(ctx, w.Client, url, w.Header, body)
+}
+
+// postJSON posts body to url with header and fails on responses other than
+// 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected response: %v: %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	return nil
+}
+
+// retry calls f until it succeeds, maxRetries retries were made or ctx is
+// done.
+func retry(ctx context.Context, maxRetries int, f func() error) error {
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	wait := retryInterval
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= maxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(wait):
+			wait = wait * 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
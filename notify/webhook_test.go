@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman"
+)
+
+func TestWebhook(t *testing.T) {
+	retryInterval = 10 * time.Millisecond
+
+	tests := []struct {
+		inFailures   int
+		inMaxRetries int
+		outRequests  int
+		outErr       bool
+	}{
+		// 0 - delivered right away
+		{0, 0, 1, false},
+		// 1 - delivered after retries
+		{2, 0, 3, false},
+		// 2 - gives up after MaxRetries
+		{5, 2, 3, true},
+		// 3 - retries disabled
+		{1, -1, 1, true},
+	}
+
+	for i, tt := range tests {
+		var mu sync.Mutex
+		var requests int
+		var received roman.Event
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			requests++
+			if requests <= tt.inFailures {
+				http.Error(w, "try again", http.StatusBadGateway)
+				return
+			}
+			if got, want := r.Header.Get("Authorization"), "Bearer secret"; got != want {
+				t.Errorf("Test(%v) Got Authorization: %v, Want: %v", i, got, want)
+			}
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+
+		w := Webhook{
+			URLs:       []string{server.URL},
+			Header:     http.Header{"Authorization": []string{"Bearer secret"}},
+			MaxRetries: tt.inMaxRetries,
+		}
+		event := roman.Event{
+			Type:     roman.EventRenewalFailed,
+			Hostname: "foo.example.com",
+			Time:     time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			Error:    "caa record forbids issuance",
+		}
+
+		err := w.Notify(context.Background(), event)
+		server.Close()
+
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := requests, tt.outRequests; got != want {
+			t.Errorf("Test(%v) Got %v requests, Want: %v", i, got, want)
+		}
+		if err == nil && received != event {
+			t.Errorf("Test(%v) Got event: %+v, Want: %+v", i, received, event)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package roman
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+)
+
+func TestNotifiers(t *testing.T) {
+	tests := []struct {
+		inClient    acme.CertificateForDomainer
+		inExpiresIn time.Duration
+		outEvents   string
+	}{
+		// 0 - first certificate
+		{&countingCertificateForDomainer{notBefore: clock.UtcNow(), notAfter: clock.UtcNow().Add(90 * 24 * time.Hour)}, 0, "[issued foo.example.com]"},
+		// 1 - renewed certificate
+		{&countingCertificateForDomainer{notBefore: clock.UtcNow(), notAfter: clock.UtcNow().Add(90 * 24 * time.Hour)}, 10 * 24 * time.Hour, "[renewed foo.example.com]"},
+		// 2 - renewal failed but there's plenty of time left
+		{&failingCertificateForDomainer{}, 20 * 24 * time.Hour, "[renewal-failed foo.example.com]"},
+		// 3 - renewal failed and the certificate expires soon
+		{&failingCertificateForDomainer{}, 10 * 24 * time.Hour, "[expiring-soon foo.example.com renewal-failed foo.example.com]"},
+	}
+
+	for i, tt := range tests {
+		n := channelNotifier(make(chan Event, 10))
+		m := CertificateManager{
+			ACMEClient:  tt.inClient,
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+			Notifiers:   []Notifier{n},
+		}
+
+		if tt.inExpiresIn != 0 {
+			certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(-80*24*time.Hour), clock.UtcNow().Add(tt.inExpiresIn))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+			}
+			err = m.putCertificateInCache("foo.example.com", certificate)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+			}
+		}
+
+		m.renewCertificates(context.Background())
+
+		// events are sent in the background, in no particular order
+		var events []string
+		timeout := time.After(5 * time.Second)
+	receive:
+		for {
+			select {
+			case event := <-n:
+				if event.Time.IsZero() {
+					t.Errorf("Test(%v) Got event without time", i)
+				}
+				if event.Type == EventRenewalFailed && event.Error == "" {
+					t.Errorf("Test(%v) Got failure without error", i)
+				}
+				events = append(events, fmt.Sprintf("%v %v", event.Type, event.Hostname))
+			case <-time.After(100 * time.Millisecond):
+				break receive
+			case <-timeout:
+				break receive
+			}
+		}
+		sort.Strings(events)
+
+		if got, want := fmt.Sprint(events), tt.outEvents; got != want {
+			t.Errorf("Test(%v) Got events: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+// channelNotifier is used in tests to receive the events sent to Notifiers.
+type channelNotifier chan Event
+
+func (c channelNotifier) Notify(ctx context.Context, event Event) error {
+	c <- event
+	return nil
+}
@@ -0,0 +1,127 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// HostPolicy decides which hosts the CertificateManager may obtain
+// certificates for on demand, when a TLS handshake asks for a host that isn't
+// in KnownHosts. It returns an error if host is not allowed, like
+// autocert.HostPolicy.
+type HostPolicy func(ctx context.Context, host string) error
+
+// HostWhitelist returns a HostPolicy that only allows the given hosts.
+func HostWhitelist(hosts ...string) HostPolicy {
+	whitelist := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		whitelist[strings.ToLower(strings.TrimSuffix(h, "."))] = true
+	}
+
+	return func(_ context.Context, host string) error {
+		if !whitelist[host] {
+			return fmt.Errorf("host %q not configured in HostWhitelist", host)
+		}
+		return nil
+	}
+}
+
+// certificateOnDemand obtains a certificate for a host that isn't cached yet
+// if HostPolicy allows it. Concurrent handshakes for the same host share a
+// single request.
+func (m *CertificateManager) certificateOnDemand(ctx context.Context, serverName string) (*tls.Certificate, error) {
+	hostname, err := onDemandHostname(serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.HostPolicy(ctx, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("host %q not allowed: %v", hostname, err)
+	}
+
+	// don't keep hitting the CA for hosts that keep failing
+	if m.isQuarantined(hostname) {
+		return nil, fmt.Errorf("host %q is quarantined", hostname)
+	}
+
+	// the request is shared by concurrent handshakes, so it isn't cancelled
+	// with the handshake that started it
+	_, err, _ = m.onDemand.Do(hostname, func() (interface{}, error) {
+		err := m.renewCertificate(context.Background(), hostname)
+		m.recordRenewal(hostname, err)
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.getCertificateFromCache(hostname)
+}
+
+// onDemandHostname normalizes a server name from a TLS handshake and makes
+// sure it's safe to use as a cache key and in a certificate request.
+func onDemandHostname(serverName string) (string, error) {
+	hostname := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if hostname == "" {
+		return "", fmt.Errorf("missing server name")
+	}
+
+	for _, c := range hostname {
+		switch {
+		case 'a' <= c && c <= 'z':
+		case '0' <= c && c <= '9':
+		case c == '-' || c == '.':
+		default:
+			return "", fmt.Errorf("invalid server name %q", serverName)
+		}
+	}
+	if strings.HasPrefix(hostname, ".") || strings.Contains(hostname, "..") {
+		return "", fmt.Errorf("invalid server name %q", serverName)
+	}
+
+	return hostname, nil
+}
+
+// allowedOnDemand returns true if HostPolicy allows hostname.
+func (m *CertificateManager) allowedOnDemand(hostname string) bool {
+	return m.HostPolicy != nil && m.HostPolicy(context.Background(), hostname) == nil
+}
+
+// renewalHosts returns KnownHosts, the hosts of HostSource and, if HostPolicy
+// is set, the hosts in the in-memory cache it still allows, so certificates
+// obtained on demand are renewed as well.
+func (m *CertificateManager) renewalHosts() []string {
+	if m.HostPolicy == nil {
+		return m.hosts()
+	}
+
+	hostnames := append([]string(nil), m.hosts()...)
+	seen := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		seen[hostname] = true
+	}
+
+	var cached []string
+	m.RLock()
+	for hostname := range m.memoryCache {
+		if !seen[hostname] {
+			cached = append(cached, hostname)
+		}
+	}
+	m.RUnlock()
+	sort.Strings(cached)
+
+	// call out without holding the lock so the policy can use the manager
+	for _, hostname := range cached {
+		if m.allowedOnDemand(hostname) {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+
+	return hostnames
+}
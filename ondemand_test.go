@@ -0,0 +1,107 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestGetCertificateOnDemand(t *testing.T) {
+	tests := []struct {
+		inServerName string
+		inServeOnly  bool
+		outCount     int
+		outError     bool
+	}{
+		// 0 - known host, nothing to do
+		{"foo.example.com", false, 0, false},
+		// 1 - allowed host is issued on demand
+		{"bar.example.com", false, 1, false},
+		// 2 - server names are normalized
+		{"BAR.example.com.", false, 1, false},
+		// 3 - host not allowed
+		{"baz.example.com", false, 0, true},
+		// 4 - invalid server name
+		{"bar.example.com/..", false, 0, true},
+		// 5 - replicas never issue
+		{"bar.example.com", true, 0, true},
+	}
+
+	for i, tt := range tests {
+		client := &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		}
+		m := CertificateManager{
+			Cache:      &cache.Memory{},
+			ACMEClient: client,
+			KnownHosts: []string{"foo.example.com"},
+			HostPolicy: HostWhitelist("foo.example.com", "bar.example.com"),
+			ServeOnly:  tt.inServeOnly,
+		}
+
+		certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.inServerName})
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if got, want := client.count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got count: %v, Want: %v", i, got, want)
+		}
+
+		// the second handshake is served from the cache
+		_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.inServerName})
+		if got, want := client.count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got count after second handshake: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestRenewalHostsOnDemand(t *testing.T) {
+	policy := HostWhitelist("foo.example.com", "bar.example.com")
+
+	m := CertificateManager{
+		Cache: &cache.Memory{},
+		ACMEClient: &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		},
+		KnownHosts: []string{"foo.example.com"},
+		HostPolicy: func(ctx context.Context, host string) error {
+			return policy(ctx, host)
+		},
+	}
+
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "bar.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from GetCertificate: %v", err)
+	}
+
+	hostnames := m.renewalHosts()
+	if got, want := len(hostnames), 2; got != want {
+		t.Fatalf("Got renewal hosts: %v, Want: %v hosts", hostnames, want)
+	}
+	if got, want := hostnames[1], "bar.example.com"; got != want {
+		t.Errorf("Got renewal host: %v, Want: %v", got, want)
+	}
+
+	// hosts that are no longer allowed are not renewed
+	policy = HostWhitelist("foo.example.com")
+
+	hostnames = m.renewalHosts()
+	if got, want := len(hostnames), 1; got != want {
+		t.Errorf("Got renewal hosts: %v, Want: %v hosts", hostnames, want)
+	}
+}
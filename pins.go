@@ -0,0 +1,52 @@
+package roman
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// SPKIHash returns the pin of publicKey for KeyPins: the base64 encoded
+// SHA-256 hash of its DER encoded SubjectPublicKeyInfo, like the pin-sha256
+// of HPKP. It's what
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+//
+// prints.
+func SPKIHash(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(der)
+	return base64.StdEncoding.EncodeToString(hash[:]), nil
+}
+
+// checkKeyPins returns an error if any of hostnames has KeyPins and the key
+// of certificate isn't one of them.
+func (m *CertificateManager) checkKeyPins(hostnames []string, certificate *tls.Certificate) error {
+	if len(m.KeyPins) == 0 {
+		return nil
+	}
+
+	pin, err := SPKIHash(certificate.Leaf.PublicKey)
+	if err != nil {
+		return fmt.Errorf("unable to hash key of certificate for %v: %v", hostnames, err)
+	}
+
+	for _, hostname := range hostnames {
+		pins, ok := m.KeyPins[hostname]
+		if !ok {
+			continue
+		}
+		if !containsString(pins, pin) {
+			return fmt.Errorf("key of new certificate for %q doesn't match its pins, not serving it: got pin-sha256 %q", hostname, pin)
+		}
+	}
+
+	return nil
+}
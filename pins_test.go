@@ -0,0 +1,75 @@
+package roman
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestKeyPins(t *testing.T) {
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unable to generate certificate: %v", err)
+	}
+	pin, err := SPKIHash(certificate.Leaf.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to hash key: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(certificate.Leaf.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+	hash := sha256.Sum256(der)
+	if got, want := pin, base64.StdEncoding.EncodeToString(hash[:]); got != want {
+		t.Errorf("Got pin: %v, Want: %v", got, want)
+	}
+
+	var tests = []struct {
+		inKeyPins map[string][]string
+		outErr    bool
+	}{
+		// 0 - no pins
+		{
+			nil,
+			false,
+		},
+		// 1 - key matches one of the pins
+		{
+			map[string][]string{"foo.example.com": {"bm90IHRoZSBrZXk=", pin}},
+			false,
+		},
+		// 2 - key doesn't match the pins
+		{
+			map[string][]string{"foo.example.com": {"bm90IHRoZSBrZXk="}},
+			true,
+		},
+		// 3 - pins of other hosts don't apply
+		{
+			map[string][]string{"bar.example.com": {"bm90IHRoZSBrZXk="}},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			ACMEClient: fixedCertificateForDomainer{certificate},
+			Cache:      newMapCache(),
+			KnownHosts: []string{"foo.example.com"},
+			KeyPins:    tt.inKeyPins,
+		}
+
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		_, err = m.getCertificateFromCache("foo.example.com")
+		if got, want := err == nil, !tt.outErr; got != want {
+			t.Errorf("Test(%v) Got cached: %v, Want: %v", i, got, want)
+		}
+	}
+}
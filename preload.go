@@ -0,0 +1,38 @@
+package roman
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+// preloadCertificates loads the certificates of KnownHosts, and of every host
+// in Cache if PreloadCachedHosts is set, into the in-memory cache so the first
+// handshake for a host doesn't read from Cache. Certificates that can't be
+// loaded are left to the renewal loop or the handshake.
+func (m *CertificateManager) preloadCertificates(ctx context.Context) error {
+	hostnames := m.hosts()
+	if m.PreloadCachedHosts {
+		cached, err := m.CachedHosts()
+		if err != nil {
+			return fmt.Errorf("unable to list cached hosts: %v", err)
+		}
+		hostnames = append(append([]string(nil), hostnames...), cached...)
+	}
+
+	for _, hostname := range hostnames {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		_, err := m.getCertificateFromCache(hostname)
+		if err != nil && err != autocert.ErrCacheMiss {
+			log.Warningf("unable to preload certificate for %q: %v", hostname, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package roman
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestPreloadCertificates(t *testing.T) {
+	tests := []struct {
+		inCache              autocert.Cache
+		inPreloadCachedHosts bool
+		outLoaded            string
+		outErr               bool
+	}{
+		// 0 - known hosts are always loaded
+		{&cache.Memory{}, false, "[foo.example.com]", false},
+		// 1 - everything in the cache if enabled
+		{&cache.Memory{}, true, "[bar.example.com foo.example.com]", false},
+		// 2 - which fails if the cache can't be listed
+		{newMapCache(), true, "[]", true},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			Cache:              tt.inCache,
+			KnownHosts:         []string{"foo.example.com", "baz.example.com"},
+			PreloadCachedHosts: tt.inPreloadCachedHosts,
+		}
+
+		for _, hostname := range []string{"foo.example.com", "bar.example.com"} {
+			certificate, err := generateCertificate(hostname, clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+			}
+			err = m.storeCertificate(context.Background(), hostname, certificate, keyInfo{})
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from storeCertificate: %v", i, err)
+			}
+		}
+
+		err := m.preloadCertificates(context.Background())
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v (%v), Want: %v", i, got, err, want)
+		}
+
+		var loaded []string
+		for hostname := range m.memoryCache {
+			loaded = append(loaded, hostname)
+		}
+		sort.Strings(loaded)
+		if got, want := fmt.Sprint(loaded), tt.outLoaded; got != want {
+			t.Errorf("Test(%v) Got loaded: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package roman
+
+import (
+	"sort"
+)
+
+// Quarantined returns the hosts that are quarantined after too many
+// consecutive renewal failures.
+func (m *CertificateManager) Quarantined() []string {
+	m.failuresMu.Lock()
+	defer m.failuresMu.Unlock()
+
+	var hostnames []string
+	for hostname := range m.quarantined {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	return hostnames
+}
+
+// Unquarantine releases a host from quarantine and resets its failure count,
+// it should be called once the operator has fixed the cause of the failures.
+// The host is renewed again the next time the renewal loop runs.
+func (m *CertificateManager) Unquarantine(hostname string) {
+	m.failuresMu.Lock()
+	defer m.failuresMu.Unlock()
+
+	delete(m.quarantined, hostname)
+	delete(m.failures, hostname)
+	delete(m.retries, hostname)
+	delete(m.lastErrors, hostname)
+}
+
+// isQuarantined returns true if hostname is quarantined.
+func (m *CertificateManager) isQuarantined(hostname string) bool {
+	m.failuresMu.Lock()
+	defer m.failuresMu.Unlock()
+
+	return m.quarantined[hostname]
+}
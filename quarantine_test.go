@@ -0,0 +1,69 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestQuarantine(t *testing.T) {
+	var quarantined []string
+
+	fcfd := failingCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:      &fcfd,
+		Cache:           newMapCache(),
+		KnownHosts:      []string{"foo.example.com"},
+		RenewBefore:     30 * 24 * time.Hour, // 30 days
+		QuarantineAfter: 2,
+		OnQuarantine: func(hostname string, err error) {
+			quarantined = append(quarantined, hostname)
+		},
+	}
+
+	// two failures put the host in quarantine
+	for i := 0; i < 2; i++ {
+		errs := m.renewCertificates(context.Background())
+		if got, want := len(errs), 1; got != want {
+			t.Fatalf("Got %v errors, Want: %v", got, want)
+		}
+	}
+	if got, want := fmt.Sprint(m.Quarantined()), "[foo.example.com]"; got != want {
+		t.Errorf("Got quarantined hosts: %v, Want: %v", got, want)
+	}
+	if got, want := fmt.Sprint(quarantined), "[foo.example.com]"; got != want {
+		t.Errorf("Got OnQuarantine called for: %v, Want: %v", got, want)
+	}
+
+	// quarantined hosts are not renewed anymore
+	errs := m.renewCertificates(context.Background())
+	if got, want := len(errs), 0; got != want {
+		t.Errorf("Got %v errors, Want: %v", got, want)
+	}
+	if got, want := fcfd.count, 2; got != want {
+		t.Errorf("Got called CertificateForDomain %v times, Want: %v", got, want)
+	}
+
+	// once released, the host is renewed again
+	m.Unquarantine("foo.example.com")
+	if got, want := len(m.Quarantined()), 0; got != want {
+		t.Errorf("Got %v quarantined hosts, Want: %v", got, want)
+	}
+	m.renewCertificates(context.Background())
+	if got, want := fcfd.count, 3; got != want {
+		t.Errorf("Got called CertificateForDomain %v times, Want: %v", got, want)
+	}
+}
+
+// failingCertificateForDomainer is used in tests to simulate issuance failures.
+type failingCertificateForDomainer struct {
+	count int
+}
+
+func (f *failingCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	f.count = f.count + 1
+	return nil, fmt.Errorf("caa record forbids issuance")
+}
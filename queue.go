@@ -0,0 +1,135 @@
+package roman
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mailgun/log"
+)
+
+// renewalQueueItem is a hostname waiting to be renewed.
+type renewalQueueItem struct {
+	hostname string
+	notAfter time.Time // zero if there is no cached certificate
+	failures int       // consecutive renewal failures
+}
+
+// renewalQueue returns KnownHosts (and hosts obtained on demand) ordered so
+// the most at risk certificates are renewed first.
+func (m *CertificateManager) renewalQueue() []string {
+	return m.orderByRisk(m.renewalHosts())
+}
+
+// orderByRisk orders hostnames so the most at risk certificates come first:
+// hosts without a certificate, then by soonest expiration, then by the number
+// of consecutive failures. When the manager is behind (for example after
+// downtime) this makes sure certificates about to expire are not stuck behind
+// hosts that still have plenty of time left.
+func (m *CertificateManager) orderByRisk(hostnames []string) []string {
+	items := make([]renewalQueueItem, 0, len(hostnames))
+
+	for _, hostname := range hostnames {
+		item := renewalQueueItem{
+			hostname: hostname,
+			failures: m.failureCount(hostname),
+		}
+
+		certificate, err := m.getCertificateFromCache(hostname)
+		if err == nil && certificate.Leaf != nil {
+			item.notAfter = certificate.Leaf.NotAfter
+		}
+
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.notAfter.Equal(b.notAfter) {
+			return a.notAfter.Before(b.notAfter)
+		}
+		return a.failures > b.failures
+	})
+
+	queue := make([]string, 0, len(items))
+	for _, v := range items {
+		queue = append(queue, v.hostname)
+	}
+
+	return queue
+}
+
+// recordRenewal keeps track of consecutive renewal failures for hostname,
+// schedules a retry with exponential backoff and quarantines it once
+// QuarantineAfter consecutive failures are reached.
+func (m *CertificateManager) recordRenewal(hostname string, err error) {
+	m.failuresMu.Lock()
+
+	if m.failures == nil {
+		m.failures = make(map[string]int)
+	}
+
+	if err == nil {
+		delete(m.failures, hostname)
+		delete(m.retries, hostname)
+		delete(m.lastErrors, hostname)
+		m.failuresMu.Unlock()
+		return
+	}
+
+	// the certificate is still served, alert once the lock is released if
+	// it's about to expire
+	defer m.notifyExpireSoon(hostname)
+
+	// hosts held back by our own rate limit didn't fail, retry them once a
+	// certificate is available
+	if e, ok := err.(*rateLimitError); ok {
+		wait := e.wait
+		if wait < minRetryBackoff {
+			wait = minRetryBackoff
+		}
+		m.scheduleRetry(hostname, wait)
+		m.failuresMu.Unlock()
+		return
+	}
+	m.failures[hostname] = m.failures[hostname] + 1
+	if m.lastErrors == nil {
+		m.lastErrors = make(map[string]HostError)
+	}
+	m.lastErrors[hostname] = HostError{
+		Error:    err.Error(),
+		Time:     clock.UtcNow(),
+		Failures: m.failures[hostname],
+	}
+	m.scheduleRetry(hostname, retryBackoff(m.failures[hostname]))
+
+	quarantine := m.QuarantineAfter > 0 && m.failures[hostname] >= m.QuarantineAfter && !m.quarantined[hostname]
+	if quarantine {
+		if m.quarantined == nil {
+			m.quarantined = make(map[string]bool)
+		}
+		m.quarantined[hostname] = true
+		delete(m.retries, hostname)
+	}
+
+	m.failuresMu.Unlock()
+
+	// call out without holding the lock so the callback can use the manager
+	if m.OnRenewFailure != nil {
+		m.OnRenewFailure(hostname, err)
+	}
+	m.notify(Event{Type: EventRenewalFailed, Hostname: hostname, Error: err.Error()})
+	if quarantine {
+		log.Errorf("quarantined %q after %v consecutive renewal failures: %v", hostname, m.QuarantineAfter, err)
+		if m.OnQuarantine != nil {
+			m.OnQuarantine(hostname, err)
+		}
+	}
+}
+
+// failureCount returns the number of consecutive renewal failures for hostname.
+func (m *CertificateManager) failureCount(hostname string) int {
+	m.failuresMu.Lock()
+	defer m.failuresMu.Unlock()
+
+	return m.failures[hostname]
+}
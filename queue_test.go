@@ -0,0 +1,66 @@
+package roman
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRenewalQueue(t *testing.T) {
+	now := clock.UtcNow()
+
+	mm := make(map[string]int)
+	cc := countingCache{&mm}
+	m := CertificateManager{
+		ACMEClient:  &countingCertificateForDomainer{},
+		Cache:       &cc,
+		KnownHosts:  []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	// a expires last, b has no certificate, c and d expire at the same time
+	// but d has been failing
+	expirations := map[string]time.Time{
+		"a.example.com": now.Add(60 * 24 * time.Hour),
+		"c.example.com": now.Add(10 * 24 * time.Hour),
+		"d.example.com": now.Add(10 * 24 * time.Hour),
+	}
+	for hostname, notAfter := range expirations {
+		certificate, err := generateCertificate(hostname, now, notAfter)
+		if err != nil {
+			t.Fatalf("Unexpected response from generateCertificate: %v", err)
+		}
+		err = m.putCertificateInCache(hostname, certificate)
+		if err != nil {
+			t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+		}
+	}
+	m.recordRenewal("d.example.com", fmt.Errorf("failed"))
+	m.recordRenewal("d.example.com", fmt.Errorf("failed"))
+
+	queue := m.renewalQueue()
+	if got, want := fmt.Sprint(queue), "[b.example.com d.example.com c.example.com a.example.com]"; got != want {
+		t.Errorf("Got renewal queue: %v, Want: %v", got, want)
+	}
+
+	// retries are ordered the same way
+	m.recordRenewal("c.example.com", fmt.Errorf("failed"))
+	m.recordRenewal("a.example.com", fmt.Errorf("failed"))
+	m.recordRenewal("b.example.com", fmt.Errorf("failed"))
+	m.failuresMu.Lock()
+	for hostname := range m.retries {
+		m.retries[hostname] = now
+	}
+	m.failuresMu.Unlock()
+
+	queue = m.dueRetries()
+	if got, want := fmt.Sprint(queue), "[b.example.com d.example.com c.example.com a.example.com]"; got != want {
+		t.Errorf("Got retry queue: %v, Want: %v", got, want)
+	}
+
+	// a successful renewal resets the failure count
+	m.recordRenewal("d.example.com", nil)
+	if got, want := m.failureCount("d.example.com"), 0; got != want {
+		t.Errorf("Got %v failures, Want: %v", got, want)
+	}
+}
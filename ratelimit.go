@@ -0,0 +1,155 @@
+package roman
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RateLimit is a token bucket limit on how many certificates are requested
+// from a CA per registered domain (example.com for www.example.com).
+// Certificates can be requested in bursts of up to Certificates, after which
+// one more becomes available every Period/Certificates.
+type RateLimit struct {
+	Certificates int
+	Period       time.Duration
+}
+
+// LetsEncryptRateLimit is the Let's Encrypt certificates per registered
+// domain limit.
+var LetsEncryptRateLimit = RateLimit{Certificates: 50, Period: 7 * 24 * time.Hour}
+
+// rateLimitError is returned when a certificate is not requested because
+// the rate limit of a registered domain is exhausted.
+type rateLimitError struct {
+	domain string
+	wait   time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limit for %v exhausted, next certificate available in %v", e.domain, e.wait)
+}
+
+// tokenBucket holds the certificates that can still be requested for a
+// registered domain.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens that became available since the bucket was last
+// used and returns how long until a token is available.
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) time.Duration {
+	rate := float64(limit.Certificates) / float64(limit.Period)
+
+	b.tokens = b.tokens + float64(now.Sub(b.last))*rate
+	if b.tokens > float64(limit.Certificates) {
+		b.tokens = float64(limit.Certificates)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate)
+}
+
+// rateLimitForHost returns the rate limit of the client used for hostname.
+func (m *CertificateManager) rateLimitForHost(hostname string) RateLimit {
+	if limit, ok := m.RateLimits[m.clientKey(hostname)]; ok {
+		return limit
+	}
+	return m.RateLimit
+}
+
+// takeRateLimit takes a token from the bucket of every registered domain in
+// hostnames, or none of them if any bucket is empty.
+func (m *CertificateManager) takeRateLimit(hostnames []string) error {
+	limit := m.rateLimitForHost(hostnames[0])
+	if limit.Certificates <= 0 || limit.Period <= 0 {
+		return nil
+	}
+
+	m.bucketsMu.Lock()
+	defer m.bucketsMu.Unlock()
+
+	if m.buckets == nil {
+		m.buckets = make(map[string]*tokenBucket)
+	}
+
+	now := clock.UtcNow()
+
+	// buckets are per client so limits of different CAs don't add up
+	var buckets []*tokenBucket
+	for _, domain := range registeredDomains(hostnames) {
+		key := m.clientKey(hostnames[0]) + "/" + domain
+
+		bucket, ok := m.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(limit.Certificates), last: now}
+			m.buckets[key] = bucket
+		}
+
+		wait := bucket.refill(limit, now)
+		if wait > 0 {
+			return &rateLimitError{domain: domain, wait: wait}
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens = bucket.tokens - 1
+	}
+
+	return nil
+}
+
+// refundRateLimit gives back the tokens taken by takeRateLimit for hostnames
+// when no certificate was issued, so failed orders don't use up the limit.
+func (m *CertificateManager) refundRateLimit(hostnames []string) {
+	limit := m.rateLimitForHost(hostnames[0])
+	if limit.Certificates <= 0 || limit.Period <= 0 {
+		return
+	}
+
+	m.bucketsMu.Lock()
+	defer m.bucketsMu.Unlock()
+
+	for _, domain := range registeredDomains(hostnames) {
+		bucket, ok := m.buckets[m.clientKey(hostnames[0])+"/"+domain]
+		if !ok {
+			continue
+		}
+
+		bucket.tokens = bucket.tokens + 1
+		if bucket.tokens > float64(limit.Certificates) {
+			bucket.tokens = float64(limit.Certificates)
+		}
+	}
+}
+
+// registeredDomains returns the distinct registered domains of hostnames.
+func registeredDomains(hostnames []string) []string {
+	var domains []string
+	seen := make(map[string]bool)
+
+	for _, hostname := range hostnames {
+		hostname = strings.TrimPrefix(hostname, "*.")
+
+		// hosts without a public suffix (internal names, ip addresses) are
+		// limited on their own
+		domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+		if err != nil {
+			domain = hostname
+		}
+
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
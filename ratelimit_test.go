@@ -0,0 +1,137 @@
+package roman
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/timetools"
+)
+
+func TestRateLimit(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := &timetools.FreezedTime{CurrentTime: time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)}
+	clock = now
+
+	client := &countingCertificateForDomainer{
+		notBefore: now.UtcNow(),
+		notAfter:  now.UtcNow().Add(90 * 24 * time.Hour),
+	}
+	m := CertificateManager{
+		ACMEClient:      client,
+		Cache:           newMapCache(),
+		KnownHosts:      []string{"a.example.com", "b.example.com", "c.example.com", "d.example.org"},
+		RenewBefore:     30 * 24 * time.Hour, // 30 days
+		RateLimit:       RateLimit{Certificates: 2, Period: 24 * time.Hour},
+		QuarantineAfter: 1,
+	}
+
+	// the third example.com certificate is held back
+	errs := m.renewCertificates(context.Background())
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("Got %v errors, Want: %v: %v", got, want, errs)
+	}
+	if !strings.Contains(errs[0].Error(), "rate limit for example.com exhausted") {
+		t.Errorf("Unexpected response from renewCertificates: %v", errs[0])
+	}
+	if got, want := client.count, 3; got != want {
+		t.Errorf("Got %v certificates issued, Want: %v", got, want)
+	}
+
+	// being rate limited is not a failure
+	if got, want := len(m.Quarantined()), 0; got != want {
+		t.Errorf("Got %v quarantined hosts, Want: %v", got, want)
+	}
+
+	// a token is available again after half the period
+	now.CurrentTime = now.CurrentTime.Add(12 * time.Hour)
+	errs = m.renewCertificates(context.Background())
+	if errs != nil {
+		t.Fatalf("Unexpected response from renewCertificates: %v", errs)
+	}
+	if got, want := client.count, 4; got != want {
+		t.Errorf("Got %v certificates issued, Want: %v", got, want)
+	}
+}
+
+func TestRateLimitRefund(t *testing.T) {
+	client := &failingCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient: client,
+		Cache:      newMapCache(),
+		RateLimit:  RateLimit{Certificates: 1, Period: 24 * time.Hour},
+	}
+
+	// failed orders give their token back and don't hold back retries
+	for i := 0; i < 3; i++ {
+		err := m.renewCertificate(context.Background(), "foo.example.com")
+		if err == nil {
+			t.Fatalf("Test(%v) Expected an error when issuance fails", i)
+		}
+		if strings.Contains(err.Error(), "rate limit") {
+			t.Errorf("Test(%v) Got error: %v, Want: issuance error", i, err)
+		}
+	}
+	if got, want := client.count, 3; got != want {
+		t.Errorf("Got %v certificates requested, Want: %v", got, want)
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient: &countingCertificateForDomainer{},
+		ACMEClients: map[string]acme.CertificateForDomainer{
+			"*.corp.example.com": &countingCertificateForDomainer{},
+		},
+		RateLimit: RateLimit{Certificates: 1, Period: 24 * time.Hour},
+		RateLimits: map[string]RateLimit{
+			"*.corp.example.com": {Certificates: 2, Period: 24 * time.Hour},
+		},
+	}
+
+	tests := []struct {
+		inHostname string
+		outErr     bool
+	}{
+		// 0 - first certificate of the public ca
+		{"www.example.com", false},
+		// 1 - public ca limit exhausted
+		{"api.example.com", true},
+		// 2 - internal ca has its own bucket and limit
+		{"git.corp.example.com", false},
+		// 3 - second certificate of the internal ca
+		{"wiki.corp.example.com", false},
+		// 4 - internal ca limit exhausted
+		{"ci.corp.example.com", true},
+	}
+
+	for i, tt := range tests {
+		err := m.takeRateLimit([]string{tt.inHostname})
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+	}
+}
+
+func TestRegisteredDomains(t *testing.T) {
+	tests := []struct {
+		inHostnames []string
+		outDomains  string
+	}{
+		// 0 - subdomains share a registered domain
+		{[]string{"www.example.com", "api.example.com"}, "example.com"},
+		// 1 - public suffixes with multiple labels
+		{[]string{"www.example.co.uk", "example.com"}, "example.co.uk,example.com"},
+		// 2 - wildcards
+		{[]string{"*.example.com"}, "example.com"},
+	}
+
+	for i, tt := range tests {
+		if got, want := strings.Join(registeredDomains(tt.inHostnames), ","), tt.outDomains; got != want {
+			t.Errorf("Test(%v) Got: %v, Want: %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package roman
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	body := []byte("-----BEGIN CERTIFICATE-----\nZGVm\n-----END CERTIFICATE-----\n")
+
+	tests := []struct {
+		inData     []byte
+		outVersion int
+		outKeyType string
+		outNames   string
+		outError   bool
+	}{
+		// 0 - current version
+		{encodeRecord(record{KeyType: "rsa", Names: []string{"example.com", "www.example.com"}, Body: body}), 1, "rsa", "[example.com www.example.com]", false},
+		// 1 - record without metadata
+		{encodeRecord(record{Body: body}), 1, "", "[]", false},
+		// 2 - raw pem written before records were versioned
+		{body, 0, "", "[]", false},
+		// 3 - record of a newer version
+		{append([]byte("-----BEGIN ROMAN RECORD-----\nVersion: 2\n\n-----END ROMAN RECORD-----\n"), body...), 0, "", "[]", true},
+		// 4 - the record block doesn't have to come first
+		{append(append([]byte{}, body...), "-----BEGIN ROMAN RECORD-----\nVersion: 1\nKey-Type: ecdsa\n\n-----END ROMAN RECORD-----\n"...), 1, "ecdsa", "[]", false},
+	}
+
+	for i, tt := range tests {
+		r, err := decodeRecord(tt.inData)
+		if got, want := err != nil, tt.outError; got != want {
+			t.Errorf("Test(%v) Got error: %v, Want error: %v", i, err, want)
+		}
+		if err != nil {
+			continue
+		}
+
+		if got, want := r.Version, tt.outVersion; got != want {
+			t.Errorf("Test(%v) Got Version: %v, Want: %v", i, got, want)
+		}
+		if got, want := r.KeyType, tt.outKeyType; got != want {
+			t.Errorf("Test(%v) Got KeyType: %v, Want: %v", i, got, want)
+		}
+		if got, want := fmt.Sprint(r.Names), tt.outNames; got != want {
+			t.Errorf("Test(%v) Got Names: %v, Want: %v", i, got, want)
+		}
+		if !bytes.Equal(r.Body, body) {
+			t.Errorf("Test(%v) Got Body: %q, Want: %q", i, r.Body, body)
+		}
+	}
+}
+
+func TestKeyTypeName(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from rsa.GenerateKey: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from ecdsa.GenerateKey: %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected response from ed25519.GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		inKey      interface{}
+		outKeyType string
+	}{
+		// 0 - rsa
+		{rsaKey, "rsa"},
+		// 1 - ecdsa
+		{ecdsaKey, "ecdsa"},
+		// 2 - ed25519
+		{ed25519Key, "ed25519"},
+		// 3 - no key
+		{nil, ""},
+	}
+
+	for i, tt := range tests {
+		if got, want := keyTypeName(tt.inKey), tt.outKeyType; got != want {
+			t.Errorf("Test(%v) Got KeyType: %q, Want: %q", i, got, want)
+		}
+	}
+}
+
+func TestRecordMigration(t *testing.T) {
+	tests := []struct {
+		inServeOnly bool
+		outMigrated bool
+	}{
+		// 0 - records are migrated when they are read
+		{false, true},
+		// 1 - but not by replicas
+		{true, false},
+	}
+
+	for i, tt := range tests {
+		mc := newMapCache()
+
+		// a certificate written before records were versioned
+		certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+		mc.putCertificate(t, "foo.example.com", certificate)
+
+		m := CertificateManager{Cache: mc, ServeOnly: tt.inServeOnly}
+		cached, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if !cached.Leaf.Equal(certificate.Leaf) {
+			t.Errorf("Test(%v) Got a different certificate", i)
+		}
+
+		migrated := strings.HasPrefix(string(mc.m["foo.example.com"]), "-----BEGIN ROMAN RECORD-----")
+		if got, want := migrated, tt.outMigrated; got != want {
+			t.Errorf("Test(%v) Got migrated: %v, Want: %v", i, got, want)
+		}
+
+		// the migrated record can be read again
+		m = CertificateManager{Cache: mc}
+		_, err = m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Errorf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package roman
+
+import (
+	"time"
+
+	"github.com/mailgun/roman/acme"
+)
+
+// Settings are the settings of a CertificateManager that Reload replaces
+// while it runs, see the fields of the same name of CertificateManager.
+type Settings struct {
+	KnownHosts        []string
+	CertificateGroups [][]string
+	ACMEClient        acme.CertificateForDomainer
+	ACMEClients       map[string]acme.CertificateForDomainer
+	RenewBefore       time.Duration
+}
+
+// Reload replaces the hosts, ACME clients (for example with rotated
+// challenge provider credentials) and RenewBefore of a running
+// CertificateManager, without interrupting handshakes or restarting the
+// renewal loop. Certificates for new hosts are requested right away in the
+// background, certificates of removed hosts are served until they expire but
+// no longer renewed. ServeOnly replicas pick up new hosts with their next
+// refresh.
+func (m *CertificateManager) Reload(s Settings) {
+	m.settingsMu.Lock()
+	m.KnownHosts = s.KnownHosts
+	m.CertificateGroups = s.CertificateGroups
+	m.ACMEClient = s.ACMEClient
+	m.ACMEClients = s.ACMEClients
+	m.RenewBefore = s.RenewBefore
+	m.settingsMu.Unlock()
+
+	// wake up the renewal loop, a reload that is already pending covers
+	// this one
+	select {
+	case m.reloads() <- struct{}{}:
+	default:
+	}
+}
+
+// reloads returns the channel Reload wakes up the renewal loop with.
+func (m *CertificateManager) reloads() chan struct{} {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+
+	if m.reloaded == nil {
+		m.reloaded = make(chan struct{}, 1)
+	}
+	return m.reloaded
+}
@@ -0,0 +1,55 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/acme"
+)
+
+func TestReload(t *testing.T) {
+	client := &multiCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:  client,
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+	err := m.Start()
+	if err != nil {
+		t.Fatalf("Unexpected response from Start: %v", err)
+	}
+	defer m.Stop(context.Background())
+
+	// a new host with a client for its domain
+	reloaded := &multiCertificateForDomainer{}
+	m.Reload(Settings{
+		KnownHosts:  []string{"foo.example.com", "bar.example.org"},
+		ACMEClient:  client,
+		ACMEClients: map[string]acme.CertificateForDomainer{"*.example.org": reloaded},
+		RenewBefore: 30 * 24 * time.Hour,
+	})
+
+	// is issued right away by the running renewal loop
+	ok := waitForCertificate(&m, "bar.example.org", func(certificate *tls.Certificate, err error) bool {
+		return err == nil
+	})
+	if !ok {
+		t.Fatalf("Expected a certificate for bar.example.org after Reload")
+	}
+	if got, want := reloaded.count, 1; got != want {
+		t.Errorf("Got %v certificates from the reloaded client, Want: %v", got, want)
+	}
+
+	// the certificate of the existing host is served and not renewed again
+	if got, want := client.count, 1; got != want {
+		t.Errorf("Got %v certificates from the original client, Want: %v", got, want)
+	}
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	if err != nil {
+		t.Errorf("Unexpected response from GetCertificate: %v", err)
+	}
+}
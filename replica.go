@@ -0,0 +1,81 @@
+package roman
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+)
+
+const (
+	defaultRefreshInterval = 1 * time.Hour
+)
+
+// refreshCertificate reloads the certificate for hostname from Cache into the
+// in-memory cache, replacing whatever was there.
+func (m *CertificateManager) refreshCertificate(hostname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cacheGetTimeout())
+	defer cancel()
+
+	certificate, key, err := m.loadCertificate(ctx, hostname)
+	if err != nil {
+		return fmt.Errorf("unable to get certificate from cache for %q: %v", hostname, err)
+	}
+
+	m.Lock()
+	m.setMemoryCertificate(hostname, certificate)
+	m.setKeyInfo(hostname, key)
+	m.Unlock()
+
+	m.stapleCertificate([]string{hostname}, certificate)
+
+	return nil
+}
+
+// refreshCertificates reloads the certificates of KnownHosts and the hosts of
+// HostSource from Cache.
+func (m *CertificateManager) refreshCertificates(ctx context.Context) []error {
+	var errs []error
+
+	err := m.updateHosts(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, hostname := range m.hosts() {
+		if ctx.Err() != nil {
+			return append(errs, ctx.Err())
+		}
+
+		err := m.refreshCertificate(hostname)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// refreshCertificatesForever calls refreshCertificates every RefreshInterval
+// until ctx is done.
+func (m *CertificateManager) refreshCertificatesForever(ctx context.Context) {
+	interval := m.RefreshInterval
+	if interval == 0 {
+		interval = defaultRefreshInterval
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		errs := m.refreshCertificates(ctx)
+		if errs != nil && ctx.Err() == nil {
+			log.Errorf("unable to refresh certificates: %v", errs)
+		}
+	}
+}
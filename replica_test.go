@@ -0,0 +1,118 @@
+package roman
+
+import (
+	"crypto/tls"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestServeOnly(t *testing.T) {
+	mc := newMapCache()
+
+	// another instance put a certificate in the shared cache
+	first, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	mc.putCertificate(t, "foo.example.com", first)
+
+	// replicas don't need an ACMEClient
+	m := CertificateManager{
+		Cache:           mc,
+		KnownHosts:      []string{"foo.example.com"},
+		ServeOnly:       true,
+		RefreshInterval: 10 * time.Millisecond,
+	}
+
+	err = m.Start()
+	if err != nil {
+		t.Fatalf("Unexpected response from Start: %v", err)
+	}
+
+	certificate, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from GetCertificate: %v", err)
+	}
+	if got, want := string(certificate.Certificate[0]), string(first.Certificate[0]); got != want {
+		t.Errorf("Got unexpected certificate from GetCertificate")
+	}
+
+	// the other instance renews the certificate, the replica should pick it up
+	second, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	mc.putCertificate(t, "foo.example.com", second)
+
+	time.Sleep(100 * time.Millisecond)
+
+	certificate, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from GetCertificate: %v", err)
+	}
+	if got, want := string(certificate.Certificate[0]), string(second.Certificate[0]); got != want {
+		t.Errorf("Replica did not pick up renewed certificate")
+	}
+}
+
+func TestServeOnlyMissingCertificate(t *testing.T) {
+	m := CertificateManager{
+		Cache:      newMapCache(),
+		KnownHosts: []string{"foo.example.com"},
+		ServeOnly:  true,
+	}
+
+	err := m.Start()
+	if err == nil {
+		t.Errorf("Expected Start to fail when the cache is empty")
+	}
+}
+
+// mapCache is used in tests as an autocert.Cache that actually stores data.
+type mapCache struct {
+	sync.Mutex
+	m map[string][]byte
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{m: make(map[string][]byte)}
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	data, ok := c.m[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *mapCache) Put(ctx context.Context, key string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.m[key] = data
+	return nil
+}
+
+func (c *mapCache) Delete(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.m, key)
+	return nil
+}
+
+func (c *mapCache) putCertificate(t *testing.T, hostname string, certificate *tls.Certificate) {
+	certificateBytes, err := certificateToBytes(certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from certificateToBytes: %v", err)
+	}
+	c.Put(context.Background(), hostname, certificateBytes)
+}
@@ -0,0 +1,48 @@
+package roman
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+	"github.com/mailgun/roman/acme"
+)
+
+// Revoke revokes the certificate served for hostname with the CA that issued
+// it and removes it from the caches of all hosts it's cached for, so the next
+// renewal obtains a new certificate. reason is a CRL reason code (RFC 5280),
+// 0 if unspecified. The ACME client of hostname must implement
+// acme.CertificateRevoker.
+func (m *CertificateManager) Revoke(ctx context.Context, hostname string, reason int) error {
+	certificate, err := m.getCertificateFromCache(hostname)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate for %q: %w", hostname, err)
+	}
+
+	client := m.clientForHost(hostname)
+	revoker, ok := client.(acme.CertificateRevoker)
+	if !ok {
+		return fmt.Errorf("unable to revoke certificate for %q: %T can't revoke certificates", hostname, client)
+	}
+	err = revoker.RevokeCertificate(ctx, certificate, reason)
+	if err != nil {
+		return fmt.Errorf("unable to revoke certificate for %q: %w", hostname, err)
+	}
+	log.Infof("revoked certificate %v for %v", certificate.Leaf.SerialNumber, certificate.Leaf.DNSNames)
+
+	// the certificate may be cached for every name on it
+	hostnames := append([]string{hostname}, certificate.Leaf.DNSNames...)
+	for _, name := range hostnames {
+		cached, err := m.getCertificateFromCache(name)
+		if err != nil || !cached.Leaf.Equal(certificate.Leaf) {
+			continue
+		}
+		err = m.deleteCertificateFromCache(name)
+		if err != nil {
+			return fmt.Errorf("unable to delete revoked certificate for %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+)
+
+func TestRevoke(t *testing.T) {
+	client := &revokingCertificateForDomainer{}
+	cache := newMapCache()
+	m := CertificateManager{
+		ACMEClient:        client,
+		Cache:             cache,
+		CertificateGroups: [][]string{{"foo.example.com", "bar.example.com"}},
+	}
+	err := m.Renew("foo.example.com", false)
+	if err != nil {
+		t.Fatalf("Unexpected response from Renew: %v", err)
+	}
+
+	err = m.Revoke(context.Background(), "bar.example.com", 4)
+	if err != nil {
+		t.Fatalf("Unexpected response from Revoke: %v", err)
+	}
+	if got, want := len(client.revoked), 1; got != want {
+		t.Fatalf("Got %v revoked certificates, Want: %v", got, want)
+	}
+	if got, want := client.reasons[0], 4; got != want {
+		t.Errorf("Got reason: %v, Want: %v", got, want)
+	}
+
+	// the certificate is gone for all hosts it was cached for
+	for _, hostname := range []string{"foo.example.com", "bar.example.com"} {
+		_, err := m.getCertificateFromCache(hostname)
+		if err != autocert.ErrCacheMiss {
+			t.Errorf("Got error for %v: %v, Want: %v", hostname, err, autocert.ErrCacheMiss)
+		}
+	}
+
+	// nothing left to revoke
+	err = m.Revoke(context.Background(), "foo.example.com", 0)
+	if err == nil {
+		t.Errorf("Expected an error revoking a certificate that isn't cached")
+	}
+
+	// clients that can't revoke
+	m = CertificateManager{ACMEClient: &multiCertificateForDomainer{}, Cache: newMapCache()}
+	err = m.Renew("foo.example.com", false)
+	if err != nil {
+		t.Fatalf("Unexpected response from Renew: %v", err)
+	}
+	err = m.Revoke(context.Background(), "foo.example.com", 0)
+	if err == nil {
+		t.Errorf("Expected an error from a client that can't revoke certificates")
+	}
+}
+
+// revokingCertificateForDomainer records the certificates it revokes.
+type revokingCertificateForDomainer struct {
+	multiCertificateForDomainer
+	revoked []*tls.Certificate
+	reasons []int
+}
+
+func (r *revokingCertificateForDomainer) RevokeCertificate(ctx context.Context, certificate *tls.Certificate, reason int) error {
+	r.revoked = append(r.revoked, certificate)
+	r.reasons = append(r.reasons, reason)
+	return nil
+}
@@ -2,23 +2,49 @@ package roman
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/singleflight"
 
 	"github.com/mailgun/log"
 	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/roman/cache"
+	"github.com/mailgun/roman/export"
+	"github.com/mailgun/roman/internal/logging"
 	"github.com/mailgun/timetools"
 )
 
+const (
+	// renewalInterval is the time between renewal cycles, without jitter.
+	renewalInterval = 24 * time.Hour
+
+	defaultRenewalJitter = 1 * time.Hour
+
+	defaultRenewRemainingPercent = 33
+
+	// shortLivedLifetime is the longest lifetime of certificates whose
+	// renewal adapts to their lifetime.
+	shortLivedLifetime = 10 * 24 * time.Hour
+)
+
 var (
 	clock timetools.TimeProvider = &timetools.RealTime{} // used to mock time in tests
 )
@@ -33,83 +59,563 @@ type CertificateManager struct {
 	// rate limits imposed by the ACME server.
 	Cache autocert.Cache
 
+	// CacheTimeouts are the timeouts of reading and writing certificates in
+	// Cache and KeyCache, the zero value uses the defaults.
+	CacheTimeouts CacheTimeouts
+
+	// KeyCache, if set, stores the private keys of certificates (for example
+	// in Vault) while Cache only stores the certificate chains, for
+	// compliance requirements about key storage. Both use the hostname as
+	// key.
+	KeyCache autocert.Cache
+
 	// KnownHosts is a slice of hosts for whom the CertificateManager will try
 	// to obtain tls certificates for.
 	KnownHosts []string
 
+	// HostSource, if set, is queried for more hosts at the start of every
+	// renewal cycle (and every refresh of a ServeOnly replica), so the host
+	// list can change without a restart. Its hosts are handled like
+	// KnownHosts. If it fails, the hosts it returned last are used.
+	HostSource HostSource
+
+	// HostPolicy, if set, allows certificates to be obtained on demand for
+	// hosts that are not in KnownHosts: when a TLS handshake asks for such a
+	// host and HostPolicy returns nil, GetCertificate requests a certificate
+	// instead of failing. Certificates obtained on demand are renewed like
+	// those of KnownHosts while they are in use.
+	HostPolicy HostPolicy
+
+	// DefaultCertificate, if set, is served when a TLS handshake has no
+	// server name or asks for a host without a certificate, so clients
+	// without SNI, scanners and health checks don't fail the handshake.
+	DefaultCertificate *tls.Certificate
+
+	// DefaultHost is like DefaultCertificate, but serves the cached (and
+	// renewed) certificate of one of the KnownHosts instead. It takes
+	// precedence over DefaultCertificate.
+	DefaultHost string
+
 	// ACMEClient is something that implements CertificateForDomainer (simple
 	// wrapper around a golang.org/x/crypto/acme.Client).
 	ACMEClient acme.CertificateForDomainer
 
+	// ACMEClients maps hostnames to the CertificateForDomainer used for them,
+	// so hosts can use different CAs or accounts (for example an internal CA
+	// for *.corp.example.com). Keys are either hostnames or patterns like
+	// *.corp.example.com that match any subdomain, the most specific match
+	// wins. Hosts without a match use ACMEClient.
+	ACMEClients map[string]acme.CertificateForDomainer
+
+	// CertificateGroups are groups of KnownHosts that share a single
+	// certificate with all of them as subject alternative names, which keeps
+	// related hosts under CA rate limits. The certificate is requested when
+	// the first host of a group is renewed, so the client for that host must
+	// implement acme.MultiCertificateForDomainer.
+	CertificateGroups [][]string
+
+	// StapleOCSP staples OCSP responses to all certificates that have an
+	// OCSP responder, not only to those with the Must-Staple extension, which
+	// always are. Staples are shared through Cache and refreshed halfway
+	// through their validity.
+	StapleOCSP bool
+
+	// RefreshChains makes the renewal loop rebuild the intermediate chain of
+	// certificates that are not due for renewal from the CA Issuers URLs
+	// (AIA) of their certificates, so a new intermediate published by the CA
+	// is served without reissuing every leaf. See RefreshChain.
+	RefreshChains bool
+
+	// ReuseKey makes renewals request the new certificate for the private key
+	// of the current one instead of a fresh key, for key pinning or keys in
+	// protected storage. The ACME client must implement
+	// acme.CertificateForKeyer.
+	ReuseKey bool
+
+	// KeyPins are the pins (see SPKIHash) of the keys certificates for a
+	// host may have, by hostname. New certificates with another key are
+	// never cached or served, which protects against misissuance and
+	// compromised accounts. Use with ReuseKey or a KeyCache holding the
+	// pinned keys.
+	KeyPins map[string][]string
+
+	// KeyRotation forces a new key every so many renewals or after some
+	// time even if ReuseKey is set, see KeyRotation.
+	KeyRotation KeyRotation
+
+	// KeyPassphrase, if set, encrypts private keys before they are written
+	// to Cache or KeyCache, with a key derived from it with scrypt, for
+	// caches that are backed up off-host. Keys written without it can still
+	// be read and are encrypted when they're written next.
+	KeyPassphrase []byte
+
+	// KeyProvider, if set, creates the private keys of new certificates, for
+	// example in a KMS, and caches only hold references to them. Keys of
+	// replaced certificates aren't deleted, set ReuseKey to keep one key per
+	// host. The ACME client must implement acme.CertificateForKeyer.
+	KeyProvider KeyProvider
+
+	// RateLimit limits how many certificates are requested from ACMEClient
+	// per registered domain, so a misconfigured KnownHosts or a renewal storm
+	// can't exhaust the limits of the CA. The zero value means no limit.
+	// Renewals held back by the limit are retried later and don't count
+	// towards QuarantineAfter.
+	RateLimit RateLimit
+
+	// RateLimits are the limits of the clients in ACMEClients, by the same
+	// keys. Clients without an entry use RateLimit.
+	RateLimits map[string]RateLimit
+
 	// RenewBefore represents how long before certificate expiration a new
-	// certificate will be requested from the ACME server.
+	// certificate will be requested from the ACME server. Short lived
+	// certificates (10 days or less) are renewed halfway through their
+	// lifetime if RenewBefore is longer than that.
 	RenewBefore time.Duration
 
-	// singleflight group to make sure we only make one request for certificate
-	// at a time
+	// RenewRemainingPercent, if set, renews certificates once less than this
+	// percentage of their lifetime remains instead of RenewBefore before
+	// they expire, which adapts to 90 day, 1 year and short lived
+	// certificates alike. If neither is set, certificates are renewed with
+	// 33% of their lifetime left.
+	RenewRemainingPercent int
+
+	// RenewalJitter is the longest random delay added to the 24 hours between
+	// renewal cycles, so a fleet of instances sharing KnownHosts doesn't hit
+	// the CA and DNS provider at the same time. Defaults to 1 hour, a negative
+	// value disables it.
+	RenewalJitter time.Duration
+
+	// RenewalLock, if set, makes sure only one of the CertificateManagers
+	// sharing Cache requests a certificate for a host at a time. The others
+	// wait for the lock and then read the new certificate from Cache.
+	RenewalLock Locker
+
+	// RenewalLockTTL is how long the renewal lock is held at most, in case
+	// its holder dies. It should be longer than issuance takes, defaults to
+	// 15 minutes.
+	RenewalLockTTL time.Duration
+
+	// TracerProvider, if set, is used to trace renewals with OpenTelemetry,
+	// defaults to the global provider. acme.Client continues the trace.
+	TracerProvider trace.TracerProvider
+
+	// Logger, if set, receives structured events (host, step, duration,
+	// error) for every step of issuance: cache lookup, account, order,
+	// authorization, challenge, DNS updates and finalization. Failed steps
+	// are logged at error level, issued certificates at info level and
+	// everything else at debug level. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Exporters are called every time a new certificate is obtained so that
+	// it can be published outside of roman (vulcand, files, keystores, etc).
+	// Certificates whose key can't be exported are skipped with a warning.
+	Exporters []export.Exporter
+
+	// PreRenewalHooks are run for each hostname right before a certificate
+	// is requested, if one fails the certificate isn't requested.
+	// PostRenewalHooks are run for each hostname after a new certificate was
+	// cached and exported, a failure is reported like a failed renewal. See
+	// RenewalHook and ExecHook.
+	PreRenewalHooks  []RenewalHook
+	PostRenewalHooks []RenewalHook
+
+	// ServeOnly turns the CertificateManager into a replica that never issues
+	// or renews certificates, it only reads them from Cache and serves them.
+	// This is useful for horizontally scaled edge nodes that share a cache and
+	// should not have any CA or DNS credentials.
+	ServeOnly bool
+
+	// QuarantineAfter is the number of consecutive renewal failures after
+	// which a host is quarantined. Quarantined hosts are skipped by the renewal
+	// loop, so they stop consuming retries and DNS API calls, until they are
+	// released with Unquarantine. Zero disables quarantine.
+	QuarantineAfter int
+
+	// OnQuarantine, if set, is called when a host is quarantined with the
+	// error of the last renewal attempt.
+	OnQuarantine func(hostname string, err error)
+
+	// OnIssue, if set, is called when the first certificate for a host is
+	// obtained, and OnRenew when a certificate replaces an existing one, so
+	// applications can reload or publish it. Both are called from the renewal
+	// loop (or a handshake for hosts obtained on demand) and should not
+	// block.
+	OnIssue func(hostname string, certificate *tls.Certificate)
+	OnRenew func(hostname string, certificate *tls.Certificate)
+
+	// OnRenewFailure, if set, is called with the error every time obtaining a
+	// certificate for a host fails. Renewals held back by RateLimit are not
+	// failures.
+	OnRenewFailure func(hostname string, err error)
+
+	// OnExpireSoon, if set, is called after a renewal attempt for a host
+	// whose certificate is more than halfway through its renewal window (15
+	// days before expiration with a RenewBefore of 30 days), to alert before
+	// it actually expires.
+	OnExpireSoon func(hostname string, notAfter time.Time)
+
+	// CAACheck, if it has IssuerDomains, checks the CAA records of hosts
+	// before certificates are requested for them.
+	CAACheck CAACheck
+
+	// CertificateTransparency, if it has Logs, checks the SCTs embedded in
+	// new certificates before they are cached and served.
+	CertificateTransparency CertificateTransparency
+
+	// Notifiers are sent an Event every time a certificate is issued,
+	// renewed, fails to renew or is about to expire, see the notify package
+	// for webhooks. Events are sent in the background.
+	Notifiers []Notifier
+
+	// ExpiryAlerts are thresholds of time left until a certificate expires,
+	// for example 14, 7 and 2 days. Every hour, independent of renewals, a
+	// certificate that crossed one of them is logged (at error level for the
+	// lowest one), shows in Metrics and is sent to Notifiers as an
+	// EventExpiringSoon, once per threshold.
+	ExpiryAlerts []time.Duration
+
+	// GarbageCollection, if its Interval is set, periodically deletes
+	// certificates from Cache that expired long ago or belong to hosts that
+	// are no longer known. Replicas never delete certificates.
+	GarbageCollection GarbageCollection
+
+	// PreloadCachedHosts makes Start load every certificate in Cache into
+	// the in-memory cache, not only those of KnownHosts, so no handshake
+	// reads from Cache. Cache has to implement cache.Lister. Certificates
+	// obtained on demand are renewed right away instead of after their next
+	// handshake.
+	PreloadCachedHosts bool
+
+	// StartupPolicy decides if Start succeeds when certificates for some
+	// hosts can't be obtained (or loaded, for ServeOnly replicas). Defaults
+	// to StartFailFast, see StartWarnAndContinue and StartRequirePercent.
+	StartupPolicy StartupPolicy
+
+	// RefreshInterval is how often a ServeOnly CertificateManager reloads
+	// certificates from Cache, defaults to 1 hour.
+	RefreshInterval time.Duration
+
+	// cancel stops the background goroutines started by StartContext, which
+	// are tracked by running, protected by the embedded mutex
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	// singleflight group to make sure we only make one request at a time for
+	// a certificate, keyed by its names
 	group singleflight.Group
 
-	// memoryCache is a in-memory cache used to store certificates
+	// onDemand makes sure concurrent handshakes for a host that isn't cached
+	// yet only make one request, keyed by hostname
+	onDemand singleflight.Group
+
+	// memoryCache is a in-memory cache of parsed certificates in front of
+	// Cache, so handshakes don't parse PEM. To put a shared fast cache like
+	// Redis in front of a durable one, use cache.Tiered as Cache.
 	memoryCache map[string]*tls.Certificate
+
+	// keyInfos is the metadata of the keys of the certificates in
+	// memoryCache, for KeyRotation, protected by the embedded mutex
+	keyInfos map[string]keyInfo
+
+	// sourceHosts are the hosts HostSource returned last, protected by the
+	// embedded mutex
+	sourceHosts []string
+
+	// settingsMu protects the Settings that Reload replaces once started,
+	// reloaded wakes up the renewal loop after they were
+	settingsMu sync.RWMutex
+	reloaded   chan struct{}
+
+	// failures is the number of consecutive renewal failures per hostname,
+	// protected by failuresMu
+	failures   map[string]int
+	failuresMu sync.Mutex
+
+	// quarantined is the set of hosts that are no longer renewed, protected
+	// by failuresMu
+	quarantined map[string]bool
+
+	// retries are the times failed renewals are retried by hostname,
+	// protected by failuresMu
+	retries map[string]time.Time
+
+	// lastErrors are the errors of the last failed renewal by hostname,
+	// protected by failuresMu
+	lastErrors map[string]HostError
+
+	// buckets are the rate limit token buckets per client and registered
+	// domain, protected by bucketsMu
+	buckets   map[string]*tokenBucket
+	bucketsMu sync.Mutex
+
+	// metrics are the counters returned by Metrics, protected by metricsMu
+	metrics   Metrics
+	metricsMu sync.Mutex
+
+	// lastRenewalRun is when renewCertificates last finished, protected by
+	// metricsMu
+	lastRenewalRun time.Time
+
+	// expiryAlerts are the ExpiryAlerts raised by hostname, protected by
+	// alertsMu
+	expiryAlerts map[string]expiryAlert
+	alertsMu     sync.Mutex
 }
 
 // Start is a blocking function that ensures the CertificateManager cache
 // contains valid certificates for all known hosts. If it doesn't contain a
-// cached TLS certificate, it requests one and put its in the cache.
+// cached TLS certificate, it requests one and put its in the cache. Cached
+// certificates are loaded into memory first, so handshakes never wait for
+// Cache.
 func (m *CertificateManager) Start() error {
+	return m.StartContext(context.Background())
+}
+
+// StartContext is like Start, but initial issuance is cancelled when ctx is
+// cancelled and the background goroutines stop when ctx is done. Cancelling
+// ctx also stops renewals that are talking to the CA or waiting for DNS.
+func (m *CertificateManager) StartContext(ctx context.Context) error {
+	return m.startContext(ctx, false)
+}
+
+// StartAsync is like Start, but returns as soon as the cached certificates
+// are loaded instead of waiting for initial issuance, for services that
+// prefer to start serving right away. Hosts without a certificate are
+// issued in the background and served DefaultHost or DefaultCertificate, if
+// set, until then. Failures are logged and retried with backoff. Replicas
+// start even if certificates are missing from Cache.
+func (m *CertificateManager) StartAsync() error {
+	return m.StartAsyncContext(context.Background())
+}
+
+// StartAsyncContext is like StartAsync, the background goroutines stop when
+// ctx is done.
+func (m *CertificateManager) StartAsyncContext(ctx context.Context) error {
+	return m.startContext(ctx, true)
+}
+
+// startContext starts the CertificateManager with a context Stop cancels.
+func (m *CertificateManager) startContext(ctx context.Context, async bool) error {
+	// Stop cancels ctx
+	ctx, cancel := context.WithCancel(ctx)
+	m.Lock()
+	m.cancel = cancel
+	m.Unlock()
+
+	err := m.start(ctx, async)
+	if err != nil {
+		cancel()
+	}
+
+	return err
+}
+
+func (m *CertificateManager) start(ctx context.Context, async bool) error {
+	// replicas only load certificates, somebody else is responsible for
+	// putting them in the cache
+	if m.ServeOnly {
+		errs := m.refreshCertificates(ctx)
+		if async && errs != nil {
+			log.Warningf("unable to load certificates, retrying in the background: %v", errs)
+		}
+		if !async {
+			err := m.checkStartup(errs)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := m.preloadCertificates(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to start: %v", err)
+		}
+
+		m.background(func() { m.refreshCertificatesForever(ctx) })
+		m.background(func() { m.watchCacheForever(ctx) })
+		m.background(func() { m.refreshStaplesForever(ctx) })
+
+		return nil
+	}
+
+	// fail early if the cache can't be garbage collected
+	if m.GarbageCollection.Interval > 0 {
+		_, err := m.CachedHosts()
+		if err != nil {
+			return fmt.Errorf("unable to garbage collect cache: %v", err)
+		}
+	}
+
+	// warm the in-memory cache before renewals, which can take a while
+	err := m.preloadCertificates(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to start: %v", err)
+	}
+
+	if async {
+		// serve what's cached right away, failed hosts are retried with
+		// backoff by the renewal loop
+		m.background(func() {
+			errs := m.renewCertificates(ctx)
+			if errs != nil && ctx.Err() == nil {
+				log.Errorf("unable to obtain certificates: %v", errs)
+			}
+			m.renewCertificatesForever(ctx)
+		})
+		m.startBackground(ctx)
+
+		return nil
+	}
+
 	// this is a both a blocking call and a function that can potentially take
 	// a lot of time, but it makes sure we have working certificates for
 	// all known hosts before we start the process.
-	errs := m.renewCertificates()
-	if errs != nil {
-		return fmt.Errorf("unable to start due to the following errors: %v", errs)
+	done := make(chan []error, 1)
+	m.background(func() {
+		done <- m.renewCertificates(ctx)
+	})
+
+	var errs []error
+	select {
+	case errs = <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("unable to start: %v", ctx.Err())
+	}
+	err = m.checkStartup(errs)
+	if err != nil {
+		return err
 	}
 
 	// kick off a go routine that will update certificates in the background
-	go m.renewCertificatesForever()
+	m.background(func() { m.renewCertificatesForever(ctx) })
+	m.startBackground(ctx)
 
 	return nil
 }
 
+// startBackground starts the goroutines other than the renewal loop that run
+// until ctx is done.
+func (m *CertificateManager) startBackground(ctx context.Context) {
+	if m.GarbageCollection.Interval > 0 {
+		m.background(func() { m.collectGarbageForever(ctx) })
+	}
+
+	// pick up certificates renewed by other instances sharing the cache
+	m.background(func() { m.watchCacheForever(ctx) })
+
+	// keep ocsp staples fresh
+	m.background(func() { m.refreshStaplesForever(ctx) })
+
+	if len(m.ExpiryAlerts) > 0 {
+		m.background(func() { m.checkExpiryAlertsForever(ctx) })
+	}
+}
+
 // GetCertificate is passed into a *tls.Config so that an *http.Server can
 // automatically reload certificates. GetCertificate always retrieves
 // certificates from a cache while a background go routine updates certificates.
+// Cached wildcard certificates are served for the hosts they cover. If
+// HostPolicy is set, certificates for allowed hosts that are not cached yet
+// are obtained during the handshake. If no certificate can be found, the
+// certificate of DefaultHost or DefaultCertificate is served if set.
 func (m *CertificateManager) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	return m.getCertificateFromCache(clientHello.ServerName)
+	certificate, err := m.getCertificate(clientHello)
+	if err == nil || (m.DefaultHost == "" && m.DefaultCertificate == nil) {
+		return certificate, err
+	}
+
+	if err != autocert.ErrCacheMiss {
+		log.Warningf("serving default certificate for %q: %v", clientHello.ServerName, err)
+	}
+
+	if m.DefaultHost != "" {
+		certificate, defaultErr := m.getCertificateFromCache(m.DefaultHost)
+		if defaultErr == nil {
+			return certificate, nil
+		}
+		if m.DefaultCertificate == nil {
+			return nil, err
+		}
+	}
+
+	return m.DefaultCertificate, nil
 }
 
-// getCertificateFromCache returns a certificate from either an in-memory cache or disk cache.
-func (m *CertificateManager) getCertificateFromCache(hostname string) (*tls.Certificate, error) {
-	m.RLock()
-	defer m.RUnlock()
+func (m *CertificateManager) getCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// clients without SNI and some scanners don't send a server name
+	if clientHello.ServerName == "" {
+		return nil, autocert.ErrCacheMiss
+	}
 
-	if m.memoryCache == nil {
-		m.memoryCache = make(map[string]*tls.Certificate)
+	certificate, err := m.matchCertificate(clientHello.ServerName)
+	m.observeHandshake(err == nil)
+	if err != autocert.ErrCacheMiss || m.HostPolicy == nil || m.ServeOnly {
+		return certificate, err
 	}
 
+	ctx := context.Background()
+	if clientHello.Context() != nil {
+		ctx = clientHello.Context()
+	}
+
+	return m.certificateOnDemand(ctx, clientHello.ServerName)
+}
+
+// CachedHosts returns the hostnames that have a certificate in Cache, which
+// has to implement cache.Lister. Other keys, like the ACME account key, are
+// skipped.
+func (m *CertificateManager) CachedHosts() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys, err := cache.List(ctx, m.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// autocert and roman name everything that isn't a certificate with a +
+	var hostnames []string
+	for _, key := range keys {
+		if !strings.Contains(key, "+") {
+			hostnames = append(hostnames, key)
+		}
+	}
+
+	return hostnames, nil
+}
+
+// getCertificateFromCache returns a certificate from either an in-memory cache or disk cache.
+func (m *CertificateManager) getCertificateFromCache(hostname string) (*tls.Certificate, error) {
 	// look in the in-memory cache first
+	m.RLock()
 	certificate, ok := m.memoryCache[hostname]
+	m.RUnlock()
 	if ok {
 		return certificate, nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), m.cacheGetTimeout())
 	defer cancel()
 
 	// couldn't find it in the in-memory cache, look for it on disk
-	certificateBytes, err := m.Cache.Get(ctx, hostname)
+	tlsCertificate, key, err := m.loadCertificate(ctx, hostname)
 	if err != nil {
 		return nil, err
 	}
 
-	// found certificate, decode and rebuild it
-	tlsCertificate, err := bytesToCertificate(certificateBytes)
-	if err != nil {
-		return nil, err
+	// staples fetched before a restart or by other instances are served
+	// right away
+	if m.needsStaple(tlsCertificate.Leaf) {
+		staple, ok := m.cachedStaple(ctx, m.certificateGroup(hostname), tlsCertificate)
+		if ok {
+			tlsCertificate.OCSPStaple = staple
+		}
 	}
 
 	// put it back in the in-memory cache
-	m.memoryCache[hostname] = tlsCertificate
+	m.Lock()
+	m.setMemoryCertificate(hostname, tlsCertificate)
+	m.setKeyInfo(hostname, key)
+	m.Unlock()
 
 	return tlsCertificate, nil
 }
@@ -120,23 +626,13 @@ func (m *CertificateManager) putCertificateInCache(hostname string, certificate
 	defer m.Unlock()
 
 	// first put the certificate into the in-memory cache
-	if m.memoryCache == nil {
-		m.memoryCache = make(map[string]*tls.Certificate)
-	}
-
-	m.memoryCache[hostname] = certificate
-
-	// get bytes
-	certificateBytes, err := certificateToBytes(certificate)
-	if err != nil {
-		return err
-	}
+	m.setMemoryCertificate(hostname, certificate)
 
-	// write them to disk
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	// write it to disk
+	ctx, cancel := context.WithTimeout(context.Background(), m.cachePutTimeout())
 	defer cancel()
 
-	return m.Cache.Put(ctx, hostname, certificateBytes)
+	return m.storeCertificate(ctx, hostname, certificate, m.keyInfos[hostname])
 }
 
 // deleteCertificateFromCache remove the certificate from both the in-memory cache and from disk.
@@ -144,20 +640,70 @@ func (m *CertificateManager) deleteCertificateFromCache(hostname string) error {
 	m.Lock()
 	defer m.Unlock()
 
+	delete(m.memoryCache, hostname)
+	delete(m.keyInfos, hostname)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cacheDeleteTimeout())
+	defer cancel()
+
+	return m.removeCertificate(ctx, hostname)
+}
+
+// setMemoryCertificate puts a parsed certificate in the in-memory cache, the
+// caller must hold the write lock.
+func (m *CertificateManager) setMemoryCertificate(hostname string, certificate *tls.Certificate) {
 	if m.memoryCache == nil {
 		m.memoryCache = make(map[string]*tls.Certificate)
 	}
+	m.memoryCache[hostname] = certificate
+}
 
-	delete(m.memoryCache, hostname)
+// Renew renews the certificate for hostname, and the hosts that share it (see
+// CertificateGroups), if it's due for renewal, or regardless if force is set.
+// The certificate is cached, exported and announced like one of a scheduled
+// renewal. hostname doesn't need to be in KnownHosts, so Renew can be used by
+// tools that obtain certificates out-of-band.
+func (m *CertificateManager) Renew(hostname string, force bool) error {
+	return m.RenewContext(context.Background(), hostname, force)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	defer cancel()
+// RenewContext is like Renew, cancelling ctx cancels the renewal.
+func (m *CertificateManager) RenewContext(ctx context.Context, hostname string, force bool) error {
+	return m.renew(ctx, m.certificateGroup(hostname)[0], force)
+}
 
-	return m.Cache.Delete(ctx, hostname)
+func (m *CertificateManager) renewCertificate(ctx context.Context, hostname string) error {
+	return m.renew(ctx, hostname, false)
 }
 
-func (m *CertificateManager) renewCertificate(hostname string) error {
+// renew renews the certificate for hostname if it's due, or regardless if
+// force is set. Cancelling ctx cancels the requests to the CA and DNS
+// providers.
+func (m *CertificateManager) renew(ctx context.Context, hostname string, force bool) (err error) {
+	// hosts that share a certificate are renewed together with the first
+	// host of their group
+	hostnames := m.certificateGroup(hostname)
+	if hostnames[0] != hostname {
+		return nil
+	}
+
+	ctx, span := m.tracer().Start(ctx, "roman.RenewCertificate", trace.WithAttributes(attribute.StringSlice("roman.hostnames", hostnames)))
+	defer func() { endSpan(span, err) }()
+
+	// the acme and challenge packages log to our logger
+	ctx = logging.NewContext(ctx, m.logger())
+
+	start := time.Now()
+	_, cacheSpan := startSpan(ctx, "roman.Cache.Get")
 	certificate, err := m.getCertificateFromCache(hostname)
+	if err == autocert.ErrCacheMiss {
+		cacheSpan.SetAttributes(attribute.Bool("roman.cache.miss", true))
+		endSpan(cacheSpan, nil)
+		logging.Step(ctx, "cache", hostname, start, nil)
+	} else {
+		endSpan(cacheSpan, err)
+		logging.Step(ctx, "cache", hostname, start, err)
+	}
 
 	// if we got an error, and it was something other than a cache miss, return it right away
 	if err != nil && err != autocert.ErrCacheMiss {
@@ -165,84 +711,333 @@ func (m *CertificateManager) renewCertificate(hostname string) error {
 	}
 
 	// if we didn't get any error, check if we need to renew the certificate
-	if err == nil {
+	if err == nil && !force {
 		// if we don't need to renew, move on to the next one
-		if needToRenew(certificate.Leaf.NotAfter, m.RenewBefore) == false {
+		if needToRenew(certificate.Leaf, m.renewBefore(certificate.Leaf)) == false && m.groupCached(certificate, hostnames) {
+			// pick up new intermediates without reissuing the leaf
+			if m.RefreshChains {
+				certificate, _, err = m.refreshChain(hostnames, certificate)
+				if err != nil {
+					log.Warningf("unable to refresh certificate chain: %v", err)
+				}
+			}
+
+			// certificates loaded from disk don't have a staple yet
+			m.stapleCertificate(hostnames, certificate)
 			return nil
 		}
 	}
 
-	// go get a new certificate from the ACME server
-	certificateI, err, _ := m.group.Do("rcfd", func() (interface{}, error) {
-		return m.ACMEClient.CertificateForDomain(hostname)
+	// make sure no other instance sharing Cache renews at the same time
+	unlock, err := m.lockRenewal(ctx, hostnames)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the instance that held the lock may have renewed it already
+	if renewed, key, ok := m.renewedElsewhere(hostnames); ok && !force {
+		m.Lock()
+		for _, hostname := range hostnames {
+			m.setMemoryCertificate(hostname, renewed)
+			m.setKeyInfo(hostname, key)
+		}
+		m.Unlock()
+
+		m.stapleCertificate(hostnames, renewed)
+		return nil
+	}
+
+	// don't create orders the CA will reject
+	err = m.checkCAA(ctx, hostnames)
+	if err != nil {
+		return err
+	}
+
+	// make sure we stay within the limits of the CA
+	err = m.takeRateLimit(hostnames)
+	if err != nil {
+		return err
+	}
+
+	previous := certificate
+
+	// keys that are reused too long are replaced anyway
+	reused, rotation := m.keyToReuse(hostname, previous)
+	if rotation != "" {
+		log.Infof("rotating private key of %v: %v", hostnames, rotation)
+	}
+
+	err = runRenewalHooks(ctx, m.PreRenewalHooks, hostnames, previous)
+	if err != nil {
+		m.refundRateLimit(hostnames)
+		return err
+	}
+
+	// go get a new certificate from the ACME server, concurrent renewals of
+	// the same names share a request
+	start = time.Now()
+	certificateI, err, _ := m.group.Do(strings.Join(hostnames, ","), func() (interface{}, error) {
+		start := time.Now()
+		certificate, err := m.certificateForHosts(ctx, hostnames, reused)
+		m.observeIssuance(time.Since(start), err)
+		return certificate, err
 	})
 	if err != nil {
-		return fmt.Errorf("unable to request certificate for hostname %q: %v", hostname, err)
+		// nothing was issued, don't count the order against the limit
+		m.refundRateLimit(hostnames)
+		logging.Step(ctx, "issue", strings.Join(hostnames, ","), start, err)
+		return fmt.Errorf("unable to request certificate for hostname %q: %w", hostname, err)
 	}
 	certificate = certificateI.(*tls.Certificate)
+	m.logger().InfoContext(ctx, "certificate issued", "host", strings.Join(hostnames, ","), "step", "issue",
+		"duration", time.Since(start), "not_after", certificate.Leaf.NotAfter)
 
-	// so delete it from the cache (if it's in it)
-	err = m.deleteCertificateFromCache(hostname)
+	// a certificate for a key we don't know wasn't requested by us
+	err = m.checkKeyPins(hostnames, certificate)
 	if err != nil {
-		return fmt.Errorf("unable to delete certificate from cache for %q: %v", hostname, err)
+		return err
 	}
 
-	// put the new certificate in the cache
-	err = m.putCertificateInCache(hostname, certificate)
+	// don't serve certificates that clients will reject
+	err = m.checkTransparencyOf(hostnames, certificate)
 	if err != nil {
-		return fmt.Errorf("unable to put certificate in cache for %q: %v", hostname, err)
+		return err
 	}
 
-	return nil
+	key := m.nextKeyInfo(hostname, reused, rotation)
+	m.Lock()
+	for _, hostname := range hostnames {
+		m.setKeyInfo(hostname, key)
+	}
+	m.Unlock()
+
+	for _, hostname := range hostnames {
+		// replace the old certificate in place, deleting it first would
+		// leave handshakes without a certificate in between
+		err = m.putCertificateInCache(hostname, certificate)
+		if err != nil {
+			return fmt.Errorf("unable to put certificate in cache for %q: %v", hostname, err)
+		}
+
+		// publish the new certificate
+		for _, e := range m.Exporters {
+			err = e.Export(hostname, certificate)
+			if errors.Is(err, export.ErrKeyNotExportable) {
+				log.Warningf("unable to export certificate for %q with %T, its key can't be exported", hostname, e)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to export certificate for %q: %v", hostname, err)
+			}
+		}
+	}
+
+	m.stapleCertificate(hostnames, certificate)
+	m.notifyRenewed(hostnames, previous, certificate)
+
+	return runRenewalHooks(ctx, m.PostRenewalHooks, hostnames, certificate)
 }
 
-// renewCertificates loops over all hostnames and makes sure they are all valid and cached.
-func (m *CertificateManager) renewCertificates() []error {
+// renewCertificates loops over all hostnames, most at risk first, and makes
+// sure they are all valid and cached.
+func (m *CertificateManager) renewCertificates(ctx context.Context) []error {
 	var errs []error
 
-	for _, hostname := range m.KnownHosts {
-		err := m.renewCertificate(hostname)
+	err := m.updateHosts(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, hostname := range m.renewalQueue() {
+		if ctx.Err() != nil {
+			return append(errs, ctx.Err())
+		}
+		if m.isQuarantined(hostname) {
+			continue
+		}
+
+		err := m.renewCertificate(ctx, hostname)
+		if ctx.Err() != nil {
+			// cancelled renewals aren't failures of the host
+			return append(errs, ctx.Err())
+		}
+		m.recordRenewal(hostname, err)
 		if err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	m.metricsMu.Lock()
+	m.lastRenewalRun = clock.UtcNow()
+	m.metricsMu.Unlock()
+
 	return errs
 }
 
-// renewCertificatesForever calls renewCertificates every 24 hours.
-func (m *CertificateManager) renewCertificatesForever() {
+// renewCertificatesForever calls renewCertificates every 24 hours, plus a
+// random delay of up to RenewalJitter, until ctx is done. Start already
+// renewed, so it waits first. Failed renewals are retried in between with
+// exponential backoff.
+func (m *CertificateManager) renewCertificatesForever(ctx context.Context) {
+	next := clock.UtcNow().Add(m.renewalInterval())
+
 	for {
-		errs := m.renewCertificates()
-		if errs != nil {
+		wait := next.Sub(clock.UtcNow())
+		if retry, ok := m.nextRetry(); ok && retry.Before(next) {
+			wait = retry.Sub(clock.UtcNow())
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-m.reloads():
+			// obtain certificates for new hosts, without starting a new
+			// cycle
+			errs := m.renewCertificates(ctx)
+			if errs != nil && ctx.Err() == nil {
+				log.Errorf("unable to renew certificates after reload: %v", errs)
+			}
+			continue
+		case <-ctx.Done():
+			return
+		}
+
+		if clock.UtcNow().Before(next) {
+			errs := m.retryRenewals(ctx)
+			if errs != nil && ctx.Err() == nil {
+				log.Errorf("unable to retry renewals: %v", errs)
+			}
+			continue
+		}
+
+		errs := m.renewCertificates(ctx)
+		if errs != nil && ctx.Err() == nil {
 			log.Errorf("unable to renew certificates: %v", errs)
 		}
+		next = clock.UtcNow().Add(m.renewalInterval())
+	}
+}
 
-		time.Sleep(24 * time.Hour)
+// renewalInterval returns how long to wait until the next renewal cycle.
+func (m *CertificateManager) renewalInterval() time.Duration {
+	jitter := m.RenewalJitter
+	if jitter == 0 {
+		jitter = defaultRenewalJitter
 	}
+	if jitter < 0 {
+		return renewalInterval
+	}
+
+	return renewalInterval + time.Duration(rand.Int63n(int64(jitter)))
 }
 
-// needToRenew will return true if it's time to renew a certificate.
-func needToRenew(notAfter time.Time, renewBefore time.Duration) bool {
-	return clock.UtcNow().Add(renewBefore).After(notAfter)
+// needToRenew will return true if it's time to renew a certificate. Short
+// lived certificates (10 days or less, for example the 6 day certificates of
+// the Let's Encrypt shortlived profile) are renewed halfway through their
+// lifetime if renewBefore is longer than that, otherwise they would be renewed
+// right after they were issued.
+func needToRenew(leaf *x509.Certificate, renewBefore time.Duration) bool {
+	return clock.UtcNow().Add(renewalWindow(leaf, renewBefore)).After(leaf.NotAfter)
 }
 
+// renewBefore returns how long before expiration leaf is due for renewal:
+// RenewRemainingPercent of its lifetime if set (or if RenewBefore isn't),
+// else RenewBefore.
+func (m *CertificateManager) renewBefore(leaf *x509.Certificate) time.Duration {
+	m.settingsMu.RLock()
+	renewBefore := m.RenewBefore
+	m.settingsMu.RUnlock()
+
+	percent := m.RenewRemainingPercent
+	if percent == 0 && renewBefore == 0 {
+		percent = defaultRenewRemainingPercent
+	}
+	if percent == 0 || leaf == nil {
+		return renewBefore
+	}
+
+	return leaf.NotAfter.Sub(leaf.NotBefore) * time.Duration(percent) / 100
+}
+
+// renewalWindow returns how long before expiration leaf is renewed.
+func renewalWindow(leaf *x509.Certificate, renewBefore time.Duration) time.Duration {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	if lifetime <= shortLivedLifetime && renewBefore > lifetime/2 {
+		return lifetime / 2
+	}
+
+	return renewBefore
+}
+
+// bytesToCertificate decodes a certificate as stored in Cache, the PEM
+// encoded private key followed by the PEM encoded chain.
 func bytesToCertificate(certificateBytes []byte) (*tls.Certificate, error) {
-	// build the private key (*rsa.PrivateKey) first
-	privateKeyBlock, publicKeyBytes := pem.Decode(certificateBytes)
+	// build the private key first
+	privateKeyBlock, chainBytes := pem.Decode(certificateBytes)
+	if privateKeyBlock == nil {
+		return nil, fmt.Errorf("unable to decode private key")
+	}
 
-	certificatePrivateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
+	certificatePrivateKey, err := parsePrivateKey(privateKeyBlock)
 	if err != nil {
 		return nil, err
 	}
 
 	// build the certificate chain next
+	tlsCertificate, err := bytesToChain(chainBytes)
+	if err != nil {
+		return nil, err
+	}
+	tlsCertificate.PrivateKey = certificatePrivateKey
+
+	return tlsCertificate, nil
+}
+
+// bytesToPrivateKey decodes a PEM encoded private key.
+func bytesToPrivateKey(privateKeyBytes []byte) (crypto.Signer, error) {
+	privateKeyBlock, _ := pem.Decode(privateKeyBytes)
+	if privateKeyBlock == nil {
+		return nil, fmt.Errorf("unable to decode private key")
+	}
+
+	return parsePrivateKey(privateKeyBlock)
+}
+
+// parsePrivateKey parses an RSA PRIVATE KEY (PKCS #1), EC PRIVATE KEY (SEC 1)
+// or PRIVATE KEY (PKCS #8) block.
+func parsePrivateKey(privateKeyBlock *pem.Block) (crypto.Signer, error) {
+	switch privateKeyBlock.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(privateKeyBlock.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(privateKeyBlock.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", privateKey)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key block: %v", privateKeyBlock.Type)
+	}
+}
+
+// bytesToChain decodes a PEM encoded certificate chain into a *tls.Certificate
+// without a private key.
+func bytesToChain(chainBytes []byte) (*tls.Certificate, error) {
 	var certificateBlock *pem.Block
-	var remainingBytes []byte = publicKeyBytes
+	var remainingBytes []byte = chainBytes
 	var certificateChain [][]byte
 
 	for {
 		certificateBlock, remainingBytes = pem.Decode(remainingBytes)
+		if certificateBlock == nil {
+			break
+		}
 		certificateChain = append(certificateChain, certificateBlock.Bytes)
 
 		if len(remainingBytes) == 0 {
@@ -261,34 +1056,82 @@ func bytesToCertificate(certificateBytes []byte) (*tls.Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(x509Chain) == 0 {
+		return nil, fmt.Errorf("no certificates in chain")
+	}
 
 	// return the tls.Certificate
 	return &tls.Certificate{
 		Certificate: certificateChain,
-		PrivateKey:  certificatePrivateKey,
 		Leaf:        x509Chain[0],
 	}, nil
 }
 
+// certificateToBytes encodes a certificate for Cache, the PEM encoded private
+// key followed by the PEM encoded chain.
 func certificateToBytes(tlsCertificate *tls.Certificate) ([]byte, error) {
-	// next create buf which will hold the bytes for the tls.Certificate that we will write to disk
-	var buf bytes.Buffer
-
-	// get the private key bytes in pkcs1 format
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(tlsCertificate.PrivateKey.(*rsa.PrivateKey))
-
-	// create a pem block that contains the private key
-	privateKeyPEMBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyBytes,
+	privateKeyBytes, err := privateKeyToBytes(tlsCertificate)
+	if err != nil {
+		return nil, err
 	}
 
-	// write private key to buf
-	err := pem.Encode(&buf, &privateKeyPEMBlock)
+	chainBytes, err := chainToBytes(tlsCertificate)
 	if err != nil {
 		return nil, err
 	}
 
+	return append(privateKeyBytes, chainBytes...), nil
+}
+
+// privateKeyToBytes PEM encodes the private key of a certificate.
+func privateKeyToBytes(tlsCertificate *tls.Certificate) ([]byte, error) {
+	var privateKeyPEMBlock *pem.Block
+
+	// rsa and ecdsa keys keep their traditional encodings so older versions
+	// and other tools can read them, keys that can't be exported, like those
+	// of a KeyProvider, are stored by reference
+	switch privateKey := tlsCertificate.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		privateKeyPEMBlock = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}
+	case *ecdsa.PrivateKey:
+		privateKeyBytes, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKeyPEMBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: privateKeyBytes,
+		}
+	case ed25519.PrivateKey:
+		privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKeyPEMBlock = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: privateKeyBytes,
+		}
+	default:
+		reference, err := keyReference(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKeyPEMBlock = &pem.Block{
+			Type:  keyReferenceBlockType,
+			Bytes: []byte(reference),
+		}
+	}
+
+	return pem.EncodeToMemory(privateKeyPEMBlock), nil
+}
+
+// chainToBytes PEM encodes the certificate chain of a certificate.
+func chainToBytes(tlsCertificate *tls.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+
 	// loop over the certificate chain and make them into pem blocks
 	// and write them to buf
 	for _, certificateBytes := range tlsCertificate.Certificate {
@@ -297,7 +1140,7 @@ func certificateToBytes(tlsCertificate *tls.Certificate) ([]byte, error) {
 			Bytes: certificateBytes,
 		}
 
-		err = pem.Encode(&buf, &certificatePEMBlock)
+		err := pem.Encode(&buf, &certificatePEMBlock)
 		if err != nil {
 			return nil, err
 		}
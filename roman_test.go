@@ -1,19 +1,28 @@
 package roman
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"math/big"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/net/context"
 
+	"github.com/mailgun/roman/cache"
+	"github.com/mailgun/roman/export"
 	"github.com/mailgun/timetools"
 )
 
@@ -41,6 +50,123 @@ func TestStart(t *testing.T) {
 	}
 }
 
+func TestStartContext(t *testing.T) {
+	mc := newMapCache()
+	bcfd := newBlockingCertificateForDomainer()
+	m := CertificateManager{
+		ACMEClient:  bcfd,
+		Cache:       mc,
+		KnownHosts:  []string{"foo.example.com", "bar.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	// give up while the first certificate is being issued
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-bcfd.started
+		cancel()
+	}()
+
+	// start gives up when the context is done, not when issuance is done
+	err := m.StartContext(ctx)
+	if err == nil {
+		t.Fatalf("Expected StartContext to fail when the context is done")
+	}
+
+	// the renewal in flight is cancelled, the next host isn't renewed
+	err = m.Stop(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from Stop: %v", err)
+	}
+	if got, want := len(bcfd.started), 0; got != want {
+		t.Errorf("Got %v more issuances started, Want: %v", got, want)
+	}
+	mc.Lock()
+	defer mc.Unlock()
+	if got, want := len(mc.m), 0; got != want {
+		t.Errorf("Got %v cached certificates, Want: %v", got, want)
+	}
+}
+
+func TestStartAsync(t *testing.T) {
+	fallback, err := generateCertificate("fallback.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+
+	bcfd := newBlockingCertificateForDomainer()
+	m := CertificateManager{
+		ACMEClient:         bcfd,
+		Cache:              newMapCache(),
+		KnownHosts:         []string{"foo.example.com"},
+		RenewBefore:        30 * 24 * time.Hour, // 30 days
+		DefaultCertificate: fallback,
+	}
+
+	// start returns before the certificate is issued
+	start := time.Now()
+	err = m.StartAsync()
+	if err != nil {
+		t.Fatalf("Unexpected response from StartAsync: %v", err)
+	}
+	defer m.Stop(context.Background())
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("StartAsync took %v, should not wait for issuance", elapsed)
+	}
+
+	// the fallback is served until then
+	certificate, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected response from GetCertificate: %v", err)
+	}
+	if got, want := certificate, fallback; got != want {
+		t.Errorf("Got certificate for %v, Want fallback", certificate.Leaf.DNSNames)
+	}
+
+	// and replaced once issuance is done
+	close(bcfd.release)
+	issued := waitForCertificate(&m, "foo.example.com", func(certificate *tls.Certificate, err error) bool {
+		return err == nil && certificate.Leaf.DNSNames[0] == "foo.example.com"
+	})
+	if !issued {
+		t.Errorf("Got no certificate for foo.example.com, Want the issued one")
+	}
+}
+
+func TestRenewalInterval(t *testing.T) {
+	tests := []struct {
+		inJitter time.Duration
+		outMin   time.Duration
+		outMax   time.Duration
+	}{
+		// 0 - default jitter
+		{0, 24 * time.Hour, 25 * time.Hour},
+		// 1 - custom jitter
+		{10 * time.Minute, 24 * time.Hour, 24*time.Hour + 10*time.Minute},
+		// 2 - disabled
+		{-1, 24 * time.Hour, 24 * time.Hour},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{RenewalJitter: tt.inJitter}
+
+		intervals := make(map[time.Duration]bool)
+		for j := 0; j < 100; j++ {
+			interval := m.renewalInterval()
+			if interval < tt.outMin || interval > tt.outMax {
+				t.Errorf("Test(%v) Got interval: %v, Want between %v and %v", i, interval, tt.outMin, tt.outMax)
+			}
+			intervals[interval] = true
+		}
+
+		// instances shouldn't all pick the same interval
+		if got, want := len(intervals) > 1, tt.outMin != tt.outMax; got != want {
+			t.Errorf("Test(%v) Got %v different intervals", i, len(intervals))
+		}
+	}
+}
+
 func TestGetPutCertificateCycle(t *testing.T) {
 	// create a CertificateManager we can manipulate
 	mm := make(map[string]int)
@@ -154,6 +280,30 @@ func TestDeleteCertificate(t *testing.T) {
 	}
 }
 
+func TestCachedHosts(t *testing.T) {
+	c := &cache.Memory{}
+	c.Put(context.Background(), "foo.example.com", []byte("1"))
+	c.Put(context.Background(), "bar.example.com", []byte("2"))
+	c.Put(context.Background(), "acme_account+key", []byte("3"))
+
+	m := CertificateManager{Cache: c}
+	hostnames, err := m.CachedHosts()
+	if err != nil {
+		t.Fatalf("Unexpected response from CachedHosts: %v", err)
+	}
+	sort.Strings(hostnames)
+	if got, want := fmt.Sprint(hostnames), "[bar.example.com foo.example.com]"; got != want {
+		t.Errorf("Got hostnames: %v, Want: %v", got, want)
+	}
+
+	// caches that can't be listed
+	m = CertificateManager{Cache: autocert.DirCache(t.TempDir())}
+	_, err = m.CachedHosts()
+	if got, want := err, cache.ErrNotListable; got != want {
+		t.Errorf("Got error: %v, Want: %v", got, want)
+	}
+}
+
 func TestRenewCertificate(t *testing.T) {
 	tests := []struct {
 		inClock     timetools.TimeProvider // initialize time to this value
@@ -218,7 +368,7 @@ func TestRenewCertificate(t *testing.T) {
 		// renew the certificate, this should cause the CertificateManager to
 		// issue a request for a new certificate and a new certificate will be
 		// put in the cache
-		err = m.renewCertificate("foo.example.com")
+		err = m.renewCertificate(context.Background(), "foo.example.com")
 		if err != nil {
 			t.Fatalf("Test(%v) Unexpected response from renewCertificate: %v", i, err)
 		}
@@ -239,6 +389,291 @@ func TestRenewCertificate(t *testing.T) {
 	}
 }
 
+func TestRenewCertificateConcurrent(t *testing.T) {
+	tests := []struct {
+		inHostnames []string // renewed concurrently
+		outCount    int
+	}{
+		// 0 - different hosts get their own certificates
+		{[]string{"foo.example.com", "bar.example.com", "baz.example.com"}, 3},
+		// 1 - renewals of the same host share a request
+		{[]string{"foo.example.com", "foo.example.com", "foo.example.com"}, 1},
+		// 2 - both
+		{[]string{"foo.example.com", "bar.example.com", "foo.example.com", "bar.example.com"}, 2},
+	}
+
+	for i, tt := range tests {
+		client := &concurrentCertificateForDomainer{
+			t:      100 * time.Millisecond,
+			counts: make(map[string]int),
+		}
+		m := CertificateManager{
+			ACMEClient:  client,
+			Cache:       &cache.Memory{},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(tt.inHostnames))
+		for j, hostname := range tt.inHostnames {
+			wg.Add(1)
+			go func(j int, hostname string) {
+				defer wg.Done()
+				errs[j] = m.renewCertificate(context.Background(), hostname)
+			}(j, hostname)
+		}
+		wg.Wait()
+
+		for j, hostname := range tt.inHostnames {
+			if errs[j] != nil {
+				t.Fatalf("Test(%v) Unexpected response from renewCertificate for %q: %v", i, hostname, errs[j])
+			}
+
+			certificate, err := m.getCertificateFromCache(hostname)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache for %q: %v", i, hostname, err)
+			}
+			if err := certificate.Leaf.VerifyHostname(hostname); err != nil {
+				t.Errorf("Test(%v) Got certificate for %v, Want: %v", i, certificate.Leaf.DNSNames, hostname)
+			}
+		}
+		if got, want := client.total(), tt.outCount; got != want {
+			t.Errorf("Test(%v) Got called CertificateForDomain %v times, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestRenew(t *testing.T) {
+	client := &multiCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:        client,
+		Cache:             newMapCache(),
+		CertificateGroups: [][]string{{"foo.example.com", "bar.example.com"}},
+		RenewBefore:       30 * 24 * time.Hour, // 30 days
+	}
+
+	tests := []struct {
+		inHostname string
+		inForce    bool
+		outCount   int
+	}{
+		// 0 - not cached yet, any host of the group issues the certificate
+		{"bar.example.com", false, 1},
+		// 1 - not due for renewal
+		{"foo.example.com", false, 1},
+		// 2 - forced
+		{"bar.example.com", true, 2},
+	}
+
+	for i, tt := range tests {
+		err := m.Renew(tt.inHostname, tt.inForce)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Renew: %v", i, err)
+		}
+		if got, want := client.count, tt.outCount; got != want {
+			t.Errorf("Test(%v) Got called CertificateForDomains %v times, Want: %v", i, got, want)
+		}
+
+		for _, hostname := range []string{"foo.example.com", "bar.example.com"} {
+			certificate, err := m.getCertificateFromCache(hostname)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache for %q: %v", i, hostname, err)
+			}
+			if got, want := certificate.Leaf.SerialNumber.Int64(), int64(tt.outCount); got != want {
+				t.Errorf("Test(%v) Got certificate %v for %v, Want: %v", i, got, hostname, want)
+			}
+		}
+	}
+}
+
+func TestNeedToRenew(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)
+	clock = &timetools.FreezedTime{CurrentTime: now}
+
+	tests := []struct {
+		inLifetime    time.Duration // lifetime of the certificate
+		inRemaining   time.Duration // time left until the certificate expires
+		inRenewBefore time.Duration
+		outRenew      bool
+	}{
+		// 0 - regular certificate, renew time has not arrived
+		{90 * 24 * time.Hour, 31 * 24 * time.Hour, 30 * 24 * time.Hour, false},
+		// 1 - regular certificate, renew time has arrived
+		{90 * 24 * time.Hour, 29 * 24 * time.Hour, 30 * 24 * time.Hour, true},
+		// 2 - short lived certificate isn't renewed right after it was issued
+		{6 * 24 * time.Hour, 5 * 24 * time.Hour, 30 * 24 * time.Hour, false},
+		// 3 - short lived certificate is renewed halfway
+		{6 * 24 * time.Hour, 2 * 24 * time.Hour, 30 * 24 * time.Hour, true},
+		// 4 - short RenewBefore is left alone for short lived certificates
+		{6 * 24 * time.Hour, 2 * 24 * time.Hour, 1 * 24 * time.Hour, false},
+	}
+
+	for i, tt := range tests {
+		leaf := &x509.Certificate{
+			NotBefore: now.Add(tt.inRemaining - tt.inLifetime),
+			NotAfter:  now.Add(tt.inRemaining),
+		}
+
+		if got, want := needToRenew(leaf, tt.inRenewBefore), tt.outRenew; got != want {
+			t.Errorf("Test(%v) Got renew: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestRenewBefore(t *testing.T) {
+	now := time.Date(2006, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	tests := []struct {
+		inLifetime    time.Duration
+		inRenewBefore time.Duration
+		inPercent     int
+		outBefore     time.Duration
+	}{
+		// 0 - a third of the lifetime by default
+		{90 * 24 * time.Hour, 0, 0, 90 * 24 * time.Hour * 33 / 100},
+		// 1 - RenewBefore if set
+		{90 * 24 * time.Hour, 10 * 24 * time.Hour, 0, 10 * 24 * time.Hour},
+		// 2 - RenewRemainingPercent takes precedence over RenewBefore
+		{90 * 24 * time.Hour, 10 * 24 * time.Hour, 50, 45 * 24 * time.Hour},
+		// 3 - and scales with the lifetime
+		{6 * 24 * time.Hour, 0, 50, 3 * 24 * time.Hour},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			RenewBefore:           tt.inRenewBefore,
+			RenewRemainingPercent: tt.inPercent,
+		}
+		leaf := &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(tt.inLifetime),
+		}
+
+		if got, want := m.renewBefore(leaf), tt.outBefore; got != want {
+			t.Errorf("Test(%v) Got renew before: %v, Want: %v", i, got, want)
+		}
+	}
+}
+
+func TestCertificateToBytes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	tests := []struct {
+		inKey        crypto.Signer
+		outBlockType string
+	}{
+		// 0 - rsa
+		{rsaKey, "RSA PRIVATE KEY"},
+		// 1 - ecdsa
+		{ecdsaKey, "EC PRIVATE KEY"},
+		// 2 - other keys are pkcs8
+		{ed25519Key, "PRIVATE KEY"},
+	}
+
+	for i, tt := range tests {
+		certificate, err := generateCertificateForKey("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(time.Hour), tt.inKey)
+		if err != nil {
+			t.Fatalf("Test(%v) Unable to generate certificate: %v", i, err)
+		}
+
+		certificateBytes, err := certificateToBytes(certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from certificateToBytes: %v", i, err)
+		}
+		block, _ := pem.Decode(certificateBytes)
+		if got, want := block.Type, tt.outBlockType; got != want {
+			t.Errorf("Test(%v) Got block type: %v, Want: %v", i, got, want)
+		}
+
+		decoded, err := bytesToCertificate(certificateBytes)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from bytesToCertificate: %v", i, err)
+		}
+		privateKey, ok := decoded.PrivateKey.(interface{ Equal(crypto.PrivateKey) bool })
+		if !ok || !privateKey.Equal(tt.inKey) {
+			t.Errorf("Test(%v) Got private key: %T, Want: %T", i, decoded.PrivateKey, tt.inKey)
+		}
+		if got, want := decoded.Leaf.SerialNumber, certificate.Leaf.SerialNumber; got.Cmp(want) != 0 {
+			t.Errorf("Test(%v) Got SerialNumber: %v, Want: %v", i, got, want)
+		}
+	}
+
+	// pkcs8 encoded rsa and ecdsa keys, as written by other tools, can be
+	// read too
+	for i, key := range []crypto.Signer{rsaKey, ecdsaKey} {
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("Test(%v) Unable to marshal key: %v", i, err)
+		}
+		decoded, err := bytesToPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from bytesToPrivateKey: %v", i, err)
+		}
+		privateKey, ok := decoded.(interface{ Equal(crypto.PrivateKey) bool })
+		if !ok || !privateKey.Equal(key) {
+			t.Errorf("Test(%v) Got private key: %T, Want: %T", i, decoded, key)
+		}
+	}
+}
+
+func TestExporters(t *testing.T) {
+	// create a CertificateManager with an exporter
+	mm := make(map[string]int)
+	cc := countingCache{&mm}
+	ce := countingExporter{}
+	m := CertificateManager{
+		ACMEClient: &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		},
+		Cache:       &cc,
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+		Exporters:   []export.Exporter{&ce},
+	}
+
+	// the cache is empty so a new certificate is obtained and exported
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+	if got, want := ce.count, 1; got != want {
+		t.Errorf("Got called Export %v times, Want: %v", got, want)
+	}
+
+	// the certificate is now in the in-memory cache and doesn't need to be
+	// renewed so nothing is exported
+	err = m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+	if got, want := ce.count, 1; got != want {
+		t.Errorf("Got called Export %v times, Want: %v", got, want)
+	}
+}
+
+// countingExporter is used in tests to check how often certificates were exported.
+type countingExporter struct {
+	count int
+}
+
+func (c *countingExporter) Export(hostname string, certificate *tls.Certificate) error {
+	c.count = c.count + 1
+	return nil
+}
+
 // sleepingCertificateForDomainer is used in tests to manipulate when certificates are issued
 // to control how long it takes to get a certificate.
 type sleepingCertificateForDomainer struct {
@@ -263,6 +698,62 @@ func (n *countingCertificateForDomainer) CertificateForDomain(hostname string) (
 	return generateCertificate(hostname, n.notBefore, n.notAfter)
 }
 
+// concurrentCertificateForDomainer is used in tests that request certificates
+// concurrently, it sleeps like sleepingCertificateForDomainer and counts calls
+// per hostname.
+type concurrentCertificateForDomainer struct {
+	t time.Duration
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *concurrentCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	c.mu.Lock()
+	c.counts[hostname] = c.counts[hostname] + 1
+	c.mu.Unlock()
+
+	time.Sleep(c.t)
+	return generateCertificate(hostname, clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+}
+
+func (c *concurrentCertificateForDomainer) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, count := range c.counts {
+		total = total + count
+	}
+	return total
+}
+
+// blockingCertificateForDomainer issues certificates once release is closed,
+// or gives up when the context is done. started receives the hostnames
+// issuance started for.
+type blockingCertificateForDomainer struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingCertificateForDomainer() *blockingCertificateForDomainer {
+	return &blockingCertificateForDomainer{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (b *blockingCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	return b.CertificateForDomainsContext(context.Background(), []string{hostname})
+}
+
+func (b *blockingCertificateForDomainer) CertificateForDomainsContext(ctx context.Context, hostnames []string) (*tls.Certificate, error) {
+	b.started <- hostnames[0]
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return generateCertificate(hostnames[0], clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+}
+
 // generateCertificate is used in tests to create dummy certificates.
 func generateCertificate(hostname string, notBefore time.Time, notAfter time.Time) (*tls.Certificate, error) {
 	keypair, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -270,6 +761,12 @@ func generateCertificate(hostname string, notBefore time.Time, notAfter time.Tim
 		return nil, err
 	}
 
+	return generateCertificateForKey(hostname, notBefore, notAfter, keypair)
+}
+
+// generateCertificateForKey is used in tests to create dummy certificates
+// for a given key.
+func generateCertificateForKey(hostname string, notBefore time.Time, notAfter time.Time, keypair crypto.Signer) (*tls.Certificate, error) {
 	template := x509.Certificate{
 		SerialNumber: big.NewInt(1),
 		Subject: pkix.Name{
@@ -0,0 +1,270 @@
+package roman
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+	"github.com/mailgun/roman/acme"
+)
+
+const (
+	// ocspCacheSuffix is appended to the hostname to cache OCSP responses.
+	ocspCacheSuffix = "+ocsp"
+
+	// ocspRefreshInterval is how often staples are checked for refresh.
+	ocspRefreshInterval = 1 * time.Hour
+)
+
+var (
+	ocspClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// stapleCertificate staples an OCSP response to certificates that carry the
+// Must-Staple extension (or all certificates with an OCSP responder if
+// StapleOCSP is set) unless they have a staple that is still fresh. The
+// stapled copy replaces certificate in the in-memory cache of hostnames.
+// Failures are logged, the certificate is still served without a staple.
+func (m *CertificateManager) stapleCertificate(hostnames []string, certificate *tls.Certificate) {
+	if !m.needsStaple(certificate.Leaf) {
+		return
+	}
+
+	due, expired := stapleState(certificate.OCSPStaple)
+	if !due {
+		return
+	}
+
+	staple, err := m.ocspStaple(hostnames, certificate)
+	if err != nil {
+		log.Warningf("unable to staple certificate for %v: %v", hostnames, err)
+
+		// keep serving the current staple until it expires
+		if !expired || certificate.OCSPStaple == nil {
+			return
+		}
+	}
+
+	// copy the certificate, the original may be used by handshakes right now
+	stapled := *certificate
+	stapled.OCSPStaple = staple
+
+	m.Lock()
+	defer m.Unlock()
+
+	// only replace the certificate if it wasn't renewed in the meantime
+	for _, hostname := range hostnames {
+		if m.memoryCache[hostname] == certificate {
+			m.setMemoryCertificate(hostname, &stapled)
+		}
+	}
+}
+
+// needsStaple returns true if leaf should be served with an OCSP staple.
+func (m *CertificateManager) needsStaple(leaf *x509.Certificate) bool {
+	if leaf == nil {
+		return false
+	}
+	return acme.HasMustStaple(leaf) || (m.StapleOCSP && len(leaf.OCSPServer) > 0)
+}
+
+// stapleState returns if staple is due for a refresh, which is halfway through
+// its validity, and if it expired. Missing and invalid staples are both.
+func stapleState(staple []byte) (bool, bool) {
+	if staple == nil {
+		return true, true
+	}
+	response, err := ocsp.ParseResponse(staple, nil)
+	if err != nil {
+		return true, true
+	}
+
+	// without a next update newer information is always available
+	if response.NextUpdate.IsZero() {
+		return true, false
+	}
+
+	now := clock.UtcNow()
+	refresh := response.ThisUpdate.Add(response.NextUpdate.Sub(response.ThisUpdate) / 2)
+
+	return !now.Before(refresh), !now.Before(response.NextUpdate)
+}
+
+// ocspStaple returns a fresh OCSP response for certificate, from Cache if
+// another instance already fetched one, else from the OCSP responder.
+// Responses from the responder are written to Cache, unless this is a
+// ServeOnly replica.
+func (m *CertificateManager) ocspStaple(hostnames []string, certificate *tls.Certificate) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	staple, ok := m.cachedStaple(ctx, hostnames, certificate)
+	if due, _ := stapleState(staple); ok && !due {
+		return staple, nil
+	}
+
+	staple, err := fetchOCSPStaple(certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.ServeOnly {
+		err = m.Cache.Put(ctx, ocspCacheKey(hostnames), staple)
+		if err != nil {
+			log.Warningf("unable to put ocsp staple in cache for %v: %v", hostnames, err)
+		}
+	}
+
+	return staple, nil
+}
+
+// cachedStaple returns the OCSP staple of certificate from Cache if there is
+// a valid one.
+func (m *CertificateManager) cachedStaple(ctx context.Context, hostnames []string, certificate *tls.Certificate) ([]byte, bool) {
+	staple, err := m.Cache.Get(ctx, ocspCacheKey(hostnames))
+	if err != nil {
+		if err != autocert.ErrCacheMiss {
+			log.Warningf("unable to get ocsp staple from cache for %v: %v", hostnames, err)
+		}
+		return nil, false
+	}
+
+	// staples of the previous certificate are left behind after renewals
+	_, err = parseOCSPStaple(staple, certificate)
+	if err != nil {
+		return nil, false
+	}
+
+	return staple, true
+}
+
+// ocspCacheKey returns the cache key of the OCSP staple of a certificate for
+// hostnames, which doesn't depend on their order.
+func ocspCacheKey(hostnames []string) string {
+	first := hostnames[0]
+	for _, hostname := range hostnames[1:] {
+		if hostname < first {
+			first = hostname
+		}
+	}
+	return first + ocspCacheSuffix
+}
+
+// deleteStaple removes the cached OCSP staple of hostname.
+func (m *CertificateManager) deleteStaple(hostname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return m.Cache.Delete(ctx, hostname+ocspCacheSuffix)
+}
+
+// fetchOCSPStaple asks the OCSP responder of certificate for its status and
+// returns the raw response if the certificate is good.
+func fetchOCSPStaple(certificate *tls.Certificate) ([]byte, error) {
+	leaf := certificate.Leaf
+	if len(leaf.OCSPServer) == 0 {
+		return nil, fmt.Errorf("certificate has no ocsp responder")
+	}
+	issuer, err := certificateIssuer(certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ocspClient.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from ocsp responder: %v", resp.Status)
+	}
+
+	// responses are small, anything bigger than 1 MiB isn't one
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = parseOCSPStaple(raw, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+// parseOCSPStaple makes sure staple is signed by the issuer of certificate,
+// is about certificate, says it's good and hasn't expired.
+func parseOCSPStaple(staple []byte, certificate *tls.Certificate) (*ocsp.Response, error) {
+	issuer, err := certificateIssuer(certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(staple, certificate.Leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status != ocsp.Good {
+		return nil, fmt.Errorf("certificate status is not good: %v", response.Status)
+	}
+	if !response.NextUpdate.IsZero() && !clock.UtcNow().Before(response.NextUpdate) {
+		return nil, fmt.Errorf("ocsp response expired on %v", response.NextUpdate.UTC().Format(time.RFC3339))
+	}
+
+	return response, nil
+}
+
+// certificateIssuer returns the issuer of certificate from its chain.
+func certificateIssuer(certificate *tls.Certificate) (*x509.Certificate, error) {
+	if len(certificate.Certificate) < 2 {
+		return nil, fmt.Errorf("no issuer in certificate chain")
+	}
+	return x509.ParseCertificate(certificate.Certificate[1])
+}
+
+// refreshStaples refreshes the staples of all certificates in the in-memory
+// cache that are due.
+func (m *CertificateManager) refreshStaples() {
+	hostnames := make(map[*tls.Certificate][]string)
+
+	m.RLock()
+	for hostname, certificate := range m.memoryCache {
+		hostnames[certificate] = append(hostnames[certificate], hostname)
+	}
+	m.RUnlock()
+
+	for certificate, v := range hostnames {
+		sort.Strings(v)
+		m.stapleCertificate(v, certificate)
+	}
+}
+
+// refreshStaplesForever calls refreshStaples every hour until ctx is done.
+func (m *CertificateManager) refreshStaplesForever(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(ocspRefreshInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		m.refreshStaples()
+	}
+}
@@ -0,0 +1,328 @@
+package roman
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/mailgun/roman/acme"
+	"github.com/mailgun/roman/cache"
+	"github.com/mailgun/timetools"
+)
+
+func TestStapleCertificate(t *testing.T) {
+	tests := []struct {
+		inMustStaple bool
+		inStapleOCSP bool
+		inStatus     int
+		outStapled   bool
+	}{
+		// 0 - good certificate is stapled
+		{true, false, ocsp.Good, true},
+		// 1 - revoked certificate is not stapled
+		{true, false, ocsp.Revoked, false},
+		// 2 - certificates without must staple are left alone
+		{false, false, ocsp.Good, false},
+		// 3 - unless all certificates are stapled
+		{false, true, ocsp.Good, true},
+	}
+
+	for i, tt := range tests {
+		server := newOCSPResponder(t, tt.inStatus)
+
+		certificate, err := generateStapleCertificate("foo.example.com", server.URL, tt.inMustStaple, server.issuer, server.issuerKey)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateStapleCertificate: %v", i, err)
+		}
+
+		m := CertificateManager{
+			Cache:      newMapCache(),
+			StapleOCSP: tt.inStapleOCSP,
+		}
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		m.stapleCertificate([]string{"foo.example.com"}, certificate)
+
+		cached, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if got, want := cached.OCSPStaple != nil, tt.outStapled; got != want {
+			t.Errorf("Test(%v) Got stapled: %v, Want: %v", i, got, want)
+		}
+		if certificate.OCSPStaple != nil {
+			t.Errorf("Test(%v) Certificate in use was modified", i)
+		}
+
+		server.Close()
+	}
+}
+
+func TestStapleCache(t *testing.T) {
+	server := newOCSPResponder(t, ocsp.Good)
+	defer server.Close()
+
+	certificate, err := generateStapleCertificate("foo.example.com", server.URL, true, server.issuer, server.issuerKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from generateStapleCertificate: %v", err)
+	}
+
+	// instances sharing a cache share staples
+	shared := &cache.Memory{}
+	for i := 0; i < 2; i++ {
+		m := CertificateManager{
+			Cache: shared,
+		}
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+		}
+
+		m.stapleCertificate([]string{"foo.example.com"}, certificate)
+
+		cached, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if cached.OCSPStaple == nil {
+			t.Errorf("Test(%v) Certificate was not stapled", i)
+		}
+	}
+	if got, want := server.requestCount(), 1; got != want {
+		t.Errorf("Got %v ocsp requests, Want: %v", got, want)
+	}
+}
+
+func TestStapleLoadedFromCache(t *testing.T) {
+	server := newOCSPResponder(t, ocsp.Good)
+	defer server.Close()
+
+	certificate, err := generateStapleCertificate("foo.example.com", server.URL, true, server.issuer, server.issuerKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from generateStapleCertificate: %v", err)
+	}
+
+	shared := &cache.Memory{}
+	m := CertificateManager{
+		Cache: shared,
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+	m.stapleCertificate([]string{"foo.example.com"}, certificate)
+
+	// after a restart the staple is served without asking the responder
+	server.setAvailable(false)
+	m = CertificateManager{
+		Cache: shared,
+	}
+
+	cached, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+	if cached.OCSPStaple == nil {
+		t.Errorf("Certificate loaded from cache was not stapled")
+	}
+	if got, want := server.requestCount(), 1; got != want {
+		t.Errorf("Got %v ocsp requests, Want: %v", got, want)
+	}
+}
+
+func TestRefreshStaples(t *testing.T) {
+	defer func(c timetools.TimeProvider) { clock = c }(clock)
+	now := &timetools.FreezedTime{CurrentTime: time.Now()}
+	clock = now
+
+	server := newOCSPResponder(t, ocsp.Good)
+	defer server.Close()
+
+	certificate, err := generateStapleCertificate("foo.example.com", server.URL, true, server.issuer, server.issuerKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from generateStapleCertificate: %v", err)
+	}
+
+	m := CertificateManager{
+		Cache: newMapCache(),
+	}
+	err = m.putCertificateInCache("foo.example.com", certificate)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	// responses are valid for 24 hours
+	tests := []struct {
+		inElapsed   time.Duration
+		inAvailable bool // if the responder can be reached
+		outRequests int
+		outStapled  bool
+	}{
+		// 0 - missing staple is fetched
+		{0, true, 1, true},
+		// 1 - fresh staple is kept
+		{11 * time.Hour, true, 1, true},
+		// 2 - halfway through its validity it's refreshed
+		{time.Hour, true, 2, true},
+		// 3 - the staple is kept if the responder is down
+		{12 * time.Hour, false, 2, true},
+		// 4 - until it expires
+		{12 * time.Hour, false, 2, false},
+	}
+
+	for i, tt := range tests {
+		now.CurrentTime = now.CurrentTime.Add(tt.inElapsed)
+		server.setAvailable(tt.inAvailable)
+
+		m.refreshStaples()
+
+		cached, err := m.getCertificateFromCache("foo.example.com")
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from getCertificateFromCache: %v", i, err)
+		}
+		if got, want := cached.OCSPStaple != nil, tt.outStapled; got != want {
+			t.Errorf("Test(%v) Got stapled: %v, Want: %v", i, got, want)
+		}
+		if got, want := server.requestCount(), tt.outRequests; got != want {
+			t.Errorf("Test(%v) Got %v ocsp requests, Want: %v", i, got, want)
+		}
+	}
+}
+
+// ocspResponder is used in tests to answer OCSP requests with a fixed status.
+type ocspResponder struct {
+	*httptest.Server
+	issuer    *x509.Certificate
+	issuerKey *rsa.PrivateKey
+
+	mu          sync.Mutex
+	requests    int
+	unavailable bool
+}
+
+func (r *ocspResponder) requestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func (r *ocspResponder) setAvailable(available bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unavailable = !available
+}
+
+func newOCSPResponder(t *testing.T, status int) *ocspResponder {
+	issuerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected response from GenerateKey: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "roman test ca"},
+		NotBefore:             clock.UtcNow(),
+		NotAfter:              clock.UtcNow().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	issuerBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, issuerKey.Public(), issuerKey)
+	if err != nil {
+		t.Fatalf("Unexpected response from CreateCertificate: %v", err)
+	}
+	issuer, err := x509.ParseCertificate(issuerBytes)
+	if err != nil {
+		t.Fatalf("Unexpected response from ParseCertificate: %v", err)
+	}
+
+	r := &ocspResponder{issuer: issuer, issuerKey: issuerKey}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		unavailable := r.unavailable
+		if !unavailable {
+			r.requests = r.requests + 1
+		}
+		r.mu.Unlock()
+		if unavailable {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		ocspRequest, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: ocspRequest.SerialNumber,
+			ThisUpdate:   clock.UtcNow(),
+			NextUpdate:   clock.UtcNow().Add(24 * time.Hour),
+			RevokedAt:    clock.UtcNow(),
+		}, issuerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(response)
+	}))
+
+	return r
+}
+
+// generateStapleCertificate is used in tests to create certificates issued by
+// issuer with an ocsp responder.
+func generateStapleCertificate(hostname string, responder string, mustStaple bool, issuer *x509.Certificate, issuerKey *rsa.PrivateKey) (*tls.Certificate, error) {
+	keypair, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    clock.UtcNow(),
+		NotAfter:     clock.UtcNow().Add(90 * 24 * time.Hour),
+		DNSNames:     []string{hostname},
+		OCSPServer:   []string{responder},
+	}
+	if mustStaple {
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    acme.OIDMustStaple,
+			Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+		})
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, &template, issuer, keypair.Public(), issuerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificateBytes, issuer.Raw},
+		PrivateKey:  keypair,
+		Leaf:        leaf,
+	}, nil
+}
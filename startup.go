@@ -0,0 +1,78 @@
+package roman
+
+import (
+	"fmt"
+
+	"github.com/mailgun/log"
+)
+
+// StartupPolicy decides if Start succeeds after the initial renewal (or
+// load, for ServeOnly replicas). hosts is the number of known hosts, missing
+// are those without a valid certificate and errs are the errors of the
+// renewal. It returns an error to make Start fail.
+type StartupPolicy func(hosts int, missing []string, errs []error) error
+
+// StartFailFast returns a StartupPolicy that fails Start if anything went
+// wrong, even if all hosts have a valid certificate. This is the default.
+func StartFailFast() StartupPolicy {
+	return func(hosts int, missing []string, errs []error) error {
+		if errs != nil {
+			return fmt.Errorf("unable to start due to the following errors: %v", errs)
+		}
+		return nil
+	}
+}
+
+// StartWarnAndContinue returns a StartupPolicy that logs errors and always
+// lets Start succeed. Hosts without a certificate are retried with backoff
+// and served DefaultHost or DefaultCertificate, if set, until then.
+func StartWarnAndContinue() StartupPolicy {
+	return StartRequirePercent(0)
+}
+
+// StartRequirePercent returns a StartupPolicy that lets Start succeed if at
+// least percent of the hosts have a valid certificate, so one broken DNS
+// zone doesn't keep all other hosts from being served. Errors are logged.
+func StartRequirePercent(percent int) StartupPolicy {
+	return func(hosts int, missing []string, errs []error) error {
+		if hosts > 0 && (hosts-len(missing))*100 < percent*hosts {
+			return fmt.Errorf("unable to start, %v of %v hosts have no certificate (%v%% required) due to the following errors: %v",
+				len(missing), hosts, percent, errs)
+		}
+		if errs != nil {
+			log.Warningf("starting without certificates for %v due to the following errors: %v", missing, errs)
+		}
+		return nil
+	}
+}
+
+// checkStartup applies StartupPolicy to the outcome of the initial renewal.
+func (m *CertificateManager) checkStartup(errs []error) error {
+	policy := m.StartupPolicy
+	if policy == nil {
+		policy = StartFailFast()
+	}
+
+	hostnames := m.hosts()
+
+	var missing []string
+	for _, hostname := range hostnames {
+		if !m.hasValidCertificate(hostname) {
+			missing = append(missing, hostname)
+		}
+	}
+
+	return policy(len(hostnames), missing, errs)
+}
+
+// hasValidCertificate returns true if a certificate that hasn't expired is
+// cached for hostname.
+func (m *CertificateManager) hasValidCertificate(hostname string) bool {
+	certificate, err := m.getCertificateFromCache(hostname)
+	if err != nil || certificate.Leaf == nil {
+		return false
+	}
+
+	now := clock.UtcNow()
+	return !now.Before(certificate.Leaf.NotBefore) && now.Before(certificate.Leaf.NotAfter)
+}
@@ -0,0 +1,67 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestStartupPolicy(t *testing.T) {
+	tests := []struct {
+		inPolicy StartupPolicy
+		outErr   bool
+	}{
+		// 0 - any failure fails start by default
+		{nil, true},
+		// 1 - same as fail fast
+		{StartFailFast(), true},
+		// 2 - unless failures are tolerated
+		{StartWarnAndContinue(), false},
+		// 3 - half of the hosts have a certificate
+		{StartRequirePercent(50), false},
+		// 4 - but more are required
+		{StartRequirePercent(75), true},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			ACMEClient: &brokenZoneCertificateForDomainer{
+				broken:   "broken.example.net",
+				notAfter: clock.UtcNow().Add(90 * 24 * time.Hour),
+			},
+			Cache:         newMapCache(),
+			KnownHosts:    []string{"foo.example.com", "broken.example.net"},
+			RenewBefore:   30 * 24 * time.Hour, // 30 days
+			StartupPolicy: tt.inPolicy,
+		}
+
+		err := m.Start()
+		if got, want := err != nil, tt.outErr; got != want {
+			t.Errorf("Test(%v) Got error: %v (%v), Want: %v", i, got, err, want)
+		}
+		m.Stop(context.Background())
+
+		// the working host is served either way
+		_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+		if err != nil {
+			t.Errorf("Test(%v) Unexpected response from GetCertificate: %v", i, err)
+		}
+	}
+}
+
+// brokenZoneCertificateForDomainer is used in tests to fail issuance for a
+// single host.
+type brokenZoneCertificateForDomainer struct {
+	broken   string
+	notAfter time.Time
+}
+
+func (b *brokenZoneCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	if hostname == b.broken {
+		return nil, fmt.Errorf("no hosted zone for %v", hostname)
+	}
+	return generateCertificate(hostname, clock.UtcNow(), b.notAfter)
+}
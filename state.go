@@ -0,0 +1,67 @@
+package roman
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+// CertificateState is the state of the certificate of a host.
+type CertificateState string
+
+const (
+	// StateMissing means there is no certificate for the host.
+	StateMissing CertificateState = "missing"
+
+	// StateValid means the certificate is valid and not due for renewal.
+	StateValid CertificateState = "valid"
+
+	// StateRenewing means the certificate is still valid and served, but
+	// it's in its renewal window and renewal hasn't succeeded yet, because
+	// it's in progress, failed and is retried, or the host is quarantined.
+	StateRenewing CertificateState = "renewing"
+
+	// StateExpired means the certificate expired, it's still served in case
+	// clients don't check.
+	StateExpired CertificateState = "expired"
+)
+
+// CertificateState returns the state of the certificate served for
+// hostname. Certificates that are due for renewal keep being served until
+// renewal succeeds, failures only show up here, in Stats and in Healthy.
+func (m *CertificateManager) CertificateState(hostname string) CertificateState {
+	certificate, err := m.getCertificateFromCache(hostname)
+	if err != nil {
+		return StateMissing
+	}
+
+	return certificateState(certificate.Leaf, m.renewBefore(certificate.Leaf))
+}
+
+// certificateState returns the state of a certificate with leaf.
+func certificateState(leaf *x509.Certificate, renewBefore time.Duration) CertificateState {
+	switch {
+	case leaf == nil:
+		return StateMissing
+	case !clock.UtcNow().Before(leaf.NotAfter):
+		return StateExpired
+	case needToRenew(leaf, renewBefore):
+		return StateRenewing
+	default:
+		return StateValid
+	}
+}
+
+// renewingHosts returns the hosts whose certificates are still valid but due
+// for renewal.
+func (m *CertificateManager) renewingHosts() []string {
+	var hostnames []string
+	for _, hostname := range m.renewalHosts() {
+		if m.CertificateState(hostname) == StateRenewing {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	sort.Strings(hostnames)
+
+	return hostnames
+}
@@ -0,0 +1,104 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCertificateState(t *testing.T) {
+	tests := []struct {
+		inNotBefore time.Duration
+		inNotAfter  time.Duration
+		inCached    bool
+		outState    CertificateState
+		outServed   bool
+	}{
+		// 0 - not due for renewal
+		{-10 * 24 * time.Hour, 80 * 24 * time.Hour, true, StateValid, true},
+		// 1 - renewal fails, the old certificate is still served
+		{-70 * 24 * time.Hour, 20 * 24 * time.Hour, true, StateRenewing, true},
+		// 2 - expired
+		{-90 * 24 * time.Hour, -1 * time.Hour, true, StateExpired, true},
+		// 3 - never obtained
+		{0, 0, false, StateMissing, false},
+	}
+
+	for i, tt := range tests {
+		m := CertificateManager{
+			ACMEClient:  &failingCertificateForDomainer{},
+			Cache:       newMapCache(),
+			KnownHosts:  []string{"foo.example.com"},
+			RenewBefore: 30 * 24 * time.Hour, // 30 days
+		}
+
+		if tt.inCached {
+			certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(tt.inNotBefore), clock.UtcNow().Add(tt.inNotAfter))
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+			}
+			err = m.putCertificateInCache("foo.example.com", certificate)
+			if err != nil {
+				t.Fatalf("Test(%v) Unexpected response from putCertificateInCache: %v", i, err)
+			}
+		}
+
+		m.renewCertificates(context.Background())
+
+		if got, want := m.CertificateState("foo.example.com"), tt.outState; got != want {
+			t.Errorf("Test(%v) Got state: %v, Want: %v", i, got, want)
+		}
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+		if got, want := err == nil, tt.outServed; got != want {
+			t.Errorf("Test(%v) Got served: %v (%v), Want: %v", i, got, err, want)
+		}
+
+		wantRenewing := "[]"
+		if tt.outState == StateRenewing {
+			wantRenewing = "[foo.example.com]"
+		}
+		if got, want := fmt.Sprint(m.Stats().Renewing), wantRenewing; got != want {
+			t.Errorf("Test(%v) Got renewing: %v, Want: %v", i, got, want)
+		}
+		if tt.inCached {
+			if got, want := m.Metrics().States["foo.example.com"], tt.outState; got != want {
+				t.Errorf("Test(%v) Got metrics state: %v, Want: %v", i, got, want)
+			}
+		}
+	}
+}
+
+func TestRenewalKeepsServing(t *testing.T) {
+	mm := make(map[string]int)
+	cc := countingCache{&mm}
+	m := CertificateManager{
+		ACMEClient: &countingCertificateForDomainer{
+			notBefore: clock.UtcNow(),
+			notAfter:  clock.UtcNow().Add(90 * 24 * time.Hour),
+		},
+		Cache:       &cc,
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	certificate, err := generateCertificate("foo.example.com", clock.UtcNow().Add(-80*24*time.Hour), clock.UtcNow().Add(10*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	m.Lock()
+	m.setMemoryCertificate("foo.example.com", certificate)
+	m.Unlock()
+
+	m.renewCertificates(context.Background())
+
+	// the old certificate is replaced, never deleted first
+	if got, want := cc.CountFor("delete"), 0; got != want {
+		t.Errorf("Delete Got called %v times, Want: %v", got, want)
+	}
+	if got, want := m.CertificateState("foo.example.com"), StateValid; got != want {
+		t.Errorf("Got state: %v, Want: %v", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package roman
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats is a snapshot of the state of a CertificateManager for operators. It
+// marshals to JSON, so it can be published with expvar:
+//
+//	expvar.Publish("roman", expvar.Func(func() interface{} { return m.Stats() }))
+type Stats struct {
+	// Hosts is the number of hosts certificates are renewed for.
+	Hosts int
+
+	// Certificates is the number of certificates in the in-memory cache.
+	Certificates int
+
+	// LastRenewalRun is when the renewal loop last finished, zero if it
+	// hasn't run yet.
+	LastRenewalRun time.Time
+
+	// Errors are the last errors of the hosts whose last renewal failed.
+	Errors map[string]HostError
+
+	// Quarantined are the quarantined hosts.
+	Quarantined []string
+
+	// Renewing are the hosts whose certificates are due for renewal but
+	// still valid, so they are still served.
+	Renewing []string
+}
+
+// HostError is the last renewal failure of a host.
+type HostError struct {
+	Error string
+	Time  time.Time
+
+	// Failures is the number of consecutive failures.
+	Failures int
+}
+
+// Stats returns a snapshot of the state of the CertificateManager.
+func (m *CertificateManager) Stats() Stats {
+	stats := Stats{
+		Hosts:    len(m.renewalHosts()),
+		Errors:   make(map[string]HostError),
+		Renewing: m.renewingHosts(),
+	}
+
+	m.RLock()
+	stats.Certificates = len(m.memoryCache)
+	m.RUnlock()
+
+	m.metricsMu.Lock()
+	stats.LastRenewalRun = m.lastRenewalRun
+	m.metricsMu.Unlock()
+
+	m.failuresMu.Lock()
+	for hostname, hostError := range m.lastErrors {
+		stats.Errors[hostname] = hostError
+	}
+	for hostname := range m.quarantined {
+		stats.Quarantined = append(stats.Quarantined, hostname)
+	}
+	m.failuresMu.Unlock()
+	sort.Strings(stats.Quarantined)
+
+	return stats
+}
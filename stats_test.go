@@ -0,0 +1,63 @@
+package roman
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestStats(t *testing.T) {
+	fcfd := failingCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:  &fcfd,
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com", "bar.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	// nothing has run yet
+	stats := m.Stats()
+	if got, want := stats.LastRenewalRun.IsZero(), true; got != want {
+		t.Errorf("Got zero LastRenewalRun: %v, Want: %v", got, want)
+	}
+	if got, want := len(stats.Errors), 0; got != want {
+		t.Errorf("Got %v errors, Want: %v", got, want)
+	}
+
+	m.renewCertificates(context.Background())
+	m.renewCertificates(context.Background())
+
+	stats = m.Stats()
+	if got, want := stats.Hosts, 2; got != want {
+		t.Errorf("Got %v hosts, Want: %v", got, want)
+	}
+	if got, want := stats.LastRenewalRun.IsZero(), false; got != want {
+		t.Errorf("Got zero LastRenewalRun: %v, Want: %v", got, want)
+	}
+	hostError, ok := stats.Errors["foo.example.com"]
+	if !ok {
+		t.Fatalf("Got no error for foo.example.com: %v", stats.Errors)
+	}
+	if got, want := hostError.Failures, 2; got != want {
+		t.Errorf("Got %v failures, Want: %v", got, want)
+	}
+	if got, want := hostError.Error, "caa record forbids issuance"; !strings.Contains(got, want) {
+		t.Errorf("Got error: %v, Want it to contain: %v", got, want)
+	}
+
+	// errors are cleared once the host is released
+	m.Unquarantine("foo.example.com")
+	stats = m.Stats()
+	if got, want := len(stats.Errors), 1; got != want {
+		t.Errorf("Got %v errors, Want: %v", got, want)
+	}
+
+	// the snapshot can be published with expvar
+	_, err := json.Marshal(stats)
+	if err != nil {
+		t.Errorf("Unexpected response from json.Marshal: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package roman
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+// Stop stops the background goroutines started by Start, waits for renewals
+// that are in flight, and flushes Cache and KeyCache if they implement
+// cache.Flusher, directly or through the caches they wrap. Certificates are still served after Stop and the
+// CertificateManager can be started again. If ctx is done before the
+// renewals finished, Stop returns its error.
+func (m *CertificateManager) Stop(ctx context.Context) error {
+	m.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("unable to wait for renewals in flight: %v", ctx.Err())
+	}
+
+	for _, c := range []autocert.Cache{m.Cache, m.KeyCache} {
+		err := cache.Flush(ctx, c)
+		if err != nil {
+			return fmt.Errorf("unable to flush cache: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// background runs f in a goroutine that Stop waits for.
+func (m *CertificateManager) background(f func()) {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		f()
+	}()
+}
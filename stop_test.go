@@ -0,0 +1,108 @@
+package roman
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestStop(t *testing.T) {
+	fc := &flushingCache{mapCache: newMapCache()}
+	m := CertificateManager{
+		ACMEClient:  &sleepingCertificateForDomainer{10 * time.Millisecond},
+		Cache:       fc,
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	// the manager can be started and stopped repeatedly
+	for i := 0; i < 2; i++ {
+		err := m.Start()
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Start: %v", i, err)
+		}
+
+		// stop returns once all background goroutines exited
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = m.Stop(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from Stop: %v", i, err)
+		}
+		if got, want := fc.flushes, i+1; got != want {
+			t.Errorf("Test(%v) Got %v flushes, Want: %v", i, got, want)
+		}
+	}
+
+	// certificates are still served
+	_, err := m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Errorf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+}
+
+func TestStopWaitsForRenewals(t *testing.T) {
+	m := CertificateManager{
+		ACMEClient:  &sleepingCertificateForDomainer{200 * time.Millisecond},
+		Cache:       newMapCache(),
+		KnownHosts:  []string{"foo.example.com"},
+		RenewBefore: 30 * 24 * time.Hour, // 30 days
+	}
+
+	// abandon start while the certificate is being issued
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	m.StartContext(ctx)
+
+	// stop gives up if the renewal takes too long
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := m.Stop(ctx)
+	if err == nil {
+		t.Errorf("Expected Stop to give up waiting for the renewal")
+	}
+
+	// or waits for it
+	err = m.Stop(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from Stop: %v", err)
+	}
+	_, err = m.getCertificateFromCache("foo.example.com")
+	if err != nil {
+		t.Errorf("Unexpected response from getCertificateFromCache: %v", err)
+	}
+}
+
+func TestStopFlushesWrappedCaches(t *testing.T) {
+	fc := &flushingCache{mapCache: newMapCache()}
+	kc := &flushingCache{mapCache: newMapCache()}
+	m := CertificateManager{
+		Cache:    &cache.Compressed{Cache: &cache.Encrypted{Cache: fc, Key: make([]byte, 32)}},
+		KeyCache: &cache.Tiered{Fast: &cache.Memory{}, Durable: kc},
+	}
+
+	err := m.Stop(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected response from Stop: %v", err)
+	}
+	if got, want := fc.flushes, 1; got != want {
+		t.Errorf("Got %v cache flushes, Want: %v", got, want)
+	}
+	if got, want := kc.flushes, 1; got != want {
+		t.Errorf("Got %v key cache flushes, Want: %v", got, want)
+	}
+}
+
+// flushingCache is used in tests as a cache.Flusher that counts flushes.
+type flushingCache struct {
+	*mapCache
+	flushes int
+}
+
+func (c *flushingCache) Flush(ctx context.Context) error {
+	c.flushes = c.flushes + 1
+	return nil
+}
@@ -0,0 +1,50 @@
+package roman
+
+import (
+	"time"
+)
+
+const (
+	defaultCacheGetTimeout    = 1 * time.Second
+	defaultCachePutTimeout    = 10 * time.Second
+	defaultCacheDeleteTimeout = 10 * time.Second
+)
+
+// CacheTimeouts are the timeouts of the Cache (and KeyCache) operations that
+// read or write a single certificate. Network backed caches like S3 or Redis
+// in another region need more than a local disk.
+type CacheTimeouts struct {
+	// Get is the timeout of reads, which can happen during a TLS handshake
+	// for certificates that are not in the in-memory cache yet. Defaults to
+	// 1 second.
+	Get time.Duration
+
+	// Put and Delete are the timeouts of writes after a renewal, both
+	// default to 10 seconds.
+	Put    time.Duration
+	Delete time.Duration
+}
+
+// cacheGetTimeout returns the timeout of Cache reads.
+func (m *CertificateManager) cacheGetTimeout() time.Duration {
+	if m.CacheTimeouts.Get > 0 {
+		return m.CacheTimeouts.Get
+	}
+	return defaultCacheGetTimeout
+}
+
+// cachePutTimeout returns the timeout of Cache writes.
+func (m *CertificateManager) cachePutTimeout() time.Duration {
+	if m.CacheTimeouts.Put > 0 {
+		return m.CacheTimeouts.Put
+	}
+	return defaultCachePutTimeout
+}
+
+// cacheDeleteTimeout returns the timeout of Cache deletes.
+func (m *CertificateManager) cacheDeleteTimeout() time.Duration {
+	if m.CacheTimeouts.Delete > 0 {
+		return m.CacheTimeouts.Delete
+	}
+	return defaultCacheDeleteTimeout
+}
@@ -0,0 +1,84 @@
+package roman
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCacheTimeouts(t *testing.T) {
+	tests := []struct {
+		inTimeouts CacheTimeouts
+		outPutErr  bool
+		outGetErr  bool
+	}{
+		// 0 - the defaults are long enough for a slow cache
+		{CacheTimeouts{}, false, false},
+		// 1 - reads time out
+		{CacheTimeouts{Get: 10 * time.Millisecond}, false, true},
+		// 2 - writes time out
+		{CacheTimeouts{Put: 10 * time.Millisecond}, true, false},
+	}
+
+	for i, tt := range tests {
+		certificate, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from generateCertificate: %v", i, err)
+		}
+
+		c := &slowCache{mapCache: newMapCache(), delay: 200 * time.Millisecond}
+		m := CertificateManager{
+			Cache:         c,
+			CacheTimeouts: tt.inTimeouts,
+		}
+
+		err = m.putCertificateInCache("foo.example.com", certificate)
+		if got, want := err != nil, tt.outPutErr; got != want {
+			t.Errorf("Test(%v) Got put error: %v (%v), Want: %v", i, got, err, want)
+		}
+
+		// write it directly and read it back from Cache
+		err = m.storeCertificate(context.Background(), "foo.example.com", certificate, keyInfo{})
+		if err != nil {
+			t.Fatalf("Test(%v) Unexpected response from storeCertificate: %v", i, err)
+		}
+		m.memoryCache = nil
+
+		_, err = m.getCertificateFromCache("foo.example.com")
+		if got, want := err != nil, tt.outGetErr; got != want {
+			t.Errorf("Test(%v) Got get error: %v (%v), Want: %v", i, got, err, want)
+		}
+	}
+}
+
+// slowCache is used in tests to simulate a network backed cache.
+type slowCache struct {
+	*mapCache
+	delay time.Duration
+}
+
+func (c *slowCache) Get(ctx context.Context, key string) ([]byte, error) {
+	err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.mapCache.Get(ctx, key)
+}
+
+func (c *slowCache) Put(ctx context.Context, key string, data []byte) error {
+	err := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+	return c.mapCache.Put(ctx, key, data)
+}
+
+func (c *slowCache) wait(ctx context.Context) error {
+	select {
+	case <-time.After(c.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
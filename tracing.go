@@ -0,0 +1,36 @@
+package roman
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	tracerName = "github.com/mailgun/roman"
+)
+
+// tracer returns the tracer for renewals, from TracerProvider or the global
+// provider.
+func (m *CertificateManager) tracer() trace.Tracer {
+	if m.TracerProvider != nil {
+		return m.TracerProvider.Tracer(tracerName)
+	}
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// startSpan starts a child of the span in ctx.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name)
+}
+
+// endSpan ends span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
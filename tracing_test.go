@@ -0,0 +1,60 @@
+package roman
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestRenewCertificateTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	client := &tracingCertificateForDomainer{}
+	m := CertificateManager{
+		ACMEClient:     client,
+		Cache:          &cache.Memory{},
+		RenewBefore:    30 * 24 * time.Hour, // 30 days
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}
+
+	err := m.renewCertificate(context.Background(), "foo.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected response from renewCertificate: %v", err)
+	}
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	if got, want := fmt.Sprint(names), "[roman.Cache.Get roman.RenewCertificate]"; got != want {
+		t.Errorf("Got spans: %v, Want: %v", got, want)
+	}
+
+	// clients that take a context continue the trace
+	if got, want := client.traced, true; got != want {
+		t.Errorf("Got traced: %v, Want: %v", got, want)
+	}
+}
+
+// tracingCertificateForDomainer is used in tests to check that the trace is
+// passed on to clients.
+type tracingCertificateForDomainer struct {
+	traced bool
+}
+
+func (c *tracingCertificateForDomainer) CertificateForDomain(hostname string) (*tls.Certificate, error) {
+	return c.CertificateForDomainsContext(context.Background(), []string{hostname})
+}
+
+func (c *tracingCertificateForDomainer) CertificateForDomainsContext(ctx context.Context, hostnames []string) (*tls.Certificate, error) {
+	c.traced = trace.SpanFromContext(ctx).SpanContext().IsValid()
+	return generateCertificate(hostnames[0], clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+}
@@ -0,0 +1,89 @@
+package roman
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/log"
+	"github.com/mailgun/roman/cache"
+)
+
+// watchRetryInterval is how long to wait before watching Cache again after a
+// watch ended.
+var watchRetryInterval = 5 * time.Second
+
+// watchCacheForever keeps the in-memory cache up to date with changes made to
+// Cache by other instances until ctx is done, if Cache implements
+// cache.Watcher.
+func (m *CertificateManager) watchCacheForever(ctx context.Context) {
+	for {
+		events, ok := cache.Watch(ctx, m.Cache)
+		if !ok {
+			return
+		}
+
+		for event := range events {
+			m.handleKeyEvent(event)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warningf("cache watch ended, watching again in %v", watchRetryInterval)
+		select {
+		case <-time.After(watchRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleKeyEvent updates the in-memory cache after key changed in Cache.
+// Certificates that aren't in the in-memory cache are loaded on demand
+// anyway, so only those that are get reloaded.
+func (m *CertificateManager) handleKeyEvent(event cache.KeyEvent) {
+	hostname := event.Key
+	if strings.Contains(hostname, "+") {
+		return
+	}
+
+	m.RLock()
+	current, ok := m.memoryCache[hostname]
+	m.RUnlock()
+	if !ok {
+		return
+	}
+
+	if event.Deleted {
+		m.Lock()
+		delete(m.memoryCache, hostname)
+		delete(m.keyInfos, hostname)
+		m.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cacheGetTimeout())
+	defer cancel()
+
+	certificate, key, err := m.loadCertificate(ctx, hostname)
+	if err != nil {
+		log.Warningf("unable to reload certificate for %q after it changed in cache: %v", hostname, err)
+		return
+	}
+
+	// our own writes come back as events too
+	if current.Leaf.Equal(certificate.Leaf) {
+		return
+	}
+
+	log.Infof("reloading certificate for %q, it changed in cache", hostname)
+
+	m.Lock()
+	m.setMemoryCertificate(hostname, certificate)
+	m.setKeyInfo(hostname, key)
+	m.Unlock()
+
+	m.stapleCertificate([]string{hostname}, certificate)
+}
@@ -0,0 +1,76 @@
+package roman
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/context"
+
+	"github.com/mailgun/roman/cache"
+)
+
+func TestWatchCache(t *testing.T) {
+	shared := &cache.Memory{}
+	m := CertificateManager{Cache: shared}
+
+	first, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	err = m.putCertificateInCache("foo.example.com", first)
+	if err != nil {
+		t.Fatalf("Unexpected response from putCertificateInCache: %v", err)
+	}
+
+	go m.watchCacheForever(context.Background())
+	time.Sleep(10 * time.Millisecond)
+
+	// another instance renews the certificate in the shared cache
+	second, err := generateCertificate("foo.example.com", clock.UtcNow(), clock.UtcNow().Add(90*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected response from generateCertificate: %v", err)
+	}
+	other := CertificateManager{Cache: shared}
+	err = other.storeCertificate(context.Background(), "foo.example.com", second, keyInfo{Created: clock.UtcNow(), Uses: 3})
+	if err != nil {
+		t.Fatalf("Unexpected response from storeCertificate: %v", err)
+	}
+
+	if !waitForCertificate(&m, "foo.example.com", func(c *tls.Certificate, err error) bool {
+		return err == nil && c.Leaf.Equal(second.Leaf)
+	}) {
+		t.Errorf("Renewed certificate was not picked up")
+	}
+
+	// along with the metadata of its key
+	m.RLock()
+	key := m.keyInfos["foo.example.com"]
+	m.RUnlock()
+	if got, want := key.Uses, 3; got != want {
+		t.Errorf("Got key uses: %v, Want: %v", got, want)
+	}
+
+	// and deletes it
+	shared.Delete(context.Background(), "foo.example.com")
+
+	if !waitForCertificate(&m, "foo.example.com", func(c *tls.Certificate, err error) bool {
+		return err == autocert.ErrCacheMiss
+	}) {
+		t.Errorf("Deleted certificate is still served")
+	}
+}
+
+// waitForCertificate polls GetCertificate for up to five seconds until done
+// returns true.
+func waitForCertificate(m *CertificateManager, hostname string, done func(*tls.Certificate, error) bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if done(m.GetCertificate(&tls.ClientHelloInfo{ServerName: hostname})) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}